@@ -2,6 +2,9 @@ package config
 
 import (
 	"log"
+	"os"
+	"time"
+
 	"github.com/joho/godotenv"
 
 )
@@ -11,4 +14,18 @@ func LoadEnv() {
 	if err !=nil {
 		log.Println("No .env file found")
 	}
-}
\ No newline at end of file
+}
+
+// GetDuration reads a duration such as "1h" or "15m" from the environment
+func GetDuration(key string, def time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		log.Printf("invalid %s %q, using %s", key, v, def)
+		return def
+	}
+	return d
+}
@@ -0,0 +1,231 @@
+package database
+
+import (
+	"fmt"
+
+	"tracker/models"
+	"tracker/money"
+	"tracker/repository"
+
+	"gorm.io/gorm"
+)
+
+// moneyColumns lists every column that holds an amount of money
+var moneyColumns = []struct{ table, column string }{
+	{"transactions", "amount"},
+	{"transaction_splits", "amount"},
+	{"budgets", "amount"},
+	{"accounts", "opening_balance"},
+	{"alerts", "amount"},
+	{"alerts", "spent"},
+	{"recurring_transactions", "amount"},
+	{"category_rules", "min_amount"},
+	{"category_rules", "max_amount"},
+}
+
+// Migrate creates or updates the tables for every model
+func Migrate(db *gorm.DB) error {
+	if err := migrateMoneyColumns(db); err != nil {
+		return fmt.Errorf("migrate money columns: %w", err)
+	}
+
+	if err := db.AutoMigrate(
+		&models.User{},
+		&models.Account{},
+		&models.Category{},
+		&models.Tag{},
+		&models.Payee{},
+		&models.Transaction{},
+		&models.TransactionSplit{},
+		&models.DuplicateCandidate{},
+		&models.Budget{},
+		&models.Alert{},
+		&models.RecurringTransaction{},
+		&models.ExchangeRate{},
+		&models.ImportProfile{},
+		&models.CategoryRule{},
+		&models.IdempotencyKey{},
+		&models.Attachment{},
+	); err != nil {
+		return fmt.Errorf("migrate db: %w", err)
+	}
+
+	if err := migrateCategories(db); err != nil {
+		return fmt.Errorf("migrate categories: %w", err)
+	}
+	if err := migrateTags(db); err != nil {
+		return fmt.Errorf("migrate tags: %w", err)
+	}
+	// Payee names are unique per user regardless of case
+	if err := db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_payee_name
+		ON payees (user_id, lower(name)) WHERE deleted_at IS NULL`).Error; err != nil {
+		return fmt.Errorf("migrate payees: %w", err)
+	}
+
+	if err := migrateExternalIDs(db); err != nil {
+		return fmt.Errorf("migrate external ids: %w", err)
+	}
+
+	// The currency conversion functions read exchange_rates, so they go in last
+	if err := repository.InstallFunctions(db); err != nil {
+		return fmt.Errorf("install sql functions: %w", err)
+	}
+	return nil
+}
+
+// migrateMoneyColumns converts amounts that were stored as floating point
+// major units into bigint minor units. Letting AutoMigrate change the type
+// would truncate 12.34 to 12, so the conversion scales and rounds explicitly.
+// Floating point amounts predate currencies, so they all have two decimals.
+func migrateMoneyColumns(db *gorm.DB) error {
+	for _, c := range moneyColumns {
+		var dataType string
+		err := db.Raw(`SELECT data_type FROM information_schema.columns
+			WHERE table_schema = current_schema() AND table_name = ? AND column_name = ?`,
+			c.table, c.column).Scan(&dataType).Error
+		if err != nil {
+			return err
+		}
+		if dataType != "double precision" && dataType != "real" && dataType != "numeric" {
+			continue
+		}
+
+		sql := fmt.Sprintf(`ALTER TABLE %q ALTER COLUMN %q TYPE bigint USING round(%q * 1e%d)`,
+			c.table, c.column, c.column, money.Exponent(""))
+		if err := db.Exec(sql).Error; err != nil {
+			return fmt.Errorf("%s.%s: %w", c.table, c.column, err)
+		}
+	}
+	return nil
+}
+
+// categoryNamesSQL lists every category name in use that is not linked to a
+// category yet, with the user and the kind of category it needs
+const categoryNamesSQL = `
+	SELECT user_id, type AS kind, trim(category) AS name FROM transactions
+	WHERE deleted_at IS NULL AND category_id IS NULL AND type IN ('income', 'expense')
+	UNION ALL
+	SELECT t.user_id, t.type, trim(s.category) FROM transaction_splits s
+	JOIN transactions t ON t.id = s.transaction_id
+	WHERE t.deleted_at IS NULL AND s.category_id IS NULL AND t.type IN ('income', 'expense')
+	UNION ALL
+	SELECT user_id, 'expense', trim(category) FROM budgets
+	WHERE deleted_at IS NULL AND category_id IS NULL
+	UNION ALL
+	SELECT user_id, type, trim(category) FROM recurring_transactions
+	WHERE deleted_at IS NULL AND category_id IS NULL AND type IN ('income', 'expense')`
+
+// migrateCategories turns the free text categories of transactions, split
+// lines, budgets and recurring transactions into Category rows and links
+// them. Names differing only in case become one category, spelled the way
+// the first of them sorts. It only touches rows that are not linked yet, so
+// running it again is harmless.
+func migrateCategories(db *gorm.DB) error {
+	// Names are unique per user and kind regardless of case
+	if err := db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_category_name
+		ON categories (user_id, kind, lower(name)) WHERE deleted_at IS NULL`).Error; err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec(`INSERT INTO categories (created_at, updated_at, user_id, kind, name, archived)
+			SELECT now(), now(), user_id, kind, MIN(name), false
+			FROM (` + categoryNamesSQL + `) AS used
+			WHERE name <> ''
+			GROUP BY user_id, kind, lower(name)
+			ON CONFLICT DO NOTHING`).Error
+		if err != nil {
+			return err
+		}
+
+		links := []string{
+			`UPDATE transactions t SET category_id = c.id, category = c.name FROM categories c
+			WHERE t.category_id IS NULL AND t.type IN ('income', 'expense')
+				AND c.deleted_at IS NULL AND c.user_id = t.user_id AND c.kind = t.type
+				AND lower(c.name) = lower(trim(t.category))`,
+			`UPDATE transaction_splits s SET category_id = c.id, category = c.name
+			FROM transactions t, categories c
+			WHERE s.category_id IS NULL AND t.id = s.transaction_id
+				AND c.deleted_at IS NULL AND c.user_id = t.user_id AND c.kind = t.type
+				AND lower(c.name) = lower(trim(s.category))`,
+			`UPDATE budgets b SET category_id = c.id, category = c.name FROM categories c
+			WHERE b.category_id IS NULL
+				AND c.deleted_at IS NULL AND c.user_id = b.user_id AND c.kind = 'expense'
+				AND lower(c.name) = lower(trim(b.category))`,
+			`UPDATE recurring_transactions r SET category_id = c.id, category = c.name FROM categories c
+			WHERE r.category_id IS NULL
+				AND c.deleted_at IS NULL AND c.user_id = r.user_id AND c.kind = r.type
+				AND lower(c.name) = lower(trim(r.category))`,
+		}
+		for _, sql := range links {
+			if err := tx.Exec(sql).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// migrateTags moves the tags transactions used to keep as a JSON list of
+// names in their own column into Tag rows and links, then drops the column.
+// Names differing only in case become one tag, spelled the way the first of
+// them sorts.
+func migrateTags(db *gorm.DB) error {
+	// Names are unique per user regardless of case
+	if err := db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_tag_name
+		ON tags (user_id, lower(name)) WHERE deleted_at IS NULL`).Error; err != nil {
+		return err
+	}
+	if !db.Migrator().HasColumn("transactions", "tags") {
+		return nil
+	}
+
+	// The old column holds a JSON array, or NULL when a transaction had no tags
+	const used = `SELECT t.id, t.user_id, trim(tag.name) AS name
+		FROM transactions t,
+			json_array_elements_text(CASE WHEN t.tags LIKE '[%' THEN t.tags::json ELSE '[]' END) AS tag(name)
+		WHERE t.deleted_at IS NULL`
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec(`INSERT INTO tags (created_at, updated_at, user_id, name)
+			SELECT now(), now(), user_id, MIN(name)
+			FROM (` + used + `) AS used
+			WHERE name <> ''
+			GROUP BY user_id, lower(name)
+			ON CONFLICT DO NOTHING`).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Exec(`INSERT INTO transaction_tags (transaction_id, tag_id)
+			SELECT DISTINCT used.id, g.id
+			FROM (` + used + `) AS used
+			JOIN tags g ON g.user_id = used.user_id AND lower(g.name) = lower(used.name) AND g.deleted_at IS NULL
+			ON CONFLICT DO NOTHING`).Error
+		if err != nil {
+			return err
+		}
+		return tx.Exec("ALTER TABLE transactions DROP COLUMN tags").Error
+	})
+}
+
+// migrateExternalIDs makes an external ID unique per user and account, so two
+// imports of the same file running at once cannot both book an entry.
+// Transactions without an account count as one account. Copies that slipped
+// in before keep their rows; their external ID gets their own ID appended.
+func migrateExternalIDs(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec(`UPDATE transactions t SET external_id = t.external_id || '#' || t.id
+			WHERE t.external_id <> '' AND t.deleted_at IS NULL AND EXISTS (
+				SELECT 1 FROM transactions o
+				WHERE o.user_id = t.user_id AND o.external_id = t.external_id
+					AND coalesce(o.account_id, 0) = coalesce(t.account_id, 0)
+					AND o.deleted_at IS NULL AND o.id < t.id)`).Error
+		if err != nil {
+			return err
+		}
+		return tx.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_transaction_external_id
+			ON transactions (user_id, coalesce(account_id, 0), external_id)
+			WHERE external_id <> '' AND deleted_at IS NULL`).Error
+	})
+}
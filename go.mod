@@ -2,14 +2,16 @@ module tracker
 
 go 1.24.0
 
-require gorm.io/gorm v1.30.1
+require (
+	golang.org/x/crypto v0.31.0
+	gorm.io/gorm v1.30.1
+)
 
 require (
 	github.com/jackc/pgpassfile v1.0.0 // indirect
 	github.com/jackc/pgservicefile v0.0.0-20240606120523-5a60cdf6a761 // indirect
 	github.com/jackc/pgx/v5 v5.6.0 // indirect
 	github.com/jackc/puddle/v2 v2.2.2 // indirect
-	golang.org/x/crypto v0.31.0 // indirect
 	golang.org/x/sync v0.10.0 // indirect
 )
 
@@ -19,6 +21,6 @@ require (
 	github.com/jinzhu/inflection v1.0.0 // indirect
 	github.com/jinzhu/now v1.1.5 // indirect
 	github.com/joho/godotenv v1.5.1
-	golang.org/x/text v0.21.0 // indirect
+	golang.org/x/text v0.21.0
 	gorm.io/driver/postgres v1.6.0
 )
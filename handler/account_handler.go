@@ -0,0 +1,186 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"tracker/middleware"
+	"tracker/models"
+	"tracker/service"
+)
+
+type AccountHandler struct {
+	Service *service.AccountService
+}
+
+// CreateAccount creates an account for the logged-in user
+func (h *AccountHandler) CreateAccount(w http.ResponseWriter, r *http.Request) {
+	var account models.Account
+	if err := json.NewDecoder(r.Body).Decode(&account); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := middleware.GetUserIDFromToken(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	account.UserID = userID
+
+	if err := h.Service.CreateAccount(&account); err != nil {
+		if isAccountValidationError(err) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(account)
+}
+
+// GetAccounts returns the logged-in user's accounts; archived ones only with include_archived=true
+func (h *AccountHandler) GetAccounts(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromToken(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	accounts, err := h.Service.GetAccountsByUserID(userID, r.URL.Query().Get("include_archived") == "true")
+	if err != nil {
+		http.Error(w, "failed to fetch accounts", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(accounts)
+}
+
+// GetAccountByID returns one account of the logged-in user
+func (h *AccountHandler) GetAccountByID(w http.ResponseWriter, r *http.Request) {
+	id, err := queryID(r)
+	if err != nil {
+		http.Error(w, "invalid account ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := middleware.GetUserIDFromToken(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	account, err := h.Service.GetAccountByID(id, userID)
+	if err != nil {
+		if errors.Is(err, service.ErrAccountNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, "failed to fetch account", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(account)
+}
+
+// UpdateAccount updates an account of the logged-in user
+func (h *AccountHandler) UpdateAccount(w http.ResponseWriter, r *http.Request) {
+	var account models.Account
+	if err := json.NewDecoder(r.Body).Decode(&account); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	id, err := queryID(r)
+	if err != nil {
+		http.Error(w, "invalid account ID", http.StatusBadRequest)
+		return
+	}
+	account.ID = id
+
+	userID, err := middleware.GetUserIDFromToken(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	account.UserID = userID
+
+	if err := h.Service.UpdateAccount(&account); err != nil {
+		switch {
+		case errors.Is(err, service.ErrAccountNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case isAccountValidationError(err):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(account)
+}
+
+// DeleteAccount deletes an account of the logged-in user that has no transactions
+func (h *AccountHandler) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	id, err := queryID(r)
+	if err != nil {
+		http.Error(w, "invalid account ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := middleware.GetUserIDFromToken(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.Service.DeleteAccount(id, userID); err != nil {
+		switch {
+		case errors.Is(err, service.ErrAccountNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, service.ErrAccountInUse):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent) // 204 No Content
+}
+
+// GetAccountBalances returns the balance of each of the logged-in user's accounts
+func (h *AccountHandler) GetAccountBalances(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromToken(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	balances, err := h.Service.GetAccountBalances(userID, r.URL.Query().Get("include_archived") == "true")
+	if err != nil {
+		if errors.Is(err, service.ErrMissingExchangeRate) {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		http.Error(w, "could not calculate account balances", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(balances)
+}
+
+// isAccountValidationError reports whether err was caused by bad input
+func isAccountValidationError(err error) bool {
+	return errors.Is(err, service.ErrInvalidAccountName) ||
+		errors.Is(err, service.ErrInvalidAccountType) ||
+		errors.Is(err, service.ErrInvalidCurrency) ||
+		errors.Is(err, service.ErrInvalidAmount)
+}
@@ -0,0 +1,37 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"tracker/middleware"
+	"tracker/service"
+)
+
+type AlertHandler struct {
+	Service *service.AlertService
+}
+
+// GetAlerts returns the logged-in user's budget alerts, newest first.
+// The optional limit query parameter caps the number of alerts returned.
+func (h *AlertHandler) GetAlerts(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromToken(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	limit, err := queryInt(r, "limit")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	alerts, err := h.Service.GetAlertsByUserID(userID, limit)
+	if err != nil {
+		http.Error(w, "failed to fetch alerts", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(alerts)
+}
@@ -0,0 +1,267 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"tracker/middleware"
+	"tracker/models"
+	"tracker/service"
+)
+
+// multipartOverhead is what an upload may add to the file itself: part
+// headers, boundaries and small fields
+const multipartOverhead = 1 << 20
+
+type AttachmentHandler struct {
+	Service *service.AttachmentService
+}
+
+// UploadAttachment stores the multipart field "file" as an attachment of
+// the transaction given by transaction_id
+func (h *AttachmentHandler) UploadAttachment(w http.ResponseWriter, r *http.Request) {
+	txID, err := queryOptionalID(r, "transaction_id")
+	if err != nil || txID == nil {
+		http.Error(w, "invalid transaction ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := middleware.GetUserIDFromToken(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// The file is streamed from the request rather than parsed into a
+	// temporary file first
+	r.Body = http.MaxBytesReader(w, r.Body, h.Service.MaxUploadSize()+multipartOverhead)
+	mr, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, "expected a multipart upload", http.StatusBadRequest)
+		return
+	}
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				writeAttachmentError(w, err)
+				return
+			}
+			http.Error(w, "missing file", http.StatusBadRequest)
+			return
+		}
+		if part.FormName() != "file" {
+			part.Close()
+			continue
+		}
+
+		att, err := h.Service.Upload(r.Context(), userID, *txID, part.FileName(), part)
+		part.Close()
+		if err != nil {
+			writeAttachmentError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(att)
+		return
+	}
+}
+
+// GetAttachments returns the attachments of the transaction given by
+// transaction_id
+func (h *AttachmentHandler) GetAttachments(w http.ResponseWriter, r *http.Request) {
+	txID, err := queryOptionalID(r, "transaction_id")
+	if err != nil || txID == nil {
+		http.Error(w, "invalid transaction ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := middleware.GetUserIDFromToken(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	atts, err := h.Service.GetAttachments(*txID, userID)
+	if err != nil {
+		writeAttachmentError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(atts)
+}
+
+// GetAttachmentByID returns one attachment of the logged-in user
+func (h *AttachmentHandler) GetAttachmentByID(w http.ResponseWriter, r *http.Request) {
+	id, err := queryID(r)
+	if err != nil {
+		http.Error(w, "invalid attachment ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := middleware.GetUserIDFromToken(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	att, err := h.Service.GetAttachmentByID(id, userID)
+	if err != nil {
+		writeAttachmentError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(att)
+}
+
+// DownloadAttachment sends the file of an attachment of the logged-in user,
+// or its thumbnail with thumbnail=true
+func (h *AttachmentHandler) DownloadAttachment(w http.ResponseWriter, r *http.Request) {
+	id, err := queryID(r)
+	if err != nil {
+		http.Error(w, "invalid attachment ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := middleware.GetUserIDFromToken(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	thumbnail := r.URL.Query().Get("thumbnail") == "true"
+	file, att, err := h.Service.Open(r.Context(), id, userID, thumbnail)
+	if err != nil {
+		writeAttachmentError(w, err)
+		return
+	}
+	defer file.Close()
+	sendAttachment(w, file, att, thumbnail)
+}
+
+// GetAttachmentLink returns a short-lived URL that downloads an attachment
+// of the logged-in user without a token, e.g. for an <img> tag or a mail
+// client; thumbnail=true links to its thumbnail
+func (h *AttachmentHandler) GetAttachmentLink(w http.ResponseWriter, r *http.Request) {
+	id, err := queryID(r)
+	if err != nil {
+		http.Error(w, "invalid attachment ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := middleware.GetUserIDFromToken(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	token, expires, err := h.Service.SignLink(id, userID, r.URL.Query().Get("thumbnail") == "true")
+	if err != nil {
+		writeAttachmentError(w, err)
+		return
+	}
+
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	link := models.AttachmentLink{
+		URL:       fmt.Sprintf("%s://%s/files/attachments?token=%s", scheme, r.Host, token),
+		ExpiresAt: expires.Unix(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(link)
+}
+
+// DownloadLink sends the file a download link points at. It is a public
+// route: the signed token in the link stands in for logging in.
+func (h *AttachmentHandler) DownloadLink(w http.ResponseWriter, r *http.Request) {
+	file, att, thumbnail, err := h.Service.OpenLink(r.Context(), r.URL.Query().Get("token"))
+	if err != nil {
+		writeAttachmentError(w, err)
+		return
+	}
+	defer file.Close()
+	w.Header().Set("Cache-Control", "private, max-age=900")
+	sendAttachment(w, file, att, thumbnail)
+}
+
+// DeleteAttachment deletes an attachment of the logged-in user with its files
+func (h *AttachmentHandler) DeleteAttachment(w http.ResponseWriter, r *http.Request) {
+	id, err := queryID(r)
+	if err != nil {
+		http.Error(w, "invalid attachment ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := middleware.GetUserIDFromToken(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.Service.DeleteAttachment(r.Context(), id, userID); err != nil {
+		writeAttachmentError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent) // 204 No Content
+}
+
+// sendAttachment writes a stored file. Images show in the browser, anything
+// else is offered as a download, and nothing may run as part of our origin.
+func sendAttachment(w http.ResponseWriter, file io.Reader, att *models.Attachment, thumbnail bool) {
+	contentType, name, size := att.ContentType, att.FileName, strconv.FormatInt(att.Size, 10)
+	if thumbnail {
+		contentType, name, size = "image/jpeg", strings.TrimSuffix(name, path.Ext(name))+"-thumbnail.jpg", ""
+	}
+	disposition := "attachment"
+	if strings.HasPrefix(contentType, "image/") {
+		disposition = "inline"
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": name}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	if size != "" {
+		w.Header().Set("Content-Length", size)
+	}
+	if _, err := io.Copy(w, file); err != nil {
+		log.Printf("send attachment %d: %v", att.ID, err)
+	}
+}
+
+// writeAttachmentError maps an attachment service error onto a response
+func writeAttachmentError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.Is(err, service.ErrAttachmentNotFound),
+		errors.Is(err, service.ErrTransactionNotFound),
+		errors.Is(err, service.ErrNoThumbnail):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, service.ErrAttachmentTooLarge), errors.As(err, &tooLarge):
+		http.Error(w, service.ErrAttachmentTooLarge.Error(), http.StatusRequestEntityTooLarge)
+	case errors.Is(err, service.ErrAttachmentType):
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+	case errors.Is(err, service.ErrEmptyAttachment):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, service.ErrInvalidLink):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -2,9 +2,11 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 
 	"net/http"
 	"strconv"
+	"time"
 	"tracker/middleware"
 	"tracker/models"
 	"tracker/service"
@@ -31,6 +33,10 @@ func (h *BudgetHandler) CreateBudget(w http.ResponseWriter, r *http.Request) {
 	budget.UserID = userID
 
 	if err := h.Service.CreateBudget(&budget); err != nil {
+		if isBudgetValidationError(err) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -92,6 +98,10 @@ func (h *BudgetHandler) UpdateBudget(w http.ResponseWriter, r *http.Request) {
 	budget.UserID = userID
 
 	if err := h.Service.UpdateBudget(&budget); err != nil {
+		if errors.Is(err, service.ErrBudgetNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
@@ -127,3 +137,92 @@ func (h *BudgetHandler) DeleteBudget(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusNoContent) // 204 No Content
 }
+
+// GetBudgetReport returns budget-vs-actual figures for the logged-in user.
+// The optional date query parameter picks the period; it defaults to today.
+func (h *BudgetHandler) GetBudgetReport(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromToken(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	at, err := queryDate(r, "date", false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if at == nil {
+		now := time.Now()
+		at = &now
+	}
+
+	reports, err := h.Service.GetBudgetReport(userID, *at)
+	if err != nil {
+		if errors.Is(err, service.ErrMissingExchangeRate) {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		http.Error(w, "failed to build budget report", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reports)
+}
+
+// GetEffectiveAmount returns a budget's amount including rollover for the
+// period containing the optional date query parameter
+func (h *BudgetHandler) GetEffectiveAmount(w http.ResponseWriter, r *http.Request) {
+	id, err := queryID(r)
+	if err != nil {
+		http.Error(w, "invalid budget ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := middleware.GetUserIDFromToken(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	at, err := queryDate(r, "date", false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if at == nil {
+		now := time.Now()
+		at = &now
+	}
+
+	amount, currency, err := h.Service.GetEffectiveAmount(id, userID, *at)
+	if err != nil {
+		if errors.Is(err, service.ErrBudgetNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, service.ErrMissingExchangeRate) {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		http.Error(w, "failed to calculate effective amount", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"effective_amount": amount.Format(currency), "currency": currency})
+}
+
+// isBudgetValidationError reports whether err was caused by bad input
+func isBudgetValidationError(err error) bool {
+	return errors.Is(err, service.ErrInvalidBudgetPeriod) ||
+		errors.Is(err, service.ErrCustomBudgetDates) ||
+		errors.Is(err, service.ErrInvalidRollover) ||
+		errors.Is(err, service.ErrInvalidThreshold) ||
+		errors.Is(err, service.ErrInvalidCurrency) ||
+		errors.Is(err, service.ErrInvalidAmount) ||
+		errors.Is(err, service.ErrCategoryNotFound) ||
+		errors.Is(err, service.ErrCategoryArchived) ||
+		errors.Is(err, service.ErrCategoryKindMismatch)
+}
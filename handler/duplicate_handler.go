@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"tracker/middleware"
+	"tracker/service"
+)
+
+type DuplicateHandler struct {
+	Service *service.DuplicateService
+}
+
+// GetDuplicates returns the logged-in user's suspected duplicates awaiting
+// review, each with both transactions
+func (h *DuplicateHandler) GetDuplicates(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromToken(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	candidates, err := h.Service.GetOpenCandidates(userID)
+	if err != nil {
+		http.Error(w, "failed to fetch duplicates", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(candidates)
+}
+
+// MergeDuplicate resolves the candidate in the id query parameter by keeping
+// one transaction and deleting the other. keep is the ID of the transaction
+// to keep and defaults to the earlier one. Responds with the survivor.
+func (h *DuplicateHandler) MergeDuplicate(w http.ResponseWriter, r *http.Request) {
+	id, err := queryID(r)
+	if err != nil {
+		http.Error(w, "invalid duplicate ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := middleware.GetUserIDFromToken(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	keep, err := queryOptionalID(r, "keep")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var keepID uint
+	if keep != nil {
+		keepID = *keep
+	}
+
+	transaction, err := h.Service.Merge(id, userID, keepID)
+	if err != nil {
+		writeDuplicateError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(transaction)
+}
+
+// DismissDuplicate marks the candidate in the id query parameter as not a duplicate
+func (h *DuplicateHandler) DismissDuplicate(w http.ResponseWriter, r *http.Request) {
+	id, err := queryID(r)
+	if err != nil {
+		http.Error(w, "invalid duplicate ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := middleware.GetUserIDFromToken(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.Service.Dismiss(id, userID); err != nil {
+		writeDuplicateError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent) // 204 No Content
+}
+
+// writeDuplicateError maps the errors of resolving a candidate onto statuses
+func writeDuplicateError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrDuplicateNotFound), errors.Is(err, service.ErrTransactionNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, service.ErrDuplicateResolved):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, service.ErrInvalidMergeKeep):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+	"tracker/service"
+)
+
+type ExchangeHandler struct {
+	Service   *service.ExchangeService
+	RatesPath string // ECB rate file or directory that reload imports from
+}
+
+// GetRates returns the latest EUR reference rate of every currency on or
+// before the date query parameter, which defaults to today
+func (h *ExchangeHandler) GetRates(w http.ResponseWriter, r *http.Request) {
+	date, err := queryDate(r, "date", false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if date == nil {
+		now := time.Now()
+		date = &now
+	}
+
+	rates, err := h.Service.GetRatesOn(*date)
+	if err != nil {
+		http.Error(w, "could not fetch exchange rates", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rates)
+}
+
+// ReloadRates imports the configured ECB rate files again; the rates are
+// shared by all users, so it is only routed for the operator
+func (h *ExchangeHandler) ReloadRates(w http.ResponseWriter, r *http.Request) {
+	if h.RatesPath == "" {
+		http.Error(w, "no exchange rate path configured", http.StatusNotFound)
+		return
+	}
+
+	n, err := h.Service.ImportPath(h.RatesPath)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"imported": n})
+}
@@ -0,0 +1,204 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"tracker/middleware"
+	"tracker/service"
+)
+
+// IdempotencyKeyHeader is the request header clients put a unique key in to
+// make retrying a write safe
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// maxIdempotencyKeyLength matches the size of the key column
+const maxIdempotencyKeyLength = 255
+
+// maxIdempotentBodySize caps the body buffered to fingerprint a request. It
+// is the largest limit of any route, that of attachment uploads, so each
+// route still applies its own.
+const maxIdempotentBodySize = service.DefaultMaxAttachmentSize + multipartOverhead
+
+type IdempotencyHandler struct {
+	Service *service.IdempotencyService
+}
+
+// Middleware makes POST, PUT, PATCH and DELETE requests that carry an
+// Idempotency-Key header run at most once per user and key. The response is
+// stored for a day and replayed, with an Idempotent-Replayed header, when the
+// same request comes again. Reusing a key for a different request is
+// rejected with 422, and retrying while the first attempt still runs with
+// 409. The first attempt holds the key for as long as it runs; only when it
+// crashed does a retry take over, after IdempotencyLease. Server errors are
+// not stored, so the request can be retried.
+// It must run after AuthMiddleware.
+func (h *IdempotencyHandler) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyKeyHeader)
+		if key == "" || !isMutating(r.Method) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			http.Error(w, "Idempotency-Key must be at most 255 characters", http.StatusBadRequest)
+			return
+		}
+
+		userID, err := middleware.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentBodySize))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, "failed to read request body", http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		stored, err := h.Service.Begin(userID, key, requestHash(r, body))
+		switch {
+		case errors.Is(err, service.ErrIdempotencyKeyReused):
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		case errors.Is(err, service.ErrIdempotencyKeyInFlight):
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		case err != nil:
+			http.Error(w, "failed to check idempotency key", http.StatusInternalServerError)
+			return
+		}
+
+		if stored != nil {
+			if stored.ContentType != "" {
+				w.Header().Set("Content-Type", stored.ContentType)
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(stored.StatusCode)
+			w.Write(stored.Body)
+			return
+		}
+
+		rec := &responseRecorder{ResponseWriter: w}
+		stop := h.Service.Hold(userID, key)
+		completed := false
+		defer func() {
+			stop()
+			if completed {
+				return
+			}
+			// The handler panicked; let the client try again
+			if err := h.Service.Release(userID, key); err != nil {
+				log.Printf("idempotency key %q: %v", key, err)
+			}
+		}()
+
+		next.ServeHTTP(rec, r)
+
+		stop()
+		completed = true
+		if rec.status >= http.StatusInternalServerError {
+			err = h.Service.Release(userID, key)
+		} else {
+			err = h.Service.Complete(userID, key, rec.statusCode(), rec.Header().Get("Content-Type"), rec.body.Bytes())
+		}
+		if err != nil {
+			log.Printf("idempotency key %q: %v", key, err)
+		}
+	})
+}
+
+// isMutating reports whether a request of this method may change data
+func isMutating(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// requestHash fingerprints what a request asks for: its method, path, query
+// and body. Multipart bodies are fingerprinted by their parts, since a retry
+// picks a new boundary.
+func requestHash(r *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+r.URL.Path+"?"+r.URL.RawQuery+"\n")
+	if mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err == nil &&
+		strings.HasPrefix(mediaType, "multipart/") && params["boundary"] != "" {
+		if parts, err := multipartHash(body, params["boundary"]); err == nil {
+			io.WriteString(h, mediaType+"\n"+parts)
+			return hex.EncodeToString(h.Sum(nil))
+		}
+	}
+	io.WriteString(h, strconv.Itoa(len(body))+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// multipartHash lists the parts of a multipart body in order: the field
+// name, file name and content type of each, with a digest of its contents
+func multipartHash(body []byte, boundary string) (string, error) {
+	var b strings.Builder
+	mr := multipart.NewReader(bytes.NewReader(body), boundary)
+	for {
+		part, err := mr.NextRawPart()
+		if err == io.EOF {
+			return b.String(), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		digest := sha256.New()
+		if _, err := io.Copy(digest, part); err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, "%q %q %q %x\n", part.FormName(), part.FileName(), part.Header.Get("Content-Type"), digest.Sum(nil))
+	}
+}
+
+// responseRecorder passes a response through while keeping a copy
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+// statusCode is the status sent, 200 if the handler wrote nothing at all
+func (rec *responseRecorder) statusCode() int {
+	if rec.status == 0 {
+		return http.StatusOK
+	}
+	return rec.status
+}
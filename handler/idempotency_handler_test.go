@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"tracker/middleware"
+	"tracker/models"
+	"tracker/service"
+
+	"gorm.io/gorm"
+)
+
+func TestIdempotencyMiddlewareRejectsLargeBody(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test")
+	token, err := middleware.GenerateJWT(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := &IdempotencyHandler{Service: &service.IdempotencyService{}}
+	reached := false
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { reached = true })
+	srv := middleware.AuthMiddleware(h.Middleware(next))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/transactions", bytes.NewReader(make([]byte, maxIdempotentBodySize+1)))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set(IdempotencyKeyHeader, "k")
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want 413", rec.Code)
+	}
+	if reached {
+		t.Error("the handler ran for an oversized body")
+	}
+}
+
+// memIdempotencyRepo keeps keys in memory for the middleware
+type memIdempotencyRepo struct {
+	keys map[string]*models.IdempotencyKey
+}
+
+func (m *memIdempotencyRepo) ReserveKey(key *models.IdempotencyKey) (bool, error) {
+	if _, ok := m.keys[key.Key]; ok {
+		return false, nil
+	}
+	key.ID = uint(len(m.keys) + 1)
+	m.keys[key.Key] = key
+	return true, nil
+}
+
+func (m *memIdempotencyRepo) GetKey(userID uint, key string) (*models.IdempotencyKey, error) {
+	if k, ok := m.keys[key]; ok {
+		copied := *k
+		return &copied, nil
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (m *memIdempotencyRepo) SaveResponse(id uint, status int, contentType string, body []byte, expiresAt time.Time) error {
+	for _, k := range m.keys {
+		if k.ID == id {
+			k.StatusCode, k.ContentType, k.Body, k.ExpiresAt = status, contentType, body, expiresAt
+		}
+	}
+	return nil
+}
+
+func (m *memIdempotencyRepo) RenewLease(id uint, expiresAt time.Time) error { return nil }
+
+func (m *memIdempotencyRepo) DeleteKey(id uint) error {
+	for name, k := range m.keys {
+		if k.ID == id {
+			delete(m.keys, name)
+		}
+	}
+	return nil
+}
+
+func (m *memIdempotencyRepo) DeleteExpired(now time.Time) (int64, error) { return 0, nil }
+
+// uploadBody builds a multipart upload; each call picks a new boundary, the
+// way a client retrying the request does
+func uploadBody(t *testing.T, contents string) (*bytes.Buffer, string) {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	if err := mw.WriteField("dry_run", "false"); err != nil {
+		t.Fatal(err)
+	}
+	fw, err := mw.CreateFormFile("file", "statement.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(fw, contents)
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &body, mw.FormDataContentType()
+}
+
+func TestIdempotencyMiddlewareReplaysMultipartRetry(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test")
+	token, err := middleware.GenerateJWT(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := &IdempotencyHandler{Service: &service.IdempotencyService{Repo: &memIdempotencyRepo{keys: map[string]*models.IdempotencyKey{}}}}
+	runs := 0
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		runs++
+		w.WriteHeader(http.StatusCreated)
+	})
+	srv := middleware.AuthMiddleware(h.Middleware(next))
+
+	send := func(contents string) *httptest.ResponseRecorder {
+		body, contentType := uploadBody(t, contents)
+		req := httptest.NewRequest(http.MethodPost, "/api/import/csv/1", body)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set(IdempotencyKeyHeader, "upload-1")
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := send("date,amount\n2026-03-01,-12.50\n"); rec.Code != http.StatusCreated {
+		t.Fatalf("first upload: status = %d, want 201", rec.Code)
+	}
+	rec := send("date,amount\n2026-03-01,-12.50\n")
+	if rec.Code != http.StatusCreated || rec.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("retry: status = %d, replayed = %q; want the stored 201", rec.Code, rec.Header().Get("Idempotent-Replayed"))
+	}
+	if runs != 1 {
+		t.Errorf("handler ran %d times, want once", runs)
+	}
+	if rec := send("date,amount\n2026-03-01,-99.00\n"); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("other file under the same key: status = %d, want 422", rec.Code)
+	}
+}
@@ -0,0 +1,297 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"tracker/middleware"
+	"tracker/models"
+	"tracker/service"
+)
+
+// maxImportSize caps the size of an uploaded statement
+const maxImportSize = 10 << 20
+
+type ImportHandler struct {
+	Service *service.ImportService
+}
+
+// CreateProfile saves a CSV column mapping profile for the logged-in user
+func (h *ImportHandler) CreateProfile(w http.ResponseWriter, r *http.Request) {
+	var profile models.ImportProfile
+	if err := json.NewDecoder(r.Body).Decode(&profile); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := middleware.GetUserIDFromToken(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	profile.UserID = userID
+
+	if err := h.Service.CreateProfile(&profile); err != nil {
+		if isImportValidationError(err) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(profile)
+}
+
+// GetProfiles returns the logged-in user's import profiles
+func (h *ImportHandler) GetProfiles(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromToken(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	profiles, err := h.Service.GetProfilesByUserID(userID)
+	if err != nil {
+		http.Error(w, "failed to fetch import profiles", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profiles)
+}
+
+// GetProfileByID returns one import profile of the logged-in user
+func (h *ImportHandler) GetProfileByID(w http.ResponseWriter, r *http.Request) {
+	id, err := queryID(r)
+	if err != nil {
+		http.Error(w, "invalid profile ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := middleware.GetUserIDFromToken(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	profile, err := h.Service.GetProfileByID(id, userID)
+	if err != nil {
+		if errors.Is(err, service.ErrImportProfileNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, "failed to fetch import profile", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profile)
+}
+
+// UpdateProfile updates an import profile of the logged-in user
+func (h *ImportHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	var profile models.ImportProfile
+	if err := json.NewDecoder(r.Body).Decode(&profile); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	id, err := queryID(r)
+	if err != nil {
+		http.Error(w, "invalid profile ID", http.StatusBadRequest)
+		return
+	}
+	profile.ID = id
+
+	userID, err := middleware.GetUserIDFromToken(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	profile.UserID = userID
+
+	if err := h.Service.UpdateProfile(&profile); err != nil {
+		switch {
+		case errors.Is(err, service.ErrImportProfileNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case isImportValidationError(err):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profile)
+}
+
+// DeleteProfile deletes an import profile of the logged-in user
+func (h *ImportHandler) DeleteProfile(w http.ResponseWriter, r *http.Request) {
+	id, err := queryID(r)
+	if err != nil {
+		http.Error(w, "invalid profile ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := middleware.GetUserIDFromToken(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.Service.DeleteProfile(id, userID); err != nil {
+		if errors.Is(err, service.ErrImportProfileNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent) // 204 No Content
+}
+
+// ImportCSV imports a CSV statement sent as the multipart field "file" using
+// the profile in profile_id. With dry_run=true nothing is saved and the parsed
+// rows come back with their errors; otherwise all rows are saved or none.
+func (h *ImportHandler) ImportCSV(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromToken(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	file, err := readUpload(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	profileID, err := queryOptionalID(r, "profile_id")
+	if err != nil || profileID == nil {
+		http.Error(w, "invalid profile_id", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.Service.ImportCSV(userID, *profileID, file, r.FormValue("dry_run") == "true")
+	writeImportResult(w, result, err)
+}
+
+// ImportStatement imports an OFX, QFX, QIF, camt.053 or MT940 statement sent as
+// the multipart field "file". format (ofx, qif, camt053 or mt940) is detected
+// when omitted; account_id books
+// the entries on an account, category fills in entries without one and
+// date_order (mdy, dmy or ymd) tells how QIF dates are written. Entries whose
+// bank ID was imported on the same account before are skipped. camt.053 and
+// MT940 results list each statement's opening and closing balance.
+func (h *ImportHandler) ImportStatement(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromToken(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	file, err := readUpload(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	accountID, err := queryOptionalID(r, "account_id")
+	if err != nil {
+		http.Error(w, "invalid account_id", http.StatusBadRequest)
+		return
+	}
+	opts := service.ImportOptions{
+		AccountID: accountID,
+		Category:  r.FormValue("category"),
+		DateOrder: r.FormValue("date_order"),
+	}
+
+	result, err := h.Service.ImportStatement(userID, r.FormValue("format"), file, opts, r.FormValue("dry_run") == "true")
+	writeImportResult(w, result, err)
+}
+
+// ImportBeancount imports a beancount journal uploaded as multipart field
+// "file"; dry_run=true only reports what would be imported
+func (h *ImportHandler) ImportBeancount(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromToken(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	file, err := readUpload(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	result, err := h.Service.ImportBeancount(userID, file, r.FormValue("dry_run") == "true")
+	writeImportResult(w, result, err)
+}
+
+// readUpload returns the multipart field "file" of a request of at most maxImportSize bytes
+func readUpload(w http.ResponseWriter, r *http.Request) (io.ReadCloser, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	if err := r.ParseMultipartForm(maxImportSize); err != nil {
+		return nil, errors.New("expected a multipart upload of at most 10 MB")
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		return nil, errors.New("missing file")
+	}
+	return file, nil
+}
+
+// writeImportResult answers an import: the result on success, the rows with
+// their errors as 422 when the file was rejected
+func writeImportResult(w http.ResponseWriter, result *models.ImportResult, err error) {
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrImportHasErrors):
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			json.NewEncoder(w).Encode(result)
+		case errors.Is(err, service.ErrImportProfileNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case isImportValidationError(err):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !result.DryRun {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(result)
+}
+
+// isImportValidationError reports whether err was caused by a bad profile or file
+func isImportValidationError(err error) bool {
+	return errors.Is(err, service.ErrInvalidProfileName) ||
+		errors.Is(err, service.ErrInvalidEncoding) ||
+		errors.Is(err, service.ErrInvalidDelimiter) ||
+		errors.Is(err, service.ErrInvalidDateFormat) ||
+		errors.Is(err, service.ErrInvalidDecimalSep) ||
+		errors.Is(err, service.ErrInvalidAmountMode) ||
+		errors.Is(err, service.ErrMissingColumn) ||
+		errors.Is(err, service.ErrColumnNotFound) ||
+		errors.Is(err, service.ErrEmptyImportFile) ||
+		errors.Is(err, service.ErrMalformedImport) ||
+		errors.Is(err, service.ErrUnknownImportFormat) ||
+		errors.Is(err, service.ErrInvalidDateOrder) ||
+		errors.Is(err, service.ErrAccountNotFound) ||
+		errors.Is(err, service.ErrAccountArchived)
+}
@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"tracker/models"
+	"tracker/money"
+)
+
+var errMissingID = errors.New("id query parameter is missing")
+
+// queryID reads the numeric id query parameter
+func queryID(r *http.Request) (uint, error) {
+	idStr := r.URL.Query().Get("id")
+	if idStr == "" {
+		return 0, errMissingID
+	}
+
+	idInt, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return uint(idInt), nil
+}
+
+// queryOptionalID reads an optional numeric ID query parameter such as account_id
+func queryOptionalID(r *http.Request, key string) (*uint, error) {
+	v := r.URL.Query().Get(key)
+	if v == "" {
+		return nil, nil
+	}
+
+	n, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s", key)
+	}
+	id := uint(n)
+	return &id, nil
+}
+
+// queryDate reads a YYYY-MM-DD or RFC 3339 query parameter.
+// With endOfDay set, a plain date is moved to the following midnight so it
+// can be used as an exclusive upper bound that still covers the whole day.
+func queryDate(r *http.Request, key string, endOfDay bool) (*time.Time, error) {
+	v := r.URL.Query().Get(key)
+	if v == "" {
+		return nil, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse("2006-01-02", v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: use YYYY-MM-DD or RFC 3339", key)
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
+
+// queryAmount reads an optional decimal money query parameter in the decimal
+// places of currency, or with two decimals when currency is empty
+func queryAmount(r *http.Request, key, currency string) (*money.Amount, error) {
+	v := r.URL.Query().Get(key)
+	if v == "" {
+		return nil, nil
+	}
+
+	a, err := money.ParseIn(v, currency)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s", key)
+	}
+	return &a, nil
+}
+
+// queryInt reads an optional integer query parameter
+func queryInt(r *http.Request, key string) (int, error) {
+	v := r.URL.Query().Get(key)
+	if v == "" {
+		return 0, nil
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s", key)
+	}
+	return n, nil
+}
+
+// queryDateRange reads the optional from/to query parameters
+func queryDateRange(r *http.Request) (models.DateRange, error) {
+	var rng models.DateRange
+	var err error
+	if rng.From, err = queryDate(r, "from", false); err != nil {
+		return rng, err
+	}
+	if rng.To, err = queryDate(r, "to", true); err != nil {
+		return rng, err
+	}
+	return rng, nil
+}
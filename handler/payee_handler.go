@@ -0,0 +1,186 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"tracker/middleware"
+	"tracker/models"
+	"tracker/service"
+)
+
+type PayeeHandler struct {
+	Service *service.PayeeService
+}
+
+// CreatePayee creates a payee for the logged-in user
+func (h *PayeeHandler) CreatePayee(w http.ResponseWriter, r *http.Request) {
+	var payee models.Payee
+	if err := json.NewDecoder(r.Body).Decode(&payee); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := middleware.GetUserIDFromToken(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	payee.UserID = userID
+
+	if err := h.Service.CreatePayee(&payee); err != nil {
+		writePayeeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(payee)
+}
+
+// GetPayees returns the logged-in user's payees in the order their aliases
+// are tried
+func (h *PayeeHandler) GetPayees(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromToken(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	payees, err := h.Service.GetPayeesByUserID(userID)
+	if err != nil {
+		http.Error(w, "failed to fetch payees", http.StatusInternalServerError)
+		return
+	}
+	if payees == nil {
+		payees = []models.Payee{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(payees)
+}
+
+// GetPayeeByID returns one payee of the logged-in user
+func (h *PayeeHandler) GetPayeeByID(w http.ResponseWriter, r *http.Request) {
+	id, err := queryID(r)
+	if err != nil {
+		http.Error(w, "invalid payee ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := middleware.GetUserIDFromToken(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	payee, err := h.Service.GetPayeeByID(id, userID)
+	if err != nil {
+		if errors.Is(err, service.ErrPayeeNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, "failed to fetch payee", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(payee)
+}
+
+// UpdatePayee updates a payee of the logged-in user; renaming it renames it
+// on its transactions
+func (h *PayeeHandler) UpdatePayee(w http.ResponseWriter, r *http.Request) {
+	var payee models.Payee
+	if err := json.NewDecoder(r.Body).Decode(&payee); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	id, err := queryID(r)
+	if err != nil {
+		http.Error(w, "invalid payee ID", http.StatusBadRequest)
+		return
+	}
+	payee.ID = id
+
+	userID, err := middleware.GetUserIDFromToken(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	payee.UserID = userID
+
+	if err := h.Service.UpdatePayee(&payee); err != nil {
+		writePayeeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(payee)
+}
+
+// DeletePayee deletes a payee of the logged-in user; its transactions stay
+func (h *PayeeHandler) DeletePayee(w http.ResponseWriter, r *http.Request) {
+	id, err := queryID(r)
+	if err != nil {
+		http.Error(w, "invalid payee ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := middleware.GetUserIDFromToken(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.Service.DeletePayee(id, userID); err != nil {
+		writePayeeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent) // 204 No Content
+}
+
+// ApplyPayees matches the logged-in user's past transactions without a
+// payee, optionally limited by from and to, against their payees
+func (h *PayeeHandler) ApplyPayees(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromToken(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	rng, err := queryDateRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.Service.ApplyPayees(userID, rng)
+	if err != nil {
+		http.Error(w, "failed to apply payees", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// writePayeeError maps a payee service error onto a response
+func writePayeeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrPayeeNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, service.ErrDuplicatePayee):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, service.ErrInvalidPayeeName),
+		errors.Is(err, service.ErrInvalidPayeeAlias),
+		errors.Is(err, service.ErrInvalidMatchType),
+		errors.Is(err, service.ErrCategoryNotFound),
+		errors.Is(err, service.ErrCategoryArchived):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
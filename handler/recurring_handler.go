@@ -0,0 +1,163 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"tracker/middleware"
+	"tracker/models"
+	"tracker/service"
+)
+
+type RecurringHandler struct {
+	Service *service.RecurringService
+}
+
+// CreateRecurring creates a recurring transaction for the logged-in user
+func (h *RecurringHandler) CreateRecurring(w http.ResponseWriter, r *http.Request) {
+	var rt models.RecurringTransaction
+	if err := json.NewDecoder(r.Body).Decode(&rt); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := middleware.GetUserIDFromToken(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	rt.UserID = userID
+
+	if err := h.Service.CreateRecurring(&rt); err != nil {
+		if isRecurringValidationError(err) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(rt)
+}
+
+// GetRecurring returns all recurring transactions of the logged-in user
+func (h *RecurringHandler) GetRecurring(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromToken(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	rts, err := h.Service.GetRecurringByUserID(userID)
+	if err != nil {
+		http.Error(w, "failed to fetch recurring transactions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rts)
+}
+
+// GetRecurringByID returns one recurring transaction of the logged-in user
+func (h *RecurringHandler) GetRecurringByID(w http.ResponseWriter, r *http.Request) {
+	id, err := queryID(r)
+	if err != nil {
+		http.Error(w, "invalid recurring transaction ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := middleware.GetUserIDFromToken(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	rt, err := h.Service.GetRecurringByID(id, userID)
+	if err != nil {
+		if errors.Is(err, service.ErrRecurringNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, "failed to fetch recurring transaction", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rt)
+}
+
+// UpdateRecurring updates a recurring transaction of the logged-in user
+func (h *RecurringHandler) UpdateRecurring(w http.ResponseWriter, r *http.Request) {
+	var rt models.RecurringTransaction
+	if err := json.NewDecoder(r.Body).Decode(&rt); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	id, err := queryID(r)
+	if err != nil {
+		http.Error(w, "invalid recurring transaction ID", http.StatusBadRequest)
+		return
+	}
+	rt.ID = id
+
+	userID, err := middleware.GetUserIDFromToken(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	rt.UserID = userID
+
+	if err := h.Service.UpdateRecurring(&rt); err != nil {
+		switch {
+		case errors.Is(err, service.ErrRecurringNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case isRecurringValidationError(err):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rt)
+}
+
+// DeleteRecurring deletes a recurring transaction of the logged-in user
+func (h *RecurringHandler) DeleteRecurring(w http.ResponseWriter, r *http.Request) {
+	id, err := queryID(r)
+	if err != nil {
+		http.Error(w, "invalid recurring transaction ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := middleware.GetUserIDFromToken(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.Service.DeleteRecurring(id, userID); err != nil {
+		if errors.Is(err, service.ErrRecurringNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent) // 204 No Content
+}
+
+// isRecurringValidationError reports whether err was caused by bad input
+func isRecurringValidationError(err error) bool {
+	return isTransactionValidationError(err) ||
+		errors.Is(err, service.ErrInvalidFrequency) ||
+		errors.Is(err, service.ErrInvalidInterval) ||
+		errors.Is(err, service.ErrInvalidDayOfMonth) ||
+		errors.Is(err, service.ErrInvalidRecurringEnd) ||
+		errors.Is(err, service.ErrLastBusinessDayUsage)
+}
@@ -0,0 +1,253 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"tracker/middleware"
+	"tracker/models"
+	"tracker/service"
+)
+
+type RuleHandler struct {
+	Service *service.RuleService
+}
+
+// CreateRule saves a categorization rule for the logged-in user
+func (h *RuleHandler) CreateRule(w http.ResponseWriter, r *http.Request) {
+	var rule models.CategoryRule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := middleware.GetUserIDFromToken(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	rule.UserID = userID
+
+	if err := h.Service.CreateRule(&rule); err != nil {
+		if isRuleValidationError(err) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(rule)
+}
+
+// GetRules returns the logged-in user's rules in the order they run
+func (h *RuleHandler) GetRules(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromToken(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	rules, err := h.Service.GetRulesByUserID(userID)
+	if err != nil {
+		http.Error(w, "failed to fetch rules", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rules)
+}
+
+// GetRuleByID returns one rule of the logged-in user
+func (h *RuleHandler) GetRuleByID(w http.ResponseWriter, r *http.Request) {
+	id, err := queryID(r)
+	if err != nil {
+		http.Error(w, "invalid rule ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := middleware.GetUserIDFromToken(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	rule, err := h.Service.GetRuleByID(id, userID)
+	if err != nil {
+		if errors.Is(err, service.ErrRuleNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, "failed to fetch rule", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rule)
+}
+
+// UpdateRule updates a rule of the logged-in user
+func (h *RuleHandler) UpdateRule(w http.ResponseWriter, r *http.Request) {
+	var rule models.CategoryRule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	id, err := queryID(r)
+	if err != nil {
+		http.Error(w, "invalid rule ID", http.StatusBadRequest)
+		return
+	}
+	rule.ID = id
+
+	userID, err := middleware.GetUserIDFromToken(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	rule.UserID = userID
+
+	if err := h.Service.UpdateRule(&rule); err != nil {
+		switch {
+		case errors.Is(err, service.ErrRuleNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case isRuleValidationError(err):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rule)
+}
+
+// DeleteRule deletes a rule of the logged-in user
+func (h *RuleHandler) DeleteRule(w http.ResponseWriter, r *http.Request) {
+	id, err := queryID(r)
+	if err != nil {
+		http.Error(w, "invalid rule ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := middleware.GetUserIDFromToken(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.Service.DeleteRule(id, userID); err != nil {
+		if errors.Is(err, service.ErrRuleNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent) // 204 No Content
+}
+
+// TestRule shows which past transactions a rule would match and how it would
+// change them, without saving anything. The rule is the saved one named by
+// the id query parameter or, without one, the rule in the request body.
+// limit caps the listed matches; every match is counted.
+func (h *RuleHandler) TestRule(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromToken(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := queryOptionalID(r, "id")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, err := queryInt(r, "limit")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var rule *models.CategoryRule
+	if id != nil {
+		if rule, err = h.Service.GetRuleByID(*id, userID); err != nil {
+			if errors.Is(err, service.ErrRuleNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			http.Error(w, "failed to fetch rule", http.StatusInternalServerError)
+			return
+		}
+	} else {
+		rule = &models.CategoryRule{}
+		if err := json.NewDecoder(r.Body).Decode(rule); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		rule.UserID = userID
+	}
+
+	result, err := h.Service.TestRule(rule, limit)
+	if err != nil {
+		if isRuleValidationError(err) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// ApplyRules runs the logged-in user's rules over their past transactions,
+// optionally limited by from, to and account_id. Only missing categories are
+// filled in unless overwrite=true.
+func (h *RuleHandler) ApplyRules(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromToken(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	rng, err := queryDateRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	accountID, err := queryOptionalID(r, "account_id")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.Service.ApplyRules(userID, rng, accountID, r.URL.Query().Get("overwrite") == "true")
+	if err != nil {
+		http.Error(w, "failed to apply rules", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// isRuleValidationError reports whether err was caused by a bad rule
+func isRuleValidationError(err error) bool {
+	return errors.Is(err, service.ErrInvalidRuleName) ||
+		errors.Is(err, service.ErrInvalidMatchType) ||
+		errors.Is(err, service.ErrInvalidRulePattern) ||
+		errors.Is(err, service.ErrInvalidRuleType) ||
+		errors.Is(err, service.ErrInvalidRuleAmounts) ||
+		errors.Is(err, service.ErrInvalidCurrency) ||
+		errors.Is(err, service.ErrRuleWithoutCriteria) ||
+		errors.Is(err, service.ErrRuleWithoutAction) ||
+		errors.Is(err, service.ErrAccountNotFound) ||
+		errors.Is(err, service.ErrPayeeNotFound)
+}
@@ -2,7 +2,11 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"time"
 	"tracker/middleware"
 	"tracker/models"
 	"tracker/service"
@@ -29,6 +33,10 @@ func (h *TransactionHandler) CreateTransaction(w http.ResponseWriter, r *http.Re
 	transaction.UserID = userID
 
 	if err := h.Service.CreateTransaction(&transaction); err != nil {
+		if isTransactionValidationError(err) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -38,7 +46,13 @@ func (h *TransactionHandler) CreateTransaction(w http.ResponseWriter, r *http.Re
 	json.NewEncoder(w).Encode(transaction)
 }
 
-// GetTransactionsByUserID returns transactions for the logged-in user
+// GetTransactionsByUserID returns a filtered, paginated list of transactions
+// for the logged-in user.
+//
+// Query parameters: from, to, type, category, account_id, min_amount, max_amount, currency
+// (of the amount bounds, the user's base currency by default), q (note text), tag
+// (repeatable), tag_mode (any, all), sort (date, amount, created_at), order (asc,
+// desc), limit, cursor.
 func (h *TransactionHandler) GetTransactionsByUserID(w http.ResponseWriter, r *http.Request) {
 	userID, err := middleware.GetUserIDFromToken(r)
 	if err != nil {
@@ -46,22 +60,342 @@ func (h *TransactionHandler) GetTransactionsByUserID(w http.ResponseWriter, r *h
 		return
 	}
 
-	transactions, err := h.Service.GetTransactionsByUserID(userID)
+	filter, err := parseTransactionFilter(r)
 	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter.UserID = userID
+
+	page, err := h.Service.ListTransactions(filter, r.URL.Query().Get("cursor"))
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidCursor) || errors.Is(err, service.ErrInvalidCurrency) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		http.Error(w, "failed to fetch transactions", http.StatusInternalServerError)
 		return
 	}
 
-	if len(transactions) == 0 {
-		http.Error(w, "no transactions found", http.StatusNotFound)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// ExportTransactions streams the logged-in user's transactions as a file
+// download. format is csv, jsonl, xlsx, ledger, hledger or beancount; the
+// filter parameters of the listing apply, except limit and cursor. Rows come
+// oldest first unless order=desc.
+func (h *TransactionHandler) ExportTransactions(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromToken(r)
+	if err != nil {
+		http.Error(w, "could not get user id", http.StatusUnauthorized)
+		return
+	}
+
+	filter, err := parseTransactionFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter.UserID = userID
+	filter.SortDesc = r.URL.Query().Get("order") == "desc"
+	filter.Limit = 0
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = service.ExportCSV
+	}
+	contentType, ext, err := service.ExportFileType(format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The status is sent with the first rows. A failure before them still
+	// gets an error response; one halfway through can only abort the
+	// connection, so the client never mistakes a truncated file for a
+	// complete one.
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="transactions-%s.%s"`, time.Now().Format("20060102"), ext))
+	out := &startedWriter{ResponseWriter: w}
+	if err := h.Service.ExportTransactions(filter, format, out); err != nil {
+		log.Printf("export transactions for user %d: %v", userID, err)
+		if out.started {
+			panic(http.ErrAbortHandler)
+		}
+		w.Header().Del("Content-Disposition")
+		if errors.Is(err, service.ErrInvalidCurrency) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, service.ErrMissingExchangeRate) {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		http.Error(w, "failed to export transactions", http.StatusInternalServerError)
+	}
+}
+
+// startedWriter notes whether any of the response has been written yet
+type startedWriter struct {
+	http.ResponseWriter
+	started bool
+}
+
+func (s *startedWriter) Write(b []byte) (int, error) {
+	s.started = true
+	return s.ResponseWriter.Write(b)
+}
+
+// parseTransactionFilter builds a TransactionFilter from the query string
+func parseTransactionFilter(r *http.Request) (models.TransactionFilter, error) {
+	q := r.URL.Query()
+	filter := models.TransactionFilter{
+		Type:     q.Get("type"),
+		Category: q.Get("category"),
+		Currency: q.Get("currency"),
+		Note:     q.Get("q"),
+		Tags:     q["tag"],
+		AllTags:  q.Get("tag_mode") == "all",
+		SortBy:   q.Get("sort"),
+		SortDesc: q.Get("order") != "asc",
+	}
+
+	var err error
+	if filter.From, err = queryDate(r, "from", false); err != nil {
+		return filter, err
+	}
+	if filter.To, err = queryDate(r, "to", true); err != nil {
+		return filter, err
+	}
+	if filter.MinAmount, err = queryAmount(r, "min_amount", filter.Currency); err != nil {
+		return filter, err
+	}
+	if filter.MaxAmount, err = queryAmount(r, "max_amount", filter.Currency); err != nil {
+		return filter, err
+	}
+	if filter.Limit, err = queryInt(r, "limit"); err != nil {
+		return filter, err
+	}
+	if filter.AccountID, err = queryOptionalID(r, "account_id"); err != nil {
+		return filter, err
+	}
+
+	switch filter.SortBy {
+	case "", "date", "amount", "created_at":
+	default:
+		return filter, errors.New("sort must be date, amount or created_at")
+	}
+	if o := q.Get("order"); o != "" && o != "asc" && o != "desc" {
+		return filter, errors.New("order must be asc or desc")
+	}
+	if m := q.Get("tag_mode"); m != "" && m != "any" && m != "all" {
+		return filter, errors.New("tag_mode must be any or all")
+	}
+	return filter, nil
+}
+
+// GetTransactionByID returns a single transaction for the logged-in user
+func (h *TransactionHandler) GetTransactionByID(w http.ResponseWriter, r *http.Request) {
+	id, err := queryID(r)
+	if err != nil {
+		http.Error(w, "invalid transaction ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := middleware.GetUserIDFromToken(r)
+	if err != nil {
+		http.Error(w, "could not get user id", http.StatusUnauthorized)
+		return
+	}
+
+	transaction, err := h.Service.GetTransactionByID(id, userID)
+	if err != nil {
+		if errors.Is(err, service.ErrTransactionNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, "failed to fetch transaction", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(transaction)
+}
+
+// SuggestCategories suggests categories for a transaction being entered,
+// learned from the logged-in user's history. The transaction is described by
+// the note, amount, type (default expense), account_id and payee_id query
+// parameters; limit caps the number of suggestions.
+func (h *TransactionHandler) SuggestCategories(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromToken(r)
+	if err != nil {
+		http.Error(w, "could not get user id", http.StatusUnauthorized)
+		return
+	}
+
+	q := r.URL.Query()
+	transaction := models.Transaction{UserID: userID, Type: q.Get("type"), Note: q.Get("note")}
+	if transaction.Type == "" {
+		transaction.Type = "expense"
+	}
+	amount, err := queryAmount(r, "amount", "")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if amount != nil {
+		transaction.Amount = *amount
+	}
+	if transaction.AccountID, err = queryOptionalID(r, "account_id"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if transaction.PayeeID, err = queryOptionalID(r, "payee_id"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, err := queryInt(r, "limit")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	suggestions, err := h.Service.SuggestCategories(transaction, limit)
+	if err != nil {
+		if errors.Is(err, service.ErrSuggestionType) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "failed to suggest categories", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(suggestions)
+}
+
+// UpdateTransaction updates a transaction for the logged-in user
+func (h *TransactionHandler) UpdateTransaction(w http.ResponseWriter, r *http.Request) {
+	var transaction models.Transaction
+	if err := json.NewDecoder(r.Body).Decode(&transaction); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	id, err := queryID(r)
+	if err != nil {
+		http.Error(w, "invalid transaction ID", http.StatusBadRequest)
+		return
+	}
+	transaction.ID = id
+
+	userID, err := middleware.GetUserIDFromToken(r)
+	if err != nil {
+		http.Error(w, "could not get user id", http.StatusUnauthorized)
+		return
+	}
+	transaction.UserID = userID
+
+	if err := h.Service.UpdateTransaction(&transaction); err != nil {
+		switch {
+		case errors.Is(err, service.ErrTransactionNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case isTransactionValidationError(err):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(transaction)
+}
+
+// DeleteTransaction deletes a transaction for the logged-in user
+func (h *TransactionHandler) DeleteTransaction(w http.ResponseWriter, r *http.Request) {
+	id, err := queryID(r)
+	if err != nil {
+		http.Error(w, "invalid transaction ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := middleware.GetUserIDFromToken(r)
+	if err != nil {
+		http.Error(w, "could not get user id", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.Service.DeleteTransaction(id, userID); err != nil {
+		if errors.Is(err, service.ErrTransactionNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent) // 204 No Content
+}
+
+// GetTotalIncome returns the total income for the logged-in user, optionally within from/to
+func (h *TransactionHandler) GetTotalIncome(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromToken(r)
+	if err != nil {
+		http.Error(w, "could not get user id", http.StatusUnauthorized)
+		return
+	}
+
+	rng, err := queryDateRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	totalIncome, currency, err := h.Service.GetTotalIncome(userID, rng)
+	if err != nil {
+		if errors.Is(err, service.ErrMissingExchangeRate) {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		http.Error(w, "could not calculate total income", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"income": totalIncome, "currency": currency})
+}
+
+// GetTotalExpense returns the total expense for the logged-in user, optionally within from/to
+func (h *TransactionHandler) GetTotalExpense(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromToken(r)
+	if err != nil {
+		http.Error(w, "could not get user id", http.StatusUnauthorized)
+		return
+	}
+
+	rng, err := queryDateRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	totalExpense, currency, err := h.Service.GetTotalExpense(userID, rng)
+	if err != nil {
+		if errors.Is(err, service.ErrMissingExchangeRate) {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		http.Error(w, "could not calculate total expense", http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(transactions)
+	json.NewEncoder(w).Encode(map[string]interface{}{"expense": totalExpense, "currency": currency})
 }
 
-// GetTotalBalance returns the total balance for the logged-in user
+// GetTotalBalance returns the total balance for the logged-in user, optionally within from/to
 func (h *TransactionHandler) GetTotalBalance(w http.ResponseWriter, r *http.Request) {
 	userID, err := middleware.GetUserIDFromToken(r)
 	if err != nil {
@@ -69,12 +403,174 @@ func (h *TransactionHandler) GetTotalBalance(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	totalBalance, err := h.Service.GetTotalBalance(userID)
+	rng, err := queryDateRange(r)
 	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	totalBalance, currency, err := h.Service.GetTotalBalance(userID, rng)
+	if err != nil {
+		if errors.Is(err, service.ErrMissingExchangeRate) {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
 		http.Error(w, "could not calculate total balance", http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]float64{"balance": totalBalance})
+	json.NewEncoder(w).Encode(map[string]interface{}{"balance": totalBalance, "currency": currency})
+}
+
+// GetCategoryTotals returns income and expense per category for the logged-in
+// user, optionally within from/to; split transactions count per split line
+func (h *TransactionHandler) GetCategoryTotals(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromToken(r)
+	if err != nil {
+		http.Error(w, "could not get user id", http.StatusUnauthorized)
+		return
+	}
+
+	rng, err := queryDateRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	totals, err := h.Service.GetCategoryTotals(userID, rng)
+	if err != nil {
+		if errors.Is(err, service.ErrMissingExchangeRate) {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		http.Error(w, "could not calculate category totals", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(totals)
+}
+
+// GetTagTotals returns income, expense and net per tag for the logged-in
+// user, optionally within from/to
+func (h *TransactionHandler) GetTagTotals(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromToken(r)
+	if err != nil {
+		http.Error(w, "could not get user id", http.StatusUnauthorized)
+		return
+	}
+
+	rng, err := queryDateRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	totals, err := h.Service.GetTagTotals(userID, rng)
+	if err != nil {
+		if errors.Is(err, service.ErrMissingExchangeRate) {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		http.Error(w, "could not calculate tag totals", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(totals)
+}
+
+// GetTopPayees ranks the payees the logged-in user spent most at in a
+// period: this_month (default), last_month, ytd or custom with from/to.
+// limit caps the number of payees.
+func (h *TransactionHandler) GetTopPayees(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromToken(r)
+	if err != nil {
+		http.Error(w, "could not get user id", http.StatusUnauthorized)
+		return
+	}
+
+	rng, err := queryDateRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, err := queryInt(r, "limit")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report, err := h.Service.GetTopPayees(userID, r.URL.Query().Get("period"), rng, limit)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidPeriod) || errors.Is(err, service.ErrCustomPeriodRange) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, service.ErrMissingExchangeRate) {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		http.Error(w, "could not calculate top payees", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// GetSummary returns income, expense, net and savings rate for a period.
+// period is this_month (default), last_month, ytd or custom with from/to.
+func (h *TransactionHandler) GetSummary(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromToken(r)
+	if err != nil {
+		http.Error(w, "could not get user id", http.StatusUnauthorized)
+		return
+	}
+
+	rng, err := queryDateRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	summary, err := h.Service.GetSummary(userID, r.URL.Query().Get("period"), rng)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidPeriod) || errors.Is(err, service.ErrCustomPeriodRange) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, service.ErrMissingExchangeRate) {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		http.Error(w, "could not calculate summary", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summary)
+}
+
+// isTransactionValidationError reports whether err was caused by bad input
+func isTransactionValidationError(err error) bool {
+	return errors.Is(err, service.ErrInvalidTransactionType) ||
+		errors.Is(err, service.ErrAccountNotFound) ||
+		errors.Is(err, service.ErrAccountArchived) ||
+		errors.Is(err, service.ErrTransferAccounts) ||
+		errors.Is(err, service.ErrTransferAmount) ||
+		errors.Is(err, service.ErrTransferTypeChange) ||
+		errors.Is(err, service.ErrTransferSplits) ||
+		errors.Is(err, service.ErrInvalidSplit) ||
+		errors.Is(err, service.ErrSplitsMismatch) ||
+		errors.Is(err, service.ErrInvalidCurrency) ||
+		errors.Is(err, service.ErrInvalidAmount) ||
+		errors.Is(err, service.ErrMissingExchangeRate) ||
+		errors.Is(err, service.ErrCategoryNotFound) ||
+		errors.Is(err, service.ErrCategoryArchived) ||
+		errors.Is(err, service.ErrCategoryKindMismatch) ||
+		errors.Is(err, service.ErrTagNotFound) ||
+		errors.Is(err, service.ErrPayeeNotFound) ||
+		errors.Is(err, service.ErrExternalIDTaken)
 }
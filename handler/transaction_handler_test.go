@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"tracker/middleware"
+	"tracker/models"
+	"tracker/repository"
+	"tracker/service"
+)
+
+// streamRepo streams a fixed number of rows and then fails with err
+type streamRepo struct {
+	repository.TransactionRepository
+	rows int
+	err  error
+}
+
+func (s streamRepo) StreamTransactions(filter models.TransactionFilter, fn func(models.Transaction) error) error {
+	for i := 0; i < s.rows; i++ {
+		if err := fn(models.Transaction{Type: "expense", Note: fmt.Sprintf("row %d with some padding to fill buffers quickly", i)}); err != nil {
+			return err
+		}
+	}
+	return s.err
+}
+
+// withUser runs a request as if AuthMiddleware had let it through
+func withUser(t *testing.T, r *http.Request, userID uint) *http.Request {
+	t.Helper()
+	t.Setenv("JWT_SECRET", "test")
+	token, err := middleware.GenerateJWT(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Authorization", "Bearer "+token)
+	var out *http.Request
+	middleware.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { out = r })).
+		ServeHTTP(httptest.NewRecorder(), r)
+	if out == nil {
+		t.Fatal("token rejected")
+	}
+	return out
+}
+
+func TestExportTransactionsErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		repo   streamRepo
+		status int
+		abort  bool
+	}{
+		{name: "failure before any output", repo: streamRepo{err: errors.New("db down")}, status: http.StatusInternalServerError},
+		{name: "missing rate before any output", repo: streamRepo{err: service.ErrMissingExchangeRate}, status: http.StatusUnprocessableEntity},
+		{name: "failure mid-stream", repo: streamRepo{rows: 1000, err: errors.New("db down")}, abort: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &TransactionHandler{Service: &service.TransactionService{Repo: tt.repo}}
+			req := withUser(t, httptest.NewRequest(http.MethodGet, "/api/transactions/export?format=csv", nil), 1)
+			rec := httptest.NewRecorder()
+
+			aborted := false
+			func() {
+				defer func() {
+					if p := recover(); p != nil {
+						if p != http.ErrAbortHandler {
+							panic(p)
+						}
+						aborted = true
+					}
+				}()
+				h.ExportTransactions(rec, req)
+			}()
+
+			if aborted != tt.abort {
+				t.Fatalf("aborted = %v, want %v", aborted, tt.abort)
+			}
+			if !tt.abort {
+				if rec.Code != tt.status {
+					t.Errorf("status = %d, want %d", rec.Code, tt.status)
+				}
+				if rec.Header().Get("Content-Disposition") != "" {
+					t.Error("an error response is offered as a file download")
+				}
+			}
+		})
+	}
+}
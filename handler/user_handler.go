@@ -2,7 +2,9 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"tracker/middleware"
 	"tracker/models"
 	"tracker/service"
 )
@@ -22,6 +24,10 @@ func (h *UserHandler) RegisterUser(w http.ResponseWriter, r *http.Request) {
 	// Call service layer
 	err = h.Service.RegisterUser(&user)
 	if err != nil {
+		if errors.Is(err, service.ErrInvalidCurrency) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		http.Error(w, "could not register user", http.StatusInternalServerError)
 		return
 	}
@@ -51,3 +57,33 @@ func (h *UserHandler) LoginUser(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"token": token})
 }
+
+// SetBaseCurrency changes the currency the logged-in user's totals and reports are shown in
+func (h *UserHandler) SetBaseCurrency(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Currency string `json:"currency"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := middleware.GetUserIDFromToken(r)
+	if err != nil {
+		http.Error(w, "could not get user id", http.StatusUnauthorized)
+		return
+	}
+
+	currency, err := h.Service.SetBaseCurrency(userID, request.Currency)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidCurrency) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "could not update base currency", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"base_currency": currency})
+}
@@ -1,15 +1,20 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
+	"os"
+	"time"
 
 	"tracker/config"
 	"tracker/database"
 	"tracker/handler"
+	"tracker/notifier"
 	"tracker/repository"
 	"tracker/routes"
 	"tracker/service"
+	"tracker/storage"
 )
 
 func main() {
@@ -21,24 +26,87 @@ func main() {
 	if err != nil {
 		log.Fatalf("db connect: %v", err)
 	}
+	if err := database.Migrate(db); err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	// attachment files live outside the db
+	store, err := storage.FromEnv()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
 
 	// 3) repos (with DB fields added)
-	userRepo := &repository.UserRepo{DB: db}
-	txRepo   := &repository.TransactionRepo{DB: db}
-	budRepo  := &repository.BudgetRepo{DB: db}
+	userRepo  := &repository.UserRepo{DB: db}
+	txRepo    := &repository.TransactionRepo{DB: db}
+	budRepo   := &repository.BudgetRepo{DB: db}
+	alertRepo := &repository.AlertRepo{DB: db}
+	recRepo   := &repository.RecurringRepo{DB: db}
+	accRepo   := &repository.AccountRepo{DB: db}
+	fxRepo    := &repository.ExchangeRateRepo{DB: db}
+	impRepo   := &repository.ImportProfileRepo{DB: db}
+	dupRepo   := &repository.DuplicateRepo{DB: db}
+	idemRepo  := &repository.IdempotencyRepo{DB: db}
+	ruleRepo  := &repository.RuleRepo{DB: db}
+	catRepo   := &repository.CategoryRepo{DB: db}
+	tagRepo   := &repository.TagRepo{DB: db}
+	payRepo   := &repository.PayeeRepo{DB: db}
+	attRepo   := &repository.AttachmentRepo{DB: db}
 
 	// 4) services
-	userSvc := &service.UserService{Repo: userRepo}
-	txSvc   := &service.TransactionService{Repo: txRepo}
-	budSvc  := &service.BudgetService{Repo: budRepo}
+	userSvc  := &service.UserService{Repo: userRepo}
+	fxSvc    := &service.ExchangeService{Repo: fxRepo, Users: userRepo}
+	sugSvc   := &service.SuggestionService{Transactions: txRepo}
+	catSvc   := &service.CategoryService{Repo: catRepo, Suggestions: sugSvc}
+	tagSvc   := &service.TagService{Repo: tagRepo}
+	budSvc   := &service.BudgetService{Repo: budRepo, FX: fxSvc, Categories: catSvc}
+	accSvc   := &service.AccountService{Repo: accRepo, FX: fxSvc}
+	alertSvc := &service.AlertService{
+		Repo:      alertRepo,
+		Budgets:   budSvc,
+		Users:     userRepo,
+		Notifiers: notifier.FromEnv(),
+	}
+	dupSvc   := &service.DuplicateService{Repo: dupRepo, Suggestions: sugSvc}
+	attSvc   := &service.AttachmentService{Repo: attRepo, Transactions: txRepo, Store: store, Secret: []byte(os.Getenv("JWT_SECRET"))}
+	paySvc   := &service.PayeeService{Repo: payRepo, Transactions: txRepo, Categories: catSvc, Suggestions: sugSvc}
+	ruleSvc  := &service.RuleService{Repo: ruleRepo, Transactions: txRepo, Accounts: accSvc, Payees: paySvc, Suggestions: sugSvc, Categories: catSvc, Tags: tagSvc, FX: fxSvc}
+	txSvc    := &service.TransactionService{Repo: txRepo, Alerts: alertSvc, Accounts: accSvc, FX: fxSvc, Budgets: budSvc, Duplicates: dupSvc, Rules: ruleSvc, Suggestions: sugSvc, Categories: catSvc, Tags: tagSvc, Payees: paySvc, Attachments: attSvc}
+	recSvc   := &service.RecurringService{Repo: recRepo, Alerts: alertSvc, Accounts: accSvc, Categories: catSvc, Transactions: txSvc}
+	impSvc   := &service.ImportService{Repo: impRepo, Transactions: txSvc}
+	idemSvc  := &service.IdempotencyService{Repo: idemRepo}
 
 	// 5) handlers
-	userH := &handler.UserHandler{Service: userSvc}
-	txH   := &handler.TransactionHandler{Service: txSvc}
-	budH  := &handler.BudgetHandler{Service: budSvc}
+	ratesPath := os.Getenv("EXCHANGE_RATES_PATH")
+	userH  := &handler.UserHandler{Service: userSvc}
+	txH    := &handler.TransactionHandler{Service: txSvc}
+	budH   := &handler.BudgetHandler{Service: budSvc}
+	alertH := &handler.AlertHandler{Service: alertSvc}
+	recH   := &handler.RecurringHandler{Service: recSvc}
+	accH   := &handler.AccountHandler{Service: accSvc}
+	fxH    := &handler.ExchangeHandler{Service: fxSvc, RatesPath: ratesPath}
+	impH   := &handler.ImportHandler{Service: impSvc}
+	dupH   := &handler.DuplicateHandler{Service: dupSvc}
+	idemH  := &handler.IdempotencyHandler{Service: idemSvc}
+	ruleH  := &handler.RuleHandler{Service: ruleSvc}
+	catH   := &handler.CategoryHandler{Service: catSvc}
+	tagH   := &handler.TagHandler{Service: tagSvc}
+	payH   := &handler.PayeeHandler{Service: paySvc}
+	attH   := &handler.AttachmentHandler{Service: attSvc}
+
+	// 6) background jobs
+	if ratesPath != "" {
+		if n, err := fxSvc.ImportPath(ratesPath); err != nil {
+			log.Printf("exchange rates: %v", err)
+		} else {
+			log.Printf("exchange rates: imported %d rates from %s", n, ratesPath)
+		}
+	}
+	go recSvc.Run(context.Background(), config.GetDuration("RECURRING_INTERVAL", time.Hour))
+	go idemSvc.Run(context.Background(), time.Hour)
 
-	// 6) router
-	r := routes.SetupRouter(userH, txH, budH)
+	// 7) router
+	r := routes.SetupRouter(userH, txH, budH, alertH, recH, accH, fxH, impH, dupH, idemH, ruleH, catH, tagH, payH, attH)
 
 	log.Println("listening on http://localhost:8080")
 	log.Fatal(http.ListenAndServe(":8080", r))
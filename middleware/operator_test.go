@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOperatorMiddleware(t *testing.T) {
+	tests := []struct {
+		name, secret, header string
+		want                 int
+	}{
+		{"not configured", "", "Bearer anything", http.StatusNotFound},
+		{"no token", "s3cret", "", http.StatusUnauthorized},
+		{"wrong token", "s3cret", "Bearer guess", http.StatusUnauthorized},
+		{"user token", "s3cret", "Bearer eyJhbGciOiJIUzI1NiJ9.e30.x", http.StatusUnauthorized},
+		{"operator token", "s3cret", "Bearer s3cret", http.StatusNoContent},
+	}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) })
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("OPERATOR_TOKEN", tt.secret)
+			req := httptest.NewRequest(http.MethodPost, "/admin/rates/reload", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			OperatorMiddleware(next).ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"encoding/json"
+	"tracker/money"
+
+	"gorm.io/gorm"
+)
+
+type Account struct {
+	gorm.Model
+	UserID         uint         `json:"user_id" gorm:"not null;index"`
+	Name           string       `json:"name" gorm:"not null"`
+	Type           string       `json:"type" gorm:"not null"` // cash, checking, savings, credit, loan or investment
+	OpeningBalance money.Amount `json:"opening_balance" gorm:"not null;default:0"`
+	Currency       string       `json:"currency" gorm:"not null;default:USD"`
+	Archived       bool         `json:"archived" gorm:"not null;default:false"`
+}
+
+// AccountBalance is an account together with its current balance
+type AccountBalance struct {
+	AccountID uint         `json:"account_id"`
+	Name      string       `json:"name"`
+	Type      string       `json:"type"`
+	Currency  string       `json:"currency"`
+	Archived  bool         `json:"archived"`
+	Balance   money.Amount `json:"balance"` // opening balance plus income and transfers in, minus expenses and transfers out
+
+	// The same balance converted into the user's base currency
+	BaseBalance  money.Amount `json:"base_balance"`
+	BaseCurrency string       `json:"base_currency"`
+}
+
+// MarshalJSON writes the opening balance in the decimal places of the currency
+func (a Account) MarshalJSON() ([]byte, error) {
+	type plain Account
+	return json.Marshal(struct {
+		*plain
+		OpeningBalance json.RawMessage `json:"opening_balance"`
+	}{(*plain)(&a), amountJSON(a.OpeningBalance, a.Currency)})
+}
+
+// UnmarshalJSON reads the opening balance in the decimal places of the
+// currency sent along, or with two decimals when there is none
+func (a *Account) UnmarshalJSON(b []byte) error {
+	type plain Account
+	in := struct {
+		*plain
+		OpeningBalance json.RawMessage `json:"opening_balance"`
+	}{plain: (*plain)(a)}
+	if err := json.Unmarshal(b, &in); err != nil {
+		return err
+	}
+	var err error
+	a.OpeningBalance, err = parseAmountJSON(in.OpeningBalance, a.OpeningBalance, a.Currency)
+	return err
+}
+
+// MarshalJSON writes each balance in the decimal places of its currency
+func (a AccountBalance) MarshalJSON() ([]byte, error) {
+	type plain AccountBalance
+	return json.Marshal(struct {
+		*plain
+		Balance     json.RawMessage `json:"balance"`
+		BaseBalance json.RawMessage `json:"base_balance"`
+	}{(*plain)(&a), amountJSON(a.Balance, a.Currency), amountJSON(a.BaseBalance, a.BaseCurrency)})
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"tracker/money"
+
+	"gorm.io/gorm"
+)
+
+// Alert records that a budget crossed one of its thresholds in a period.
+// The unique index makes each threshold fire at most once per period.
+type Alert struct {
+	gorm.Model
+	UserID      uint         `json:"user_id" gorm:"not null;index"`
+	BudgetID    uint         `json:"budget_id" gorm:"not null;uniqueIndex:idx_alert_once"`
+	Threshold   int          `json:"threshold" gorm:"not null;uniqueIndex:idx_alert_once"`
+	PeriodStart time.Time    `json:"period_start" gorm:"not null;uniqueIndex:idx_alert_once"`
+	Category    string       `json:"category" gorm:"not null"`
+	Amount      money.Amount `json:"amount" gorm:"not null"` // effective budget amount for the period
+	Spent       money.Amount `json:"spent" gorm:"not null"`
+	Currency    string       `json:"currency" gorm:"not null;default:USD"` // of the budget report, the user's base currency
+	Message     string       `json:"message" gorm:"not null"`
+}
+
+// MarshalJSON writes the amounts in the decimal places of the currency
+func (a Alert) MarshalJSON() ([]byte, error) {
+	type plain Alert
+	return json.Marshal(struct {
+		*plain
+		Amount json.RawMessage `json:"amount"`
+		Spent  json.RawMessage `json:"spent"`
+	}{(*plain)(&a), amountJSON(a.Amount, a.Currency), amountJSON(a.Spent, a.Currency)})
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"tracker/money"
+)
+
+// amountJSON writes an amount as a decimal string in the decimal places of
+// its currency
+func amountJSON(a money.Amount, currency string) json.RawMessage {
+	return json.RawMessage(strconv.Quote(a.Format(currency)))
+}
+
+// optionalAmountJSON is amountJSON for amounts that may be left out
+func optionalAmountJSON(a *money.Amount, currency string) json.RawMessage {
+	if a == nil {
+		return nil
+	}
+	return amountJSON(*a, currency)
+}
+
+// parseAmountJSON reads an amount in the decimal places of its currency;
+// when the amount was not sent at all, it keeps the current value
+func parseAmountJSON(raw json.RawMessage, current money.Amount, currency string) (money.Amount, error) {
+	if raw == nil {
+		return current, nil
+	}
+	return money.ParseJSON(raw, currency)
+}
+
+// parseOptionalAmountJSON is parseAmountJSON for amounts that may be left
+// out; null clears them
+func parseOptionalAmountJSON(raw json.RawMessage, current *money.Amount, currency string) (*money.Amount, error) {
+	if raw == nil {
+		return current, nil
+	}
+	if string(raw) == "null" {
+		return nil, nil
+	}
+	a, err := money.ParseJSON(raw, currency)
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
@@ -0,0 +1,25 @@
+package models
+
+import "gorm.io/gorm"
+
+// Attachment is a receipt or other document kept with a transaction. The
+// file itself lives in the blob store under StorageKey; images also get a
+// small JPEG preview under ThumbnailKey.
+type Attachment struct {
+	gorm.Model
+	UserID        uint   `json:"user_id" gorm:"not null;index"`
+	TransactionID uint   `json:"transaction_id" gorm:"not null;index"`
+	FileName      string `json:"file_name" gorm:"not null"`
+	ContentType   string `json:"content_type" gorm:"not null"`
+	Size          int64  `json:"size"`
+	Checksum      string `json:"checksum"` // hex SHA-256 of the contents
+	StorageKey    string `json:"-" gorm:"not null"`
+	ThumbnailKey  string `json:"-"`
+	HasThumbnail  bool   `json:"has_thumbnail"`
+}
+
+// AttachmentLink is a download URL that works without a token until it expires
+type AttachmentLink struct {
+	URL       string `json:"url"`
+	ExpiresAt int64  `json:"expires_at"` // Unix seconds
+}
@@ -1,10 +1,138 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"encoding/json"
+	"time"
+
+	"tracker/money"
+
+	"gorm.io/gorm"
+)
 
 type Budget struct {
 	gorm.Model
-	UserID   uint    `json:"user_id" gorm:"not null"`
-	Category string  `json:"category" gorm:"not null"`
-	Amount   float64 `json:"amount" gorm:"not null"`
+	UserID    uint         `json:"user_id" gorm:"not null"`
+	Category  string       `json:"category" gorm:"not null"`
+	Amount    money.Amount `json:"amount" gorm:"not null"`
+	Currency  string       `json:"currency" gorm:"not null;default:USD"`
+	Period    string       `json:"period" gorm:"not null;default:monthly"` // weekly, monthly, quarterly, yearly or custom
+	StartDate *time.Time   `json:"start_date,omitempty"`                   // custom periods only
+	EndDate   *time.Time   `json:"end_date,omitempty"`                     // custom periods only, inclusive
+	Rollover  string       `json:"rollover" gorm:"not null;default:none"`  // none, surplus, deficit or both
+
+	// CategoryID links the expense category; spending on its subcategories counts too
+	CategoryID *uint `json:"category_id,omitempty" gorm:"index"`
+
+	// Thresholds are the percentages of the budget that raise an alert once reached
+	Thresholds Percentages `json:"thresholds" gorm:"not null;default:'50,80,100'"`
+}
+
+// SpendWindow asks for the expenses of one category and its subcategories
+// between From (inclusive) and To (exclusive). Without a CategoryID the
+// category is matched by name.
+type SpendWindow struct {
+	CategoryID uint
+	Category   string
+	From       time.Time
+	To         time.Time
+}
+
+// BudgetReport compares a budget against what was actually spent in its current period
+type BudgetReport struct {
+	BudgetID       uint         `json:"budget_id"`
+	Category       string       `json:"category"`
+	Period         string       `json:"period"`
+	PeriodStart    time.Time    `json:"period_start"`
+	PeriodEnd      time.Time    `json:"period_end"`
+	Amount         money.Amount `json:"amount"`
+	Currency       string       `json:"currency"` // the user's base currency, all amounts are converted into it
+	Spent          money.Amount `json:"spent"`
+	Remaining      money.Amount `json:"remaining"`
+	PercentUsed    float64      `json:"percent_used"`
+	ProjectedSpend money.Amount `json:"projected_spend"` // spend at the end of the period if the current pace holds
+
+	Rollover        string         `json:"rollover"`
+	CarriedIn       money.Amount   `json:"carried_in"`               // brought over from the previous period
+	EffectiveAmount money.Amount   `json:"effective_amount"`         // amount plus carried_in
+	RolloverChain   []RolloverStep `json:"rollover_chain,omitempty"` // the last 12 periods at most, each against today's amount
+}
+
+// RolloverStep is one past period in a budget's rollover history
+type RolloverStep struct {
+	PeriodStart     time.Time    `json:"period_start"`
+	PeriodEnd       time.Time    `json:"period_end"`
+	CarriedIn       money.Amount `json:"carried_in"`
+	EffectiveAmount money.Amount `json:"effective_amount"`
+	Spent           money.Amount `json:"spent"`
+	CarriedOut      money.Amount `json:"carried_out"`
+}
+
+// MarshalJSON writes the amount in the decimal places of the currency
+func (b Budget) MarshalJSON() ([]byte, error) {
+	type plain Budget
+	return json.Marshal(struct {
+		*plain
+		Amount json.RawMessage `json:"amount"`
+	}{(*plain)(&b), amountJSON(b.Amount, b.Currency)})
+}
+
+// UnmarshalJSON reads the amount in the decimal places of the currency sent
+// along, or with two decimals when there is none
+func (b *Budget) UnmarshalJSON(data []byte) error {
+	type plain Budget
+	in := struct {
+		*plain
+		Amount json.RawMessage `json:"amount"`
+	}{plain: (*plain)(b)}
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	var err error
+	b.Amount, err = parseAmountJSON(in.Amount, b.Amount, b.Currency)
+	return err
+}
+
+// rolloverStepJSON is the JSON form of a rollover step
+type rolloverStepJSON struct {
+	*plainRolloverStep
+	CarriedIn       json.RawMessage `json:"carried_in"`
+	EffectiveAmount json.RawMessage `json:"effective_amount"`
+	Spent           json.RawMessage `json:"spent"`
+	CarriedOut      json.RawMessage `json:"carried_out"`
+}
+
+type plainRolloverStep RolloverStep
+
+// MarshalJSON writes the amounts in the decimal places of the currency
+func (r BudgetReport) MarshalJSON() ([]byte, error) {
+	type plain BudgetReport
+	out := struct {
+		*plain
+		Amount          json.RawMessage    `json:"amount"`
+		Spent           json.RawMessage    `json:"spent"`
+		Remaining       json.RawMessage    `json:"remaining"`
+		ProjectedSpend  json.RawMessage    `json:"projected_spend"`
+		CarriedIn       json.RawMessage    `json:"carried_in"`
+		EffectiveAmount json.RawMessage    `json:"effective_amount"`
+		RolloverChain   []rolloverStepJSON `json:"rollover_chain,omitempty"`
+	}{
+		plain:           (*plain)(&r),
+		Amount:          amountJSON(r.Amount, r.Currency),
+		Spent:           amountJSON(r.Spent, r.Currency),
+		Remaining:       amountJSON(r.Remaining, r.Currency),
+		ProjectedSpend:  amountJSON(r.ProjectedSpend, r.Currency),
+		CarriedIn:       amountJSON(r.CarriedIn, r.Currency),
+		EffectiveAmount: amountJSON(r.EffectiveAmount, r.Currency),
+	}
+	for i := range r.RolloverChain {
+		step := r.RolloverChain[i]
+		out.RolloverChain = append(out.RolloverChain, rolloverStepJSON{
+			plainRolloverStep: (*plainRolloverStep)(&step),
+			CarriedIn:         amountJSON(step.CarriedIn, r.Currency),
+			EffectiveAmount:   amountJSON(step.EffectiveAmount, r.Currency),
+			Spent:             amountJSON(step.Spent, r.Currency),
+			CarriedOut:        amountJSON(step.CarriedOut, r.Currency),
+		})
+	}
+	return json.Marshal(out)
 }
@@ -0,0 +1,17 @@
+package models
+
+import "gorm.io/gorm"
+
+// Category groups transactions and budgets. Categories nest: what is booked
+// on a subcategory also counts towards its parents in budgets and reports.
+// Names are unique per user and kind, ignoring case.
+type Category struct {
+	gorm.Model
+	UserID   uint   `json:"user_id" gorm:"not null;index"`
+	Name     string `json:"name" gorm:"not null"`
+	Kind     string `json:"kind" gorm:"not null"` // income or expense, like the transactions it takes
+	ParentID *uint  `json:"parent_id,omitempty" gorm:"index"`
+	Icon     string `json:"icon,omitempty"`
+	Color    string `json:"color,omitempty"`                        // #rrggbb
+	Archived bool   `json:"archived" gorm:"not null;default:false"` // kept for history, not offered for new entries
+}
@@ -0,0 +1,17 @@
+package models
+
+import "gorm.io/gorm"
+
+// DuplicateCandidate records that a transaction looks like a duplicate of an
+// earlier one. Each pair is recorded once, so a dismissed pair stays dismissed.
+type DuplicateCandidate struct {
+	gorm.Model
+	UserID        uint    `json:"user_id" gorm:"not null;index"`
+	TransactionID uint    `json:"transaction_id" gorm:"not null;uniqueIndex:idx_duplicate_pair"` // the later entry
+	DuplicateOfID uint    `json:"duplicate_of_id" gorm:"not null;uniqueIndex:idx_duplicate_pair;index"`
+	Score         float64 `json:"score" gorm:"not null"`                     // 0 to 1, how alike the two are
+	Status        string  `json:"status" gorm:"not null;default:open;index"` // open, merged or dismissed
+
+	Transaction *Transaction `json:"transaction,omitempty" gorm:"foreignKey:TransactionID"`
+	DuplicateOf *Transaction `json:"duplicate_of,omitempty" gorm:"foreignKey:DuplicateOfID"`
+}
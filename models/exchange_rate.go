@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// ExchangeRate is a reference rate: one EUR buys Rate units of Currency on Date.
+// Rates are quoted against EUR because that is how the ECB publishes them;
+// any other pair is crossed through EUR.
+type ExchangeRate struct {
+	ID       uint      `json:"-" gorm:"primarykey"`
+	Date     time.Time `json:"date" gorm:"type:date;not null;uniqueIndex:idx_rate_day"`
+	Currency string    `json:"currency" gorm:"size:3;not null;uniqueIndex:idx_rate_day"`
+	Rate     float64   `json:"rate" gorm:"type:numeric(20,10);not null"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// IdempotencyKey remembers the response to a write request sent with an
+// Idempotency-Key header, so a client retrying it gets the same answer
+// instead of booking twice. Keys are scoped per user.
+type IdempotencyKey struct {
+	ID          uint      `json:"id" gorm:"primarykey"`
+	UserID      uint      `json:"user_id" gorm:"not null;uniqueIndex:idx_idempotency_key"`
+	Key         string    `json:"key" gorm:"not null;size:255;uniqueIndex:idx_idempotency_key"`
+	RequestHash string    `json:"request_hash" gorm:"not null"`          // sha256 of method, path, query and body
+	StatusCode  int       `json:"status_code" gorm:"not null;default:0"` // 0 while the first request is still running
+	ContentType string    `json:"content_type" gorm:"not null;default:''"`
+	Body        []byte    `json:"-"`
+	CreatedAt   time.Time `json:"created_at"`
+	ExpiresAt   time.Time `json:"expires_at" gorm:"not null;index"` // end of the lease while StatusCode is 0
+}
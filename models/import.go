@@ -0,0 +1,106 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"tracker/money"
+
+	"gorm.io/gorm"
+)
+
+// ImportProfile is a saved description of how a bank's CSV export maps onto transactions.
+// Columns are header names, or 1-based column numbers for files without a header row.
+type ImportProfile struct {
+	gorm.Model
+	UserID           uint   `json:"user_id" gorm:"not null;index"`
+	Name             string `json:"name" gorm:"not null"`
+	Encoding         string `json:"encoding" gorm:"not null;default:utf-8"` // any WHATWG label, e.g. utf-8, windows-1252, iso-8859-1, utf-16le
+	Delimiter        string `json:"delimiter" gorm:"not null;default:','"`
+	HasHeader        bool   `json:"has_header" gorm:"not null"`
+	SkipRows         int    `json:"skip_rows" gorm:"not null;default:0"`            // lines before the header (or data), e.g. bank preambles
+	DateFormat       string `json:"date_format" gorm:"not null;default:YYYY-MM-DD"` // YYYY, YY, MM, M, DD, D and literal separators
+	DecimalSeparator string `json:"decimal_separator" gorm:"not null;default:'.'"`  // "." or ","; the other one is taken as thousands separator
+	AmountMode       string `json:"amount_mode" gorm:"not null;default:signed"`     // signed or debit_credit
+
+	DateColumn     string `json:"date_column" gorm:"not null"`
+	AmountColumn   string `json:"amount_column,omitempty"` // signed mode: negative amounts are expenses
+	DebitColumn    string `json:"debit_column,omitempty"`  // debit_credit mode: money out
+	CreditColumn   string `json:"credit_column,omitempty"` // debit_credit mode: money in
+	NoteColumn     string `json:"note_column,omitempty"`
+	CategoryColumn string `json:"category_column,omitempty"`
+	CurrencyColumn string `json:"currency_column,omitempty"`
+
+	// Defaults for every imported row
+	AccountID       *uint  `json:"account_id,omitempty" gorm:"index"`
+	DefaultCategory string `json:"default_category"`
+}
+
+// ImportRow is one parsed entry of an import file, with the reasons it cannot be imported.
+// Line is the line of a CSV record, or the position of the entry in other formats.
+type ImportRow struct {
+	Line        int         `json:"line"`
+	Transaction Transaction `json:"transaction"`
+	Duplicate   bool        `json:"duplicate,omitempty"` // already imported before, skipped
+	Errors      []string    `json:"errors,omitempty"`
+
+	// Counterpart is the receiving leg when Transaction is the sending leg of
+	// a transfer; both amounts are positive until they are booked
+	Counterpart *Transaction `json:"counterpart,omitempty"`
+}
+
+// ImportResult reports what an import did, or would do on a dry run
+type ImportResult struct {
+	DryRun   bool        `json:"dry_run"`
+	Total    int         `json:"total"`
+	Valid    int         `json:"valid"`
+	Invalid  int         `json:"invalid"`
+	Skipped  int         `json:"skipped"` // duplicates of earlier imports
+	Imported int         `json:"imported"`
+	Rows     []ImportRow `json:"rows"`
+
+	// Budgets a journal carried that were added, or would be on a dry run;
+	// ones matching an existing budget's category and period are left out
+	Budgets []Budget `json:"budgets,omitempty"`
+
+	// Statement formats carry balances to reconcile against; AccountBalance
+	// is what the account holds now, after the import unless it was a dry run
+	Statements      []StatementBalance `json:"statements,omitempty"`
+	AccountBalance  *money.Amount      `json:"account_balance,omitempty"`
+	AccountCurrency string             `json:"account_currency,omitempty"`
+}
+
+// MarshalJSON writes the account balance in the decimal places of the
+// account's currency
+func (r ImportResult) MarshalJSON() ([]byte, error) {
+	type plain ImportResult
+	return json.Marshal(struct {
+		*plain
+		AccountBalance json.RawMessage `json:"account_balance,omitempty"`
+	}{(*plain)(&r), optionalAmountJSON(r.AccountBalance, r.AccountCurrency)})
+}
+
+// StatementBalance summarizes one bank statement of an import file
+type StatementBalance struct {
+	StatementID    string       `json:"statement_id"`
+	Account        string       `json:"account,omitempty"` // IBAN or account number as printed on the statement
+	Currency       string       `json:"currency"`
+	OpeningDate    *time.Time   `json:"opening_date,omitempty"`
+	OpeningBalance money.Amount `json:"opening_balance"`
+	ClosingDate    *time.Time   `json:"closing_date,omitempty"`
+	ClosingBalance money.Amount `json:"closing_balance"`
+	Entries        int          `json:"entries"`
+	Movement       money.Amount `json:"movement"`   // booked credits minus debits
+	Reconciled     bool         `json:"reconciled"` // both balances given, and opening plus movement equals closing
+}
+
+// MarshalJSON writes the balances in the decimal places of the currency
+func (b StatementBalance) MarshalJSON() ([]byte, error) {
+	type plain StatementBalance
+	return json.Marshal(struct {
+		*plain
+		OpeningBalance json.RawMessage `json:"opening_balance"`
+		ClosingBalance json.RawMessage `json:"closing_balance"`
+		Movement       json.RawMessage `json:"movement"`
+	}{(*plain)(&b), amountJSON(b.OpeningBalance, b.Currency), amountJSON(b.ClosingBalance, b.Currency), amountJSON(b.Movement, b.Currency)})
+}
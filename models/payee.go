@@ -0,0 +1,72 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"tracker/money"
+
+	"gorm.io/gorm"
+)
+
+// Payee is a merchant or other party money is paid to or received from.
+// Statements spell the same payee many ways, so raw note text is recognized
+// by the payee's aliases, and its name as whole words. Names are unique per
+// user, ignoring case.
+type Payee struct {
+	gorm.Model
+	UserID  uint         `json:"user_id" gorm:"not null;index"`
+	Name    string       `json:"name" gorm:"not null"`
+	Aliases []PayeeAlias `json:"aliases,omitempty" gorm:"serializer:json;type:text"`
+
+	// CategoryID is booked on transactions of this payee that neither carry
+	// a category nor get one from a rule, if it is of the transaction's kind
+	CategoryID *uint `json:"category_id,omitempty" gorm:"index"`
+}
+
+// PayeeAlias is one spelling of a payee in statement text
+type PayeeAlias struct {
+	MatchType string `json:"match_type"` // contains (case-insensitive, the default) or regex
+	Pattern   string `json:"pattern"`
+}
+
+// PayeeTotal is what was spent at one payee, in the base currency
+type PayeeTotal struct {
+	PayeeID uint         `json:"payee_id"`
+	Payee   string       `json:"payee"`
+	Total   money.Amount `json:"total"`
+	Count   int64        `json:"count"`
+}
+
+// PayeeReport ranks the payees most was spent at in a period
+type PayeeReport struct {
+	Period   string       `json:"period"`
+	From     time.Time    `json:"from"`
+	To       time.Time    `json:"to"`
+	Currency string       `json:"currency"`
+	Payees   []PayeeTotal `json:"payees"`
+}
+
+// MarshalJSON writes the totals in the decimal places of the currency
+func (r PayeeReport) MarshalJSON() ([]byte, error) {
+	type plain PayeeReport
+	type plainTotal PayeeTotal
+	type total struct {
+		*plainTotal
+		Total json.RawMessage `json:"total"`
+	}
+	payees := make([]total, len(r.Payees))
+	for i := range r.Payees {
+		payees[i] = total{(*plainTotal)(&r.Payees[i]), amountJSON(r.Payees[i].Total, r.Currency)}
+	}
+	return json.Marshal(struct {
+		*plain
+		Payees []total `json:"payees"`
+	}{(*plain)(&r), payees})
+}
+
+// PayeeApplyResult reports what matching past transactions to payees did
+type PayeeApplyResult struct {
+	Scanned int `json:"scanned"`
+	Updated int `json:"updated"`
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Percentages is a list of whole percentages stored as comma separated text
+type Percentages []int
+
+// GormDataType tells gorm which column type to use
+func (Percentages) GormDataType() string {
+	return "text"
+}
+
+// Value implements driver.Valuer
+func (p Percentages) Value() (driver.Value, error) {
+	parts := make([]string, len(p))
+	for i, v := range p {
+		parts[i] = strconv.Itoa(v)
+	}
+	return strings.Join(parts, ","), nil
+}
+
+// Scan implements sql.Scanner
+func (p *Percentages) Scan(src interface{}) error {
+	var s string
+	switch v := src.(type) {
+	case nil:
+		*p = nil
+		return nil
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return fmt.Errorf("cannot scan %T into Percentages", src)
+	}
+
+	out := Percentages{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return fmt.Errorf("scan percentages: %w", err)
+		}
+		out = append(out, n)
+	}
+	*p = out
+	return nil
+}
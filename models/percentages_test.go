@@ -0,0 +1,43 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPercentagesRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		src  interface{}
+		want Percentages
+	}{
+		{"text", "50,80,100", Percentages{50, 80, 100}},
+		{"bytes with spaces", []byte(" 50, 120 "), Percentages{50, 120}},
+		{"empty", "", Percentages{}},
+		{"null", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p Percentages
+			if err := p.Scan(tt.src); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(p, tt.want) {
+				t.Fatalf("Scan(%v) = %v, want %v", tt.src, p, tt.want)
+			}
+			v, err := p.Value()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var back Percentages
+			if err := back.Scan(v); err != nil || len(back) != len(p) {
+				t.Errorf("round trip of %v gave %v, %v", p, back, err)
+			}
+		})
+	}
+
+	var p Percentages
+	if err := p.Scan("50,most"); err == nil {
+		t.Error("Scan accepted a non-number")
+	}
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"tracker/money"
+
+	"gorm.io/gorm"
+)
+
+// RecurringTransaction is a template that the scheduler turns into real
+// transactions on every occurrence of its schedule
+type RecurringTransaction struct {
+	gorm.Model
+	UserID    uint         `json:"user_id" gorm:"not null;index"`
+	Type      string       `json:"type" gorm:"not null"` // income or expense
+	Category  string       `json:"category" gorm:"not null"`
+	Amount    money.Amount `json:"amount" gorm:"not null"`
+	Currency  string       `json:"currency" gorm:"not null;default:USD"`
+	Note      string       `json:"note" gorm:"not null"`
+	AccountID *uint        `json:"account_id,omitempty"`
+
+	CategoryID *uint `json:"category_id,omitempty"` // looked up by name when left out, like on transactions
+
+	// Schedule, modelled on RRULE: FREQ, INTERVAL, BYMONTHDAY, UNTIL and COUNT
+	Frequency       string     `json:"frequency" gorm:"not null"`          // daily, weekly, monthly or yearly
+	Interval        int        `json:"interval" gorm:"not null;default:1"` // every N days/weeks/months/years
+	DayOfMonth      int        `json:"day_of_month"`                       // monthly only; 0 means the start date's day
+	LastBusinessDay bool       `json:"last_business_day"`                  // monthly only; last Monday-Friday of the month
+	StartDate       time.Time  `json:"start_date" gorm:"not null"`
+	EndDate         *time.Time `json:"end_date,omitempty"` // inclusive
+	Count           int        `json:"count"`              // total occurrences, 0 means unlimited
+
+	// Scheduler state
+	NextIndex int        `json:"-" gorm:"not null;default:0"`
+	Generated int        `json:"generated" gorm:"not null;default:0"`
+	LastRun   *time.Time `json:"last_run,omitempty"`
+	NextRun   *time.Time `json:"next_run,omitempty" gorm:"index"`    // nil once the schedule has ended or was stopped
+	Failures  int        `json:"failures" gorm:"not null;default:0"` // runs in a row whose occurrences failed the checks
+	LastError string     `json:"last_error,omitempty"`               // why the last run failed
+}
+
+// MarshalJSON writes the amount in the decimal places of the currency
+func (r RecurringTransaction) MarshalJSON() ([]byte, error) {
+	type plain RecurringTransaction
+	return json.Marshal(struct {
+		*plain
+		Amount json.RawMessage `json:"amount"`
+	}{(*plain)(&r), amountJSON(r.Amount, r.Currency)})
+}
+
+// UnmarshalJSON reads the amount in the decimal places of the currency sent
+// along, or with two decimals when there is none
+func (r *RecurringTransaction) UnmarshalJSON(b []byte) error {
+	type plain RecurringTransaction
+	in := struct {
+		*plain
+		Amount json.RawMessage `json:"amount"`
+	}{plain: (*plain)(r)}
+	if err := json.Unmarshal(b, &in); err != nil {
+		return err
+	}
+	var err error
+	r.Amount, err = parseAmountJSON(in.Amount, r.Amount, r.Currency)
+	return err
+}
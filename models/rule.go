@@ -0,0 +1,103 @@
+package models
+
+import (
+	"encoding/json"
+	"tracker/money"
+
+	"gorm.io/gorm"
+)
+
+// CategoryRule assigns a category and tags to transactions that meet all of
+// its conditions. Conditions left empty match everything; a rule needs at
+// least one. Rules run in ascending Priority, then creation order.
+type CategoryRule struct {
+	gorm.Model
+	UserID   uint   `json:"user_id" gorm:"not null;index"`
+	Name     string `json:"name" gorm:"not null"`
+	Priority int    `json:"priority" gorm:"not null;default:0"` // lower runs first
+	Disabled bool   `json:"disabled" gorm:"not null;default:false"`
+
+	// Conditions. Pattern is matched against the note, which carries the
+	// payee on imported entries; PayeeID against the payee the transaction
+	// was linked to. Amounts are compared inclusively in Currency, the user's
+	// base currency unless given; transactions in other currencies are
+	// converted at the rates of their date, and never match without one.
+	MatchType string        `json:"match_type" gorm:"not null;default:contains"` // contains (case-insensitive) or regex
+	Pattern   string        `json:"pattern,omitempty"`
+	MinAmount *money.Amount `json:"min_amount,omitempty"`
+	MaxAmount *money.Amount `json:"max_amount,omitempty"`
+	Currency  string        `json:"currency,omitempty"` // of MinAmount and MaxAmount
+	AccountID *uint         `json:"account_id,omitempty" gorm:"index"`
+	PayeeID   *uint         `json:"payee_id,omitempty" gorm:"index"`
+	Type      string        `json:"type,omitempty"` // income or expense
+
+	// Actions
+	Category string   `json:"category,omitempty"`
+	Tags     []string `json:"tags,omitempty" gorm:"serializer:json;type:text"`
+}
+
+// MarshalJSON writes the amounts in the decimal places of the currency
+func (r CategoryRule) MarshalJSON() ([]byte, error) {
+	type plain CategoryRule
+	return json.Marshal(struct {
+		*plain
+		MinAmount json.RawMessage `json:"min_amount,omitempty"`
+		MaxAmount json.RawMessage `json:"max_amount,omitempty"`
+	}{(*plain)(&r), optionalAmountJSON(r.MinAmount, r.Currency), optionalAmountJSON(r.MaxAmount, r.Currency)})
+}
+
+// UnmarshalJSON reads the amounts in the decimal places of the currency sent
+// along, or with two decimals when there is none
+func (r *CategoryRule) UnmarshalJSON(b []byte) error {
+	type plain CategoryRule
+	in := struct {
+		*plain
+		MinAmount json.RawMessage `json:"min_amount"`
+		MaxAmount json.RawMessage `json:"max_amount"`
+	}{plain: (*plain)(r)}
+	if err := json.Unmarshal(b, &in); err != nil {
+		return err
+	}
+	var err error
+	if r.MinAmount, err = parseOptionalAmountJSON(in.MinAmount, r.MinAmount, r.Currency); err != nil {
+		return err
+	}
+	r.MaxAmount, err = parseOptionalAmountJSON(in.MaxAmount, r.MaxAmount, r.Currency)
+	return err
+}
+
+// RuleMatch is a transaction a rule matches and what the rule would change
+type RuleMatch struct {
+	TransactionID uint         `json:"transaction_id"`
+	Date          string       `json:"date"`
+	Type          string       `json:"type"`
+	Amount        money.Amount `json:"amount"`
+	Currency      string       `json:"currency"`
+	Note          string       `json:"note"`
+	Category      string       `json:"category"`
+	NewCategory   string       `json:"new_category"`
+	Tags          []string     `json:"tags,omitempty"`
+	NewTags       []string     `json:"new_tags,omitempty"`
+}
+
+// MarshalJSON writes the amount in the decimal places of the currency
+func (m RuleMatch) MarshalJSON() ([]byte, error) {
+	type plain RuleMatch
+	return json.Marshal(struct {
+		*plain
+		Amount json.RawMessage `json:"amount"`
+	}{(*plain)(&m), amountJSON(m.Amount, m.Currency)})
+}
+
+// RuleTestResult reports how a rule fares against a user's history
+type RuleTestResult struct {
+	Scanned int         `json:"scanned"`
+	Matched int         `json:"matched"`
+	Matches []RuleMatch `json:"matches"` // the most recent ones, up to the limit
+}
+
+// RuleApplyResult reports what re-applying the rules to past transactions did
+type RuleApplyResult struct {
+	Scanned int `json:"scanned"`
+	Updated int `json:"updated"`
+}
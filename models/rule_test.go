@@ -0,0 +1,55 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"tracker/money"
+)
+
+func TestCategoryRuleJSON(t *testing.T) {
+	tests := []struct {
+		in       string
+		min, max int64 // -1 when left out
+		out      string
+	}{
+		{`{"min_amount":"1000","max_amount":"5000","currency":"JPY"}`, 1000, 5000, `{"min_amount":"1000","max_amount":"5000"}`},
+		{`{"min_amount":"10","currency":"EUR"}`, 1000, -1, `{"min_amount":"10.00"}`},
+		{`{"max_amount":"12.50"}`, -1, 1250, `{"max_amount":"12.50"}`},
+		{`{"pattern":"acme"}`, -1, -1, `{}`},
+	}
+	for _, tt := range tests {
+		var rule CategoryRule
+		if err := json.Unmarshal([]byte(tt.in), &rule); err != nil {
+			t.Errorf("Unmarshal(%s): %v", tt.in, err)
+			continue
+		}
+		if !sameAmount(rule.MinAmount, tt.min) || !sameAmount(rule.MaxAmount, tt.max) {
+			t.Errorf("Unmarshal(%s) = %v, %v, want %d, %d", tt.in, rule.MinAmount, rule.MaxAmount, tt.min, tt.max)
+			continue
+		}
+
+		b, err := json.Marshal(rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got, want map[string]json.RawMessage
+		if err := json.Unmarshal(b, &got); err != nil {
+			t.Fatal(err)
+		}
+		json.Unmarshal([]byte(tt.out), &want)
+		for _, key := range []string{"min_amount", "max_amount"} {
+			if string(got[key]) != string(want[key]) {
+				t.Errorf("Marshal(%s) %s = %s, want %s", tt.in, key, got[key], want[key])
+			}
+		}
+	}
+}
+
+// sameAmount compares an optional amount with minor units, -1 meaning nil
+func sameAmount(a *money.Amount, want int64) bool {
+	if a == nil {
+		return want == -1
+	}
+	return a.Minor() == want
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"encoding/json"
+
+	"tracker/money"
+
+	"gorm.io/gorm"
+)
+
+// Tag labels transactions across categories, e.g. a trip or a project. A
+// transaction can carry any number of tags. Names are unique per user,
+// ignoring case.
+type Tag struct {
+	gorm.Model
+	UserID uint   `json:"user_id" gorm:"not null;index"`
+	Name   string `json:"name" gorm:"not null"`
+	Color  string `json:"color,omitempty"` // #rrggbb
+}
+
+// UnmarshalJSON also accepts a tag given by its bare name, so the tags of a
+// transaction can be sent as ["japan-2026"]
+func (t *Tag) UnmarshalJSON(b []byte) error {
+	var name string
+	if err := json.Unmarshal(b, &name); err == nil {
+		*t = Tag{Name: name}
+		return nil
+	}
+	type plain Tag
+	return json.Unmarshal(b, (*plain)(t))
+}
+
+// TagTotal is what was booked on transactions carrying one tag, in the base
+// currency. A transaction with several tags counts towards each of them.
+type TagTotal struct {
+	TagID    uint         `json:"tag_id"`
+	Tag      string       `json:"tag"`
+	Income   money.Amount `json:"income"`
+	Expense  money.Amount `json:"expense"`
+	Net      money.Amount `json:"net"`
+	Count    int64        `json:"count"`
+	Currency string       `json:"currency"`
+}
+
+// MarshalJSON writes the totals in the decimal places of the currency
+func (t TagTotal) MarshalJSON() ([]byte, error) {
+	type plain TagTotal
+	return json.Marshal(struct {
+		*plain
+		Income  json.RawMessage `json:"income"`
+		Expense json.RawMessage `json:"expense"`
+		Net     json.RawMessage `json:"net"`
+	}{(*plain)(&t), amountJSON(t.Income, t.Currency), amountJSON(t.Expense, t.Currency), amountJSON(t.Net, t.Currency)})
+}
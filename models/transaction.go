@@ -1,12 +1,216 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"encoding/json"
+	"time"
+
+	"tracker/money"
+
+	"gorm.io/gorm"
+)
 
 type Transaction struct {
 	gorm.Model
-	UserID   uint    `json:"user_id" gorm:"not null"`
-	Type     string  `json:"type" gorm:"not null"` // income or expense
-	Category string  `json:"category" gorm:"not null"`
-	Amount   float64 `json:"amount" gorm:"not null"`
-	Note     string  `json:"note" gorm:"not null"`
+	UserID   uint         `json:"user_id" gorm:"not null"`
+	Type     string       `json:"type" gorm:"not null"` // income, expense or transfer
+	Category string       `json:"category" gorm:"not null"`
+	Amount   money.Amount `json:"amount" gorm:"not null"`
+	Currency string       `json:"currency" gorm:"not null;default:USD"`
+	Note     string       `json:"note" gorm:"not null"`
+	Date     time.Time    `json:"date" gorm:"not null;index;uniqueIndex:idx_recurring_occurrence;default:CURRENT_TIMESTAMP"` // when the money moved, not when it was entered
+
+	// CategoryID links the category Category names; when it is left out the
+	// category is looked up by name, and created if the user has none of that
+	// name yet. Transfers have no category.
+	CategoryID *uint `json:"category_id,omitempty" gorm:"index"`
+
+	// ValueDate is when the bank started or stopped paying interest on the
+	// money, if it differs from the booking date; bank statements carry it
+	ValueDate *time.Time `json:"value_date,omitempty"`
+
+	// AccountID is the wallet the money moved in or out of, if any
+	AccountID *uint `json:"account_id,omitempty" gorm:"index"`
+
+	// Transfers are booked as two legs of type transfer that point at each
+	// other: a negative amount on the source account and a positive one on
+	// the destination. ToAccountID is only used when creating a transfer.
+	LinkedID    *uint `json:"linked_id,omitempty" gorm:"index"`
+	ToAccountID *uint `json:"to_account_id,omitempty" gorm:"-"`
+
+	// RecurringID links an occurrence to the RecurringTransaction that created it
+	RecurringID *uint `json:"recurring_id,omitempty" gorm:"uniqueIndex:idx_recurring_occurrence"`
+
+	// ExternalID is the bank's identifier of an imported entry (an OFX FITID,
+	// for instance); an entry is only imported once per account
+	ExternalID string `json:"external_id,omitempty" gorm:"index"`
+
+	// PayeeID links the payee the money went to or came from. When neither
+	// it nor Payee is sent, the note is matched against the user's payees.
+	PayeeID *uint  `json:"payee_id,omitempty" gorm:"index"`
+	Payee   string `json:"payee,omitempty"`
+
+	// Tags label the transaction on top of its category, e.g. with a trip.
+	// They are looked up by name when sent without an ID, and created if the
+	// user has none of that name yet. Transfers carry no tags.
+	Tags []Tag `json:"tags,omitempty" gorm:"many2many:transaction_tags"`
+
+	// PossibleDuplicates lists earlier transactions this one looks like a
+	// duplicate of; it is only filled in on create and import
+	PossibleDuplicates []uint `json:"possible_duplicates,omitempty" gorm:"-"`
+
+	// Splits spread the amount over several categories; when present they
+	// must add up to Amount and replace Category in every per-category figure
+	Splits []TransactionSplit `json:"splits,omitempty" gorm:"constraint:OnDelete:CASCADE"`
+}
+
+// transactionJSON is the JSON form of a transaction, with the amounts
+// written in the decimal places of its currency
+type transactionJSON struct {
+	*plainTransaction
+	Amount json.RawMessage `json:"amount"`
+	Splits []splitJSON     `json:"splits,omitempty"`
+}
+
+type plainTransaction Transaction
+
+// splitJSON is the JSON form of a split line
+type splitJSON struct {
+	plainSplit
+	Amount json.RawMessage `json:"amount"`
+}
+
+type plainSplit TransactionSplit
+
+// MarshalJSON writes the amounts in the decimal places of the currency
+func (t Transaction) MarshalJSON() ([]byte, error) {
+	out := transactionJSON{plainTransaction: (*plainTransaction)(&t), Amount: amountJSON(t.Amount, t.Currency)}
+	for _, split := range t.Splits {
+		out.Splits = append(out.Splits, splitJSON{plainSplit(split), amountJSON(split.Amount, t.Currency)})
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON reads the amounts in the decimal places of the currency sent
+// along, or with two decimals when there is none
+func (t *Transaction) UnmarshalJSON(b []byte) error {
+	in := transactionJSON{plainTransaction: (*plainTransaction)(t)}
+	if err := json.Unmarshal(b, &in); err != nil {
+		return err
+	}
+	var err error
+	if t.Amount, err = parseAmountJSON(in.Amount, t.Amount, t.Currency); err != nil {
+		return err
+	}
+	if in.Splits == nil {
+		return nil
+	}
+	t.Splits = make([]TransactionSplit, len(in.Splits))
+	for i, s := range in.Splits {
+		t.Splits[i] = TransactionSplit(s.plainSplit)
+		if t.Splits[i].Amount, err = parseAmountJSON(s.Amount, 0, t.Currency); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TransactionSplit is one category line of a split transaction
+type TransactionSplit struct {
+	ID            uint         `json:"id" gorm:"primarykey"`
+	TransactionID uint         `json:"transaction_id" gorm:"not null;index"`
+	Category      string       `json:"category" gorm:"not null"`
+	CategoryID    *uint        `json:"category_id,omitempty" gorm:"index"`
+	Amount        money.Amount `json:"amount" gorm:"not null"`
+	Note          string       `json:"note" gorm:"not null;default:''"`
+}
+
+// CategoryTotal is the amount booked on one category. Total includes the
+// subcategories, so only the totals without a parent add up to everything.
+type CategoryTotal struct {
+	Category   string       `json:"category"`
+	CategoryID *uint        `json:"category_id,omitempty"`
+	ParentID   *uint        `json:"parent_id,omitempty"`
+	Type       string       `json:"type"`
+	Total      money.Amount `json:"total"`
+	Direct     money.Amount `json:"direct"` // booked on the category itself
+	Currency   string       `json:"currency"`
+}
+
+// MarshalJSON writes the totals in the decimal places of the currency
+func (c CategoryTotal) MarshalJSON() ([]byte, error) {
+	type plain CategoryTotal
+	return json.Marshal(struct {
+		*plain
+		Total  json.RawMessage `json:"total"`
+		Direct json.RawMessage `json:"direct"`
+	}{(*plain)(&c), amountJSON(c.Total, c.Currency), amountJSON(c.Direct, c.Currency)})
+}
+
+// TransactionFilter narrows down, orders and pages a transaction listing.
+// From is inclusive and To is exclusive; nil pointers mean "no bound".
+type TransactionFilter struct {
+	UserID    uint
+	From      *time.Time
+	To        *time.Time
+	Type      string
+	Category  string
+	AccountID *uint
+	MinAmount *money.Amount
+	MaxAmount *money.Amount
+	Currency  string   // of MinAmount and MaxAmount; other transactions are converted into it
+	Note      string   // case-insensitive substring match
+	Tags      []string // tag names, ignoring case
+	AllTags   bool     // with several Tags, only match transactions carrying all of them
+	SortBy    string   // date, amount or created_at
+	SortDesc  bool
+	Limit     int
+	After     *TransactionCursor
+}
+
+// TransactionCursor marks the last row of the previous page
+type TransactionCursor struct {
+	Value string `json:"v"` // value of the sort column, formatted as text
+	ID    uint   `json:"id"`
+}
+
+// TransactionPage is one page of a transaction listing
+type TransactionPage struct {
+	Transactions []Transaction `json:"transactions"`
+	NextCursor   string        `json:"next_cursor,omitempty"`
+}
+
+// DateRange is an optional time window; From is inclusive, To is exclusive
+type DateRange struct {
+	From *time.Time
+	To   *time.Time
+}
+
+// Summary holds the income/expense figures for a period
+type Summary struct {
+	Period      string       `json:"period"`
+	From        time.Time    `json:"from"`
+	To          time.Time    `json:"to"`
+	Income      money.Amount `json:"income"`
+	Expense     money.Amount `json:"expense"`
+	Net         money.Amount `json:"net"`
+	Currency    string       `json:"currency"`
+	SavingsRate float64      `json:"savings_rate"` // net as a percentage of income
+}
+
+// MarshalJSON writes the figures in the decimal places of the currency
+func (s Summary) MarshalJSON() ([]byte, error) {
+	type plain Summary
+	return json.Marshal(struct {
+		*plain
+		Income  json.RawMessage `json:"income"`
+		Expense json.RawMessage `json:"expense"`
+		Net     json.RawMessage `json:"net"`
+	}{(*plain)(&s), amountJSON(s.Income, s.Currency), amountJSON(s.Expense, s.Currency), amountJSON(s.Net, s.Currency)})
+}
+
+// CategorySuggestion is a category a transaction likely belongs to, learned
+// from the user's history
+type CategorySuggestion struct {
+	Category   string  `json:"category"`
+	Confidence float64 `json:"confidence"` // 0 to 1; the suggestions of one transaction add up to about 1
 }
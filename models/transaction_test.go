@@ -0,0 +1,52 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestTransactionJSON(t *testing.T) {
+	tests := []struct {
+		in        string
+		amount    int64
+		split     int64
+		formatted string
+	}{
+		{`{"amount":"12.50","currency":"EUR","splits":[{"amount":"2.50"}]}`, 1250, 250, `"12.50"`},
+		{`{"amount":1500,"currency":"JPY","splits":[{"amount":"500"}]}`, 1500, 500, `"1500"`},
+		{`{"amount":"1.25","currency":"kwd","splits":[{"amount":"0.005"}]}`, 1250, 5, `"1.250"`},
+		{`{"amount":"12.50","splits":[{"amount":"2.50"}]}`, 1250, 250, `"12.50"`},
+		{`{"amount":"12.50","currency":"EUR","splits":[{"id":7,"category":"Food","amount":"2.50"}]}`, 1250, 250, `"12.50"`},
+	}
+	for _, tt := range tests {
+		var tx Transaction
+		if err := json.Unmarshal([]byte(tt.in), &tx); err != nil {
+			t.Errorf("Unmarshal(%s): %v", tt.in, err)
+			continue
+		}
+		if tx.Amount.Minor() != tt.amount || len(tx.Splits) != 1 || tx.Splits[0].Amount.Minor() != tt.split {
+			t.Errorf("Unmarshal(%s) = %d, %v, want %d with a split of %d", tt.in, tx.Amount, tx.Splits, tt.amount, tt.split)
+			continue
+		}
+
+		b, err := json.Marshal(tx)
+		if err != nil {
+			t.Errorf("Marshal(%s): %v", tt.in, err)
+			continue
+		}
+		var out map[string]json.RawMessage
+		if err := json.Unmarshal(b, &out); err != nil {
+			t.Fatal(err)
+		}
+		if string(out["amount"]) != tt.formatted {
+			t.Errorf("Marshal(%s) amount = %s, want %s", tt.in, out["amount"], tt.formatted)
+		}
+	}
+
+	for _, in := range []string{`{"amount":"12.5","currency":"JPY"}`, `{"amount":"1.2345","currency":"KWD"}`} {
+		var tx Transaction
+		if err := json.Unmarshal([]byte(in), &tx); err == nil {
+			t.Errorf("Unmarshal(%s) succeeded", in)
+		}
+	}
+}
@@ -4,9 +4,10 @@ import "gorm.io/gorm"
 
 type User struct {
 	gorm.Model
-	Username string `json:"username" gorm:"unique;not null"`
-	Email    string `json:"email" gorm:"unique;not null"`
-	Password string `json:"password" gorm:"not null"`
+	Username     string `json:"username" gorm:"unique;not null"`
+	Email        string `json:"email" gorm:"unique;not null"`
+	Password     string `json:"password" gorm:"not null"`
+	BaseCurrency string `json:"base_currency" gorm:"not null;default:USD"` // totals and reports are converted into it
 }
 
 type LoginRequest struct {
@@ -0,0 +1,314 @@
+// Package money holds the fixed-point type used for every amount of money.
+//
+// Amounts are kept as integer minor units of the currency named next to them
+// (cents of EUR, yen of JPY, fils of KWD), so sums never drift the way
+// float64 does. How many minor units make a major one depends on the
+// currency; see Exponent. Amounts are stored as bigint and travel over JSON as
+// decimal strings such as "12.34", written in their currency's decimal places
+// by the types that carry the currency. An amount without a currency is read
+// and written with two decimals.
+package money
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// exponents lists the ISO 4217 currencies whose minor unit is not a
+// hundredth, by the number of decimal places they use
+var exponents = map[string]int{
+	// no minor unit
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0,
+	"KRW": 0, "PYG": 0, "RWF": 0, "UGX": 0, "UYI": 0, "VND": 0, "VUV": 0,
+	"XAF": 0, "XOF": 0, "XPF": 0,
+	// thousandths
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+	// ten-thousandths
+	"CLF": 4, "UYW": 4,
+}
+
+// Exponent returns the number of decimal places of an ISO 4217 currency,
+// which is 2 for currencies not listed and for no currency at all
+func Exponent(currency string) int {
+	if e, ok := exponents[strings.ToUpper(currency)]; ok {
+		return e
+	}
+	return 2
+}
+
+// Exponents returns the currencies whose exponent is not 2, for code that
+// has to know them outside Go, such as SQL functions
+func Exponents() map[string]int {
+	out := make(map[string]int, len(exponents))
+	for c, e := range exponents {
+		out[c] = e
+	}
+	return out
+}
+
+var ErrInvalidAmount = errors.New("invalid amount: use a decimal with no more decimal places than its currency has")
+
+// Amount is an exact amount of money in minor units
+type Amount int64
+
+// Parse reads a decimal string such as "12", "-3.5" or "1234.56" with at
+// most two decimal places
+func Parse(s string) (Amount, error) {
+	return ParseIn(s, "")
+}
+
+// ParseIn reads a decimal string into minor units of currency, e.g. "1500"
+// yen or "1.250" dinars; it may not have more decimal places than the
+// currency
+func ParseIn(s, currency string) (Amount, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, ErrInvalidAmount
+	}
+
+	neg := false
+	switch s[0] {
+	case '-':
+		neg = true
+		s = s[1:]
+	case '+':
+		s = s[1:]
+	}
+
+	whole, frac, hasDot := strings.Cut(s, ".")
+	if whole == "" && (!hasDot || frac == "") {
+		return 0, ErrInvalidAmount
+	}
+	if hasDot && frac == "" {
+		return 0, ErrInvalidAmount
+	}
+
+	// Extra decimals are fine as long as they are zeros ("1.500")
+	exp := Exponent(currency)
+	if len(frac) > exp {
+		if strings.Trim(frac[exp:], "0") != "" {
+			return 0, ErrInvalidAmount
+		}
+		frac = frac[:exp]
+	}
+	for len(frac) < exp {
+		frac += "0"
+	}
+
+	if whole == "" {
+		whole = "0"
+	}
+	if !isDigits(whole) || (exp > 0 && !isDigits(frac)) {
+		return 0, ErrInvalidAmount
+	}
+
+	scale := pow10(exp)
+	w, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || w > math.MaxInt64/scale-1 {
+		return 0, ErrInvalidAmount
+	}
+	var f int64
+	if exp > 0 {
+		f, _ = strconv.ParseInt(frac, 10, 64)
+	}
+
+	v := Amount(w*scale + f)
+	if neg {
+		v = -v
+	}
+	return v, nil
+}
+
+// MustParse is Parse for constants; it panics on bad input
+func MustParse(s string) Amount {
+	return MustParseIn(s, "")
+}
+
+// MustParseIn is ParseIn for constants; it panics on bad input
+func MustParseIn(s, currency string) Amount {
+	a, err := ParseIn(s, currency)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+// FromMinor builds an amount from minor units
+func FromMinor(minor int64) Amount {
+	return Amount(minor)
+}
+
+// Minor returns the amount in minor units
+func (a Amount) Minor() int64 {
+	return int64(a)
+}
+
+// Major returns the amount in major units of its currency; only use it for
+// ratios and magnitudes, never for sums
+func (a Amount) Major(currency string) float64 {
+	return float64(a) / float64(pow10(Exponent(currency)))
+}
+
+// MulRatio scales the amount by a ratio, rounding half away from zero
+func (a Amount) MulRatio(r float64) Amount {
+	return Amount(math.Round(float64(a) * r))
+}
+
+// Convert converts an amount of currency from into currency to, where rate
+// is what one major unit of from buys in major units of to; the result is
+// rounded to the minor unit of to
+func (a Amount) Convert(from, to string, rate float64) Amount {
+	return a.MulRatio(rate * math.Pow10(Exponent(to)-Exponent(from)))
+}
+
+// Rescale reads the amount, written in minor units of from, as the same
+// decimal in minor units of to: 1500.00 of no currency becomes 1500 yen. It
+// fails when to has too few decimal places for the amount.
+func (a Amount) Rescale(from, to string) (Amount, error) {
+	diff := Exponent(to) - Exponent(from)
+	switch {
+	case diff > 0:
+		scale := pow10(diff)
+		if a > math.MaxInt64/Amount(scale) || a < math.MinInt64/Amount(scale) {
+			return 0, ErrInvalidAmount
+		}
+		return a * Amount(scale), nil
+	case diff < 0:
+		scale := Amount(pow10(-diff))
+		if a%scale != 0 {
+			return 0, ErrInvalidAmount
+		}
+		return a / scale, nil
+	}
+	return a, nil
+}
+
+// Abs returns the absolute value
+func (a Amount) Abs() Amount {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
+// String formats the amount with two decimals, such as "-12.05"
+func (a Amount) String() string {
+	return a.Format("")
+}
+
+// Format writes the amount in the decimal places of currency, such as
+// "-12.05", "1500" for yen or "1.250" for dinars
+func (a Amount) Format(currency string) string {
+	sign := ""
+	v := int64(a)
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	exp := Exponent(currency)
+	if exp == 0 {
+		return sign + strconv.FormatInt(v, 10)
+	}
+	scale := pow10(exp)
+	return fmt.Sprintf("%s%d.%0*d", sign, v/scale, exp, v%scale)
+}
+
+// MarshalJSON emits the amount as a decimal string
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(a.String())), nil
+}
+
+// UnmarshalJSON accepts a decimal string or a plain JSON number
+func (a *Amount) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		return nil
+	}
+	v, err := ParseJSON(b, "")
+	if err != nil {
+		return err
+	}
+	*a = v
+	return nil
+}
+
+// ParseJSON reads a JSON decimal string or number into minor units of
+// currency; null reads as zero. Types that carry the currency of their
+// amounts use it to decode them.
+func ParseJSON(b []byte, currency string) (Amount, error) {
+	s := string(b)
+	if s == "null" {
+		return 0, nil
+	}
+	if unq, err := strconv.Unquote(s); err == nil {
+		s = unq
+	}
+	return ParseIn(s, currency)
+}
+
+// GormDataType tells gorm which column type to use
+func (Amount) GormDataType() string {
+	return "bigint"
+}
+
+// Value implements driver.Valuer
+func (a Amount) Value() (driver.Value, error) {
+	return int64(a), nil
+}
+
+// Scan implements sql.Scanner. Sums of bigint columns come back as numeric,
+// so text is accepted too.
+func (a *Amount) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*a = 0
+	case int64:
+		*a = Amount(v)
+	case []byte:
+		return a.scanText(string(v))
+	case string:
+		return a.scanText(v)
+	default:
+		return fmt.Errorf("cannot scan %T into money.Amount", src)
+	}
+	return nil
+}
+
+// scanText parses a whole number of minor units
+func (a *Amount) scanText(s string) error {
+	// numeric results may carry a zero fraction, e.g. "1234.0000"
+	if whole, frac, ok := strings.Cut(s, "."); ok && strings.Trim(frac, "0") == "" {
+		s = whole
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return fmt.Errorf("scan money.Amount: %w", err)
+	}
+	*a = Amount(v)
+	return nil
+}
+
+// isDigits reports whether s is a non-empty run of ASCII digits
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// pow10 returns 10 to the power of a small exponent
+func pow10(exp int) int64 {
+	v := int64(1)
+	for i := 0; i < exp; i++ {
+		v *= 10
+	}
+	return v
+}
@@ -0,0 +1,298 @@
+package money
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Amount
+	}{
+		{"12", 1200},
+		{"-3.5", -350},
+		{"+3.5", 350},
+		{"1234.56", 123456},
+		{".5", 50},
+		{" 0.01 ", 1},
+		{"1.500", 150},
+		{"-0", 0},
+		{"92233720368547757", 9223372036854775700},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.in)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Parse(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+
+	for _, in := range []string{"", "-", ".", "1.", "1.234", "1,50", "1e3", "--1", "0x10", "12 34", "92233720368547758"} {
+		if _, err := Parse(in); err != ErrInvalidAmount {
+			t.Errorf("Parse(%q): err = %v, want ErrInvalidAmount", in, err)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		in   Amount
+		want string
+	}{
+		{0, "0.00"},
+		{5, "0.05"},
+		{-5, "-0.05"},
+		{123456, "1234.56"},
+		{-1200, "-12.00"},
+	}
+	for _, tt := range tests {
+		if got := tt.in.String(); got != tt.want {
+			t.Errorf("Amount(%d).String() = %q, want %q", tt.in, got, tt.want)
+		}
+		if back, err := Parse(tt.want); err != nil || back != tt.in {
+			t.Errorf("Parse(%q) = %d, %v, want %d", tt.want, back, err, tt.in)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Amount
+	}{
+		{`"12.30"`, 1230},
+		{`12.3`, 1230},
+		{`-7`, -700},
+		{`null`, 0},
+	}
+	for _, tt := range tests {
+		var a Amount
+		if err := a.UnmarshalJSON([]byte(tt.in)); err != nil {
+			t.Errorf("UnmarshalJSON(%s): %v", tt.in, err)
+			continue
+		}
+		if a != tt.want {
+			t.Errorf("UnmarshalJSON(%s) = %d, want %d", tt.in, a, tt.want)
+		}
+	}
+
+	var a Amount
+	if err := a.UnmarshalJSON([]byte(`"12.345"`)); err != ErrInvalidAmount {
+		t.Errorf("UnmarshalJSON of three decimals: err = %v, want ErrInvalidAmount", err)
+	}
+	if b, _ := Amount(-1205).MarshalJSON(); string(b) != `"-12.05"` {
+		t.Errorf("MarshalJSON = %s, want \"-12.05\"", b)
+	}
+}
+
+func TestScan(t *testing.T) {
+	tests := []struct {
+		src  interface{}
+		want Amount
+	}{
+		{nil, 0},
+		{int64(1230), 1230},
+		{[]byte("1230"), 1230},
+		{"-1230.0000", -1230},
+	}
+	for _, tt := range tests {
+		a := Amount(99)
+		if err := a.Scan(tt.src); err != nil {
+			t.Errorf("Scan(%v): %v", tt.src, err)
+			continue
+		}
+		if a != tt.want {
+			t.Errorf("Scan(%v) = %d, want %d", tt.src, a, tt.want)
+		}
+	}
+
+	for _, src := range []interface{}{"12.5", 1.5, "abc"} {
+		var a Amount
+		if err := a.Scan(src); err == nil {
+			t.Errorf("Scan(%v) succeeded", src)
+		}
+	}
+}
+
+func TestMulRatio(t *testing.T) {
+	tests := []struct {
+		in    Amount
+		ratio float64
+		want  Amount
+	}{
+		{1000, 1.1, 1100},
+		{1, 0.5, 1},
+		{-1, 0.5, -1},
+		{3, 1.0 / 3, 1},
+		{0, 7, 0},
+	}
+	for _, tt := range tests {
+		if got := tt.in.MulRatio(tt.ratio); got != tt.want {
+			t.Errorf("Amount(%d).MulRatio(%g) = %d, want %d", tt.in, tt.ratio, got, tt.want)
+		}
+	}
+}
+
+func TestExponent(t *testing.T) {
+	tests := []struct {
+		currency string
+		want     int
+	}{
+		{"EUR", 2},
+		{"USD", 2},
+		{"JPY", 0},
+		{"KRW", 0},
+		{"KWD", 3},
+		{"CLF", 4},
+	}
+	for _, tt := range tests {
+		if got := Exponent(tt.currency); got != tt.want {
+			t.Errorf("Exponent(%s) = %d, want %d", tt.currency, got, tt.want)
+		}
+	}
+}
+
+func TestParseIn(t *testing.T) {
+	tests := []struct {
+		in, currency string
+		want         Amount
+	}{
+		{"1500", "JPY", 1500},
+		{"1.250", "KWD", 1250},
+		{"1.25", "kwd", 1250},
+		{"0.0001", "CLF", 1},
+		{"12.30", "EUR", 1230},
+		{"12.30", "XYZ", 1230},
+	}
+	for _, tt := range tests {
+		got, err := ParseIn(tt.in, tt.currency)
+		if err != nil {
+			t.Errorf("ParseIn(%q, %s): %v", tt.in, tt.currency, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseIn(%q, %s) = %d, want %d", tt.in, tt.currency, got, tt.want)
+		}
+	}
+
+	invalid := []struct{ in, currency string }{
+		{"12.5", "JPY"},
+		{"1.2345", "KWD"},
+		{"1.234", "EUR"},
+	}
+	for _, tt := range invalid {
+		if _, err := ParseIn(tt.in, tt.currency); err != ErrInvalidAmount {
+			t.Errorf("ParseIn(%q, %s): err = %v, want ErrInvalidAmount", tt.in, tt.currency, err)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		in       Amount
+		currency string
+		want     string
+	}{
+		{1500, "JPY", "1500"},
+		{-1500, "JPY", "-1500"},
+		{1250, "KWD", "1.250"},
+		{-5, "KWD", "-0.005"},
+		{1, "CLF", "0.0001"},
+		{1230, "EUR", "12.30"},
+	}
+	for _, tt := range tests {
+		if got := tt.in.Format(tt.currency); got != tt.want {
+			t.Errorf("Amount(%d).Format(%s) = %q, want %q", tt.in, tt.currency, got, tt.want)
+		}
+		if back, err := ParseIn(tt.want, tt.currency); err != nil || back != tt.in {
+			t.Errorf("ParseIn(%q, %s) = %d, %v, want %d", tt.want, tt.currency, back, err, tt.in)
+		}
+	}
+}
+
+func TestRescale(t *testing.T) {
+	tests := []struct {
+		in       Amount
+		from, to string
+		want     Amount
+		err      error
+	}{
+		{150000, "", "JPY", 1500, nil},
+		{150050, "", "JPY", 0, ErrInvalidAmount},
+		{1250, "", "KWD", 12500, nil},
+		{1250, "EUR", "USD", 1250, nil},
+		{1500, "JPY", "EUR", 150000, nil},
+		{Amount(math.MaxInt64 / 5), "", "KWD", 0, ErrInvalidAmount},
+	}
+	for _, tt := range tests {
+		got, err := tt.in.Rescale(tt.from, tt.to)
+		if err != tt.err {
+			t.Errorf("Amount(%d).Rescale(%q, %q): err = %v, want %v", tt.in, tt.from, tt.to, err, tt.err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Amount(%d).Rescale(%q, %q) = %d, want %d", tt.in, tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		in       Amount
+		from, to string
+		rate     float64
+		want     Amount
+	}{
+		{1000, "EUR", "USD", 1.1, 1100},
+		{1000, "EUR", "JPY", 160, 1600},
+		{1600, "JPY", "EUR", 1.0 / 160, 1000},
+		{1000, "EUR", "KWD", 0.33, 3300},
+		{3300, "KWD", "EUR", 1 / 0.33, 1000},
+	}
+	for _, tt := range tests {
+		if got := tt.in.Convert(tt.from, tt.to, tt.rate); got != tt.want {
+			t.Errorf("Amount(%d).Convert(%s, %s, %g) = %d, want %d", tt.in, tt.from, tt.to, tt.rate, got, tt.want)
+		}
+	}
+}
+
+func TestMajor(t *testing.T) {
+	if got := Amount(1500).Major("JPY"); got != 1500 {
+		t.Errorf("Major(JPY) = %g, want 1500", got)
+	}
+	if got := Amount(1250).Major("KWD"); got != 1.25 {
+		t.Errorf("Major(KWD) = %g, want 1.25", got)
+	}
+	if got := Amount(1250).Major("EUR"); got != 12.5 {
+		t.Errorf("Major(EUR) = %g, want 12.5", got)
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	tests := []struct {
+		in, currency string
+		want         Amount
+	}{
+		{`"1500"`, "JPY", 1500},
+		{`1500`, "JPY", 1500},
+		{`"1.250"`, "KWD", 1250},
+		{`null`, "KWD", 0},
+	}
+	for _, tt := range tests {
+		got, err := ParseJSON([]byte(tt.in), tt.currency)
+		if err != nil {
+			t.Errorf("ParseJSON(%s, %s): %v", tt.in, tt.currency, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseJSON(%s, %s) = %d, want %d", tt.in, tt.currency, got, tt.want)
+		}
+	}
+	if _, err := ParseJSON([]byte(`"12.5"`), "JPY"); err != ErrInvalidAmount {
+		t.Errorf("ParseJSON of yen with decimals: err = %v, want ErrInvalidAmount", err)
+	}
+}
@@ -0,0 +1,61 @@
+package notifier
+
+import (
+	"context"
+	"log"
+	"os"
+
+	"tracker/models"
+)
+
+// Notification is a message about an alert addressed to one user
+type Notification struct {
+	Email   string
+	Subject string
+	Body    string
+	Alert   models.Alert
+}
+
+// Notifier delivers notifications somewhere
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// LogNotifier writes notifications to the standard logger
+type LogNotifier struct{}
+
+// Notify logs the notification
+func (LogNotifier) Notify(_ context.Context, n Notification) error {
+	log.Printf("alert for user %d: %s", n.Alert.UserID, n.Body)
+	return nil
+}
+
+// FromEnv builds the notifiers configured through environment variables.
+// The log notifier is always on; webhook and SMTP are enabled by
+// NOTIFY_WEBHOOK_URL and SMTP_HOST respectively.
+func FromEnv() []Notifier {
+	notifiers := []Notifier{LogNotifier{}}
+
+	if url := os.Getenv("NOTIFY_WEBHOOK_URL"); url != "" {
+		notifiers = append(notifiers, &WebhookNotifier{URL: url})
+	}
+
+	if host := os.Getenv("SMTP_HOST"); host != "" {
+		notifiers = append(notifiers, &SMTPNotifier{
+			Host:     host,
+			Port:     getenv("SMTP_PORT", "25"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     getenv("SMTP_FROM", "tracker@localhost"),
+		})
+	}
+	return notifiers
+}
+
+// small helper for defaults
+func getenv(k, def string) string {
+	if v := os.Getenv(k); v != "" {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,121 @@
+package notifier
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSMTP accepts one connection and plays a minimal SMTP server, sending
+// what it received on the returned channel. With mute set it never greets.
+func fakeSMTP(t *testing.T, mute bool) (host, port string, received <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	out := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if mute {
+			time.Sleep(2 * time.Second)
+			return
+		}
+
+		var session strings.Builder
+		r := bufio.NewReader(conn)
+		reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+		reply("220 fake ESMTP")
+		inData := false
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				out <- session.String()
+				return
+			}
+			session.WriteString(line)
+			cmd := strings.ToUpper(strings.TrimSpace(line))
+			switch {
+			case inData:
+				if cmd == "." {
+					inData = false
+					reply("250 queued")
+				}
+			case strings.HasPrefix(cmd, "EHLO"):
+				reply("250 fake")
+			case cmd == "DATA":
+				inData = true
+				reply("354 go ahead")
+			case cmd == "QUIT":
+				reply("221 bye")
+				out <- session.String()
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+	host, port, _ = net.SplitHostPort(ln.Addr().String())
+	return host, port, out
+}
+
+func TestSMTPNotify(t *testing.T) {
+	host, port, received := fakeSMTP(t, false)
+	s := &SMTPNotifier{Host: host, Port: port, From: "tracker@localhost"}
+
+	err := s.Notify(context.Background(), Notification{
+		Email:   "user@example.com",
+		Subject: "Budget alert\r\nBcc: victim@example.com",
+		Body:    "You spent 80% of Groceries.",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session := <-received
+	for _, want := range []string{"MAIL FROM:<tracker@localhost>", "RCPT TO:<user@example.com>", "To: user@example.com\r\n", "You spent 80% of Groceries."} {
+		if !strings.Contains(session, want) {
+			t.Errorf("session lacks %q:\n%s", want, session)
+		}
+	}
+	if strings.Contains(session, "\r\nBcc:") {
+		t.Errorf("subject started a new header:\n%s", session)
+	}
+}
+
+func TestSMTPNotifyRejectsHeaderInjection(t *testing.T) {
+	host, port, _ := fakeSMTP(t, false)
+	s := &SMTPNotifier{Host: host, Port: port, From: "tracker@localhost"}
+
+	err := s.Notify(context.Background(), Notification{Email: "user@example.com\r\nBcc: victim@example.com", Subject: "x"})
+	if err == nil {
+		t.Fatal("address with a line break was accepted")
+	}
+	if got := string(s.message(Notification{Email: "a@example.com\r\nBcc: b@example.com"})); strings.Contains(got, "\r\nBcc:") {
+		t.Errorf("To header was not sanitised:\n%s", got)
+	}
+}
+
+func TestSMTPNotifyStopsAtDeadline(t *testing.T) {
+	host, port, _ := fakeSMTP(t, true)
+	s := &SMTPNotifier{Host: host, Port: port, From: "tracker@localhost"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := s.Notify(ctx, Notification{Email: "user@example.com"}); err == nil {
+		t.Fatal("Notify succeeded against a server that never answers")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Notify took %s, want it to give up at the deadline", elapsed)
+	}
+}
@@ -0,0 +1,42 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"tracker/models"
+)
+
+func TestWebhookNotifier(t *testing.T) {
+	var got map[string]interface{}
+	status := http.StatusNoContent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("request = %s %s, want a JSON POST", r.Method, r.Header.Get("Content-Type"))
+		}
+		got = nil
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	w := &WebhookNotifier{URL: srv.URL}
+	n := Notification{Subject: "Budget alert: Food at 80%", Body: "Food budget reached 80%", Alert: models.Alert{BudgetID: 3, Threshold: 80}}
+	if err := w.Notify(context.Background(), n); err != nil {
+		t.Fatal(err)
+	}
+	alert, _ := got["alert"].(map[string]interface{})
+	if got["subject"] != n.Subject || got["message"] != n.Body || alert["threshold"] != float64(80) {
+		t.Errorf("payload = %v", got)
+	}
+
+	status = http.StatusBadGateway
+	if err := w.Notify(context.Background(), n); err == nil {
+		t.Error("a failing webhook was not reported")
+	}
+}
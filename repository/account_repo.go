@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"tracker/models"
+
+	"gorm.io/gorm"
+)
+
+type AccountRepo struct{ DB *gorm.DB }
+
+type AccountRepository interface {
+	CreateAccount(account *models.Account) error
+	GetAccountsByUserID(userID uint, includeArchived bool) ([]models.Account, error)
+	GetAccountByID(id uint) (*models.Account, error)
+	UpdateAccount(account *models.Account) error
+	CheckAccountExistsForUser(id uint, userID uint) bool
+	CountTransactions(id uint) (int64, error)
+	DeleteAccount(id uint) error
+	GetAccountBalances(userID uint, base string, includeArchived bool) ([]models.AccountBalance, error)
+}
+
+// CreateAccount inserts a new account
+func (r *AccountRepo) CreateAccount(account *models.Account) error {
+	return r.DB.Create(account).Error
+}
+
+// GetAccountsByUserID fetches the accounts of a user
+func (r *AccountRepo) GetAccountsByUserID(userID uint, includeArchived bool) ([]models.Account, error) {
+	var accounts []models.Account
+	q := r.DB.Where("user_id = ?", userID)
+	if !includeArchived {
+		q = q.Where("archived = ?", false)
+	}
+	if err := q.Order("name").Find(&accounts).Error; err != nil {
+		return nil, err
+	}
+	return accounts, nil
+}
+
+// GetAccountByID fetches a single account
+func (r *AccountRepo) GetAccountByID(id uint) (*models.Account, error) {
+	var account models.Account
+	if err := r.DB.First(&account, id).Error; err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// UpdateAccount updates an account
+func (r *AccountRepo) UpdateAccount(account *models.Account) error {
+	return r.DB.Save(account).Error
+}
+
+// CheckAccountExistsForUser checks if an account exists for a given user
+func (r *AccountRepo) CheckAccountExistsForUser(id uint, userID uint) bool {
+	var count int64
+	r.DB.Model(&models.Account{}).
+		Where("id = ? AND user_id = ?", id, userID).
+		Count(&count)
+	return count > 0
+}
+
+// CountTransactions counts the transactions booked on an account
+func (r *AccountRepo) CountTransactions(id uint) (int64, error) {
+	var count int64
+	err := r.DB.Model(&models.Transaction{}).Where("account_id = ?", id).Count(&count).Error
+	return count, err
+}
+
+// DeleteAccount deletes an account by ID
+func (r *AccountRepo) DeleteAccount(id uint) error {
+	return r.DB.Where("id = ?", id).Delete(&models.Account{}).Error
+}
+
+// GetAccountBalances computes the balance of every account of a user, both in
+// the account's own currency and in the base currency. Transactions in another
+// currency are converted at the rate of their date.
+func (r *AccountRepo) GetAccountBalances(userID uint, base string, includeArchived bool) ([]models.AccountBalance, error) {
+	q := r.DB.Table("accounts a").
+		Select("a.id AS account_id, a.name, a.type, a.currency, a.archived, "+
+			"a.opening_balance + COALESCE(SUM(CASE WHEN t.type = 'expense' THEN -1 ELSE 1 END * fx_convert(t.amount, t.currency, a.currency, t.date)), 0) AS balance, "+
+			"fx_convert(a.opening_balance, a.currency, ?, a.created_at) + COALESCE(SUM(CASE WHEN t.type = 'expense' THEN -1 ELSE 1 END * fx_convert(t.amount, t.currency, ?, t.date)), 0) AS base_balance, "+
+			"COUNT(t.id) FILTER (WHERE fx_convert(t.amount, t.currency, a.currency, t.date) IS NULL OR fx_convert(t.amount, t.currency, ?, t.date) IS NULL) "+
+			"+ CASE WHEN fx_convert(a.opening_balance, a.currency, ?, a.created_at) IS NULL THEN 1 ELSE 0 END AS missing",
+			base, base, base, base).
+		Joins("LEFT JOIN transactions t ON t.account_id = a.id AND t.deleted_at IS NULL").
+		Where("a.user_id = ? AND a.deleted_at IS NULL", userID)
+	if !includeArchived {
+		q = q.Where("a.archived = ?", false)
+	}
+
+	var rows []struct {
+		models.AccountBalance
+		Missing int64
+	}
+	if err := q.Group("a.id").Order("a.name").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	balances := make([]models.AccountBalance, len(rows))
+	for i, row := range rows {
+		if row.Missing > 0 {
+			return nil, ErrMissingExchangeRate
+		}
+		balances[i] = row.AccountBalance
+		balances[i].BaseCurrency = base
+	}
+	return balances, nil
+}
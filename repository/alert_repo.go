@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"tracker/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type AlertRepo struct{ DB *gorm.DB }
+
+type AlertRepository interface {
+	CreateAlertOnce(alert *models.Alert) (bool, error)
+	GetAlertsByUserID(userID uint, limit int) ([]models.Alert, error)
+}
+
+// CreateAlertOnce inserts an alert unless the same budget, threshold and period
+// already fired. It reports whether a new row was written.
+func (r *AlertRepo) CreateAlertOnce(alert *models.Alert) (bool, error) {
+	res := r.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(alert)
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected > 0, nil
+}
+
+// GetAlertsByUserID fetches a user's alerts, newest first
+func (r *AlertRepo) GetAlertsByUserID(userID uint, limit int) ([]models.Alert, error) {
+	var alerts []models.Alert
+	q := r.DB.Where("user_id = ?", userID).Order("created_at DESC, id DESC")
+	if limit > 0 {
+		q = q.Limit(limit)
+	}
+	if err := q.Find(&alerts).Error; err != nil {
+		return nil, err
+	}
+	return alerts, nil
+}
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"tracker/models"
+
+	"gorm.io/gorm"
+)
+
+type AttachmentRepo struct{ DB *gorm.DB }
+
+type AttachmentRepository interface {
+	CreateAttachment(att *models.Attachment) error
+	GetAttachmentsByTransactionID(txID uint) ([]models.Attachment, error)
+	GetAttachmentByID(id uint) (*models.Attachment, error)
+	CheckAttachmentExistsForUser(id uint, userID uint) bool
+	DeleteAttachment(id uint) error
+	DeleteAttachmentsByTransactionIDs(txIDs ...uint) ([]models.Attachment, error)
+}
+
+// CreateAttachment inserts a new attachment
+func (r *AttachmentRepo) CreateAttachment(att *models.Attachment) error {
+	return r.DB.Create(att).Error
+}
+
+// GetAttachmentsByTransactionID fetches the attachments of a transaction,
+// oldest first
+func (r *AttachmentRepo) GetAttachmentsByTransactionID(txID uint) ([]models.Attachment, error) {
+	var atts []models.Attachment
+	if err := r.DB.Where("transaction_id = ?", txID).Order("id").Find(&atts).Error; err != nil {
+		return nil, err
+	}
+	return atts, nil
+}
+
+// GetAttachmentByID fetches a single attachment
+func (r *AttachmentRepo) GetAttachmentByID(id uint) (*models.Attachment, error) {
+	var att models.Attachment
+	if err := r.DB.First(&att, id).Error; err != nil {
+		return nil, err
+	}
+	return &att, nil
+}
+
+// CheckAttachmentExistsForUser checks if an attachment exists for a given user
+func (r *AttachmentRepo) CheckAttachmentExistsForUser(id uint, userID uint) bool {
+	var count int64
+	r.DB.Model(&models.Attachment{}).
+		Where("id = ? AND user_id = ?", id, userID).
+		Count(&count)
+	return count > 0
+}
+
+// DeleteAttachment deletes an attachment by ID. The row is removed for good
+// since its file is removed from the blob store along with it.
+func (r *AttachmentRepo) DeleteAttachment(id uint) error {
+	return r.DB.Unscoped().Where("id = ?", id).Delete(&models.Attachment{}).Error
+}
+
+// DeleteAttachmentsByTransactionIDs deletes every attachment of the
+// transactions and returns them, so their files can be removed as well
+func (r *AttachmentRepo) DeleteAttachmentsByTransactionIDs(txIDs ...uint) ([]models.Attachment, error) {
+	var atts []models.Attachment
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("transaction_id IN ?", txIDs).Find(&atts).Error; err != nil {
+			return err
+		}
+		if len(atts) == 0 {
+			return nil
+		}
+		return tx.Unscoped().Where("transaction_id IN ?", txIDs).Delete(&models.Attachment{}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return atts, nil
+}
@@ -1,7 +1,11 @@
 package repository
 
 import (
+	"fmt"
+	"strings"
+
 	"tracker/models"
+	"tracker/money"
 
 	"gorm.io/gorm"
 )
@@ -12,9 +16,12 @@ type BudgetRepository interface {
 	CheckDuplicateBudget(budget *models.Budget) bool
 	CreateBudget(budget *models.Budget) error
 	GetBudgetsByUserID(userID uint) ([]models.Budget, error)
+	GetBudgetByID(id uint) (*models.Budget, error)
+	GetBudgetsCovering(userID uint, categoryID *uint, category string) ([]models.Budget, error)
 	UpdateBudget(budget *models.Budget) error
 	CheckBudgetExistsForUser(id uint, userID uint) bool
 	DeleteBudget(id uint) error
+	GetSpending(userID uint, base string, windows []models.SpendWindow) ([]money.Amount, error)
 }
 
 // CheckDuplicateBudget checks if a budget category already exists for the user
@@ -40,6 +47,38 @@ func (r *BudgetRepo) GetBudgetsByUserID(userID uint) ([]models.Budget, error) {
 	return budgets, nil
 }
 
+// GetBudgetByID fetches a single budget
+func (r *BudgetRepo) GetBudgetByID(id uint) (*models.Budget, error) {
+	var budget models.Budget
+	if err := r.DB.First(&budget, id).Error; err != nil {
+		return nil, err
+	}
+	return &budget, nil
+}
+
+// GetBudgetsCovering fetches a user's budgets that spending on a category
+// counts towards: those of the category and of every category above it.
+// Without a category ID, and for budgets without one, the name is matched.
+func (r *BudgetRepo) GetBudgetsCovering(userID uint, categoryID *uint, category string) ([]models.Budget, error) {
+	var budgets []models.Budget
+	if categoryID == nil {
+		if err := r.DB.Where("user_id = ? AND category = ?", userID, category).Find(&budgets).Error; err != nil {
+			return nil, err
+		}
+		return budgets, nil
+	}
+
+	err := r.DB.Raw(`WITH RECURSIVE `+categoryAncestorsCTE+`
+		SELECT * FROM budgets
+		WHERE deleted_at IS NULL AND user_id = ?
+			AND (category_id IN (SELECT id FROM ancestors) OR (category_id IS NULL AND category = ?))
+		ORDER BY id`, *categoryID, userID, category).Scan(&budgets).Error
+	if err != nil {
+		return nil, err
+	}
+	return budgets, nil
+}
+
 // UpdateBudget updates a budget
 func (r *BudgetRepo) UpdateBudget(budget *models.Budget) error {
 	return r.DB.Save(budget).Error
@@ -58,3 +97,52 @@ func (r *BudgetRepo) CheckBudgetExistsForUser(id uint, userID uint) bool {
 func (r *BudgetRepo) DeleteBudget(id uint) error {
 	return r.DB.Where("id = ?", id).Delete(&models.Budget{}).Error
 }
+
+// GetSpending sums a user's expenses for every window in one query, converted
+// into the base currency. The result is in the same order as windows.
+func (r *BudgetRepo) GetSpending(userID uint, base string, windows []models.SpendWindow) ([]money.Amount, error) {
+	spent := make([]money.Amount, len(windows))
+	if len(windows) == 0 {
+		return spent, nil
+	}
+
+	values := make([]string, len(windows))
+	args := make([]interface{}, 0, len(windows)*5+3)
+	args = append(args, userID)
+	for i, w := range windows {
+		values[i] = "(?::int, ?::bigint, ?::text, ?::timestamptz, ?::timestamptz)"
+		args = append(args, i, w.CategoryID, w.Category, w.From, w.To)
+	}
+	args = append(args, base, userID)
+
+	// Split transactions count towards the categories of their lines, and
+	// subcategories towards their parents
+	query := fmt.Sprintf(`WITH RECURSIVE %s
+		SELECT w.idx, COALESCE(SUM(l.amount), 0) AS spent,
+			COUNT(l.id) FILTER (WHERE l.amount IS NULL) AS missing
+		FROM (VALUES %s) AS w(idx, category_id, category, start_at, end_at)
+		LEFT JOIN (%s) AS l
+			ON l.type = 'expense'
+			AND CASE WHEN w.category_id > 0
+				THEN l.category_id IN (SELECT id FROM tree WHERE root = w.category_id)
+				ELSE l.category = w.category END
+			AND l.date >= w.start_at
+			AND l.date < w.end_at
+		GROUP BY w.idx`, categoryTreeCTE, strings.Join(values, ", "), categoryLinesSQL)
+
+	var rows []struct {
+		Idx     int
+		Spent   money.Amount
+		Missing int64
+	}
+	if err := r.DB.Raw(query, args...).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		if row.Missing > 0 {
+			return nil, ErrMissingExchangeRate
+		}
+		spent[row.Idx] = row.Spent
+	}
+	return spent, nil
+}
@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"strings"
+
+	"tracker/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// categoryTreeCTE pairs each of a user's categories (root) with itself and
+// every category below it (id). It goes in a WITH RECURSIVE clause.
+// Argument: user ID.
+const categoryTreeCTE = `tree(root, id) AS (
+		SELECT id, id FROM categories WHERE deleted_at IS NULL AND user_id = ?
+		UNION ALL
+		SELECT tree.root, c.id FROM categories c JOIN tree ON c.parent_id = tree.id
+		WHERE c.deleted_at IS NULL
+	)`
+
+// categoryAncestorsCTE lists a category and every category above it.
+// It goes in a WITH RECURSIVE clause. Argument: category ID.
+const categoryAncestorsCTE = `ancestors(id, parent_id) AS (
+		SELECT id, parent_id FROM categories WHERE id = ? AND deleted_at IS NULL
+		UNION ALL
+		SELECT c.id, c.parent_id FROM categories c JOIN ancestors a ON c.id = a.parent_id
+		WHERE c.deleted_at IS NULL
+	)`
+
+type CategoryRepo struct{ DB *gorm.DB }
+
+type CategoryRepository interface {
+	CreateCategory(category *models.Category) error
+	CreateMissingCategories(categories []models.Category) error
+	GetCategoriesByUserID(userID uint, includeArchived bool) ([]models.Category, error)
+	GetCategoryByID(id uint) (*models.Category, error)
+	UpdateCategory(category *models.Category, oldName string) error
+	CheckCategoryExistsForUser(id uint, userID uint) bool
+	CountCategoryUses(id uint) (int64, error)
+	DeleteCategory(id uint) error
+	GetDescendantIDs(id uint, userID uint) ([]uint, error)
+}
+
+// CreateCategory inserts a new category
+func (r *CategoryRepo) CreateCategory(category *models.Category) error {
+	return r.DB.Create(category).Error
+}
+
+// CreateMissingCategories inserts categories, skipping those whose name the
+// user already has for the kind
+func (r *CategoryRepo) CreateMissingCategories(categories []models.Category) error {
+	if len(categories) == 0 {
+		return nil
+	}
+	return r.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&categories).Error
+}
+
+// GetCategoriesByUserID fetches the categories of a user by kind and name
+func (r *CategoryRepo) GetCategoriesByUserID(userID uint, includeArchived bool) ([]models.Category, error) {
+	var categories []models.Category
+	q := r.DB.Where("user_id = ?", userID)
+	if !includeArchived {
+		q = q.Where("archived = ?", false)
+	}
+	if err := q.Order("kind, lower(name), id").Find(&categories).Error; err != nil {
+		return nil, err
+	}
+	return categories, nil
+}
+
+// GetCategoryByID fetches a single category
+func (r *CategoryRepo) GetCategoryByID(id uint) (*models.Category, error) {
+	var category models.Category
+	if err := r.DB.First(&category, id).Error; err != nil {
+		return nil, err
+	}
+	return &category, nil
+}
+
+// UpdateCategory saves a category. When it was renamed, the new name is
+// written everywhere the old one is stored, all in one DB transaction.
+func (r *CategoryRepo) UpdateCategory(category *models.Category, oldName string) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(category).Error; err != nil {
+			return err
+		}
+		if category.Name == oldName {
+			return nil
+		}
+
+		for _, table := range []string{"transactions", "transaction_splits", "budgets", "recurring_transactions"} {
+			if err := tx.Table(table).Where("category_id = ?", category.ID).
+				Update("category", category.Name).Error; err != nil {
+				return err
+			}
+		}
+		// Rules name the category they assign; income rules cannot assign expense categories
+		return tx.Model(&models.CategoryRule{}).
+			Where("user_id = ? AND lower(category) = ? AND type IN ?", category.UserID, strings.ToLower(oldName), []string{"", category.Kind}).
+			Update("category", category.Name).Error
+	})
+}
+
+// CheckCategoryExistsForUser checks if a category exists for a given user
+func (r *CategoryRepo) CheckCategoryExistsForUser(id uint, userID uint) bool {
+	var count int64
+	r.DB.Model(&models.Category{}).
+		Where("id = ? AND user_id = ?", id, userID).
+		Count(&count)
+	return count > 0
+}
+
+// CountCategoryUses counts the transactions, split lines, budgets, recurring
+// transactions and subcategories that refer to a category
+func (r *CategoryRepo) CountCategoryUses(id uint) (int64, error) {
+	var count int64
+	err := r.DB.Raw(`SELECT
+		(SELECT COUNT(*) FROM transactions WHERE category_id = @id AND deleted_at IS NULL) +
+		(SELECT COUNT(*) FROM transaction_splits s JOIN transactions t ON t.id = s.transaction_id
+			WHERE s.category_id = @id AND t.deleted_at IS NULL) +
+		(SELECT COUNT(*) FROM budgets WHERE category_id = @id AND deleted_at IS NULL) +
+		(SELECT COUNT(*) FROM recurring_transactions WHERE category_id = @id AND deleted_at IS NULL) +
+		(SELECT COUNT(*) FROM categories WHERE parent_id = @id AND deleted_at IS NULL)`,
+		map[string]interface{}{"id": id}).Scan(&count).Error
+	return count, err
+}
+
+// DeleteCategory deletes a category by ID
+func (r *CategoryRepo) DeleteCategory(id uint) error {
+	return r.DB.Where("id = ?", id).Delete(&models.Category{}).Error
+}
+
+// GetDescendantIDs lists the IDs of every category below a category of the user
+func (r *CategoryRepo) GetDescendantIDs(id uint, userID uint) ([]uint, error) {
+	var ids []uint
+	err := r.DB.Raw("WITH RECURSIVE "+categoryTreeCTE+" SELECT id FROM tree WHERE root = ? AND id <> root", userID, id).
+		Scan(&ids).Error
+	return ids, err
+}
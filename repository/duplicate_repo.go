@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"time"
+
+	"tracker/models"
+	"tracker/money"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type DuplicateRepo struct{ DB *gorm.DB }
+
+type DuplicateRepository interface {
+	FindSimilar(userID uint, amounts []money.Amount, from, to time.Time) ([]models.Transaction, error)
+	CreateCandidates(candidates []models.DuplicateCandidate) error
+	GetOpenCandidates(userID uint) ([]models.DuplicateCandidate, error)
+	GetCandidateByID(id uint) (*models.DuplicateCandidate, error)
+	CheckCandidateExistsForUser(id uint, userID uint) bool
+	UpdateCandidateStatus(id uint, status string) error
+	MergeCandidate(id uint, keep *models.Transaction, removeID uint, status string) error
+}
+
+// FindSimilar fetches a user's incomes and expenses of one of the amounts
+// booked between from (inclusive) and to (exclusive)
+func (r *DuplicateRepo) FindSimilar(userID uint, amounts []money.Amount, from, to time.Time) ([]models.Transaction, error) {
+	var transactions []models.Transaction
+	if len(amounts) == 0 {
+		return transactions, nil
+	}
+	err := r.DB.Where("user_id = ? AND type <> 'transfer' AND amount IN ? AND date >= ? AND date < ?", userID, amounts, from, to).
+		Order("date, id").
+		Find(&transactions).Error
+	if err != nil {
+		return nil, err
+	}
+	return transactions, nil
+}
+
+// CreateCandidates saves suspected duplicates; pairs recorded before, in
+// whatever status, are left alone
+func (r *DuplicateRepo) CreateCandidates(candidates []models.DuplicateCandidate) error {
+	if len(candidates) == 0 {
+		return nil
+	}
+	return r.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&candidates).Error
+}
+
+// GetOpenCandidates fetches a user's unresolved candidates whose transactions
+// both still exist, newest first, with the two transactions
+func (r *DuplicateRepo) GetOpenCandidates(userID uint) ([]models.DuplicateCandidate, error) {
+	var candidates []models.DuplicateCandidate
+	live := "SELECT id FROM transactions WHERE deleted_at IS NULL"
+	err := r.DB.Where("user_id = ? AND status = ?", userID, "open").
+		Where("transaction_id IN (" + live + ") AND duplicate_of_id IN (" + live + ")").
+		Preload("Transaction.Splits").Preload("Transaction.Tags").
+		Preload("DuplicateOf.Splits").Preload("DuplicateOf.Tags").
+		Order("created_at DESC, id DESC").
+		Find(&candidates).Error
+	if err != nil {
+		return nil, err
+	}
+	return candidates, nil
+}
+
+// GetCandidateByID fetches a candidate with its two transactions; a
+// transaction deleted since is left nil
+func (r *DuplicateRepo) GetCandidateByID(id uint) (*models.DuplicateCandidate, error) {
+	var candidate models.DuplicateCandidate
+	if err := r.DB.Preload("Transaction.Splits").Preload("Transaction.Tags").
+		Preload("DuplicateOf.Splits").Preload("DuplicateOf.Tags").
+		First(&candidate, id).Error; err != nil {
+		return nil, err
+	}
+	return &candidate, nil
+}
+
+// CheckCandidateExistsForUser checks if a candidate belongs to the user
+func (r *DuplicateRepo) CheckCandidateExistsForUser(id uint, userID uint) bool {
+	var count int64
+	r.DB.Model(&models.DuplicateCandidate{}).Where("id = ? AND user_id = ?", id, userID).Count(&count)
+	return count > 0
+}
+
+// UpdateCandidateStatus sets the status of a candidate
+func (r *DuplicateRepo) UpdateCandidateStatus(id uint, status string) error {
+	return r.DB.Model(&models.DuplicateCandidate{}).Where("id = ?", id).Update("status", status).Error
+}
+
+// MergeCandidate moves the tags and attachments of the removed transaction
+// onto the surviving one, deletes it, saves the survivor and resolves the
+// candidate, all in one DB transaction. The removed row goes first: the
+// survivor may take over its bank reference, which must be unique among live
+// rows.
+func (r *DuplicateRepo) MergeCandidate(id uint, keep *models.Transaction, removeID uint, status string) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec(`INSERT INTO transaction_tags (transaction_id, tag_id)
+			SELECT ?, tag_id FROM transaction_tags WHERE transaction_id = ?
+			ON CONFLICT DO NOTHING`, keep.ID, removeID).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&models.Attachment{}).Where("transaction_id = ?", removeID).
+			Update("transaction_id", keep.ID).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Delete(&models.Transaction{}, removeID).Error; err != nil {
+			return err
+		}
+		if err := tx.Omit(clause.Associations).Save(keep).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.DuplicateCandidate{}).Where("id = ?", id).Update("status", status).Error
+	})
+}
@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"tracker/models"
+	"tracker/money"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// TestMergeManualWithImported merges a manual entry with its imported bank
+// copy against the postgres named by TEST_DATABASE_DSN. The manual entry
+// survives and takes over the bank reference, which the unique index on live
+// external IDs only allows once the imported row is gone. The test is skipped
+// when the variable is unset.
+func TestMergeManualWithImported(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("set TEST_DATABASE_DSN to run against postgres")
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.Tag{}, &models.Transaction{}, &models.TransactionSplit{},
+		&models.DuplicateCandidate{}, &models.Attachment{}); err != nil {
+		t.Fatal(err)
+	}
+	err = db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_transaction_external_id
+		ON transactions (user_id, coalesce(account_id, 0), external_id)
+		WHERE external_id <> '' AND deleted_at IS NULL`).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	userID := uint(time.Now().UnixNano()%1_000_000_000) + 1_000_000
+	t.Cleanup(func() {
+		db.Exec("DELETE FROM transaction_tags WHERE transaction_id IN (SELECT id FROM transactions WHERE user_id = ?)", userID)
+		db.Unscoped().Where("user_id = ?", userID).Delete(&models.Attachment{})
+		db.Unscoped().Where("user_id = ?", userID).Delete(&models.DuplicateCandidate{})
+		db.Unscoped().Where("user_id = ?", userID).Delete(&models.Transaction{})
+		db.Unscoped().Where("user_id = ?", userID).Delete(&models.Tag{})
+	})
+
+	day := time.Date(2026, time.April, 1, 0, 0, 0, 0, time.UTC)
+	tag := models.Tag{UserID: userID, Name: "bank"}
+	if err := db.Create(&tag).Error; err != nil {
+		t.Fatal(err)
+	}
+	manual := models.Transaction{UserID: userID, Type: "expense", Category: "Groceries", Amount: money.MustParse("23.90"),
+		Currency: "EUR", Note: "groceries", Date: day}
+	imported := models.Transaction{UserID: userID, Type: "expense", Category: "Imported", Amount: money.MustParse("23.90"),
+		Currency: "EUR", Note: "REWE SAGT DANKE", Date: day.AddDate(0, 0, 1), ExternalID: "2026040100001", Tags: []models.Tag{tag}}
+	if err := db.Create(&[]*models.Transaction{&manual, &imported}).Error; err != nil {
+		t.Fatal(err)
+	}
+	receipt := models.Attachment{UserID: userID, TransactionID: imported.ID, FileName: "receipt.pdf", ContentType: "application/pdf", StorageKey: "test"}
+	if err := db.Create(&receipt).Error; err != nil {
+		t.Fatal(err)
+	}
+	candidate := models.DuplicateCandidate{UserID: userID, TransactionID: imported.ID, DuplicateOfID: manual.ID, Score: 0.9, Status: "open"}
+	if err := db.Create(&candidate).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	manual.ExternalID = imported.ExternalID
+	r := &DuplicateRepo{DB: db}
+	if err := r.MergeCandidate(candidate.ID, &manual, imported.ID, "merged"); err != nil {
+		t.Fatalf("MergeCandidate: %v", err)
+	}
+
+	var kept models.Transaction
+	if err := db.Preload("Tags").First(&kept, manual.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if kept.ExternalID != imported.ExternalID {
+		t.Errorf("external ID = %q, want %q", kept.ExternalID, imported.ExternalID)
+	}
+	if len(kept.Tags) != 1 || kept.Tags[0].ID != tag.ID {
+		t.Errorf("tags = %v, want the imported entry's tag", kept.Tags)
+	}
+	var moved models.Attachment
+	if err := db.First(&moved, receipt.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if moved.TransactionID != manual.ID {
+		t.Errorf("attachment belongs to %d, want %d", moved.TransactionID, manual.ID)
+	}
+	if err := db.First(&models.Transaction{}, imported.ID).Error; err == nil {
+		t.Error("imported entry still exists")
+	}
+	var status string
+	db.Model(&models.DuplicateCandidate{}).Where("id = ?", candidate.ID).Pluck("status", &status)
+	if status != "merged" {
+		t.Errorf("candidate status = %q, want merged", status)
+	}
+}
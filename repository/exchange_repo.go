@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"tracker/models"
+	"tracker/money"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrMissingExchangeRate is returned when an amount cannot be converted because
+// no rate is known for its currency on or before its date
+var ErrMissingExchangeRate = errors.New("missing exchange rate")
+
+// fxFunctionsSQL defines fx_exponent, the decimal places of a currency, and
+// fx_convert, which converts amount (minor units of cur) into minor units of
+// target using the latest EUR reference rates on or before at. fx_convert
+// yields NULL when a rate is missing.
+var fxFunctionsSQL = []string{`
+CREATE OR REPLACE FUNCTION fx_exponent(cur text) RETURNS int AS $$
+	SELECT ` + CurrencyExponentSQL("cur") + `
+$$ LANGUAGE sql IMMUTABLE`, `
+CREATE OR REPLACE FUNCTION fx_rate(cur text, at timestamptz) RETURNS numeric AS $$
+	SELECT CASE WHEN cur = 'EUR' THEN 1::numeric ELSE (
+		SELECT rate FROM exchange_rates
+		WHERE currency = cur AND date <= at::date
+		ORDER BY date DESC LIMIT 1
+	) END
+$$ LANGUAGE sql STABLE`, `
+CREATE OR REPLACE FUNCTION fx_convert(amount bigint, cur text, target text, at timestamptz) RETURNS bigint AS $$
+	SELECT CASE WHEN cur = target THEN amount
+		ELSE ROUND(amount * fx_rate(target, at) / NULLIF(fx_rate(cur, at), 0)
+			* power(10::numeric, fx_exponent(target) - fx_exponent(cur)))::bigint
+	END
+$$ LANGUAGE sql STABLE`}
+
+// CurrencyExponentSQL is a SQL expression for the decimal places of the
+// currency code expr evaluates to, following money.Exponent
+func CurrencyExponentSQL(expr string) string {
+	byExponent := map[int][]string{}
+	for currency, exp := range money.Exponents() {
+		byExponent[exp] = append(byExponent[exp], "'"+currency+"'")
+	}
+	exps := make([]int, 0, len(byExponent))
+	for exp := range byExponent {
+		exps = append(exps, exp)
+	}
+	sort.Ints(exps)
+
+	var b strings.Builder
+	b.WriteString("CASE")
+	for _, exp := range exps {
+		codes := byExponent[exp]
+		sort.Strings(codes)
+		fmt.Fprintf(&b, " WHEN upper(%s) IN (%s) THEN %d", expr, strings.Join(codes, ", "), exp)
+	}
+	fmt.Fprintf(&b, " ELSE %d END", money.Exponent(""))
+	return b.String()
+}
+
+type ExchangeRateRepo struct{ DB *gorm.DB }
+
+type ExchangeRateRepository interface {
+	SaveRates(rates []models.ExchangeRate) error
+	GetRatesOn(date time.Time) ([]models.ExchangeRate, error)
+	GetRate(currency string, at time.Time) (float64, error)
+}
+
+// InstallFunctions creates the SQL functions the aggregates use for currency conversion
+func InstallFunctions(db *gorm.DB) error {
+	for _, stmt := range fxFunctionsSQL {
+		if err := db.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SaveRates upserts rates, replacing any rate already stored for the same day and currency
+func (r *ExchangeRateRepo) SaveRates(rates []models.ExchangeRate) error {
+	if len(rates) == 0 {
+		return nil
+	}
+	return r.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "date"}, {Name: "currency"}},
+		DoUpdates: clause.AssignmentColumns([]string{"rate"}),
+	}).CreateInBatches(rates, 500).Error
+}
+
+// GetRatesOn returns the latest rate of every currency on or before date
+func (r *ExchangeRateRepo) GetRatesOn(date time.Time) ([]models.ExchangeRate, error) {
+	var rates []models.ExchangeRate
+	err := r.DB.Raw(`
+		SELECT DISTINCT ON (currency) id, date, currency, rate
+		FROM exchange_rates
+		WHERE date <= ?::date
+		ORDER BY currency, date DESC`, date).Scan(&rates).Error
+	if err != nil {
+		return nil, err
+	}
+	return rates, nil
+}
+
+// GetRate returns the EUR rate of a currency on or before at
+func (r *ExchangeRateRepo) GetRate(currency string, at time.Time) (float64, error) {
+	if currency == "EUR" {
+		return 1, nil
+	}
+
+	var rates []float64
+	err := r.DB.Model(&models.ExchangeRate{}).
+		Where("currency = ? AND date <= ?::date", currency, at).
+		Order("date DESC").Limit(1).
+		Pluck("rate", &rates).Error
+	if err != nil {
+		return 0, err
+	}
+	if len(rates) == 0 || rates[0] == 0 {
+		return 0, ErrMissingExchangeRate
+	}
+	return rates[0], nil
+}
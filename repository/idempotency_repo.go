@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"time"
+
+	"tracker/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type IdempotencyRepo struct{ DB *gorm.DB }
+
+type IdempotencyRepository interface {
+	ReserveKey(key *models.IdempotencyKey) (bool, error)
+	GetKey(userID uint, key string) (*models.IdempotencyKey, error)
+	SaveResponse(id uint, status int, contentType string, body []byte, expiresAt time.Time) error
+	RenewLease(id uint, expiresAt time.Time) error
+	DeleteKey(id uint) error
+	DeleteExpired(now time.Time) (int64, error)
+}
+
+// ReserveKey inserts a key unless the user already holds a live one of the
+// same name; an expired one, or one whose request lease ran out, is replaced. It reports whether the key was
+// reserved.
+func (r *IdempotencyRepo) ReserveKey(key *models.IdempotencyKey) (bool, error) {
+	var created bool
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND key = ? AND expires_at <= ?", key.UserID, key.Key, time.Now()).
+			Delete(&models.IdempotencyKey{}).Error; err != nil {
+			return err
+		}
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(key)
+		if res.Error != nil {
+			return res.Error
+		}
+		created = res.RowsAffected > 0
+		return nil
+	})
+	return created, err
+}
+
+// GetKey fetches a user's key by name
+func (r *IdempotencyRepo) GetKey(userID uint, key string) (*models.IdempotencyKey, error) {
+	var k models.IdempotencyKey
+	if err := r.DB.Where("user_id = ? AND key = ?", userID, key).First(&k).Error; err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
+
+// SaveResponse stores the response of the request a key was reserved for
+// and when it expires
+func (r *IdempotencyRepo) SaveResponse(id uint, status int, contentType string, body []byte, expiresAt time.Time) error {
+	return r.DB.Model(&models.IdempotencyKey{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status_code":  status,
+		"content_type": contentType,
+		"body":         body,
+		"expires_at":   expiresAt,
+	}).Error
+}
+
+// RenewLease moves the expiry of a key whose request is still running; a
+// key that was answered in the meantime keeps its own
+func (r *IdempotencyRepo) RenewLease(id uint, expiresAt time.Time) error {
+	return r.DB.Model(&models.IdempotencyKey{}).Where("id = ? AND status_code = 0", id).
+		Update("expires_at", expiresAt).Error
+}
+
+// DeleteKey removes a key so the request can be tried again
+func (r *IdempotencyRepo) DeleteKey(id uint) error {
+	return r.DB.Delete(&models.IdempotencyKey{}, id).Error
+}
+
+// DeleteExpired removes every key that expired by now and reports how many
+func (r *IdempotencyRepo) DeleteExpired(now time.Time) (int64, error) {
+	res := r.DB.Where("expires_at <= ?", now).Delete(&models.IdempotencyKey{})
+	return res.RowsAffected, res.Error
+}
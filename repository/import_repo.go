@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"tracker/models"
+
+	"gorm.io/gorm"
+)
+
+type ImportProfileRepo struct{ DB *gorm.DB }
+
+type ImportProfileRepository interface {
+	CreateProfile(profile *models.ImportProfile) error
+	GetProfilesByUserID(userID uint) ([]models.ImportProfile, error)
+	GetProfileByID(id uint) (*models.ImportProfile, error)
+	UpdateProfile(profile *models.ImportProfile) error
+	CheckProfileExistsForUser(id uint, userID uint) bool
+	DeleteProfile(id uint) error
+}
+
+// CreateProfile inserts a new import profile
+func (r *ImportProfileRepo) CreateProfile(profile *models.ImportProfile) error {
+	return r.DB.Create(profile).Error
+}
+
+// GetProfilesByUserID fetches the import profiles of a user
+func (r *ImportProfileRepo) GetProfilesByUserID(userID uint) ([]models.ImportProfile, error) {
+	var profiles []models.ImportProfile
+	if err := r.DB.Where("user_id = ?", userID).Order("name").Find(&profiles).Error; err != nil {
+		return nil, err
+	}
+	return profiles, nil
+}
+
+// GetProfileByID fetches a single import profile
+func (r *ImportProfileRepo) GetProfileByID(id uint) (*models.ImportProfile, error) {
+	var profile models.ImportProfile
+	if err := r.DB.First(&profile, id).Error; err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+// UpdateProfile updates an import profile
+func (r *ImportProfileRepo) UpdateProfile(profile *models.ImportProfile) error {
+	return r.DB.Save(profile).Error
+}
+
+// CheckProfileExistsForUser checks if an import profile exists for a given user
+func (r *ImportProfileRepo) CheckProfileExistsForUser(id uint, userID uint) bool {
+	var count int64
+	r.DB.Model(&models.ImportProfile{}).
+		Where("id = ? AND user_id = ?", id, userID).
+		Count(&count)
+	return count > 0
+}
+
+// DeleteProfile deletes an import profile by ID
+func (r *ImportProfileRepo) DeleteProfile(id uint) error {
+	return r.DB.Where("id = ?", id).Delete(&models.ImportProfile{}).Error
+}
@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"tracker/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type PayeeRepo struct{ DB *gorm.DB }
+
+type PayeeRepository interface {
+	CreatePayee(payee *models.Payee) error
+	CreateMissingPayees(payees []models.Payee) error
+	GetPayeesByUserID(userID uint) ([]models.Payee, error)
+	GetPayeeByID(id uint) (*models.Payee, error)
+	UpdatePayee(payee *models.Payee, oldName string) error
+	CheckPayeeExistsForUser(id uint, userID uint) bool
+	DeletePayee(id uint) error
+	UpdateTransactionPayees(transactions []models.Transaction) error
+}
+
+// CreatePayee inserts a new payee
+func (r *PayeeRepo) CreatePayee(payee *models.Payee) error {
+	return r.DB.Create(payee).Error
+}
+
+// CreateMissingPayees inserts payees, skipping those whose name the user
+// already has
+func (r *PayeeRepo) CreateMissingPayees(payees []models.Payee) error {
+	if len(payees) == 0 {
+		return nil
+	}
+	return r.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&payees).Error
+}
+
+// GetPayeesByUserID fetches the payees of a user in creation order, the
+// order their aliases are tried in
+func (r *PayeeRepo) GetPayeesByUserID(userID uint) ([]models.Payee, error) {
+	var payees []models.Payee
+	if err := r.DB.Where("user_id = ?", userID).Order("id").Find(&payees).Error; err != nil {
+		return nil, err
+	}
+	return payees, nil
+}
+
+// GetPayeeByID fetches a single payee
+func (r *PayeeRepo) GetPayeeByID(id uint) (*models.Payee, error) {
+	var payee models.Payee
+	if err := r.DB.First(&payee, id).Error; err != nil {
+		return nil, err
+	}
+	return &payee, nil
+}
+
+// UpdatePayee saves a payee. When it was renamed, the new name is written to
+// its transactions, all in one DB transaction.
+func (r *PayeeRepo) UpdatePayee(payee *models.Payee, oldName string) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(payee).Error; err != nil {
+			return err
+		}
+		if payee.Name == oldName {
+			return nil
+		}
+		return tx.Model(&models.Transaction{}).Where("payee_id = ?", payee.ID).
+			Update("payee", payee.Name).Error
+	})
+}
+
+// CheckPayeeExistsForUser checks if a payee exists for a given user
+func (r *PayeeRepo) CheckPayeeExistsForUser(id uint, userID uint) bool {
+	var count int64
+	r.DB.Model(&models.Payee{}).
+		Where("id = ? AND user_id = ?", id, userID).
+		Count(&count)
+	return count > 0
+}
+
+// DeletePayee deletes a payee by ID; its transactions keep their notes but
+// no longer name a payee
+func (r *PayeeRepo) DeletePayee(id uint) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.Transaction{}).Where("payee_id = ?", id).
+			Updates(map[string]interface{}{"payee_id": nil, "payee": ""}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("id = ?", id).Delete(&models.Payee{}).Error
+	})
+}
+
+// UpdateTransactionPayees saves the payee and the category of each
+// transaction, all in one DB transaction
+func (r *PayeeRepo) UpdateTransactionPayees(transactions []models.Transaction) error {
+	if len(transactions) == 0 {
+		return nil
+	}
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		for i := range transactions {
+			t := &transactions[i]
+			if err := tx.Model(t).Select("payee", "payee_id", "category", "category_id").Updates(t).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
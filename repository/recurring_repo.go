@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"time"
+
+	"tracker/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type RecurringRepo struct{ DB *gorm.DB }
+
+type RecurringRepository interface {
+	CreateRecurring(rt *models.RecurringTransaction) error
+	GetRecurringByUserID(userID uint) ([]models.RecurringTransaction, error)
+	GetRecurringByID(id uint) (*models.RecurringTransaction, error)
+	UpdateRecurring(rt *models.RecurringTransaction) error
+	CheckRecurringExistsForUser(id uint, userID uint) bool
+	DeleteRecurring(id uint) error
+	ProcessDue(now time.Time, advance func(rt *models.RecurringTransaction) []models.Transaction) ([]models.Transaction, error)
+}
+
+// CreateRecurring inserts a new recurring transaction
+func (r *RecurringRepo) CreateRecurring(rt *models.RecurringTransaction) error {
+	return r.DB.Create(rt).Error
+}
+
+// GetRecurringByUserID fetches all recurring transactions for a user
+func (r *RecurringRepo) GetRecurringByUserID(userID uint) ([]models.RecurringTransaction, error) {
+	var rts []models.RecurringTransaction
+	if err := r.DB.Where("user_id = ?", userID).Order("id").Find(&rts).Error; err != nil {
+		return nil, err
+	}
+	return rts, nil
+}
+
+// GetRecurringByID fetches a single recurring transaction
+func (r *RecurringRepo) GetRecurringByID(id uint) (*models.RecurringTransaction, error) {
+	var rt models.RecurringTransaction
+	if err := r.DB.First(&rt, id).Error; err != nil {
+		return nil, err
+	}
+	return &rt, nil
+}
+
+// UpdateRecurring updates a recurring transaction
+func (r *RecurringRepo) UpdateRecurring(rt *models.RecurringTransaction) error {
+	return r.DB.Save(rt).Error
+}
+
+// CheckRecurringExistsForUser checks if a recurring transaction exists for a given user
+func (r *RecurringRepo) CheckRecurringExistsForUser(id uint, userID uint) bool {
+	var count int64
+	r.DB.Model(&models.RecurringTransaction{}).
+		Where("id = ? AND user_id = ?", id, userID).
+		Count(&count)
+	return count > 0
+}
+
+// DeleteRecurring deletes a recurring transaction by ID
+func (r *RecurringRepo) DeleteRecurring(id uint) error {
+	return r.DB.Where("id = ?", id).Delete(&models.RecurringTransaction{}).Error
+}
+
+// ProcessDue locks every recurring transaction due at now, lets advance move
+// its schedule forward and return the occurrences to book, and stores both in
+// one DB transaction. Rows locked by another worker are skipped, and
+// occurrences that already exist are ignored, so running it twice is harmless.
+// It returns the transactions that were actually created.
+func (r *RecurringRepo) ProcessDue(now time.Time, advance func(rt *models.RecurringTransaction) []models.Transaction) ([]models.Transaction, error) {
+	var created []models.Transaction
+
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		var due []models.RecurringTransaction
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("next_run IS NOT NULL AND next_run <= ?", now).
+			Find(&due).Error; err != nil {
+			return err
+		}
+
+		for i := range due {
+			rt := &due[i]
+			for _, occurrence := range advance(rt) {
+				// Tags are linked only once the occurrence is known to be new
+				res := tx.Clauses(clause.OnConflict{DoNothing: true}).Omit(clause.Associations).Create(&occurrence)
+				if res.Error != nil {
+					return res.Error
+				}
+				if res.RowsAffected == 0 {
+					continue
+				}
+				if len(occurrence.Tags) > 0 {
+					if err := replaceTags(tx, &occurrence); err != nil {
+						return err
+					}
+				}
+				created = append(created, occurrence)
+			}
+			if err := tx.Save(rt).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
+}
@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"tracker/models"
+
+	"gorm.io/gorm"
+)
+
+type RuleRepo struct{ DB *gorm.DB }
+
+type RuleRepository interface {
+	CreateRule(rule *models.CategoryRule) error
+	GetRulesByUserID(userID uint) ([]models.CategoryRule, error)
+	GetRuleByID(id uint) (*models.CategoryRule, error)
+	UpdateRule(rule *models.CategoryRule) error
+	CheckRuleExistsForUser(id uint, userID uint) bool
+	DeleteRule(id uint) error
+	UpdateCategoriesAndTags(transactions []models.Transaction) error
+}
+
+// CreateRule inserts a new rule
+func (r *RuleRepo) CreateRule(rule *models.CategoryRule) error {
+	return r.DB.Create(rule).Error
+}
+
+// GetRulesByUserID fetches the rules of a user in the order they run
+func (r *RuleRepo) GetRulesByUserID(userID uint) ([]models.CategoryRule, error) {
+	var rules []models.CategoryRule
+	if err := r.DB.Where("user_id = ?", userID).Order("priority, id").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// GetRuleByID fetches a single rule
+func (r *RuleRepo) GetRuleByID(id uint) (*models.CategoryRule, error) {
+	var rule models.CategoryRule
+	if err := r.DB.First(&rule, id).Error; err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// UpdateRule updates a rule
+func (r *RuleRepo) UpdateRule(rule *models.CategoryRule) error {
+	return r.DB.Save(rule).Error
+}
+
+// CheckRuleExistsForUser checks if a rule exists for a given user
+func (r *RuleRepo) CheckRuleExistsForUser(id uint, userID uint) bool {
+	var count int64
+	r.DB.Model(&models.CategoryRule{}).
+		Where("id = ? AND user_id = ?", id, userID).
+		Count(&count)
+	return count > 0
+}
+
+// DeleteRule deletes a rule by ID
+func (r *RuleRepo) DeleteRule(id uint) error {
+	return r.DB.Where("id = ?", id).Delete(&models.CategoryRule{}).Error
+}
+
+// UpdateCategoriesAndTags saves the category, its link and the links to the
+// tags of each transaction, all in one DB transaction. The tags must exist.
+func (r *RuleRepo) UpdateCategoriesAndTags(transactions []models.Transaction) error {
+	if len(transactions) == 0 {
+		return nil
+	}
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		for i := range transactions {
+			t := &transactions[i]
+			if err := tx.Model(t).Select("category", "category_id").Updates(t).Error; err != nil {
+				return err
+			}
+			if err := replaceTags(tx, t); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,164 @@
+package repository
+
+import (
+	"strings"
+
+	"tracker/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type TagRepo struct{ DB *gorm.DB }
+
+type TagRepository interface {
+	CreateTag(tag *models.Tag) error
+	CreateMissingTags(tags []models.Tag) error
+	GetTagsByUserID(userID uint) ([]models.Tag, error)
+	GetTagByID(id uint) (*models.Tag, error)
+	UpdateTag(tag *models.Tag, oldName string) error
+	MergeTags(from *models.Tag, into *models.Tag) error
+	CheckTagExistsForUser(id uint, userID uint) bool
+	CountRulesWithTag(userID uint, name string) (int64, error)
+	DeleteTag(id uint) error
+}
+
+// CreateTag inserts a new tag
+func (r *TagRepo) CreateTag(tag *models.Tag) error {
+	return r.DB.Create(tag).Error
+}
+
+// CreateMissingTags inserts tags, skipping those whose name the user
+// already has
+func (r *TagRepo) CreateMissingTags(tags []models.Tag) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	return r.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&tags).Error
+}
+
+// GetTagsByUserID fetches the tags of a user by name
+func (r *TagRepo) GetTagsByUserID(userID uint) ([]models.Tag, error) {
+	var tags []models.Tag
+	if err := r.DB.Where("user_id = ?", userID).Order("lower(name), id").Find(&tags).Error; err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// GetTagByID fetches a single tag
+func (r *TagRepo) GetTagByID(id uint) (*models.Tag, error) {
+	var tag models.Tag
+	if err := r.DB.First(&tag, id).Error; err != nil {
+		return nil, err
+	}
+	return &tag, nil
+}
+
+// UpdateTag saves a tag. When it was renamed, the rules that set the old
+// name set the new one instead, all in one DB transaction.
+func (r *TagRepo) UpdateTag(tag *models.Tag, oldName string) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(tag).Error; err != nil {
+			return err
+		}
+		if tag.Name == oldName {
+			return nil
+		}
+		return renameRuleTags(tx, tag.UserID, oldName, tag.Name)
+	})
+}
+
+// MergeTags moves every transaction and rule from one tag to another and
+// deletes the first, all in one DB transaction
+func (r *TagRepo) MergeTags(from *models.Tag, into *models.Tag) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec(`INSERT INTO transaction_tags (transaction_id, tag_id)
+			SELECT transaction_id, ? FROM transaction_tags WHERE tag_id = ?
+			ON CONFLICT DO NOTHING`, into.ID, from.ID).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM transaction_tags WHERE tag_id = ?", from.ID).Error; err != nil {
+			return err
+		}
+		if err := renameRuleTags(tx, from.UserID, from.Name, into.Name); err != nil {
+			return err
+		}
+		return tx.Delete(from).Error
+	})
+}
+
+// renameRuleTags replaces a tag name, ignoring case, in the tags the user's
+// rules set; a rule already setting the new name keeps it once
+func renameRuleTags(tx *gorm.DB, userID uint, oldName, newName string) error {
+	var rules []models.CategoryRule
+	if err := tx.Where("user_id = ?", userID).Find(&rules).Error; err != nil {
+		return err
+	}
+	for i := range rules {
+		rule := &rules[i]
+		var tags []string
+		changed := false
+		for _, t := range rule.Tags {
+			if strings.EqualFold(t, oldName) {
+				t, changed = newName, true
+			}
+			if !containsFold(tags, t) {
+				tags = append(tags, t)
+			}
+		}
+		if !changed {
+			continue
+		}
+		rule.Tags = tags
+		if err := tx.Model(rule).Select("tags").Updates(rule).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// containsFold reports whether list holds s, ignoring case
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckTagExistsForUser checks if a tag exists for a given user
+func (r *TagRepo) CheckTagExistsForUser(id uint, userID uint) bool {
+	var count int64
+	r.DB.Model(&models.Tag{}).
+		Where("id = ? AND user_id = ?", id, userID).
+		Count(&count)
+	return count > 0
+}
+
+// CountRulesWithTag counts the user's rules that set a tag name, ignoring case
+func (r *TagRepo) CountRulesWithTag(userID uint, name string) (int64, error) {
+	var rules []models.CategoryRule
+	if err := r.DB.Where("user_id = ?", userID).Find(&rules).Error; err != nil {
+		return 0, err
+	}
+	var count int64
+	for _, rule := range rules {
+		if containsFold(rule.Tags, name) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// DeleteTag deletes a tag by ID and takes it off every transaction
+func (r *TagRepo) DeleteTag(id uint) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM transaction_tags WHERE tag_id = ?", id).Error; err != nil {
+			return err
+		}
+		return tx.Where("id = ?", id).Delete(&models.Tag{}).Error
+	})
+}
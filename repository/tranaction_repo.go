@@ -1,24 +1,177 @@
 package repository
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
 	"tracker/models"
+	"tracker/money"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// ErrInvalidCursor is returned when a pagination cursor does not match the sort column
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// categoryLinesSQL yields one row per category line of a user's transactions:
+// a row per split for split transactions, the transaction itself otherwise.
+// Amounts are converted into the base currency at the rate of the transaction
+// date and are NULL when a rate is missing. Every per-category figure is
+// computed from it. Arguments: base currency, user ID.
+const categoryLinesSQL = `
+	SELECT t.id, t.type, t.date,
+		COALESCE(s.category, t.category) AS category,
+		CASE WHEN s.id IS NULL THEN t.category_id ELSE s.category_id END AS category_id,
+		fx_convert(COALESCE(s.amount, t.amount), t.currency, ?, t.date) AS amount
+	FROM transactions t
+	LEFT JOIN transaction_splits s ON s.transaction_id = t.id
+	WHERE t.deleted_at IS NULL AND t.user_id = ?`
+
 type TransactionRepo struct{ DB *gorm.DB }
 
 type TransactionRepository interface {
 	CreateTransaction(transaction *models.Transaction) error
+	CreateTransactions(transactions []models.Transaction, transfers [][2]int) error
+	GetImportedIDs(userID uint, accountID *uint, ids []string) (map[string]bool, error)
 	GetTransactionsByUserID(userID uint) ([]models.Transaction, error)
-	GetTotalIncome(userID uint) (float64, error)
-	GetTotalExpense(userID uint) (float64, error)
-	GetTotalBalance(userID uint) (float64, error)
+	ListTransactions(filter models.TransactionFilter) ([]models.Transaction, error)
+	StreamTransactions(filter models.TransactionFilter, fn func(models.Transaction) error) error
+	GetTransactionByID(id uint) (*models.Transaction, error)
+	UpdateTransaction(transaction *models.Transaction) error
+	CheckTransactionExistsForUser(id uint, userID uint) bool
+	DeleteTransaction(id uint) error
+	CreateTransfer(out *models.Transaction, in *models.Transaction) error
+	UpdateTransfer(legs ...*models.Transaction) error
+	DeleteTransfer(ids ...uint) error
+	GetTotalIncome(userID uint, base string, rng models.DateRange) (money.Amount, error)
+	GetTotalExpense(userID uint, base string, rng models.DateRange) (money.Amount, error)
+	GetTotalBalance(userID uint, base string, rng models.DateRange) (money.Amount, error)
+	GetTotals(userID uint, base string, rng models.DateRange) (income money.Amount, expense money.Amount, err error)
+	GetCategoryTotals(userID uint, base string, rng models.DateRange) ([]models.CategoryTotal, error)
+	GetTagTotals(userID uint, base string, rng models.DateRange) ([]models.TagTotal, error)
+	GetPayeeTotals(userID uint, base string, rng models.DateRange) ([]models.PayeeTotal, error)
 }
 
-// CreateTransaction saves a new transaction
+// CreateTransaction saves a new transaction. Its tags must exist already;
+// only the links to them are written.
 func (r *TransactionRepo) CreateTransaction(tx *models.Transaction) error {
-	return r.DB.Create(tx).Error
+	return r.DB.Omit("Tags.*").Create(tx).Error
+}
+
+// CreateTransactions saves a batch of transactions in one DB transaction, so
+// either all of them are stored or none. Each pair in transfers holds the
+// positions of the two legs of a transfer, which get linked to each other.
+// Entries whose external ID their account already holds, for instance from
+// an import running at the same time, are skipped and keep ID 0; a transfer
+// is only booked when both legs are new.
+func (r *TransactionRepo) CreateTransactions(transactions []models.Transaction, transfers [][2]int) error {
+	if len(transactions) == 0 {
+		return nil
+	}
+	leg := map[int]bool{}
+	for _, pair := range transfers {
+		leg[pair[0]], leg[pair[1]] = true, true
+	}
+
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		for i := range transactions {
+			if leg[i] {
+				continue
+			}
+			if _, err := createNew(tx, &transactions[i]); err != nil {
+				return err
+			}
+		}
+		for n, pair := range transfers {
+			a, b := &transactions[pair[0]], &transactions[pair[1]]
+			savepoint := fmt.Sprintf("transfer_%d", n)
+			if err := tx.SavePoint(savepoint).Error; err != nil {
+				return err
+			}
+			newA, err := createNew(tx, a)
+			if err != nil {
+				return err
+			}
+			newB, err := createNew(tx, b)
+			if err != nil {
+				return err
+			}
+			if !newA || !newB {
+				if err := tx.RollbackTo(savepoint).Error; err != nil {
+					return err
+				}
+				a.ID, b.ID = 0, 0
+				continue
+			}
+			a.LinkedID, b.LinkedID = &b.ID, &a.ID
+			if err := tx.Model(a).Update("linked_id", b.ID).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(b).Update("linked_id", a.ID).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// createNew inserts a transaction with its splits and tags unless its
+// external ID is taken, and reports whether it did
+func createNew(tx *gorm.DB, t *models.Transaction) (bool, error) {
+	res := tx.Clauses(clause.OnConflict{DoNothing: true}).Omit(clause.Associations).Create(t)
+	if res.Error != nil {
+		return false, res.Error
+	}
+	if res.RowsAffected == 0 {
+		t.ID = 0
+		return false, nil
+	}
+	if len(t.Splits) > 0 {
+		for i := range t.Splits {
+			t.Splits[i].TransactionID = t.ID
+		}
+		if err := tx.Create(&t.Splits).Error; err != nil {
+			return false, err
+		}
+	}
+	if len(t.Tags) > 0 {
+		if err := replaceTags(tx, t); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// GetImportedIDs returns which of the external IDs were already imported for
+// the account (or for transactions without one when accountID is nil).
+// Deleted transactions count too, so removing an entry keeps it from coming back.
+func (r *TransactionRepo) GetImportedIDs(userID uint, accountID *uint, ids []string) (map[string]bool, error) {
+	found := map[string]bool{}
+	if len(ids) == 0 {
+		return found, nil
+	}
+
+	q := r.DB.Unscoped().Model(&models.Transaction{}).
+		Where("user_id = ? AND external_id IN ?", userID, ids)
+	if accountID != nil {
+		q = q.Where("account_id = ?", *accountID)
+	} else {
+		q = q.Where("account_id IS NULL")
+	}
+
+	var existing []string
+	if err := q.Distinct().Pluck("external_id", &existing).Error; err != nil {
+		return nil, err
+	}
+	for _, id := range existing {
+		found[id] = true
+	}
+	return found, nil
 }
 
 // GetTransactionsByUserID fetches all transactions for a user
@@ -30,32 +183,500 @@ func (r *TransactionRepo) GetTransactionsByUserID(userID uint) ([]models.Transac
 	return transactions, nil
 }
 
-// GetTotalIncome returns the total income for a user
-func (r *TransactionRepo) GetTotalIncome(userID uint) (float64, error) {
-	var total float64
-	err := r.DB.Model(&models.Transaction{}).
-		Where("user_id = ? AND type = ?", userID, "income").
-		Select("COALESCE(SUM(amount), 0)").
-		Scan(&total).Error
-	return total, err
+// transactionSortColumns whitelists the columns a listing may be ordered by
+var transactionSortColumns = map[string]string{
+	"date":       "date",
+	"amount":     "amount",
+	"created_at": "created_at",
+}
+
+// ListTransactions fetches a filtered, sorted page of a user's transactions
+func (r *TransactionRepo) ListTransactions(f models.TransactionFilter) ([]models.Transaction, error) {
+	q := filterTransactions(r.DB, f)
+	col, dir, cmp := transactionOrder(f)
+
+	// Keyset pagination: continue strictly after the last row of the previous page
+	if f.After != nil {
+		v, err := parseCursorValue(col, f.After.Value)
+		if err != nil {
+			return nil, err
+		}
+		q = q.Where(fmt.Sprintf("(%s, id) %s (?, ?)", col, cmp), v, f.After.ID)
+	}
+
+	q = q.Order(fmt.Sprintf("%s %s, id %s", col, dir, dir))
+	if f.Limit > 0 {
+		q = q.Limit(f.Limit)
+	}
+
+	var transactions []models.Transaction
+	if err := q.Preload("Splits").Preload("Tags").Find(&transactions).Error; err != nil {
+		return nil, err
+	}
+	return transactions, nil
+}
+
+// streamedTransaction is a transaction row with its split lines and tags
+// aggregated into JSON, so they arrive on the same cursor as their transaction
+type streamedTransaction struct {
+	models.Transaction
+	SplitLines string
+	TagList    string
+}
+
+// splitLinesSQL aggregates the splits of the current transactions row
+const splitLinesSQL = `COALESCE((
+	SELECT json_agg(json_build_object('id', s.id, 'category', s.category, 'amount', s.amount, 'note', s.note) ORDER BY s.id)
+	FROM transaction_splits s WHERE s.transaction_id = transactions.id), '[]')::text AS split_lines`
+
+// tagListSQL aggregates the tags of the current transactions row
+const tagListSQL = `COALESCE((
+	SELECT json_agg(json_build_object('id', g.id, 'name', g.name, 'color', g.color) ORDER BY lower(g.name))
+	FROM transaction_tags tt JOIN tags g ON g.id = tt.tag_id
+	WHERE tt.transaction_id = transactions.id AND g.deleted_at IS NULL), '[]')::text AS tag_list`
+
+// StreamTransactions walks every transaction matching the filter in its sort
+// order, calling fn for each one as it is read from the database cursor.
+// Limit and After are ignored. Iteration stops at the first error fn returns.
+func (r *TransactionRepo) StreamTransactions(f models.TransactionFilter, fn func(models.Transaction) error) error {
+	col, dir, _ := transactionOrder(f)
+	rows, err := filterTransactions(r.DB.Model(&models.Transaction{}), f).
+		Select("transactions.*, " + splitLinesSQL + ", " + tagListSQL).
+		Order(fmt.Sprintf("%s %s, id %s", col, dir, dir)).
+		Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row streamedTransaction
+		if err := r.DB.ScanRows(rows, &row); err != nil {
+			return err
+		}
+		tx := row.Transaction
+		if tx.Splits, err = decodeSplitLines(tx.ID, row.SplitLines); err != nil {
+			return err
+		}
+		if tx.Tags, err = decodeTagList(tx.UserID, row.TagList); err != nil {
+			return err
+		}
+		if err := fn(tx); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// decodeSplitLines reads the JSON built by splitLinesSQL; amounts in it are
+// minor units, not the decimal strings money.Amount expects
+func decodeSplitLines(txID uint, lines string) ([]models.TransactionSplit, error) {
+	var raw []struct {
+		ID       uint   `json:"id"`
+		Category string `json:"category"`
+		Amount   int64  `json:"amount"`
+		Note     string `json:"note"`
+	}
+	if err := json.Unmarshal([]byte(lines), &raw); err != nil {
+		return nil, err
+	}
+	var splits []models.TransactionSplit
+	for _, s := range raw {
+		splits = append(splits, models.TransactionSplit{
+			ID:            s.ID,
+			TransactionID: txID,
+			Category:      s.Category,
+			Amount:        money.FromMinor(s.Amount),
+			Note:          s.Note,
+		})
+	}
+	return splits, nil
 }
 
-// GetTotalExpense returns the total expense for a user
-func (r *TransactionRepo) GetTotalExpense(userID uint) (float64, error) {
-	var total float64
-	err := r.DB.Model(&models.Transaction{}).
-		Where("user_id = ? AND type = ?", userID, "expense").
-		Select("COALESCE(SUM(amount), 0)").
-		Scan(&total).Error
-	return total, err
+// decodeTagList reads the JSON built by tagListSQL
+func decodeTagList(userID uint, list string) ([]models.Tag, error) {
+	var raw []struct {
+		ID    uint   `json:"id"`
+		Name  string `json:"name"`
+		Color string `json:"color"`
+	}
+	if err := json.Unmarshal([]byte(list), &raw); err != nil {
+		return nil, err
+	}
+	var tags []models.Tag
+	for _, t := range raw {
+		tag := models.Tag{UserID: userID, Name: t.Name, Color: t.Color}
+		tag.ID = t.ID
+		tags = append(tags, tag)
+	}
+	return tags, nil
 }
 
-// GetTotalBalance calculates total balance (income - expense) for a user
-func (r *TransactionRepo) GetTotalBalance(userID uint) (float64, error) {
-	var total float64
-	err := r.DB.Model(&models.Transaction{}).
+// filterTransactions applies the filter's conditions, but not its order or paging
+func filterTransactions(q *gorm.DB, f models.TransactionFilter) *gorm.DB {
+	q = q.Where("user_id = ?", f.UserID)
+
+	q = withDateRange(q, models.DateRange{From: f.From, To: f.To})
+	if f.Type != "" {
+		q = q.Where("type = ?", f.Type)
+	}
+	if f.Category != "" {
+		q = q.Where("category = ? OR id IN (SELECT transaction_id FROM transaction_splits WHERE category = ?)", f.Category, f.Category)
+	}
+	if f.AccountID != nil {
+		q = q.Where("account_id = ?", *f.AccountID)
+	}
+	// Amounts are compared in the filter's currency; rows without a rate for
+	// their date convert to NULL and never match
+	if f.MinAmount != nil {
+		q = q.Where("fx_convert(amount, currency, ?, date) >= ?", f.Currency, *f.MinAmount)
+	}
+	if f.MaxAmount != nil {
+		q = q.Where("fx_convert(amount, currency, ?, date) <= ?", f.Currency, *f.MaxAmount)
+	}
+	if f.Note != "" {
+		q = q.Where("note ILIKE ?", "%"+escapeLike(f.Note)+"%")
+	}
+	if len(f.Tags) > 0 {
+		q = withTags(q, f.Tags, f.AllTags)
+	}
+	return q
+}
+
+// withTags restricts a query to transactions carrying any of the tag names,
+// or all of them with all set; names are compared ignoring case
+func withTags(q *gorm.DB, names []string, all bool) *gorm.DB {
+	seen := map[string]bool{}
+	var lower []string
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "" && !seen[name] {
+			seen[name] = true
+			lower = append(lower, name)
+		}
+	}
+	if len(lower) == 0 {
+		return q
+	}
+
+	sub := `SELECT tt.transaction_id FROM transaction_tags tt JOIN tags g ON g.id = tt.tag_id
+		WHERE g.deleted_at IS NULL AND lower(g.name) IN ?`
+	if !all {
+		return q.Where("id IN ("+sub+")", lower)
+	}
+	return q.Where("id IN ("+sub+" GROUP BY tt.transaction_id HAVING COUNT(DISTINCT g.id) = ?)", lower, len(lower))
+}
+
+// transactionOrder returns the sort column, direction and the comparison
+// that continues past a cursor in that direction
+func transactionOrder(f models.TransactionFilter) (col, dir, cmp string) {
+	col, ok := transactionSortColumns[f.SortBy]
+	if !ok {
+		col = "date"
+	}
+	if f.SortDesc {
+		return col, "DESC", "<"
+	}
+	return col, "ASC", ">"
+}
+
+// CursorFor builds the cursor that resumes a listing right after tx
+func CursorFor(tx models.Transaction, sortBy string) models.TransactionCursor {
+	c := models.TransactionCursor{ID: tx.ID}
+	switch sortBy {
+	case "amount":
+		c.Value = strconv.FormatInt(tx.Amount.Minor(), 10)
+	case "created_at":
+		c.Value = tx.CreatedAt.Format(time.RFC3339Nano)
+	default:
+		c.Value = tx.Date.Format(time.RFC3339Nano)
+	}
+	return c
+}
+
+// parseCursorValue converts a cursor value back into the sort column's type
+func parseCursorValue(col, v string) (interface{}, error) {
+	if col == "amount" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+		}
+		return n, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, v)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+	return t, nil
+}
+
+// escapeLike escapes the LIKE wildcards in user input
+func escapeLike(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+	return r.Replace(s)
+}
+
+// GetTransactionByID fetches a single transaction
+func (r *TransactionRepo) GetTransactionByID(id uint) (*models.Transaction, error) {
+	var transaction models.Transaction
+	if err := r.DB.Preload("Splits").Preload("Tags").First(&transaction, id).Error; err != nil {
+		return nil, err
+	}
+	return &transaction, nil
+}
+
+// UpdateTransaction updates a transaction and replaces its split lines and
+// the links to its tags
+func (r *TransactionRepo) UpdateTransaction(t *models.Transaction) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Splits", "Tags").Save(t).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("transaction_id = ?", t.ID).Delete(&models.TransactionSplit{}).Error; err != nil {
+			return err
+		}
+		for i := range t.Splits {
+			t.Splits[i].ID = 0
+			t.Splits[i].TransactionID = t.ID
+		}
+		if len(t.Splits) > 0 {
+			if err := tx.Create(&t.Splits).Error; err != nil {
+				return err
+			}
+		}
+		return replaceTags(tx, t)
+	})
+}
+
+// replaceTags links a saved transaction to exactly its tags, which must exist
+func replaceTags(tx *gorm.DB, t *models.Transaction) error {
+	tags := tx.Model(t).Omit("Tags.*").Association("Tags")
+	if len(t.Tags) == 0 {
+		return tags.Clear()
+	}
+	return tags.Replace(t.Tags)
+}
+
+// CheckTransactionExistsForUser checks if a transaction exists for a given user
+func (r *TransactionRepo) CheckTransactionExistsForUser(id uint, userID uint) bool {
+	var count int64
+	r.DB.Model(&models.Transaction{}).
+		Where("id = ? AND user_id = ?", id, userID).
+		Count(&count)
+	return count > 0
+}
+
+// DeleteTransaction deletes a transaction by ID
+func (r *TransactionRepo) DeleteTransaction(id uint) error {
+	return r.DB.Where("id = ?", id).Delete(&models.Transaction{}).Error
+}
+
+// CreateTransfer inserts both legs of a transfer and links them to each other
+// in one DB transaction
+func (r *TransactionRepo) CreateTransfer(out *models.Transaction, in *models.Transaction) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(out).Error; err != nil {
+			return err
+		}
+		in.LinkedID = &out.ID
+		if err := tx.Create(in).Error; err != nil {
+			return err
+		}
+		out.LinkedID = &in.ID
+		return tx.Model(out).Update("linked_id", in.ID).Error
+	})
+}
+
+// UpdateTransfer saves the legs of a transfer in one DB transaction
+func (r *TransactionRepo) UpdateTransfer(legs ...*models.Transaction) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		for _, leg := range legs {
+			if err := tx.Save(leg).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteTransfer deletes the legs of a transfer in one DB transaction
+func (r *TransactionRepo) DeleteTransfer(ids ...uint) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		return tx.Where("id IN ?", ids).Delete(&models.Transaction{}).Error
+	})
+}
+
+// GetTotalIncome returns the total income for a user within the range, in the base currency
+func (r *TransactionRepo) GetTotalIncome(userID uint, base string, rng models.DateRange) (money.Amount, error) {
+	income, _, err := r.GetTotals(userID, base, rng)
+	return income, err
+}
+
+// GetTotalExpense returns the total expense for a user within the range, in the base currency
+func (r *TransactionRepo) GetTotalExpense(userID uint, base string, rng models.DateRange) (money.Amount, error) {
+	_, expense, err := r.GetTotals(userID, base, rng)
+	return expense, err
+}
+
+// GetTotalBalance calculates total balance (income - expense) for a user within the range, in the base currency
+func (r *TransactionRepo) GetTotalBalance(userID uint, base string, rng models.DateRange) (money.Amount, error) {
+	income, expense, err := r.GetTotals(userID, base, rng)
+	return income - expense, err
+}
+
+// GetTotals returns income and expense for a user within the range in a single
+// query, converting every amount into the base currency at its date's rate
+func (r *TransactionRepo) GetTotals(userID uint, base string, rng models.DateRange) (income money.Amount, expense money.Amount, err error) {
+	var row struct {
+		Income  money.Amount
+		Expense money.Amount
+		Missing int64
+	}
+	err = withDateRange(r.DB.Model(&models.Transaction{}), rng).
+		Select("COALESCE(SUM(fx_convert(amount, currency, ?, date)) FILTER (WHERE type = 'income'), 0) AS income, "+
+			"COALESCE(SUM(fx_convert(amount, currency, ?, date)) FILTER (WHERE type = 'expense'), 0) AS expense, "+
+			"COUNT(*) FILTER (WHERE type IN ('income', 'expense') AND fx_convert(amount, currency, ?, date) IS NULL) AS missing",
+			base, base, base).
 		Where("user_id = ?", userID).
-		Select("COALESCE(SUM(CASE WHEN type = 'income' THEN amount ELSE -amount END), 0)").
-		Scan(&total).Error
-	return total, err
+		Scan(&row).Error
+	if err != nil {
+		return 0, 0, err
+	}
+	if row.Missing > 0 {
+		return 0, 0, ErrMissingExchangeRate
+	}
+	return row.Income, row.Expense, nil
+}
+
+// GetCategoryTotals sums income and expense per category within the range in
+// the base currency, using split lines where a transaction has them. Each
+// category's total includes its subcategories; lines not linked to a
+// category are summed by name.
+func (r *TransactionRepo) GetCategoryTotals(userID uint, base string, rng models.DateRange) ([]models.CategoryTotal, error) {
+	where := "l.type IN ('income', 'expense')"
+	args := []interface{}{userID, base, userID}
+	if rng.From != nil {
+		where += " AND l.date >= ?"
+		args = append(args, *rng.From)
+	}
+	if rng.To != nil {
+		where += " AND l.date < ?"
+		args = append(args, *rng.To)
+	}
+
+	query := `WITH RECURSIVE ` + categoryTreeCTE + `,
+		lines AS (SELECT * FROM (` + categoryLinesSQL + `) AS l WHERE ` + where + `)
+		SELECT c.name AS category, c.id AS category_id, c.parent_id, l.type,
+			COALESCE(SUM(l.amount), 0) AS total,
+			COALESCE(SUM(l.amount) FILTER (WHERE l.category_id = c.id), 0) AS direct,
+			COUNT(*) FILTER (WHERE l.amount IS NULL) AS missing
+		FROM tree
+		JOIN categories c ON c.id = tree.root
+		JOIN lines l ON l.category_id = tree.id
+		GROUP BY c.id, c.name, c.parent_id, l.type
+		UNION ALL
+		SELECT l.category, NULL, NULL, l.type,
+			COALESCE(SUM(l.amount), 0), COALESCE(SUM(l.amount), 0),
+			COUNT(*) FILTER (WHERE l.amount IS NULL)
+		FROM lines l
+		WHERE l.category_id IS NULL
+		GROUP BY l.category, l.type
+		ORDER BY type, total DESC`
+
+	var rows []struct {
+		models.CategoryTotal
+		Missing int64
+	}
+	if err := r.DB.Raw(query, args...).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	totals := make([]models.CategoryTotal, len(rows))
+	for i, row := range rows {
+		if row.Missing > 0 {
+			return nil, ErrMissingExchangeRate
+		}
+		totals[i] = row.CategoryTotal
+		totals[i].Currency = base
+	}
+	return totals, nil
+}
+
+// GetTagTotals sums income and expense per tag within the range in the base
+// currency. Tags are on whole transactions, so split lines do not matter here.
+func (r *TransactionRepo) GetTagTotals(userID uint, base string, rng models.DateRange) ([]models.TagTotal, error) {
+	var rows []struct {
+		models.TagTotal
+		Missing int64
+	}
+	err := withDateRange(r.DB.Table("transactions"), rng).
+		Select(`g.id AS tag_id, g.name AS tag,
+			COALESCE(SUM(fx_convert(transactions.amount, transactions.currency, ?, transactions.date)) FILTER (WHERE transactions.type = 'income'), 0) AS income,
+			COALESCE(SUM(fx_convert(transactions.amount, transactions.currency, ?, transactions.date)) FILTER (WHERE transactions.type = 'expense'), 0) AS expense,
+			COUNT(*) AS count,
+			COUNT(*) FILTER (WHERE fx_convert(transactions.amount, transactions.currency, ?, transactions.date) IS NULL) AS missing`,
+			base, base, base).
+		Joins("JOIN transaction_tags tt ON tt.transaction_id = transactions.id").
+		Joins("JOIN tags g ON g.id = tt.tag_id AND g.deleted_at IS NULL").
+		Where("transactions.deleted_at IS NULL AND transactions.user_id = ? AND transactions.type IN ('income', 'expense')", userID).
+		Group("g.id, g.name").
+		Order("expense DESC, lower(g.name)").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	totals := make([]models.TagTotal, len(rows))
+	for i, row := range rows {
+		if row.Missing > 0 {
+			return nil, ErrMissingExchangeRate
+		}
+		totals[i] = row.TagTotal
+		totals[i].Net = row.Income - row.Expense
+		totals[i].Currency = base
+	}
+	return totals, nil
+}
+
+// GetPayeeTotals sums the expenses per payee within the range in the base
+// currency, most spent first; transactions without a payee are left out
+func (r *TransactionRepo) GetPayeeTotals(userID uint, base string, rng models.DateRange) ([]models.PayeeTotal, error) {
+	var rows []struct {
+		models.PayeeTotal
+		Missing int64
+	}
+	err := withDateRange(r.DB.Table("transactions"), rng).
+		Select(`p.id AS payee_id, p.name AS payee,
+			COALESCE(SUM(fx_convert(transactions.amount, transactions.currency, ?, transactions.date)), 0) AS total,
+			COUNT(*) AS count,
+			COUNT(*) FILTER (WHERE fx_convert(transactions.amount, transactions.currency, ?, transactions.date) IS NULL) AS missing`,
+			base, base).
+		Joins("JOIN payees p ON p.id = transactions.payee_id AND p.deleted_at IS NULL").
+		Where("transactions.deleted_at IS NULL AND transactions.user_id = ? AND transactions.type = 'expense'", userID).
+		Group("p.id, p.name").
+		Order("total DESC, lower(p.name)").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	totals := make([]models.PayeeTotal, len(rows))
+	for i, row := range rows {
+		if row.Missing > 0 {
+			return nil, ErrMissingExchangeRate
+		}
+		totals[i] = row.PayeeTotal
+	}
+	return totals, nil
+}
+
+// withDateRange restricts a query to transactions dated inside the range
+func withDateRange(q *gorm.DB, rng models.DateRange) *gorm.DB {
+	if rng.From != nil {
+		q = q.Where("date >= ?", *rng.From)
+	}
+	if rng.To != nil {
+		q = q.Where("date < ?", *rng.To)
+	}
+	return q
 }
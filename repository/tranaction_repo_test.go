@@ -0,0 +1,304 @@
+package repository
+
+import (
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"tracker/models"
+	"tracker/money"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// dryRunDB builds postgres SQL without a server
+func dryRunDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(postgres.Open("host=localhost"), &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestWithTags(t *testing.T) {
+	tests := []struct {
+		name  string
+		names []string
+		all   bool
+		want  string // "" when the query must stay unfiltered
+	}{
+		{"no tags", nil, false, ""},
+		{"blank tags", []string{" ", ""}, true, ""},
+		{"any", []string{"Japan", "food"}, false, `lower(g.name) IN ('japan','food'))`},
+		{"all", []string{"Japan", "food"}, true, `lower(g.name) IN ('japan','food') GROUP BY tt.transaction_id HAVING COUNT(DISTINCT g.id) = 2)`},
+		{"all counts each name once", []string{"japan", " JAPAN ", "food"}, true, `lower(g.name) IN ('japan','food') GROUP BY tt.transaction_id HAVING COUNT(DISTINCT g.id) = 2)`},
+		{"all of one tag", []string{"japan"}, true, `lower(g.name) IN ('japan') GROUP BY tt.transaction_id HAVING COUNT(DISTINCT g.id) = 1)`},
+	}
+	db := dryRunDB(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql := db.ToSQL(func(tx *gorm.DB) *gorm.DB {
+				var txs []models.Transaction
+				return withTags(tx.Model(&models.Transaction{}), tt.names, tt.all).Find(&txs)
+			})
+			sql = strings.Join(strings.Fields(sql), " ")
+			if tt.want == "" {
+				if strings.Contains(sql, "transaction_tags") {
+					t.Errorf("query filters by tags: %s", sql)
+				}
+				return
+			}
+			if !strings.Contains(sql, tt.want) {
+				t.Errorf("query = %s\nwant it to contain %s", sql, tt.want)
+			}
+			if !tt.all && strings.Contains(sql, "HAVING") {
+				t.Errorf("any-tag query requires all tags: %s", sql)
+			}
+		})
+	}
+}
+
+func TestFilterTransactionsByAmount(t *testing.T) {
+	min, max := money.Amount(1000), money.Amount(5000)
+	db := dryRunDB(t)
+	sql := db.ToSQL(func(tx *gorm.DB) *gorm.DB {
+		var txs []models.Transaction
+		f := models.TransactionFilter{UserID: 1, MinAmount: &min, MaxAmount: &max, Currency: "JPY"}
+		return filterTransactions(tx.Model(&models.Transaction{}), f).Find(&txs)
+	})
+	for _, want := range []string{
+		"fx_convert(amount, currency, 'JPY', date) >= 1000",
+		"fx_convert(amount, currency, 'JPY', date) <= 5000",
+	} {
+		if !strings.Contains(sql, want) {
+			t.Errorf("query = %s\nwant it to contain %s", sql, want)
+		}
+	}
+}
+
+// TestListTransactionsByTags runs the tag filter against the postgres named
+// by TEST_DATABASE_DSN, e.g.
+//
+//	TEST_DATABASE_DSN="host=localhost user=postgres dbname=fintrack_test sslmode=disable" go test ./repository
+//
+// It creates the tables it needs and removes its rows afterwards. The test is
+// skipped when the variable is unset.
+func TestListTransactionsByTags(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("set TEST_DATABASE_DSN to run against postgres")
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.Tag{}, &models.Transaction{}, &models.TransactionSplit{}); err != nil {
+		t.Fatal(err)
+	}
+
+	userID := uint(time.Now().UnixNano()%1_000_000_000) + 1_000_000
+	t.Cleanup(func() {
+		db.Exec("DELETE FROM transaction_tags WHERE transaction_id IN (SELECT id FROM transactions WHERE user_id = ?)", userID)
+		db.Unscoped().Where("user_id = ?", userID).Delete(&models.Transaction{})
+		db.Unscoped().Where("user_id = ?", userID).Delete(&models.Tag{})
+	})
+
+	japan := models.Tag{UserID: userID, Name: "Japan"}
+	food := models.Tag{UserID: userID, Name: "food"}
+	if err := db.Create(&[]*models.Tag{&japan, &food}).Error; err != nil {
+		t.Fatal(err)
+	}
+	day := time.Date(2026, time.April, 1, 0, 0, 0, 0, time.UTC)
+	entries := map[string][]models.Tag{
+		"ramen":    {japan, food},
+		"hotel":    {japan},
+		"bakery":   {food},
+		"untagged": nil,
+	}
+	for note, tags := range entries {
+		tx := models.Transaction{UserID: userID, Type: "expense", Category: "Trip", Amount: money.MustParse("1.00"), Currency: "EUR", Note: note, Date: day, Tags: tags}
+		if err := db.Create(&tx).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		tags []string
+		all  bool
+		want string // notes, sorted
+	}{
+		{"any of one", []string{"JAPAN"}, false, "hotel,ramen"},
+		{"any of two", []string{"japan", "food"}, false, "bakery,hotel,ramen"},
+		{"all of two", []string{"japan", "food"}, true, "ramen"},
+		{"all with an unknown tag", []string{"japan", "museum"}, true, ""},
+	}
+	r := &TransactionRepo{DB: db}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			txs, err := r.ListTransactions(models.TransactionFilter{UserID: userID, Tags: tt.tags, AllTags: tt.all, SortBy: "amount"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var notes []string
+			for _, tx := range txs {
+				notes = append(notes, tx.Note)
+			}
+			sort.Strings(notes)
+			if got := strings.Join(notes, ","); got != tt.want {
+				t.Errorf("notes = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// totalsDB opens the postgres named by TEST_DATABASE_DSN with the tables and
+// functions the totals need, and a fresh user whose rows are removed after
+// the test. The test is skipped when the variable is unset.
+func totalsDB(t *testing.T) (*gorm.DB, uint) {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("set TEST_DATABASE_DSN to run against postgres")
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.Tag{}, &models.Category{}, &models.Transaction{}, &models.TransactionSplit{}, &models.ExchangeRate{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := InstallFunctions(db); err != nil {
+		t.Fatal(err)
+	}
+
+	userID := uint(time.Now().UnixNano()%1_000_000_000) + 1_000_000
+	t.Cleanup(func() {
+		db.Exec("DELETE FROM transaction_splits WHERE transaction_id IN (SELECT id FROM transactions WHERE user_id = ?)", userID)
+		db.Unscoped().Where("user_id = ?", userID).Delete(&models.Transaction{})
+		db.Unscoped().Where("user_id = ?", userID).Delete(&models.Category{})
+	})
+	return db, userID
+}
+
+// TestTransfers books, totals and deletes a transfer against postgres
+func TestTransfers(t *testing.T) {
+	db, userID := totalsDB(t)
+	r := &TransactionRepo{DB: db}
+	day := time.Date(2026, time.April, 1, 0, 0, 0, 0, time.UTC)
+	checking, savings := uint(1), uint(2)
+
+	salary := models.Transaction{UserID: userID, Type: "income", Category: "Salary", Amount: money.MustParse("3000"), Currency: "EUR", Date: day, AccountID: &checking}
+	rent := models.Transaction{UserID: userID, Type: "expense", Category: "Rent", Amount: money.MustParse("900"), Currency: "EUR", Date: day, AccountID: &checking}
+	for _, tx := range []*models.Transaction{&salary, &rent} {
+		if err := r.CreateTransaction(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	leg := func(accountID *uint, amount string) *models.Transaction {
+		return &models.Transaction{UserID: userID, Type: "transfer", Category: "Transfer", Amount: money.MustParse(amount), Currency: "EUR", Date: day, AccountID: accountID}
+	}
+
+	// A leg that cannot be stored takes the other one with it
+	out, in := leg(&checking, "-500"), leg(&savings, "500")
+	in.ID = rent.ID
+	if err := r.CreateTransfer(out, in); err == nil {
+		t.Fatal("transfer with a clashing leg was booked")
+	}
+	var count int64
+	db.Model(&models.Transaction{}).Where("user_id = ? AND type = 'transfer'", userID).Count(&count)
+	if count != 0 {
+		t.Fatalf("%d legs left behind by a failed transfer", count)
+	}
+
+	out, in = leg(&checking, "-500"), leg(&savings, "500")
+	if err := r.CreateTransfer(out, in); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := r.GetTransactionByID(out.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.LinkedID == nil || *stored.LinkedID != in.ID || in.LinkedID == nil || *in.LinkedID != out.ID {
+		t.Errorf("legs linked to %v and %v, want each other", stored.LinkedID, in.LinkedID)
+	}
+
+	income, expense, err := r.GetTotals(userID, "EUR", models.DateRange{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if income != salary.Amount || expense != rent.Amount {
+		t.Errorf("totals = %d income, %d expense, want the transfer left out", income, expense)
+	}
+	totals, err := r.GetCategoryTotals(userID, "EUR", models.DateRange{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, total := range totals {
+		if total.Category == "Transfer" {
+			t.Errorf("category totals include the transfer: %+v", total)
+		}
+	}
+
+	if err := r.DeleteTransfer(out.ID, in.ID); err != nil {
+		t.Fatal(err)
+	}
+	db.Model(&models.Transaction{}).Where("user_id = ? AND type = 'transfer'", userID).Count(&count)
+	if count != 0 {
+		t.Errorf("%d legs left after deleting the transfer", count)
+	}
+}
+
+// TestSplitTotals checks against postgres that split transactions count
+// towards the categories of their lines, in totals and budget spending alike
+func TestSplitTotals(t *testing.T) {
+	db, userID := totalsDB(t)
+	r := &TransactionRepo{DB: db}
+	day := time.Date(2026, time.April, 1, 0, 0, 0, 0, time.UTC)
+
+	groceries := models.Category{UserID: userID, Name: "Groceries", Kind: "expense"}
+	if err := db.Create(&groceries).Error; err != nil {
+		t.Fatal(err)
+	}
+	shop := models.Transaction{UserID: userID, Type: "expense", Category: "Split", Amount: money.MustParse("100"), Currency: "EUR", Date: day,
+		Splits: []models.TransactionSplit{
+			{Category: "Groceries", CategoryID: &groceries.ID, Amount: money.MustParse("60")},
+			{Category: "Household", Amount: money.MustParse("40")},
+		}}
+	plain := models.Transaction{UserID: userID, Type: "expense", Category: "Household", Amount: money.MustParse("5"), Currency: "EUR", Date: day}
+	for _, tx := range []*models.Transaction{&shop, &plain} {
+		if err := r.CreateTransaction(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	totals, err := r.GetCategoryTotals(userID, "EUR", models.DateRange{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]money.Amount{}
+	for _, total := range totals {
+		got[total.Category] = total.Total
+	}
+	want := map[string]money.Amount{"Groceries": money.MustParse("60"), "Household": money.MustParse("45")}
+	if len(got) != len(want) || got["Groceries"] != want["Groceries"] || got["Household"] != want["Household"] {
+		t.Errorf("category totals = %v, want %v", got, want)
+	}
+
+	spent, err := (&BudgetRepo{DB: db}).GetSpending(userID, "EUR", []models.SpendWindow{
+		{CategoryID: groceries.ID, From: day, To: day.AddDate(0, 1, 0)},
+		{Category: "Household", From: day, To: day.AddDate(0, 1, 0)},
+		{Category: "Split", From: day, To: day.AddDate(0, 1, 0)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spent[0] != money.MustParse("60") || spent[1] != money.MustParse("45") || spent[2] != 0 {
+		t.Errorf("budget spending = %v, want 60.00, 45.00 and nothing on the parent's category", spent)
+	}
+}
@@ -27,3 +27,17 @@ func (r *UserRepo) GetUserByEmail(email string) (*models.User, error) {
 func (r *UserRepo) CreateUser(user *models.User) error {
 	return r.DB.Create(user).Error
 }
+
+// GetUserByID fetches a user by ID
+func (r *UserRepo) GetUserByID(id uint) (*models.User, error) {
+	var user models.User
+	if err := r.DB.First(&user, id).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// UpdateBaseCurrency changes the currency a user's totals are converted into
+func (r *UserRepo) UpdateBaseCurrency(id uint, currency string) error {
+	return r.DB.Model(&models.User{}).Where("id = ?", id).Update("base_currency", currency).Error
+}
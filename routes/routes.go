@@ -0,0 +1,135 @@
+package routes
+
+import (
+	"net/http"
+
+	"tracker/handler"
+	"tracker/middleware"
+
+	"github.com/gorilla/mux"
+)
+
+// SetupRouter wires all handlers to their routes
+func SetupRouter(userH *handler.UserHandler, txH *handler.TransactionHandler, budH *handler.BudgetHandler, alertH *handler.AlertHandler, recH *handler.RecurringHandler, accH *handler.AccountHandler, fxH *handler.ExchangeHandler, impH *handler.ImportHandler, dupH *handler.DuplicateHandler, idemH *handler.IdempotencyHandler, ruleH *handler.RuleHandler, catH *handler.CategoryHandler, tagH *handler.TagHandler, payH *handler.PayeeHandler, attH *handler.AttachmentHandler) *mux.Router {
+	r := mux.NewRouter()
+
+	// public routes
+	r.HandleFunc("/register", userH.RegisterUser).Methods(http.MethodPost)
+	r.HandleFunc("/login", userH.LoginUser).Methods(http.MethodPost)
+	// signed, short-lived attachment download links
+	r.HandleFunc("/files/attachments", attH.DownloadLink).Methods(http.MethodGet)
+
+	// maintenance for all users, only with the operator token
+	admin := r.PathPrefix("/admin").Subrouter()
+	admin.Use(middleware.OperatorMiddleware)
+	admin.HandleFunc("/rates/reload", fxH.ReloadRates).Methods(http.MethodPost)
+
+	// everything under /api needs a valid token
+	api := r.PathPrefix("/api").Subrouter()
+	api.Use(middleware.AuthMiddleware)
+	// writes sent with an Idempotency-Key header are only carried out once
+	api.Use(idemH.Middleware)
+
+	// transactions
+	api.HandleFunc("/transactions", txH.CreateTransaction).Methods(http.MethodPost)
+	api.HandleFunc("/transactions", txH.GetTransactionByID).Methods(http.MethodGet).Queries("id", "{id}")
+	api.HandleFunc("/transactions", txH.GetTransactionsByUserID).Methods(http.MethodGet)
+	api.HandleFunc("/transactions", txH.UpdateTransaction).Methods(http.MethodPut)
+	api.HandleFunc("/transactions", txH.DeleteTransaction).Methods(http.MethodDelete)
+	api.HandleFunc("/transactions/income", txH.GetTotalIncome).Methods(http.MethodGet)
+	api.HandleFunc("/transactions/expense", txH.GetTotalExpense).Methods(http.MethodGet)
+	api.HandleFunc("/transactions/balance", txH.GetTotalBalance).Methods(http.MethodGet)
+	api.HandleFunc("/transactions/summary", txH.GetSummary).Methods(http.MethodGet)
+	api.HandleFunc("/transactions/categories", txH.GetCategoryTotals).Methods(http.MethodGet)
+	api.HandleFunc("/transactions/tags", txH.GetTagTotals).Methods(http.MethodGet)
+	api.HandleFunc("/transactions/payees", txH.GetTopPayees).Methods(http.MethodGet)
+	api.HandleFunc("/transactions/export", txH.ExportTransactions).Methods(http.MethodGet)
+	api.HandleFunc("/transactions/suggest", txH.SuggestCategories).Methods(http.MethodGet)
+
+	// attachments
+	api.HandleFunc("/attachments", attH.UploadAttachment).Methods(http.MethodPost)
+	api.HandleFunc("/attachments", attH.GetAttachmentByID).Methods(http.MethodGet).Queries("id", "{id}")
+	api.HandleFunc("/attachments", attH.GetAttachments).Methods(http.MethodGet)
+	api.HandleFunc("/attachments", attH.DeleteAttachment).Methods(http.MethodDelete)
+	api.HandleFunc("/attachments/download", attH.DownloadAttachment).Methods(http.MethodGet)
+	api.HandleFunc("/attachments/link", attH.GetAttachmentLink).Methods(http.MethodGet)
+
+	// budgets
+	api.HandleFunc("/budgets", budH.CreateBudget).Methods(http.MethodPost)
+	api.HandleFunc("/budgets", budH.GetBudgetsByUserID).Methods(http.MethodGet)
+	api.HandleFunc("/budgets", budH.UpdateBudget).Methods(http.MethodPut)
+	api.HandleFunc("/budgets", budH.DeleteBudget).Methods(http.MethodDelete)
+	api.HandleFunc("/budgets/report", budH.GetBudgetReport).Methods(http.MethodGet)
+	api.HandleFunc("/budgets/effective", budH.GetEffectiveAmount).Methods(http.MethodGet)
+
+	// recurring transactions
+	api.HandleFunc("/recurring", recH.CreateRecurring).Methods(http.MethodPost)
+	api.HandleFunc("/recurring", recH.GetRecurringByID).Methods(http.MethodGet).Queries("id", "{id}")
+	api.HandleFunc("/recurring", recH.GetRecurring).Methods(http.MethodGet)
+	api.HandleFunc("/recurring", recH.UpdateRecurring).Methods(http.MethodPut)
+	api.HandleFunc("/recurring", recH.DeleteRecurring).Methods(http.MethodDelete)
+
+	// accounts
+	api.HandleFunc("/accounts", accH.CreateAccount).Methods(http.MethodPost)
+	api.HandleFunc("/accounts", accH.GetAccountByID).Methods(http.MethodGet).Queries("id", "{id}")
+	api.HandleFunc("/accounts", accH.GetAccounts).Methods(http.MethodGet)
+	api.HandleFunc("/accounts", accH.UpdateAccount).Methods(http.MethodPut)
+	api.HandleFunc("/accounts", accH.DeleteAccount).Methods(http.MethodDelete)
+	api.HandleFunc("/accounts/balances", accH.GetAccountBalances).Methods(http.MethodGet)
+
+	// statement imports
+	api.HandleFunc("/import/profiles", impH.CreateProfile).Methods(http.MethodPost)
+	api.HandleFunc("/import/profiles", impH.GetProfileByID).Methods(http.MethodGet).Queries("id", "{id}")
+	api.HandleFunc("/import/profiles", impH.GetProfiles).Methods(http.MethodGet)
+	api.HandleFunc("/import/profiles", impH.UpdateProfile).Methods(http.MethodPut)
+	api.HandleFunc("/import/profiles", impH.DeleteProfile).Methods(http.MethodDelete)
+	api.HandleFunc("/import/csv", impH.ImportCSV).Methods(http.MethodPost)
+	api.HandleFunc("/import/statement", impH.ImportStatement).Methods(http.MethodPost)
+	api.HandleFunc("/import/beancount", impH.ImportBeancount).Methods(http.MethodPost)
+
+	// categories
+	api.HandleFunc("/categories", catH.CreateCategory).Methods(http.MethodPost)
+	api.HandleFunc("/categories", catH.GetCategoryByID).Methods(http.MethodGet).Queries("id", "{id}")
+	api.HandleFunc("/categories", catH.GetCategories).Methods(http.MethodGet)
+	api.HandleFunc("/categories", catH.UpdateCategory).Methods(http.MethodPut)
+	api.HandleFunc("/categories", catH.DeleteCategory).Methods(http.MethodDelete)
+
+	// tags
+	api.HandleFunc("/tags", tagH.CreateTag).Methods(http.MethodPost)
+	api.HandleFunc("/tags", tagH.GetTagByID).Methods(http.MethodGet).Queries("id", "{id}")
+	api.HandleFunc("/tags", tagH.GetTags).Methods(http.MethodGet)
+	api.HandleFunc("/tags", tagH.UpdateTag).Methods(http.MethodPut)
+	api.HandleFunc("/tags", tagH.DeleteTag).Methods(http.MethodDelete)
+	api.HandleFunc("/tags/merge", tagH.MergeTags).Methods(http.MethodPost)
+
+	// payees
+	api.HandleFunc("/payees", payH.CreatePayee).Methods(http.MethodPost)
+	api.HandleFunc("/payees", payH.GetPayeeByID).Methods(http.MethodGet).Queries("id", "{id}")
+	api.HandleFunc("/payees", payH.GetPayees).Methods(http.MethodGet)
+	api.HandleFunc("/payees", payH.UpdatePayee).Methods(http.MethodPut)
+	api.HandleFunc("/payees", payH.DeletePayee).Methods(http.MethodDelete)
+	api.HandleFunc("/payees/apply", payH.ApplyPayees).Methods(http.MethodPost)
+
+	// categorization rules
+	api.HandleFunc("/rules", ruleH.CreateRule).Methods(http.MethodPost)
+	api.HandleFunc("/rules", ruleH.GetRuleByID).Methods(http.MethodGet).Queries("id", "{id}")
+	api.HandleFunc("/rules", ruleH.GetRules).Methods(http.MethodGet)
+	api.HandleFunc("/rules", ruleH.UpdateRule).Methods(http.MethodPut)
+	api.HandleFunc("/rules", ruleH.DeleteRule).Methods(http.MethodDelete)
+	api.HandleFunc("/rules/test", ruleH.TestRule).Methods(http.MethodPost)
+	api.HandleFunc("/rules/apply", ruleH.ApplyRules).Methods(http.MethodPost)
+
+	// duplicate review
+	api.HandleFunc("/duplicates", dupH.GetDuplicates).Methods(http.MethodGet)
+	api.HandleFunc("/duplicates/merge", dupH.MergeDuplicate).Methods(http.MethodPost)
+	api.HandleFunc("/duplicates/dismiss", dupH.DismissDuplicate).Methods(http.MethodPost)
+
+	// alerts
+	api.HandleFunc("/alerts", alertH.GetAlerts).Methods(http.MethodGet)
+
+	// currencies
+	api.HandleFunc("/me/currency", userH.SetBaseCurrency).Methods(http.MethodPut)
+	api.HandleFunc("/rates", fxH.GetRates).Methods(http.MethodGet)
+
+	return r
+}
@@ -0,0 +1,184 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"strings"
+
+	"tracker/models"
+	"tracker/money"
+	"tracker/repository"
+)
+
+var (
+	ErrAccountNotFound    = errors.New("account not found")
+	ErrAccountArchived    = errors.New("account is archived")
+	ErrAccountInUse       = errors.New("account has transactions; archive it instead")
+	ErrInvalidAccountType = errors.New("type must be cash, checking, savings, credit, loan or investment")
+	ErrInvalidAccountName = errors.New("name is required")
+	ErrInvalidCurrency    = errors.New("currency must be a three letter ISO 4217 code")
+)
+
+var accountTypes = map[string]bool{
+	"cash":       true,
+	"checking":   true,
+	"savings":    true,
+	"credit":     true,
+	"loan":       true,
+	"investment": true,
+}
+
+type AccountService struct {
+	Repo repository.AccountRepository
+	FX   *ExchangeService // optional, supplies the user's base currency
+}
+
+// CreateAccount creates a new account
+func (a *AccountService) CreateAccount(account *models.Account) error {
+	if err := a.resolveCurrency(&account.Currency, nil, account.UserID, &account.OpeningBalance); err != nil {
+		return err
+	}
+	if err := validateAccount(account); err != nil {
+		return err
+	}
+	return a.Repo.CreateAccount(account)
+}
+
+// GetAccountsByUserID fetches the accounts of a user
+func (a *AccountService) GetAccountsByUserID(userID uint, includeArchived bool) ([]models.Account, error) {
+	return a.Repo.GetAccountsByUserID(userID, includeArchived)
+}
+
+// GetAccountByID fetches an account owned by the user
+func (a *AccountService) GetAccountByID(id uint, userID uint) (*models.Account, error) {
+	if !a.Repo.CheckAccountExistsForUser(id, userID) {
+		return nil, ErrAccountNotFound
+	}
+	return a.Repo.GetAccountByID(id)
+}
+
+// UpdateAccount updates an account owned by the user
+func (a *AccountService) UpdateAccount(account *models.Account) error {
+	if err := a.resolveCurrency(&account.Currency, nil, account.UserID, &account.OpeningBalance); err != nil {
+		return err
+	}
+	if err := validateAccount(account); err != nil {
+		return err
+	}
+
+	existing, err := a.GetAccountByID(account.ID, account.UserID)
+	if err != nil {
+		return err
+	}
+	account.CreatedAt = existing.CreatedAt
+	return a.Repo.UpdateAccount(account)
+}
+
+// DeleteAccount deletes an account without transactions
+func (a *AccountService) DeleteAccount(id uint, userID uint) error {
+	if !a.Repo.CheckAccountExistsForUser(id, userID) {
+		return ErrAccountNotFound
+	}
+
+	count, err := a.Repo.CountTransactions(id)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrAccountInUse
+	}
+
+	log.Printf("Account with ID %d found for user %d, proceeding to delete", id, userID)
+	return a.Repo.DeleteAccount(id)
+}
+
+// GetAccountBalances returns the balance of each account of a user, in the
+// account's currency and in the user's base currency
+func (a *AccountService) GetAccountBalances(userID uint, includeArchived bool) ([]models.AccountBalance, error) {
+	base, err := a.FX.BaseCurrency(userID)
+	if err != nil {
+		return nil, err
+	}
+	return a.Repo.GetAccountBalances(userID, base, includeArchived)
+}
+
+// GetAccountBalance returns the balance of one account in its own currency
+func (a *AccountService) GetAccountBalance(id uint, userID uint) (*models.AccountBalance, error) {
+	account, err := a.GetAccountByID(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	balances, err := a.Repo.GetAccountBalances(userID, account.Currency, true)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range balances {
+		if b.AccountID == id {
+			return &b, nil
+		}
+	}
+	return nil, ErrAccountNotFound
+}
+
+// resolveCurrency fills in an empty currency from the account, if any, and
+// otherwise falls back to the user's base currency. Like ResolveCurrency it
+// moves amounts read without a currency onto the one filled in.
+func (a *AccountService) resolveCurrency(currency *string, accountID *uint, userID uint, amounts ...*money.Amount) error {
+	given := *currency
+	if *currency == "" && accountID != nil && a != nil {
+		account, err := a.GetAccountByID(*accountID, userID)
+		if err != nil {
+			return err
+		}
+		*currency = account.Currency
+	}
+
+	var fx *ExchangeService
+	if a != nil {
+		fx = a.FX
+	}
+	if err := fx.ResolveCurrency(currency, userID); err != nil {
+		return err
+	}
+	if given == "" {
+		return rescaleAmounts(*currency, amounts...)
+	}
+	return nil
+}
+
+// CheckAccountUsable makes sure new transactions may be booked on the account
+func (a *AccountService) CheckAccountUsable(id uint, userID uint) error {
+	account, err := a.GetAccountByID(id, userID)
+	if err != nil {
+		return err
+	}
+	if account.Archived {
+		return ErrAccountArchived
+	}
+	return nil
+}
+
+// validateAccount checks the account name and type
+func validateAccount(account *models.Account) error {
+	account.Name = strings.TrimSpace(account.Name)
+	if account.Name == "" {
+		return ErrInvalidAccountName
+	}
+	if !accountTypes[account.Type] {
+		return ErrInvalidAccountType
+	}
+	return nil
+}
+
+// isCurrencyCode reports whether s looks like an ISO 4217 code
+func isCurrencyCode(s string) bool {
+	if len(s) != 3 {
+		return false
+	}
+	for _, c := range s {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
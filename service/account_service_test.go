@@ -0,0 +1,196 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"tracker/models"
+	"tracker/money"
+	"tracker/repository"
+
+	"gorm.io/gorm"
+)
+
+// memAccountRepo serves a fixed set of accounts
+type memAccountRepo struct {
+	repository.AccountRepository
+	accounts map[uint]*models.Account
+	booked   map[uint]int64 // transactions per account
+}
+
+func (m *memAccountRepo) CreateAccount(account *models.Account) error {
+	if m.accounts == nil {
+		m.accounts = map[uint]*models.Account{}
+	}
+	account.ID = uint(len(m.accounts) + 1)
+	m.accounts[account.ID] = account
+	return nil
+}
+
+func (m *memAccountRepo) GetAccountByID(id uint) (*models.Account, error) {
+	if a, ok := m.accounts[id]; ok {
+		return a, nil
+	}
+	return nil, errors.New("record not found")
+}
+
+func (m *memAccountRepo) CheckAccountExistsForUser(id uint, userID uint) bool {
+	a, ok := m.accounts[id]
+	return ok && a.UserID == userID
+}
+
+func (m *memAccountRepo) CountTransactions(id uint) (int64, error) {
+	return m.booked[id], nil
+}
+
+func (m *memAccountRepo) DeleteAccount(id uint) error {
+	delete(m.accounts, id)
+	return nil
+}
+
+func TestValidateAccount(t *testing.T) {
+	tests := []struct {
+		name    string
+		account models.Account
+		err     error
+	}{
+		{"valid", models.Account{Name: " Wallet ", Type: "cash"}, nil},
+		{"blank name", models.Account{Name: "  ", Type: "cash"}, ErrInvalidAccountName},
+		{"unknown type", models.Account{Name: "Crypto", Type: "wallet"}, ErrInvalidAccountType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := tt.account
+			if err := validateAccount(&a); !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if tt.err == nil && a.Name != "Wallet" {
+				t.Errorf("name = %q, want it trimmed", a.Name)
+			}
+		})
+	}
+}
+
+func TestCreateAccountCurrency(t *testing.T) {
+	fx := &ExchangeService{Users: &memUserRepo{users: map[uint]*models.User{1: {BaseCurrency: "EUR"}}}}
+	tests := []struct {
+		name     string
+		currency string
+		want     string
+		err      error
+	}{
+		{"defaults to the base currency", "", "EUR", nil},
+		{"upper-cased", "chf", "CHF", nil},
+		{"no cents", "JPY", "JPY", nil},
+		{"three decimals", "kwd", "KWD", nil},
+		{"not a currency code", "EURO", "", ErrInvalidCurrency},
+		{"digits", "E1R", "", ErrInvalidCurrency},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &memAccountRepo{}
+			s := &AccountService{Repo: repo, FX: fx}
+			a := models.Account{UserID: 1, Name: "Savings", Type: "savings", Currency: tt.currency}
+			if err := s.CreateAccount(&a); !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if tt.err == nil && (a.Currency != tt.want || repo.accounts[a.ID] == nil) {
+				t.Errorf("stored %v in %q, want it in %q", repo.accounts, a.Currency, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeleteAccount(t *testing.T) {
+	repo := &memAccountRepo{
+		accounts: map[uint]*models.Account{
+			1: {Model: gorm.Model{ID: 1}, UserID: 1, Name: "Checking"},
+			2: {Model: gorm.Model{ID: 2}, UserID: 1, Name: "Old card"},
+		},
+		booked: map[uint]int64{1: 3},
+	}
+	s := &AccountService{Repo: repo}
+
+	if err := s.DeleteAccount(2, 2); !errors.Is(err, ErrAccountNotFound) {
+		t.Errorf("another user's delete: err = %v, want %v", err, ErrAccountNotFound)
+	}
+	if err := s.DeleteAccount(1, 1); !errors.Is(err, ErrAccountInUse) {
+		t.Errorf("account with transactions: err = %v, want %v", err, ErrAccountInUse)
+	}
+	if err := s.DeleteAccount(2, 1); err != nil {
+		t.Fatal(err)
+	}
+	if len(repo.accounts) != 1 || repo.accounts[1] == nil {
+		t.Errorf("accounts left = %v, want only the one in use", repo.accounts)
+	}
+}
+
+func TestTransactionAccountChecks(t *testing.T) {
+	accounts := &memAccountRepo{accounts: map[uint]*models.Account{
+		1: {Model: gorm.Model{ID: 1}, UserID: 1, Name: "Checking"},
+		2: {Model: gorm.Model{ID: 2}, UserID: 1, Name: "Closed", Archived: true},
+		3: {Model: gorm.Model{ID: 3}, UserID: 2, Name: "Someone else's"},
+	}}
+	repo := &memTransactionRepo{}
+	s := &TransactionService{Repo: repo, Accounts: &AccountService{Repo: accounts}}
+
+	tests := []struct {
+		name      string
+		accountID uint
+		err       error
+	}{
+		{"open account", 1, nil},
+		{"archived account", 2, ErrAccountArchived},
+		{"another user's account", 3, ErrAccountNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id := tt.accountID
+			tx := models.Transaction{UserID: 1, Type: "expense", Category: "Food", Amount: money.MustParse("12"), AccountID: &id}
+			if err := s.CreateTransaction(&tx); !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+		})
+	}
+
+	// A transaction already on an archived account can still be edited in place
+	archived := uint(2)
+	repo.save(&models.Transaction{UserID: 1, Type: "expense", Category: "Food", Amount: money.MustParse("12"), AccountID: &archived})
+	update := models.Transaction{Model: gorm.Model{ID: repo.nextID}, UserID: 1, Type: "expense", Category: "Food", Amount: money.MustParse("15"), AccountID: &archived}
+	if err := s.UpdateTransaction(&update); err != nil {
+		t.Errorf("editing on the archived account: %v", err)
+	}
+	open := uint(1)
+	moved := models.Transaction{Model: gorm.Model{ID: repo.nextID}, UserID: 1, Type: "expense", Category: "Food", Amount: money.MustParse("15"), AccountID: &open}
+	if err := s.UpdateTransaction(&moved); err != nil {
+		t.Errorf("moving to an open account: %v", err)
+	}
+	back := models.Transaction{Model: gorm.Model{ID: repo.nextID}, UserID: 1, Type: "expense", Category: "Food", Amount: money.MustParse("15"), AccountID: &archived}
+	if err := s.UpdateTransaction(&back); !errors.Is(err, ErrAccountArchived) {
+		t.Errorf("moving onto the archived account: err = %v, want %v", err, ErrAccountArchived)
+	}
+}
+
+func TestRescaleAmounts(t *testing.T) {
+	tests := []struct {
+		currency string
+		in, want money.Amount
+		err      error
+	}{
+		{"EUR", 1250, 1250, nil},
+		{"KWD", 1250, 12500, nil},
+		{"JPY", 1200, 12, nil},
+		{"JPY", 1250, 0, ErrInvalidAmount},
+	}
+	for _, tt := range tests {
+		a, b := tt.in, tt.in*2
+		err := rescaleAmounts(tt.currency, &a, &b)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("rescaleAmounts(%s, %d) error = %v, want %v", tt.currency, tt.in, err, tt.err)
+			continue
+		}
+		if err == nil && (a != tt.want || b != tt.want*2) {
+			t.Errorf("rescaleAmounts(%s, %d) = %d, %d, want %d, %d", tt.currency, tt.in, a, b, tt.want, tt.want*2)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"tracker/models"
+	"tracker/notifier"
+	"tracker/repository"
+)
+
+// notifyTimeout bounds how long a single alert may spend in the notifiers
+const notifyTimeout = 30 * time.Second
+
+type AlertService struct {
+	Repo      repository.AlertRepository
+	Budgets   *BudgetService
+	Users     UserRepo
+	Notifiers []notifier.Notifier
+}
+
+// GetAlertsByUserID fetches a user's alerts, newest first
+func (a *AlertService) GetAlertsByUserID(userID uint, limit int) ([]models.Alert, error) {
+	return a.Repo.GetAlertsByUserID(userID, limit)
+}
+
+// CheckTransaction evaluates the budgets touched by an expense and records an
+// alert for every threshold crossed for the first time in the period.
+// Failures are logged rather than returned so they never block the write.
+func (a *AlertService) CheckTransaction(tx models.Transaction) {
+	if tx.Type != "expense" {
+		return
+	}
+
+	for _, category := range transactionCategories(tx) {
+		a.checkCategory(tx, category)
+	}
+}
+
+// checkCategory evaluates the budgets of one category touched by tx
+func (a *AlertService) checkCategory(tx models.Transaction, category bookedCategory) {
+	budgets, reports, err := a.Budgets.GetCategoryReports(tx.UserID, category.id, category.name, tx.Date)
+	if err != nil {
+		log.Printf("alerts: evaluate budgets for user %d: %v", tx.UserID, err)
+		return
+	}
+
+	for i, budget := range budgets {
+		report := reports[i]
+		for _, threshold := range budget.Thresholds {
+			if report.PercentUsed < float64(threshold) {
+				break // thresholds are kept sorted
+			}
+
+			alert := &models.Alert{
+				UserID:      tx.UserID,
+				BudgetID:    budget.ID,
+				Threshold:   threshold,
+				PeriodStart: report.PeriodStart,
+				Category:    budget.Category,
+				Amount:      report.EffectiveAmount,
+				Spent:       report.Spent,
+				Currency:    report.Currency,
+				Message: fmt.Sprintf("%s budget reached %d%%: spent %s %s of %s in the period starting %s",
+					budget.Category, threshold, report.Spent.Format(report.Currency), report.Currency,
+					report.EffectiveAmount.Format(report.Currency), report.PeriodStart.Format("2006-01-02")),
+			}
+
+			created, err := a.Repo.CreateAlertOnce(alert)
+			if err != nil {
+				log.Printf("alerts: save alert for budget %d: %v", budget.ID, err)
+				continue
+			}
+			if created {
+				go a.notify(*alert)
+			}
+		}
+	}
+}
+
+// bookedCategory is a category a transaction is booked on
+type bookedCategory struct {
+	id   *uint
+	name string
+}
+
+// transactionCategories lists the distinct categories a transaction is booked on
+func transactionCategories(tx models.Transaction) []bookedCategory {
+	if len(tx.Splits) == 0 {
+		return []bookedCategory{{tx.CategoryID, tx.Category}}
+	}
+
+	seen := map[string]bool{}
+	var categories []bookedCategory
+	for _, split := range tx.Splits {
+		if !seen[split.Category] {
+			seen[split.Category] = true
+			categories = append(categories, bookedCategory{split.CategoryID, split.Category})
+		}
+	}
+	return categories
+}
+
+// notify hands a freshly created alert to every notifier
+func (a *AlertService) notify(alert models.Alert) {
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+
+	n := notifier.Notification{
+		Subject: fmt.Sprintf("Budget alert: %s at %d%%", alert.Category, alert.Threshold),
+		Body:    alert.Message,
+		Alert:   alert,
+	}
+	if a.Users != nil {
+		if user, err := a.Users.GetUserByID(alert.UserID); err == nil {
+			n.Email = user.Email
+		}
+	}
+
+	for _, nt := range a.Notifiers {
+		if err := nt.Notify(ctx, n); err != nil {
+			log.Printf("alerts: notify alert %d: %v", alert.ID, err)
+		}
+	}
+}
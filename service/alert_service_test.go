@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"tracker/models"
+	"tracker/money"
+	"tracker/notifier"
+	"tracker/repository"
+
+	"gorm.io/gorm"
+)
+
+// memBudgetRepo serves fixed budgets that have all spent the same in every period
+type memBudgetRepo struct {
+	repository.BudgetRepository
+	budgets []models.Budget
+	spent   money.Amount
+}
+
+func (r *memBudgetRepo) GetBudgetsCovering(userID uint, categoryID *uint, category string) ([]models.Budget, error) {
+	var out []models.Budget
+	for _, b := range r.budgets {
+		if b.UserID == userID && b.Category == category {
+			out = append(out, b)
+		}
+	}
+	return out, nil
+}
+
+func (r *memBudgetRepo) GetSpending(userID uint, base string, windows []models.SpendWindow) ([]money.Amount, error) {
+	spent := make([]money.Amount, len(windows))
+	for i := range spent {
+		spent[i] = r.spent
+	}
+	return spent, nil
+}
+
+// memAlertRepo keeps alerts unique per budget, threshold and period like the database does
+type memAlertRepo struct {
+	repository.AlertRepository
+	alerts []models.Alert
+}
+
+func (r *memAlertRepo) CreateAlertOnce(alert *models.Alert) (bool, error) {
+	for _, a := range r.alerts {
+		if a.BudgetID == alert.BudgetID && a.Threshold == alert.Threshold && a.PeriodStart.Equal(alert.PeriodStart) {
+			return false, nil
+		}
+	}
+	r.alerts = append(r.alerts, *alert)
+	return true, nil
+}
+
+// chanNotifier hands notifications to the test
+type chanNotifier chan notifier.Notification
+
+func (c chanNotifier) Notify(_ context.Context, n notifier.Notification) error {
+	c <- n
+	return nil
+}
+
+func TestCheckTransactionAlertsOncePerThreshold(t *testing.T) {
+	budgets := &memBudgetRepo{budgets: []models.Budget{
+		{Model: gorm.Model{ID: 1}, UserID: 1, Category: "Food", Period: BudgetMonthly, Amount: money.MustParse("200"), Thresholds: models.Percentages{50, 80, 100}},
+	}}
+	alerts := &memAlertRepo{}
+	sent := make(chanNotifier, 10)
+	s := &AlertService{Repo: alerts, Budgets: &BudgetService{Repo: budgets}, Notifiers: []notifier.Notifier{sent}}
+	tx := models.Transaction{UserID: 1, Type: "expense", Category: "Food", Amount: money.MustParse("10"), Date: date(2026, time.April, 12)}
+
+	steps := []struct {
+		spent string
+		fired []int // thresholds that alert for the first time
+	}{
+		{"90", nil},
+		{"170", []int{50, 80}},
+		{"180", nil},
+		{"210", []int{100}},
+	}
+	for _, step := range steps {
+		budgets.spent = money.MustParse(step.spent)
+		before := len(alerts.alerts)
+		s.CheckTransaction(tx)
+
+		fired := alerts.alerts[before:]
+		if len(fired) != len(step.fired) {
+			t.Fatalf("at %s spent: %d alerts, want %v", step.spent, len(fired), step.fired)
+		}
+		for i, a := range fired {
+			if a.Threshold != step.fired[i] || !a.PeriodStart.Equal(date(2026, time.April, 1)) || a.Spent != budgets.spent {
+				t.Errorf("alert = %+v, want threshold %d in April", a, step.fired[i])
+			}
+			select {
+			case n := <-sent:
+				if n.Alert.UserID != 1 || n.Body != n.Alert.Message {
+					t.Errorf("notification = %+v, does not describe its alert", n)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("no notification for the %d%% alert", a.Threshold)
+			}
+		}
+	}
+
+	// Income and other categories never touch the budget
+	budgets.spent = money.MustParse("1000")
+	s.CheckTransaction(models.Transaction{UserID: 1, Type: "income", Category: "Food", Amount: money.MustParse("10"), Date: tx.Date})
+	s.CheckTransaction(models.Transaction{UserID: 1, Type: "expense", Category: "Rent", Amount: money.MustParse("10"), Date: tx.Date})
+	if len(alerts.alerts) != 3 {
+		t.Errorf("%d alerts, want 3", len(alerts.alerts))
+	}
+}
+
+func TestTransactionCategories(t *testing.T) {
+	food, groceries := uint(1), uint(2)
+	tests := []struct {
+		name string
+		tx   models.Transaction
+		want []bookedCategory
+	}{
+		{"plain", models.Transaction{Category: "Food", CategoryID: &food}, []bookedCategory{{&food, "Food"}}},
+		{"split lines replace the category", models.Transaction{Category: "Shop", Splits: []models.TransactionSplit{
+			{Category: "Groceries", CategoryID: &groceries}, {Category: "Household"}, {Category: "Groceries", CategoryID: &groceries}}},
+			[]bookedCategory{{&groceries, "Groceries"}, {nil, "Household"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := transactionCategories(tt.tx); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("categories = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,315 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"tracker/models"
+	"tracker/repository"
+	"tracker/storage"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	// DefaultMaxAttachmentSize caps uploads when MaxSize is not set
+	DefaultMaxAttachmentSize = 10 << 20
+	// attachmentLinkTTL is how long a download link keeps working
+	attachmentLinkTTL = 15 * time.Minute
+	// maxFileNameLength caps the stored file name, in bytes
+	maxFileNameLength = 255
+)
+
+var (
+	ErrAttachmentNotFound = errors.New("attachment not found")
+	ErrAttachmentTooLarge = errors.New("attachment is too large")
+	ErrAttachmentType     = errors.New("attachment must be a JPEG, PNG, GIF or WebP image or a PDF")
+	ErrEmptyAttachment    = errors.New("attachment is empty")
+	ErrNoThumbnail        = errors.New("attachment has no thumbnail")
+	ErrInvalidLink        = errors.New("download link is invalid or has expired")
+)
+
+// attachmentTypes are the content types accepted for upload. The type is
+// sniffed from the contents; what the client claims is ignored.
+var attachmentTypes = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"application/pdf": true,
+}
+
+type AttachmentService struct {
+	Repo         repository.AttachmentRepository
+	Transactions repository.TransactionRepository
+	Store        storage.BlobStore
+	Secret       []byte // signs download links
+	MaxSize      int64  // optional, defaults to DefaultMaxAttachmentSize
+}
+
+// MaxUploadSize returns the largest file accepted, in bytes
+func (s *AttachmentService) MaxUploadSize() int64 {
+	if s.MaxSize > 0 {
+		return s.MaxSize
+	}
+	return DefaultMaxAttachmentSize
+}
+
+// Upload stores a file from r as an attachment of a transaction owned by the
+// user. Images also get a thumbnail.
+func (s *AttachmentService) Upload(ctx context.Context, userID uint, txID uint, fileName string, r io.Reader) (*models.Attachment, error) {
+	if !s.Transactions.CheckTransactionExistsForUser(txID, userID) {
+		return nil, ErrTransactionNotFound
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, s.MaxUploadSize()+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > s.MaxUploadSize() {
+		return nil, ErrAttachmentTooLarge
+	}
+	if len(data) == 0 {
+		return nil, ErrEmptyAttachment
+	}
+	contentType := http.DetectContentType(data)
+	if !attachmentTypes[contentType] {
+		return nil, ErrAttachmentType
+	}
+
+	key, err := newStorageKey(userID)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	att := &models.Attachment{
+		UserID:        userID,
+		TransactionID: txID,
+		FileName:      cleanFileName(fileName),
+		ContentType:   contentType,
+		Size:          int64(len(data)),
+		Checksum:      hex.EncodeToString(sum[:]),
+		StorageKey:    key,
+	}
+
+	if err := s.Store.Put(ctx, key, bytes.NewReader(data), att.Size, contentType); err != nil {
+		return nil, fmt.Errorf("store attachment: %w", err)
+	}
+	if strings.HasPrefix(contentType, "image/") {
+		s.storeThumbnail(ctx, att, data)
+	}
+
+	if err := s.Repo.CreateAttachment(att); err != nil {
+		s.deleteBlobs(ctx, att)
+		return nil, err
+	}
+	return att, nil
+}
+
+// storeThumbnail stores a preview of an image. An image that cannot be
+// previewed is still kept, just without a thumbnail.
+func (s *AttachmentService) storeThumbnail(ctx context.Context, att *models.Attachment, data []byte) {
+	thumb, err := makeThumbnail(data)
+	if err != nil {
+		return
+	}
+	key := att.StorageKey + "-thumb.jpg"
+	if err := s.Store.Put(ctx, key, bytes.NewReader(thumb), int64(len(thumb)), "image/jpeg"); err != nil {
+		log.Printf("attachment thumbnail: %v", err)
+		return
+	}
+	att.ThumbnailKey = key
+	att.HasThumbnail = true
+}
+
+// GetAttachments fetches the attachments of a transaction owned by the user
+func (s *AttachmentService) GetAttachments(txID uint, userID uint) ([]models.Attachment, error) {
+	if !s.Transactions.CheckTransactionExistsForUser(txID, userID) {
+		return nil, ErrTransactionNotFound
+	}
+	atts, err := s.Repo.GetAttachmentsByTransactionID(txID)
+	if err != nil {
+		return nil, err
+	}
+	if atts == nil {
+		atts = []models.Attachment{}
+	}
+	return atts, nil
+}
+
+// GetAttachmentByID fetches an attachment owned by the user whose
+// transaction still exists
+func (s *AttachmentService) GetAttachmentByID(id uint, userID uint) (*models.Attachment, error) {
+	if !s.Repo.CheckAttachmentExistsForUser(id, userID) {
+		return nil, ErrAttachmentNotFound
+	}
+	att, err := s.Repo.GetAttachmentByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if !s.Transactions.CheckTransactionExistsForUser(att.TransactionID, userID) {
+		return nil, ErrAttachmentNotFound
+	}
+	return att, nil
+}
+
+// Open returns the contents of an attachment owned by the user, or of its
+// thumbnail; the caller closes them
+func (s *AttachmentService) Open(ctx context.Context, id uint, userID uint, thumbnail bool) (io.ReadCloser, *models.Attachment, error) {
+	att, err := s.GetAttachmentByID(id, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	key := att.StorageKey
+	if thumbnail {
+		if !att.HasThumbnail {
+			return nil, nil, ErrNoThumbnail
+		}
+		key = att.ThumbnailKey
+	}
+
+	rc, err := s.Store.Get(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil, ErrAttachmentNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return rc, att, nil
+}
+
+// DeleteAttachment deletes an attachment owned by the user along with its
+// files
+func (s *AttachmentService) DeleteAttachment(ctx context.Context, id uint, userID uint) error {
+	att, err := s.GetAttachmentByID(id, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.Repo.DeleteAttachment(id); err != nil {
+		return err
+	}
+	s.deleteBlobs(ctx, att)
+	return nil
+}
+
+// DeleteForTransactions deletes the attachments of deleted transactions
+// along with their files
+func (s *AttachmentService) DeleteForTransactions(ctx context.Context, txIDs ...uint) error {
+	atts, err := s.Repo.DeleteAttachmentsByTransactionIDs(txIDs...)
+	if err != nil {
+		return err
+	}
+	for i := range atts {
+		s.deleteBlobs(ctx, &atts[i])
+	}
+	return nil
+}
+
+// deleteBlobs removes the files of an attachment. Failures are only logged:
+// the attachment is gone either way and a stray file harms no one.
+func (s *AttachmentService) deleteBlobs(ctx context.Context, att *models.Attachment) {
+	keys := []string{att.StorageKey}
+	if att.ThumbnailKey != "" {
+		keys = append(keys, att.ThumbnailKey)
+	}
+	for _, key := range keys {
+		if err := s.Store.Delete(ctx, key); err != nil {
+			log.Printf("delete attachment %s: %v", key, err)
+		}
+	}
+}
+
+// SignLink issues a token that lets whoever holds it download an attachment
+// of the user, or its thumbnail, for a short while without logging in
+func (s *AttachmentService) SignLink(id uint, userID uint, thumbnail bool) (string, time.Time, error) {
+	att, err := s.GetAttachmentByID(id, userID)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if thumbnail && !att.HasThumbnail {
+		return "", time.Time{}, ErrNoThumbnail
+	}
+
+	expires := time.Now().Add(attachmentLinkTTL)
+	// No user_id claim, so the token cannot pass for a login token
+	claims := jwt.MapClaims{
+		"scope":      "attachment",
+		"attachment": att.ID,
+		"owner":      att.UserID,
+		"thumbnail":  thumbnail,
+		"exp":        expires.Unix(),
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.Secret)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expires, nil
+}
+
+// OpenLink returns the contents a download link token points at
+func (s *AttachmentService) OpenLink(ctx context.Context, token string) (io.ReadCloser, *models.Attachment, bool, error) {
+	parsed, err := jwt.Parse(token, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+		return s.Secret, nil
+	})
+	if err != nil || !parsed.Valid {
+		return nil, nil, false, ErrInvalidLink
+	}
+	claims, ok := parsed.Claims.(jwt.MapClaims)
+	if !ok || claims["scope"] != "attachment" {
+		return nil, nil, false, ErrInvalidLink
+	}
+	id, ok1 := claims["attachment"].(float64)
+	owner, ok2 := claims["owner"].(float64)
+	thumbnail, ok3 := claims["thumbnail"].(bool)
+	if !ok1 || !ok2 || !ok3 {
+		return nil, nil, false, ErrInvalidLink
+	}
+
+	rc, att, err := s.Open(ctx, uint(id), uint(owner), thumbnail)
+	return rc, att, thumbnail, err
+}
+
+// newStorageKey picks an unguessable key for a new file of the user
+func newStorageKey(userID uint) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("users/%d/%s", userID, hex.EncodeToString(b)), nil
+}
+
+// cleanFileName keeps the last path element of a client supplied file name,
+// without control characters and cut to maxFileNameLength
+func cleanFileName(name string) string {
+	name = path.Base(strings.ReplaceAll(name, `\`, "/"))
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+	for len(name) > maxFileNameLength {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	if name == "" || name == "." || name == ".." || name == "/" {
+		return "attachment"
+	}
+	return name
+}
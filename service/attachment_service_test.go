@@ -0,0 +1,259 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"strings"
+	"testing"
+
+	"tracker/models"
+	"tracker/repository"
+	"tracker/storage"
+)
+
+// memAttachmentRepo keeps attachments in memory
+type memAttachmentRepo struct {
+	atts   map[uint]*models.Attachment
+	nextID uint
+}
+
+func (m *memAttachmentRepo) CreateAttachment(att *models.Attachment) error {
+	m.nextID++
+	att.ID = m.nextID
+	m.atts[att.ID] = att
+	return nil
+}
+
+func (m *memAttachmentRepo) GetAttachmentsByTransactionID(txID uint) ([]models.Attachment, error) {
+	var atts []models.Attachment
+	for id := uint(1); id <= m.nextID; id++ {
+		if att, ok := m.atts[id]; ok && att.TransactionID == txID {
+			atts = append(atts, *att)
+		}
+	}
+	return atts, nil
+}
+
+func (m *memAttachmentRepo) GetAttachmentByID(id uint) (*models.Attachment, error) {
+	att := *m.atts[id]
+	return &att, nil
+}
+
+func (m *memAttachmentRepo) CheckAttachmentExistsForUser(id uint, userID uint) bool {
+	att, ok := m.atts[id]
+	return ok && att.UserID == userID
+}
+
+func (m *memAttachmentRepo) DeleteAttachment(id uint) error {
+	delete(m.atts, id)
+	return nil
+}
+
+func (m *memAttachmentRepo) DeleteAttachmentsByTransactionIDs(txIDs ...uint) ([]models.Attachment, error) {
+	var deleted []models.Attachment
+	for id, att := range m.atts {
+		for _, txID := range txIDs {
+			if att.TransactionID == txID {
+				deleted = append(deleted, *att)
+				delete(m.atts, id)
+			}
+		}
+	}
+	return deleted, nil
+}
+
+// userTransactions stands in for the transactions a user owns
+type userTransactions struct {
+	repository.TransactionRepository
+	owner map[uint]uint // transaction ID → user ID
+}
+
+func (u userTransactions) CheckTransactionExistsForUser(id uint, userID uint) bool {
+	owner, ok := u.owner[id]
+	return ok && owner == userID
+}
+
+// receiptPDF is enough of a PDF for content sniffing
+const receiptPDF = "%PDF-1.4\n% receipt\n"
+
+func newTestAttachmentService(t *testing.T) (*AttachmentService, userTransactions) {
+	t.Helper()
+	txs := userTransactions{owner: map[uint]uint{10: 1, 11: 1, 20: 2}}
+	return &AttachmentService{
+		Repo:         &memAttachmentRepo{atts: map[uint]*models.Attachment{}},
+		Transactions: txs,
+		Store:        &storage.FSStore{Root: t.TempDir()},
+		Secret:       []byte("test"),
+	}, txs
+}
+
+func TestAttachmentOfDeletedTransaction(t *testing.T) {
+	s, txs := newTestAttachmentService(t)
+	ctx := context.Background()
+
+	att, err := s.Upload(ctx, 1, 10, "receipt.pdf", strings.NewReader(receiptPDF))
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := s.SignLink(att.ID, 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	delete(txs.owner, 10)
+	if _, err := s.GetAttachmentByID(att.ID, 1); !errors.Is(err, ErrAttachmentNotFound) {
+		t.Errorf("GetAttachmentByID: err = %v, want ErrAttachmentNotFound", err)
+	}
+	if _, _, err := s.Open(ctx, att.ID, 1, false); !errors.Is(err, ErrAttachmentNotFound) {
+		t.Errorf("Open: err = %v, want ErrAttachmentNotFound", err)
+	}
+	if _, _, _, err := s.OpenLink(ctx, token); !errors.Is(err, ErrAttachmentNotFound) {
+		t.Errorf("OpenLink: err = %v, want ErrAttachmentNotFound", err)
+	}
+
+	if err := s.DeleteForTransactions(ctx, 10); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Store.Get(ctx, att.StorageKey); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("file still stored after its transaction was deleted: err = %v", err)
+	}
+}
+
+func TestAttachmentLinks(t *testing.T) {
+	s, _ := newTestAttachmentService(t)
+	ctx := context.Background()
+
+	att, err := s.Upload(ctx, 1, 10, "receipt.pdf", strings.NewReader(receiptPDF))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.SignLink(att.ID, 2, false); !errors.Is(err, ErrAttachmentNotFound) {
+		t.Errorf("link for another user: err = %v, want ErrAttachmentNotFound", err)
+	}
+	if _, _, err := s.SignLink(att.ID, 1, true); !errors.Is(err, ErrNoThumbnail) {
+		t.Errorf("thumbnail link of a PDF: err = %v, want ErrNoThumbnail", err)
+	}
+	token, _, err := s.SignLink(att.ID, 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rc, got, thumbnail, err := s.OpenLink(ctx, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc.Close()
+	if got.ID != att.ID || thumbnail {
+		t.Errorf("link opened attachment %d (thumbnail %v), want %d", got.ID, thumbnail, att.ID)
+	}
+
+	other := *s
+	other.Secret = []byte("other")
+	if _, _, _, err := other.OpenLink(ctx, token); !errors.Is(err, ErrInvalidLink) {
+		t.Errorf("link signed with another secret: err = %v, want ErrInvalidLink", err)
+	}
+}
+
+func TestDeleteForTransactionsKeepsOthers(t *testing.T) {
+	s, _ := newTestAttachmentService(t)
+	ctx := context.Background()
+
+	gone, err := s.Upload(ctx, 1, 10, "a.pdf", strings.NewReader(receiptPDF))
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept, err := s.Upload(ctx, 1, 11, "b.pdf", bytes.NewReader([]byte(receiptPDF)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.DeleteForTransactions(ctx, 10); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetAttachmentByID(gone.ID, 1); !errors.Is(err, ErrAttachmentNotFound) {
+		t.Errorf("deleted attachment: err = %v, want ErrAttachmentNotFound", err)
+	}
+	rc, _, err := s.Open(ctx, kept.ID, 1, false)
+	if err != nil {
+		t.Fatalf("attachment of another transaction: %v", err)
+	}
+	rc.Close()
+}
+
+func TestGetAttachmentsEmpty(t *testing.T) {
+	s, _ := newTestAttachmentService(t)
+
+	atts, err := s.GetAttachments(10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Handlers encode the slice; nil would become null instead of []
+	if atts == nil || len(atts) != 0 {
+		t.Errorf("atts = %#v, want an empty slice", atts)
+	}
+	if _, err := s.GetAttachments(20, 1); !errors.Is(err, ErrTransactionNotFound) {
+		t.Errorf("transaction of another user: err = %v, want ErrTransactionNotFound", err)
+	}
+}
+
+func TestUploadLimits(t *testing.T) {
+	png := encodePNG(t, image.NewGray(image.Rect(0, 0, 4, 4)))
+	tests := []struct {
+		name      string
+		userID    uint
+		txID      uint
+		data      string
+		wantErr   error
+		wantType  string
+		wantThumb bool
+	}{
+		{name: "pdf", userID: 1, txID: 10, data: receiptPDF, wantType: "application/pdf"},
+		{name: "image gets a thumbnail", userID: 1, txID: 10, data: string(png), wantType: "image/png", wantThumb: true},
+		{name: "exactly the limit", userID: 1, txID: 10, data: receiptPDF + strings.Repeat(" ", 64-len(receiptPDF)), wantType: "application/pdf"},
+		{name: "one byte over the limit", userID: 1, txID: 10, data: receiptPDF + strings.Repeat(" ", 65-len(receiptPDF)), wantErr: ErrAttachmentTooLarge},
+		{name: "empty", userID: 1, txID: 10, data: "", wantErr: ErrEmptyAttachment},
+		{name: "html", userID: 1, txID: 10, data: "<html><script>alert(1)</script>", wantErr: ErrAttachmentType},
+		{name: "transaction of another user", userID: 1, txID: 20, data: receiptPDF, wantErr: ErrTransactionNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestAttachmentService(t)
+			s.MaxSize = 64
+			if tt.wantThumb {
+				s.MaxSize = 0
+			}
+			att, err := s.Upload(context.Background(), tt.userID, tt.txID, "receipt", strings.NewReader(tt.data))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if att.ContentType != tt.wantType || att.Size != int64(len(tt.data)) || att.HasThumbnail != tt.wantThumb {
+				t.Errorf("attachment = %s %d bytes thumbnail %v, want %s %d bytes thumbnail %v",
+					att.ContentType, att.Size, att.HasThumbnail, tt.wantType, len(tt.data), tt.wantThumb)
+			}
+		})
+	}
+}
+
+func TestCleanFileName(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"receipt.pdf", "receipt.pdf"},
+		{"../../etc/passwd", "passwd"},
+		{`C:\Users\me\scan 1.jpg`, "scan 1.jpg"},
+		{"bad\r\nname.pdf", "badname.pdf"},
+		{"  spaced.pdf  ", "spaced.pdf"},
+		{"", "attachment"},
+		{"/", "attachment"},
+		{"..", "attachment"},
+		{strings.Repeat("ä", 200) + ".pdf", strings.Repeat("ä", 127)},
+	}
+	for _, tt := range tests {
+		if got := cleanFileName(tt.in); got != tt.want {
+			t.Errorf("cleanFileName(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
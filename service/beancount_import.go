@@ -0,0 +1,581 @@
+package service
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"tracker/models"
+	"tracker/money"
+)
+
+var (
+	// beancountTxn starts a transaction directive: date, then a flag or "txn"
+	beancountTxn = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2})\s+(\*|!|txn)(?:\s+(.*))?$`)
+
+	// beancountMeta is a key: value metadata line
+	beancountMeta = regexp.MustCompile(`^([a-z][A-Za-z0-9_-]*):\s*(.*)$`)
+
+	// beancountPostingLine is an optional flag, an account and what follows it
+	beancountPostingLine = regexp.MustCompile(`^(?:[!*]\s+)?([A-Z][^\s]*)\s*(.*)$`)
+
+	// beancountBudgetLine is fava's budget directive: date, account, period, amount
+	beancountBudgetLine = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2})\s+custom\s+"budget"\s+([A-Z][^\s]*)\s+("[^"]*")\s+(.+)$`)
+
+	// beancountUnits is the amount and commodity at the start of a posting
+	beancountUnits = regexp.MustCompile(`^([-+]?[\d,]*\.?\d+)\s+([A-Z][A-Z0-9'._-]*)\s*(.*)$`)
+)
+
+// beancountEntry is a transaction or budget directive as read from the file
+type beancountEntry struct {
+	line     int
+	date     string
+	period   string // budget directives only
+	header   string // payee and narration strings, tags and links
+	meta     map[string]string
+	postings []beancountPosting
+	raw      []string // the lines of the entry, to identify it
+}
+
+// beancountPosting is one posting of an entry with its metadata
+type beancountPosting struct {
+	account  string
+	amount   *money.Amount // nil when left for beancount to balance
+	currency string
+	price    *money.Amount // total price of the units in priceCur, from @ or @@
+	priceCur string
+	meta     map[string]string
+}
+
+// ParseBeancount reads the transactions and budgets of a beancount journal,
+// such as one exported by this service. The money side of each entry must be
+// one of the accounts (under Assets: or Liabilities:, named like
+// JournalAccountNames does) or JournalUnassigned; the category side comes
+// from Expenses: or Income: accounts, or from category metadata where an
+// account name could not hold it. Entries between two accounts are
+// transfers, and so are two legs booked against JournalTransfers on the same
+// day. Budgets come from fava's custom "budget" directives. Other directives
+// (open, balance, price, ...) are skipped.
+func ParseBeancount(r io.Reader, accounts []models.Account) ([]models.ImportRow, []models.Budget, error) {
+	decoded, err := DecodeReader(r, "utf-8")
+	if err != nil {
+		return nil, nil, err
+	}
+	entries, err := readBeancount(decoded)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ids := map[string]*uint{JournalUnassigned: nil}
+	for id, name := range JournalAccountNames(accounts, ExportBeancount) {
+		id := id
+		ids[name] = &id
+	}
+
+	var rows []models.ImportRow
+	var budgets []models.Budget
+	var raw [][]string // the lines behind each row
+	for _, e := range entries {
+		if e.period != "" {
+			b, err := beancountBudget(e)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%w: line %d: %v", ErrMalformedImport, e.line, err)
+			}
+			budgets = append(budgets, b)
+			continue
+		}
+		rows = append(rows, beancountRow(e, ids))
+		raw = append(raw, e.raw)
+	}
+	rows, raw = pairTransferLegs(rows, raw)
+
+	seen := map[string]int{}
+	for i := range rows {
+		row := &rows[i]
+		if row.Transaction.ExternalID == "" {
+			sum := sha1.Sum([]byte(strings.Join(raw[i], "\n")))
+			key := hex.EncodeToString(sum[:8])
+			seen[key]++
+			row.Transaction.ExternalID = fmt.Sprintf("beancount:%s:%d", key, seen[key])
+			if row.Counterpart != nil && row.Counterpart.ExternalID == "" {
+				row.Counterpart.ExternalID = row.Transaction.ExternalID
+			}
+		}
+	}
+
+	if len(rows) == 0 && len(budgets) == 0 {
+		return nil, nil, ErrEmptyImportFile
+	}
+	return rows, budgets, nil
+}
+
+// pairTransferLegs joins each sending transfer leg with the first receiving
+// leg of the same day on another account, in file order, into one transfer.
+// Legs left without a partner cannot be imported. The lines of both legs
+// identify the joined row.
+func pairTransferLegs(rows []models.ImportRow, raw [][]string) ([]models.ImportRow, [][]string) {
+	isLeg := func(row models.ImportRow) bool {
+		return row.Transaction.Type == TypeTransfer && row.Counterpart == nil && len(row.Errors) == 0
+	}
+	paired := map[int]bool{}
+	for i := range rows {
+		out := &rows[i].Transaction
+		if !isLeg(rows[i]) || out.Amount >= 0 {
+			continue
+		}
+		for k := range rows {
+			in := rows[k].Transaction
+			if paired[k] || !isLeg(rows[k]) || in.Amount <= 0 || !in.Date.Equal(out.Date) || sameAccount(in.AccountID, out.AccountID) {
+				continue
+			}
+			if in.Currency == out.Currency && in.Amount != -out.Amount {
+				continue
+			}
+			paired[i], paired[k] = true, true
+			out.Amount = -out.Amount
+			rows[i].Counterpart = &in
+			raw[i] = append(append([]string{}, raw[i]...), raw[k]...)
+			break
+		}
+	}
+
+	var keptRows []models.ImportRow
+	var keptRaw [][]string
+	for i, row := range rows {
+		if paired[i] && row.Counterpart == nil {
+			continue // joined into the sending leg's row
+		}
+		if isLeg(row) && !paired[i] {
+			row.Transaction.Amount = row.Transaction.Amount.Abs()
+			row.Errors = append(row.Errors, "transfer leg has no other leg on the same day in this file")
+		}
+		keptRows = append(keptRows, row)
+		keptRaw = append(keptRaw, raw[i])
+	}
+	return keptRows, keptRaw
+}
+
+// beancountBudget maps a fava budget directive onto a budget of the category
+// of its Expenses: account
+func beancountBudget(e beancountEntry) (models.Budget, error) {
+	var b models.Budget
+	period := strings.ToLower(e.period)
+	switch period {
+	case BudgetWeekly, BudgetMonthly, BudgetQuarterly, BudgetYearly:
+	default:
+		return b, fmt.Errorf("budget period %q is not weekly, monthly, quarterly or yearly", e.period)
+	}
+	if len(e.postings) != 1 || e.postings[0].amount == nil || !strings.HasPrefix(e.postings[0].account, "Expenses:") {
+		return b, fmt.Errorf("a budget needs an Expenses account and an amount")
+	}
+	p := e.postings[0]
+	b.Category = firstNonEmpty(e.meta["category"], AccountCategory(p.account))
+	b.Period = period
+	b.Amount, b.Currency = p.amount.Abs(), p.currency
+	return b, nil
+}
+
+// readBeancount collects the transaction and budget directives of a journal
+func readBeancount(r io.Reader) ([]beancountEntry, error) {
+	var entries []beancountEntry
+	var current *beancountEntry
+	postingIndent := -1
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for lineNo := 1; sc.Scan(); lineNo++ {
+		line := strings.TrimRight(sc.Text(), "\r")
+		trimmed := strings.TrimSpace(stripBeancountComment(line))
+		if trimmed == "" {
+			continue
+		}
+
+		if line[0] != ' ' && line[0] != '\t' {
+			if current != nil {
+				entries = append(entries, *current)
+				current = nil
+			}
+			if m := beancountTxn.FindStringSubmatch(trimmed); m != nil {
+				current = &beancountEntry{line: lineNo, date: m[1], header: m[3], meta: map[string]string{}, raw: []string{trimmed}}
+				postingIndent = -1
+			} else if m := beancountBudgetLine.FindStringSubmatch(trimmed); m != nil {
+				p, err := parseBeancountPosting(m[2] + " " + m[4])
+				if err != nil {
+					return nil, fmt.Errorf("%w: line %d: %v", ErrMalformedImport, lineNo, err)
+				}
+				current = &beancountEntry{line: lineNo, date: m[1], period: beancountValue(m[3]), meta: map[string]string{}, postings: []beancountPosting{p}}
+				postingIndent = len(line) // metadata below belongs to the directive
+			}
+			continue
+		}
+		if current == nil {
+			continue // metadata of a directive that is not imported
+		}
+		current.raw = append(current.raw, trimmed)
+
+		indent := len(line) - len(strings.TrimLeft(line, " \t"))
+		if m := beancountMeta.FindStringSubmatch(trimmed); m != nil {
+			value := beancountValue(m[2])
+			if n := len(current.postings); n > 0 && indent > postingIndent {
+				current.postings[n-1].meta[m[1]] = value
+			} else {
+				current.meta[m[1]] = value
+			}
+			continue
+		}
+
+		p, err := parseBeancountPosting(trimmed)
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %v", ErrMalformedImport, lineNo, err)
+		}
+		current.postings = append(current.postings, p)
+		postingIndent = indent
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedImport, err)
+	}
+	if current != nil {
+		entries = append(entries, *current)
+	}
+	return entries, nil
+}
+
+// parseBeancountPosting reads Account [amount CUR [@ price CUR | @@ total CUR]]
+func parseBeancountPosting(s string) (beancountPosting, error) {
+	p := beancountPosting{meta: map[string]string{}}
+	m := beancountPostingLine.FindStringSubmatch(s)
+	if m == nil {
+		return p, fmt.Errorf("%q is not a posting", s)
+	}
+	p.account = m[1]
+	rest := strings.TrimSpace(m[2])
+	if rest == "" {
+		return p, nil
+	}
+
+	u := beancountUnits.FindStringSubmatch(rest)
+	if u == nil {
+		return p, fmt.Errorf("amount %q cannot be read", rest)
+	}
+	units, err := ParseDecimal(u[1], ".", u[2])
+	if err != nil {
+		return p, fmt.Errorf("amount %q cannot be read", u[1])
+	}
+	p.amount, p.currency = &units, u[2]
+
+	rest = strings.TrimSpace(u[3])
+	if strings.HasPrefix(rest, "{") {
+		return p, fmt.Errorf("lots held at cost are not supported")
+	}
+	if rest == "" {
+		return p, nil
+	}
+	total := strings.HasPrefix(rest, "@@")
+	price := beancountUnits.FindStringSubmatch(strings.TrimSpace(strings.TrimLeft(rest, "@")))
+	if !strings.HasPrefix(rest, "@") || price == nil {
+		return p, fmt.Errorf("price %q cannot be read", rest)
+	}
+	value, err := ParseDecimal(price[1], ".", price[2])
+	if err != nil {
+		return p, fmt.Errorf("price %q cannot be read", price[1])
+	}
+	if !total {
+		value = value.MulRatio(units.Abs().Major(u[2]))
+	}
+	value = value.Abs()
+	p.price, p.priceCur = &value, price[2]
+	return p, nil
+}
+
+// beancountRow maps one entry onto a transaction, or a transfer between two accounts
+func beancountRow(e beancountEntry, ids map[string]*uint) models.ImportRow {
+	row := models.ImportRow{Line: e.line}
+	tx := &row.Transaction
+
+	date, err := time.Parse("2006-01-02", e.date)
+	if err != nil {
+		row.Errors = append(row.Errors, fmt.Sprintf("date %q is not a date", e.date))
+	}
+	tx.Date = date
+	if v := e.meta["value_date"]; v != "" {
+		if vd, err := time.Parse("2006-01-02", v); err == nil {
+			tx.ValueDate = &vd
+		} else {
+			row.Errors = append(row.Errors, fmt.Sprintf("value_date %q is not a date", v))
+		}
+	}
+	strs := beancountStrings(e.header)
+	switch len(strs) {
+	case 1:
+		tx.Note = strs[0]
+	case 2:
+		tx.Payee, tx.Note = strs[0], strs[1]
+	}
+	for _, name := range beancountTags(e.header, e.meta["tags"]) {
+		tx.Tags = append(tx.Tags, models.Tag{Name: name})
+	}
+	tx.ExternalID = e.meta["external_id"]
+
+	if err := balanceBeancount(e.postings); err != nil {
+		row.Errors = append(row.Errors, err.Error())
+		return row
+	}
+
+	var funds, categories, transfers []beancountPosting
+	for _, p := range e.postings {
+		switch {
+		case strings.HasPrefix(p.account, "Expenses:"), strings.HasPrefix(p.account, "Income:"):
+			categories = append(categories, p)
+		case strings.HasPrefix(p.account, "Assets:"), strings.HasPrefix(p.account, "Liabilities:"):
+			funds = append(funds, p)
+		case p.account == JournalTransfers:
+			transfers = append(transfers, p)
+		default:
+			row.Errors = append(row.Errors, fmt.Sprintf("account %s is not under Assets, Liabilities, Expenses or Income", p.account))
+			return row
+		}
+	}
+	accountOf := func(name string) *uint {
+		id, ok := ids[name]
+		if !ok {
+			row.Errors = append(row.Errors, fmt.Sprintf("account %s does not match any of your accounts", name))
+		}
+		return id
+	}
+
+	if len(transfers) > 0 {
+		// One leg of a transfer; ParseBeancount pairs it with the other leg
+		if len(transfers) != 1 || len(funds) != 1 || len(categories) != 0 {
+			row.Errors = append(row.Errors, fmt.Sprintf("a transfer leg books one account against %s only", JournalTransfers))
+			return row
+		}
+		tx.Type = TypeTransfer
+		tx.Category = firstNonEmpty(e.meta["category"], "Transfer")
+		tx.AccountID, tx.Amount, tx.Currency = accountOf(funds[0].account), *funds[0].amount, funds[0].currency
+		return row
+	}
+
+	if len(categories) == 0 {
+		if len(funds) != 2 {
+			row.Errors = append(row.Errors, "entries without Expenses or Income postings must move money between two accounts")
+			return row
+		}
+		out, in := funds[0], funds[1]
+		if *out.amount > 0 {
+			out, in = in, out
+		}
+		tx.Type = TypeTransfer
+		tx.Category = firstNonEmpty(e.meta["category"], "Transfer")
+		tx.AccountID, tx.Amount, tx.Currency = accountOf(out.account), out.amount.Abs(), out.currency
+		row.Counterpart = &models.Transaction{
+			Type:       TypeTransfer,
+			Category:   tx.Category,
+			Note:       tx.Note,
+			Date:       tx.Date,
+			ValueDate:  tx.ValueDate,
+			ExternalID: tx.ExternalID,
+			AccountID:  accountOf(in.account),
+			Amount:     in.amount.Abs(),
+			Currency:   in.currency,
+		}
+		return row
+	}
+
+	if len(funds) > 1 {
+		row.Errors = append(row.Errors, "entries may only book on one account")
+		return row
+	}
+	if len(funds) == 1 {
+		tx.AccountID = accountOf(funds[0].account)
+	}
+
+	tx.Type = "expense"
+	if strings.HasPrefix(categories[0].account, "Income:") {
+		tx.Type = "income"
+	}
+	tx.Currency = categories[0].currency
+	var total money.Amount
+	for _, p := range categories {
+		if !strings.HasPrefix(p.account, strings.Split(categories[0].account, ":")[0]+":") {
+			row.Errors = append(row.Errors, "entries cannot mix Expenses and Income postings")
+			return row
+		}
+		if p.currency != tx.Currency || p.price != nil {
+			row.Errors = append(row.Errors, "entries in more than one currency are only supported as transfers")
+			return row
+		}
+		// Income is credited, so its postings are negative
+		amount := *p.amount
+		if tx.Type == "income" {
+			amount = -amount
+		}
+		if amount <= 0 {
+			row.Errors = append(row.Errors, fmt.Sprintf("%s posting must be positive for an %s", p.account, tx.Type))
+			return row
+		}
+		total += amount
+		if len(categories) > 1 {
+			tx.Splits = append(tx.Splits, models.TransactionSplit{
+				Category: firstNonEmpty(p.meta["category"], AccountCategory(p.account)),
+				Amount:   amount,
+				Note:     p.meta["note"],
+			})
+		}
+	}
+	tx.Amount = total
+	tx.Category = firstNonEmpty(e.meta["category"], categories[0].meta["category"], AccountCategory(categories[0].account))
+	if len(categories) > 1 && e.meta["category"] == "" {
+		tx.Category = "Split"
+	}
+	return row
+}
+
+// balanceBeancount fills in the amount of the one posting left blank, which
+// beancount balances against the others; they must share a currency then
+func balanceBeancount(postings []beancountPosting) error {
+	blank := -1
+	var sum money.Amount
+	currency := ""
+	priced := false
+	for i, p := range postings {
+		if p.amount == nil {
+			if blank >= 0 {
+				return fmt.Errorf("only one posting may leave out its amount")
+			}
+			blank = i
+			continue
+		}
+		cur, weight := p.currency, *p.amount
+		if p.price != nil {
+			priced = true
+			cur, weight = p.priceCur, *p.price
+			if *p.amount < 0 {
+				weight = -weight
+			}
+		}
+		if currency != "" && cur != currency {
+			currency = "*"
+		} else if currency == "" {
+			currency = cur
+		}
+		sum += weight
+	}
+	if blank < 0 {
+		// A per-unit price may leave a rounding difference of a cent
+		if currency != "*" && sum != 0 && !(priced && sum.Abs() <= 1) {
+			return fmt.Errorf("postings do not balance: off by %s %s", sum.Format(currency), currency)
+		}
+		return nil
+	}
+	if currency == "*" || currency == "" {
+		return fmt.Errorf("cannot balance a blank posting against several currencies")
+	}
+	rest := -sum
+	postings[blank].amount, postings[blank].currency = &rest, currency
+	return nil
+}
+
+// beancountStrings returns the quoted strings (payee, narration) of a header
+func beancountStrings(s string) []string {
+	var out []string
+	for {
+		start := strings.IndexByte(s, '"')
+		if start < 0 {
+			return out
+		}
+		v, rest, ok := readBeancountString(s[start:])
+		if !ok {
+			return out
+		}
+		out = append(out, v)
+		s = rest
+	}
+}
+
+// beancountTags returns the #tags of a header, or the tag names metadata
+// lists when a tag could not be written exactly
+func beancountTags(header, meta string) []string {
+	var tags []string
+	if meta != "" {
+		for _, name := range strings.Split(meta, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				tags = append(tags, name)
+			}
+		}
+		return tags
+	}
+	for header != "" {
+		if header[0] == '"' {
+			_, rest, ok := readBeancountString(header)
+			if !ok {
+				break
+			}
+			header = rest
+			continue
+		}
+		end := strings.IndexAny(header, " \t\"")
+		if end < 0 {
+			end = len(header)
+		}
+		if word := header[:end]; len(word) > 1 && word[0] == '#' {
+			tags = append(tags, word[1:])
+		}
+		header = strings.TrimLeft(header[end:], " \t")
+	}
+	return tags
+}
+
+// beancountValue unquotes a metadata value when it is a string
+func beancountValue(s string) string {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, `"`) {
+		if v, _, ok := readBeancountString(s); ok {
+			return v
+		}
+	}
+	return s
+}
+
+// readBeancountString reads the string s starts with and returns what follows it
+func readBeancountString(s string) (string, string, bool) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				b.WriteByte(s[i])
+			}
+		case '"':
+			return b.String(), s[i+1:], true
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return "", "", false
+}
+
+// stripBeancountComment cuts a ; comment off a line, leaving strings alone
+func stripBeancountComment(line string) string {
+	quoted := false
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			if quoted {
+				i++
+			}
+		case '"':
+			quoted = !quoted
+		case ';':
+			if !quoted {
+				return line[:i]
+			}
+		}
+	}
+	return line
+}
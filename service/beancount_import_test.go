@@ -0,0 +1,369 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"tracker/models"
+	"tracker/money"
+
+	"gorm.io/gorm"
+)
+
+var journalAccounts = []models.Account{
+	{Model: gorm.Model{ID: 1}, Name: "Checking", Type: "checking"},
+	{Model: gorm.Model{ID: 2}, Name: "Savings", Type: "savings"},
+}
+
+// transferLegs returns the sending and receiving leg of a transfer of amount
+func transferLegs(amount string, day time.Time) (models.Transaction, models.Transaction) {
+	checking, savings := uint(1), uint(2)
+	outID, inID := uint(10), uint(11)
+	out := models.Transaction{
+		UserID: 1, Type: TypeTransfer, Category: "Transfer", Note: "to savings",
+		Amount: -money.MustParse(amount), Currency: "EUR", Date: day, AccountID: &checking, LinkedID: &inID,
+	}
+	in := models.Transaction{
+		UserID: 1, Type: TypeTransfer, Category: "Transfer", Note: "to savings",
+		Amount: money.MustParse(amount), Currency: "EUR", Date: day, AccountID: &savings, LinkedID: &outID,
+	}
+	out.ID, in.ID = outID, inID
+	return out, in
+}
+
+// unlinked drops the link to the other leg, so the journal writes the leg alone
+func unlinked(leg models.Transaction) models.Transaction {
+	leg.LinkedID = nil
+	return leg
+}
+
+func writeJournal(t *testing.T, opts JournalOptions, txs ...models.Transaction) string {
+	t.Helper()
+	var buf bytes.Buffer
+	w := newJournalWriter(&buf, ExportBeancount, opts)
+	for _, tx := range txs {
+		if err := w.Write(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestBeancountTransferRoundTrip(t *testing.T) {
+	day := time.Date(2026, time.May, 4, 0, 0, 0, 0, time.UTC)
+	out, in := transferLegs("250.00", day)
+	linked := func(id uint) (*models.Transaction, error) {
+		if id == in.ID {
+			return &in, nil
+		}
+		return nil, errors.New("not found")
+	}
+
+	tests := []struct {
+		name    string
+		opts    JournalOptions
+		legs    []models.Transaction
+		wantErr string
+	}{
+		{"both legs exported", JournalOptions{Accounts: journalAccounts}, []models.Transaction{out, in}, ""},
+		{"other leg looked up", JournalOptions{Accounts: journalAccounts, LinkedLeg: linked}, []models.Transaction{out}, ""},
+		{"legs exported alone", JournalOptions{Accounts: journalAccounts}, []models.Transaction{unlinked(out), unlinked(in)}, ""},
+		{"leg without partner", JournalOptions{Accounts: journalAccounts}, []models.Transaction{out}, "no other leg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			journal := writeJournal(t, tt.opts, tt.legs...)
+			rows, _, err := ParseBeancount(strings.NewReader(journal), journalAccounts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rows) != 1 {
+				t.Fatalf("got %d rows, want 1:\n%s", len(rows), journal)
+			}
+			row := rows[0]
+			if tt.wantErr != "" {
+				if len(row.Errors) == 0 || !strings.Contains(row.Errors[0], tt.wantErr) {
+					t.Fatalf("errors = %v, want %q", row.Errors, tt.wantErr)
+				}
+				return
+			}
+			if len(row.Errors) > 0 {
+				t.Fatalf("unexpected errors %v:\n%s", row.Errors, journal)
+			}
+			if row.Counterpart == nil {
+				t.Fatalf("transfer came back without its receiving leg:\n%s", journal)
+			}
+			if *row.Transaction.AccountID != 1 || *row.Counterpart.AccountID != 2 {
+				t.Errorf("accounts = %d -> %d, want 1 -> 2", *row.Transaction.AccountID, *row.Counterpart.AccountID)
+			}
+			if want := money.MustParse("250.00"); row.Transaction.Amount != want || row.Counterpart.Amount != want {
+				t.Errorf("amounts = %s / %s, want %s", row.Transaction.Amount, row.Counterpart.Amount, want)
+			}
+		})
+	}
+}
+
+func TestBeancountBudgetRoundTrip(t *testing.T) {
+	start := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 2, 0)
+	budgets := []models.Budget{
+		{Category: "Groceries", Amount: money.MustParse("400.00"), Currency: "EUR", Period: BudgetMonthly},
+		{Category: "Eating out", Amount: money.MustParse("80.00"), Currency: "EUR", Period: BudgetWeekly},
+		{Category: "Trip", Amount: money.MustParse("900.00"), Currency: "EUR", Period: BudgetCustom, StartDate: &start, EndDate: &end},
+	}
+	journal := writeJournal(t, JournalOptions{Budgets: budgets})
+
+	rows, got, err := ParseBeancount(strings.NewReader(journal), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 0 {
+		t.Errorf("got %d transaction rows, want none", len(rows))
+	}
+	// Custom periods have no fava equivalent and stay a comment
+	if len(got) != 2 {
+		t.Fatalf("got %d budgets, want 2:\n%s", len(got), journal)
+	}
+	for i, b := range got {
+		want := budgets[i]
+		if b.Category != want.Category || b.Period != want.Period || b.Amount != want.Amount || b.Currency != want.Currency {
+			t.Errorf("budget %d = %s %s %s %s, want %s %s %s %s", i, b.Category, b.Period, b.Amount, b.Currency, want.Category, want.Period, want.Amount, want.Currency)
+		}
+	}
+}
+
+func TestParseBeancountBudgetErrors(t *testing.T) {
+	tests := []struct{ name, line string }{
+		{"unknown period", `2026-01-01 custom "budget" Expenses:Food "daily" 10.00 EUR`},
+		{"not an expense", `2026-01-01 custom "budget" Income:Salary "monthly" 10.00 EUR`},
+		{"no amount", `2026-01-01 custom "budget" Expenses:Food "monthly" ten EUR`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := ParseBeancount(strings.NewReader(tt.line+"\n"), nil)
+			if !errors.Is(err, ErrMalformedImport) {
+				t.Errorf("err = %v, want ErrMalformedImport", err)
+			}
+		})
+	}
+}
+
+func TestParseBeancount(t *testing.T) {
+	tests := []struct {
+		name       string
+		entry      string
+		typ        string
+		amount     string
+		category   string
+		note       string
+		account    uint // 0 when the entry books on no account
+		splits     int
+		transferTo uint
+	}{
+		{"expense", `2026-03-02 * "Acme Markt" "Groceries"
+  Assets:Checking   -23.90 EUR
+  Expenses:Food:Groceries   23.90 EUR`, "expense", "23.90", "Food / Groceries", "Groceries", 1, 0, 0},
+		{"income is credited", `2026-03-02 * "Salary"
+  Assets:Checking   1250.00 EUR
+  Income:Salary   -1250.00 EUR`, "income", "1250.00", "Salary", "Salary", 1, 0, 0},
+		{"blank posting is balanced", `2026-03-02 txn "Bakery"
+  Expenses:Food   4.20 EUR
+  Assets:Savings`, "expense", "4.20", "Food", "Bakery", 2, 0, 0},
+		{"unassigned", `2026-03-02 * "Cash"
+  Assets:Unassigned   -5.00 EUR
+  Expenses:Food   5.00 EUR`, "expense", "5.00", "Food", "Cash", 0, 0, 0},
+		{"split", `2026-03-02 * "Drugstore"
+  Assets:Checking   -60.00 EUR
+  Expenses:Household   40.00 EUR
+  Expenses:Health:Pharmacy   20.00 EUR`, "expense", "60.00", "Split", "Drugstore", 1, 2, 0},
+		{"category metadata", `2026-03-02 * "Drugstore"
+  category: "Drugstore run"
+  Assets:Checking   -60.00 EUR
+  Expenses:Household   40.00 EUR
+  Expenses:Health   20.00 EUR`, "expense", "60.00", "Drugstore run", "Drugstore", 1, 2, 0},
+		{"transfer", `2026-03-02 * "to savings"
+  Assets:Checking   -250.00 EUR
+  Assets:Savings   250.00 EUR`, TypeTransfer, "250.00", "Transfer", "to savings", 1, 0, 2},
+		{"transfer in file order", `2026-03-02 * "from savings"
+  Assets:Checking   250.00 EUR
+  Assets:Savings   -250.00 EUR`, TypeTransfer, "250.00", "Transfer", "from savings", 2, 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, _, err := ParseBeancount(strings.NewReader(tt.entry+"\n"), journalAccounts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rows) != 1 || len(rows[0].Errors) > 0 {
+				t.Fatalf("rows = %+v, want one row without errors", rows)
+			}
+			row, tx := rows[0], rows[0].Transaction
+			if row.Line != 1 || !tx.Date.Equal(time.Date(2026, time.March, 2, 0, 0, 0, 0, time.UTC)) || tx.Currency != "EUR" {
+				t.Errorf("row = line %d %s %s, want line 1 2026-03-02 EUR", row.Line, tx.Date.Format("2006-01-02"), tx.Currency)
+			}
+			if tx.Type != tt.typ || tx.Amount != money.MustParse(tt.amount) || tx.Category != tt.category || tx.Note != tt.note || len(tx.Splits) != tt.splits {
+				t.Errorf("row = %s %s %q %q %d splits, want %s %s %q %q %d splits",
+					tx.Type, tx.Amount, tx.Category, tx.Note, len(tx.Splits), tt.typ, tt.amount, tt.category, tt.note, tt.splits)
+			}
+			if got := accountID(tx.AccountID); got != tt.account {
+				t.Errorf("account = %d, want %d", got, tt.account)
+			}
+			if tt.transferTo == 0 {
+				if row.Counterpart != nil {
+					t.Errorf("counterpart = %+v, want none", row.Counterpart)
+				}
+			} else if row.Counterpart == nil || accountID(row.Counterpart.AccountID) != tt.transferTo || row.Counterpart.Amount != tx.Amount {
+				t.Errorf("counterpart = %+v, want %s on account %d", row.Counterpart, tx.Amount, tt.transferTo)
+			}
+			if tx.ExternalID == "" {
+				t.Error("row has no external ID")
+			}
+		})
+	}
+}
+
+// accountID returns the ID behind id, or 0 when there is none
+func accountID(id *uint) uint {
+	if id == nil {
+		return 0
+	}
+	return *id
+}
+
+func TestBeancountPayeeAndTagsRoundTrip(t *testing.T) {
+	checking := uint(1)
+	day := time.Date(2026, time.March, 2, 0, 0, 0, 0, time.UTC)
+	entry := func(payee, note string, tags ...string) models.Transaction {
+		tx := models.Transaction{UserID: 1, Type: "expense", Category: "Groceries", Amount: money.MustParse("23.90"),
+			Currency: "EUR", Date: day, AccountID: &checking, Payee: payee, Note: note}
+		for _, name := range tags {
+			tx.Tags = append(tx.Tags, models.Tag{Name: name})
+		}
+		return tx
+	}
+
+	tests := []struct {
+		name       string
+		tx         models.Transaction
+		wantHeader string
+	}{
+		{"note only", entry("", "weekly shop"), `2026-03-02 * "weekly shop"`},
+		{"payee", entry("Acme Markt", "weekly shop"), `2026-03-02 * "Acme Markt" "weekly shop"`},
+		{"payee without note", entry("Acme Markt", ""), `2026-03-02 * "Acme Markt" ""`},
+		{"tags", entry("Acme Markt", "weekly shop", "Japan", "food"), `2026-03-02 * "Acme Markt" "weekly shop" #Japan #food`},
+		{"tag names a #tag cannot hold", entry("", "ramen", "Japan 2026", "café"), `2026-03-02 * "ramen" #Japan-2026 #caf`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			journal := writeJournal(t, JournalOptions{Accounts: journalAccounts}, tt.tx)
+			if header := strings.SplitN(journal, "\n", 2)[0]; header != tt.wantHeader {
+				t.Errorf("header = %s, want %s", header, tt.wantHeader)
+			}
+
+			rows, _, err := ParseBeancount(strings.NewReader(journal), journalAccounts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rows) != 1 || len(rows[0].Errors) > 0 {
+				t.Fatalf("rows = %+v, want one row without errors:\n%s", rows, journal)
+			}
+			got := rows[0].Transaction
+			if got.Payee != tt.tx.Payee || got.Note != tt.tx.Note {
+				t.Errorf("payee %q, note %q, want %q, %q", got.Payee, got.Note, tt.tx.Payee, tt.tx.Note)
+			}
+			if names, want := strings.Join(tagNames(got.Tags), ","), strings.Join(tagNames(tt.tx.Tags), ","); names != want {
+				t.Errorf("tags = %q, want %q:\n%s", names, want, journal)
+			}
+		})
+	}
+}
+
+func TestParseBeancountTags(t *testing.T) {
+	tests := []struct {
+		header, meta string
+		want         string
+	}{
+		{`"Acme" "shop" #food #trip-2026 ^invoice-12`, "", "food,trip-2026"},
+		{`"#not-a-tag" #food`, "", "food"},
+		{`"shop"`, "", ""},
+		{`"shop" #Japan-2026`, "Japan 2026, food", "Japan 2026,food"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(beancountTags(tt.header, tt.meta), ","); got != tt.want {
+			t.Errorf("beancountTags(%s, %q) = %q, want %q", tt.header, tt.meta, got, tt.want)
+		}
+	}
+}
+
+func TestParseBeancountMetadata(t *testing.T) {
+	journal := `2026-03-02 * "Drugstore"
+  external_id: "bank-77"
+  value_date: 2026-03-04
+  Assets:Checking   -60.00 EUR
+  Expenses:Household   40.00 EUR
+    note: "Soap"
+  Expenses:Health   20.00 EUR
+    category: "Pharmacy"
+`
+	rows, _, err := ParseBeancount(strings.NewReader(journal), journalAccounts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := rows[0].Transaction
+	if tx.ExternalID != "bank-77" || tx.ValueDate == nil || !tx.ValueDate.Equal(time.Date(2026, time.March, 4, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("external ID %q, value date %v, want bank-77 and 2026-03-04", tx.ExternalID, tx.ValueDate)
+	}
+	if len(tx.Splits) != 2 || tx.Splits[0].Note != "Soap" || tx.Splits[1].Category != "Pharmacy" {
+		t.Errorf("splits = %+v, want the note and category from the posting metadata", tx.Splits)
+	}
+}
+
+func TestParseBeancountEntryErrors(t *testing.T) {
+	tests := []struct {
+		name, entry, wantErr string
+	}{
+		{"unbalanced", "  Assets:Checking   -20.00 EUR\n  Expenses:Food   19.00 EUR", "do not balance"},
+		{"two blank postings", "  Assets:Checking\n  Expenses:Food", "only one posting"},
+		{"unknown account", "  Assets:Wallet   -5.00 EUR\n  Expenses:Food   5.00 EUR", "does not match any of your accounts"},
+		{"equity", "  Assets:Checking   -5.00 EUR\n  Equity:Opening   5.00 EUR", "is not under Assets"},
+		{"two accounts and a category", "  Assets:Checking   -5.00 EUR\n  Assets:Savings   -5.00 EUR\n  Expenses:Food   10.00 EUR", "only book on one account"},
+		{"expenses and income", "  Expenses:Food   5.00 EUR\n  Income:Refund   -5.00 EUR", "cannot mix"},
+		{"negative expense", "  Assets:Checking   5.00 EUR\n  Expenses:Food   -5.00 EUR", "must be positive"},
+		{"bad value date", "  value_date: soon\n  Assets:Checking   -5.00 EUR\n  Expenses:Food   5.00 EUR", "value_date"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			journal := "2026-03-02 * \"Entry\"\n" + tt.entry + "\n"
+			rows, _, err := ParseBeancount(strings.NewReader(journal), journalAccounts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rows) != 1 || len(rows[0].Errors) == 0 || !strings.Contains(rows[0].Errors[0], tt.wantErr) {
+				t.Fatalf("rows = %+v, want one row failing with %q", rows, tt.wantErr)
+			}
+		})
+	}
+
+	files := []struct {
+		name, journal string
+		wantErr       error
+	}{
+		{"empty", "", ErrEmptyImportFile},
+		{"other directives only", "2026-01-01 open Assets:Checking EUR\n", ErrEmptyImportFile},
+		{"lot at cost", "2026-03-02 * \"Shares\"\n  Assets:Checking   10 ACME {12.00 EUR}\n  Assets:Savings\n", ErrMalformedImport},
+		{"unreadable amount", "2026-03-02 * \"Entry\"\n  Assets:Checking   ten EUR\n", ErrMalformedImport},
+	}
+	for _, tt := range files {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := ParseBeancount(strings.NewReader(tt.journal), journalAccounts); !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
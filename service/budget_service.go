@@ -2,20 +2,64 @@ package service
 
 import (
 	"errors"
-	
 	"log"
+	"math"
+	"slices"
+	"sort"
+	"time"
 	"tracker/models"
+	"tracker/money"
 	"tracker/repository"
 )
 
-var ErrBudgetNotFound = errors.New("budget not found")
+var (
+	ErrBudgetNotFound      = errors.New("budget not found")
+	ErrInvalidBudgetPeriod = errors.New("period must be weekly, monthly, quarterly, yearly or custom")
+	ErrCustomBudgetDates   = errors.New("custom budgets need a start_date on or before end_date")
+	ErrInvalidRollover     = errors.New("rollover must be none, surplus, deficit or both")
+	ErrInvalidThreshold    = errors.New("thresholds must be percentages between 1 and 1000")
+)
+
+const (
+	BudgetWeekly    = "weekly"
+	BudgetMonthly   = "monthly"
+	BudgetQuarterly = "quarterly"
+	BudgetYearly    = "yearly"
+	BudgetCustom    = "custom"
+)
+
+// Rollover modes decide what happens to a period's leftover (or overspend)
+const (
+	RolloverNone    = "none"
+	RolloverSurplus = "surplus"
+	RolloverDeficit = "deficit"
+	RolloverBoth    = "both"
+)
+
+// maxRolloverPeriods caps how many periods, the current one included, a
+// rolling budget carries over from. Older periods no longer count, so a
+// budget's history stops growing once it is a year of months old.
+const maxRolloverPeriods = 12
 
 type BudgetService struct {
-	Repo repository.BudgetRepository
+	Repo       repository.BudgetRepository
+	FX         *ExchangeService // optional, converts spending and budgets into the base currency
+	Categories *CategoryService // optional, links budgets to their categories
 }
 
 // CreateBudget creates a new budget
 func (b *BudgetService) CreateBudget(budget *models.Budget) error {
+	if err := b.FX.ResolveCurrency(&budget.Currency, budget.UserID, &budget.Amount); err != nil {
+		return err
+	}
+	if err := validateBudget(budget); err != nil {
+		return err
+	}
+	if b.Categories != nil {
+		if err := b.Categories.assignBudget(budget, false); err != nil {
+			return err
+		}
+	}
 	return b.Repo.CreateBudget(budget)
 }
 
@@ -30,6 +74,28 @@ func (b *BudgetService) GetBudgetsByUserID(userID uint) ([]models.Budget, error)
 
 // UpdateBudget updates a budget
 func (b *BudgetService) UpdateBudget(budget *models.Budget) error {
+	if err := b.FX.ResolveCurrency(&budget.Currency, budget.UserID, &budget.Amount); err != nil {
+		return err
+	}
+	if err := validateBudget(budget); err != nil {
+		return err
+	}
+
+	// Ensure budget exists and belongs to user; keep its creation time since
+	// the rollover history starts there
+	if !b.Repo.CheckBudgetExistsForUser(budget.ID, budget.UserID) {
+		return ErrBudgetNotFound
+	}
+	existing, err := b.Repo.GetBudgetByID(budget.ID)
+	if err != nil {
+		return err
+	}
+	if b.Categories != nil {
+		if err := b.Categories.assignBudget(budget, true); err != nil {
+			return err
+		}
+	}
+	budget.CreatedAt = existing.CreatedAt
 	return b.Repo.UpdateBudget(budget)
 }
 
@@ -44,3 +110,265 @@ func (b *BudgetService) DeleteBudget(id uint, userID uint) error {
 	log.Printf("Budget with ID %d found for user %d, proceeding to delete", id, userID)
 	return b.Repo.DeleteBudget(id)
 }
+
+// GetBudgetReport compares every budget of a user against the expenses booked
+// in the budget period containing at, including rollover from earlier periods
+func (b *BudgetService) GetBudgetReport(userID uint, at time.Time) ([]models.BudgetReport, error) {
+	budgets, err := b.Repo.GetBudgetsByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	return b.buildReports(userID, budgets, at)
+}
+
+// GetCategoryReports returns the budgets spending on one category counts
+// towards, its own and its parents', together with their reports for the
+// period containing at
+func (b *BudgetService) GetCategoryReports(userID uint, categoryID *uint, category string, at time.Time) ([]models.Budget, []models.BudgetReport, error) {
+	budgets, err := b.Repo.GetBudgetsCovering(userID, categoryID, category)
+	if err != nil {
+		return nil, nil, err
+	}
+	reports, err := b.buildReports(userID, budgets, at)
+	if err != nil {
+		return nil, nil, err
+	}
+	return budgets, reports, nil
+}
+
+// buildReports computes the reports for the given budgets
+func (b *BudgetService) buildReports(userID uint, budgets []models.Budget, at time.Time) ([]models.BudgetReport, error) {
+	// Collect the history of every budget so all spending comes back in one query
+	var windows []models.SpendWindow
+	offsets := make([]int, len(budgets)+1)
+	for i, budget := range budgets {
+		offsets[i] = len(windows)
+		windows = append(windows, budgetHistoryWindows(budget, at)...)
+	}
+	offsets[len(budgets)] = len(windows)
+
+	base, err := b.FX.BaseCurrency(userID)
+	if err != nil {
+		return nil, err
+	}
+	spent, err := b.Repo.GetSpending(userID, base, windows)
+	if err != nil {
+		return nil, err
+	}
+
+	reports := make([]models.BudgetReport, len(budgets))
+	for i, budget := range budgets {
+		converted, err := b.inCurrency(budget, base, at)
+		if err != nil {
+			return nil, err
+		}
+		chain := buildRolloverChain(converted, windows[offsets[i]:offsets[i+1]], spent[offsets[i]:offsets[i+1]])
+		reports[i] = buildBudgetReport(converted, chain, at)
+	}
+	return reports, nil
+}
+
+// inCurrency returns a copy of the budget with its amount converted into the
+// given currency at the rates of at
+func (b *BudgetService) inCurrency(budget models.Budget, currency string, at time.Time) (models.Budget, error) {
+	if budget.Currency == "" || budget.Currency == currency {
+		budget.Currency = currency
+		return budget, nil
+	}
+	amount, err := b.FX.Convert(budget.Amount, budget.Currency, currency, at)
+	if err != nil {
+		return budget, err
+	}
+	budget.Amount = amount
+	budget.Currency = currency
+	return budget, nil
+}
+
+// GetEffectiveAmount returns what a budget allows in the period containing at,
+// i.e. its amount plus whatever rolled over from earlier periods, and the
+// user's base currency it is expressed in
+func (b *BudgetService) GetEffectiveAmount(id uint, userID uint, at time.Time) (money.Amount, string, error) {
+	if !b.Repo.CheckBudgetExistsForUser(id, userID) {
+		return 0, "", ErrBudgetNotFound
+	}
+	budget, err := b.Repo.GetBudgetByID(id)
+	if err != nil {
+		return 0, "", err
+	}
+
+	base, err := b.FX.BaseCurrency(userID)
+	if err != nil {
+		return 0, "", err
+	}
+	converted, err := b.inCurrency(*budget, base, at)
+	if err != nil {
+		return 0, "", err
+	}
+
+	windows := budgetHistoryWindows(converted, at)
+	spent, err := b.Repo.GetSpending(userID, base, windows)
+	if err != nil {
+		return 0, "", err
+	}
+	chain := buildRolloverChain(converted, windows, spent)
+	return chain[len(chain)-1].EffectiveAmount, base, nil
+}
+
+// BudgetPeriodWindow returns the [from, to) window of the budget period containing at
+func BudgetPeriodWindow(budget models.Budget, at time.Time) (time.Time, time.Time) {
+	day := time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, at.Location())
+
+	switch budget.Period {
+	case BudgetWeekly:
+		// weeks start on Monday
+		offset := (int(day.Weekday()) + 6) % 7
+		from := day.AddDate(0, 0, -offset)
+		return from, from.AddDate(0, 0, 7)
+	case BudgetQuarterly:
+		firstMonth := time.Month((int(at.Month())-1)/3*3 + 1)
+		from := time.Date(at.Year(), firstMonth, 1, 0, 0, 0, 0, at.Location())
+		return from, from.AddDate(0, 3, 0)
+	case BudgetYearly:
+		from := time.Date(at.Year(), time.January, 1, 0, 0, 0, 0, at.Location())
+		return from, from.AddDate(1, 0, 0)
+	case BudgetCustom:
+		if budget.StartDate != nil && budget.EndDate != nil {
+			return *budget.StartDate, budget.EndDate.AddDate(0, 0, 1)
+		}
+	}
+
+	// monthly is the default
+	from := time.Date(at.Year(), at.Month(), 1, 0, 0, 0, 0, at.Location())
+	return from, from.AddDate(0, 1, 0)
+}
+
+// budgetHistoryWindows lists the periods that matter for a budget at the given
+// time, oldest first: only the current one, or when it rolls over the periods
+// since creation, at most maxRolloverPeriods of them. Budgets keep no history
+// of their amount, so every period is measured against the current one.
+func budgetHistoryWindows(budget models.Budget, at time.Time) []models.SpendWindow {
+	from, to := BudgetPeriodWindow(budget, at)
+	windows := []models.SpendWindow{spendWindow(budget, from, to)}
+	if budget.Rollover == RolloverNone || budget.Rollover == "" || budget.Period == BudgetCustom || budget.CreatedAt.IsZero() {
+		return windows
+	}
+
+	first, _ := BudgetPeriodWindow(budget, budget.CreatedAt)
+	for len(windows) < maxRolloverPeriods && first.Before(from) {
+		from, to = BudgetPeriodWindow(budget, from.AddDate(0, 0, -1))
+		windows = append(windows, spendWindow(budget, from, to))
+	}
+	slices.Reverse(windows)
+	return windows
+}
+
+// spendWindow asks for the budget's spending between from and to
+func spendWindow(budget models.Budget, from, to time.Time) models.SpendWindow {
+	w := models.SpendWindow{Category: budget.Category, From: from, To: to}
+	if budget.CategoryID != nil {
+		w.CategoryID = *budget.CategoryID
+	}
+	return w
+}
+
+// buildRolloverChain walks the periods in order, carrying what is left (or
+// overspent) from one period into the next as the budget's rollover mode allows.
+// The last step is the current period.
+func buildRolloverChain(budget models.Budget, windows []models.SpendWindow, spent []money.Amount) []models.RolloverStep {
+	chain := make([]models.RolloverStep, len(windows))
+	var carry money.Amount
+	for i, w := range windows {
+		effective := budget.Amount + carry
+		chain[i] = models.RolloverStep{
+			PeriodStart:     w.From,
+			PeriodEnd:       w.To,
+			CarriedIn:       carry,
+			EffectiveAmount: effective,
+			Spent:           spent[i],
+		}
+		carry = carryOver(budget.Rollover, effective-spent[i])
+		chain[i].CarriedOut = carry
+	}
+	return chain
+}
+
+// carryOver returns the part of what is left in a period that moves to the next one
+func carryOver(mode string, left money.Amount) money.Amount {
+	switch {
+	case left > 0 && (mode == RolloverSurplus || mode == RolloverBoth):
+		return left
+	case left < 0 && (mode == RolloverDeficit || mode == RolloverBoth):
+		return left
+	}
+	return 0
+}
+
+// buildBudgetReport works out remaining, percent used and projected spend for
+// the current period, the last step of the chain
+func buildBudgetReport(budget models.Budget, chain []models.RolloverStep, now time.Time) models.BudgetReport {
+	current := chain[len(chain)-1]
+	spent := current.Spent
+	amount := current.EffectiveAmount
+
+	report := models.BudgetReport{
+		BudgetID:        budget.ID,
+		Category:        budget.Category,
+		Period:          budget.Period,
+		PeriodStart:     current.PeriodStart,
+		PeriodEnd:       current.PeriodEnd,
+		Amount:          budget.Amount,
+		Currency:        budget.Currency,
+		Spent:           spent,
+		Remaining:       amount - spent,
+		ProjectedSpend:  spent,
+		Rollover:        budget.Rollover,
+		CarriedIn:       current.CarriedIn,
+		EffectiveAmount: amount,
+		RolloverChain:   chain[:len(chain)-1],
+	}
+	if amount > 0 {
+		report.PercentUsed = math.Round(float64(spent)/float64(amount)*10000) / 100
+	}
+
+	// Extrapolate the current pace over the rest of the period
+	elapsed := now.Sub(current.PeriodStart)
+	total := current.PeriodEnd.Sub(current.PeriodStart)
+	if elapsed > 0 && elapsed < total {
+		report.ProjectedSpend = spent.MulRatio(float64(total) / float64(elapsed))
+	}
+	return report
+}
+
+// validateBudget fills in defaults for period, rollover and thresholds and checks their values
+func validateBudget(budget *models.Budget) error {
+	switch budget.Period {
+	case "":
+		budget.Period = BudgetMonthly
+	case BudgetWeekly, BudgetMonthly, BudgetQuarterly, BudgetYearly:
+	case BudgetCustom:
+		if budget.StartDate == nil || budget.EndDate == nil || budget.EndDate.Before(*budget.StartDate) {
+			return ErrCustomBudgetDates
+		}
+	default:
+		return ErrInvalidBudgetPeriod
+	}
+
+	switch budget.Rollover {
+	case "":
+		budget.Rollover = RolloverNone
+	case RolloverNone, RolloverSurplus, RolloverDeficit, RolloverBoth:
+	default:
+		return ErrInvalidRollover
+	}
+
+	if len(budget.Thresholds) == 0 {
+		budget.Thresholds = models.Percentages{50, 80, 100}
+	}
+	for _, t := range budget.Thresholds {
+		if t <= 0 || t > 1000 {
+			return ErrInvalidThreshold
+		}
+	}
+	sort.Ints(budget.Thresholds)
+	return nil
+}
@@ -0,0 +1,248 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"tracker/models"
+	"tracker/money"
+
+	"gorm.io/gorm"
+)
+
+func TestBudgetPeriodWindow(t *testing.T) {
+	start, end := date(2026, time.March, 10), date(2026, time.April, 9)
+	tests := []struct {
+		name     string
+		budget   models.Budget
+		at       time.Time
+		from, to time.Time
+	}{
+		{"weekly from Monday", models.Budget{Period: BudgetWeekly}, time.Date(2026, time.March, 11, 15, 30, 0, 0, time.UTC), date(2026, time.March, 9), date(2026, time.March, 16)},
+		{"weekly on Sunday", models.Budget{Period: BudgetWeekly}, date(2026, time.March, 15), date(2026, time.March, 9), date(2026, time.March, 16)},
+		{"weekly across new year", models.Budget{Period: BudgetWeekly}, date(2026, time.January, 1), date(2025, time.December, 29), date(2026, time.January, 5)},
+		{"monthly", models.Budget{Period: BudgetMonthly}, date(2026, time.February, 28), date(2026, time.February, 1), date(2026, time.March, 1)},
+		{"monthly is the default", models.Budget{}, date(2026, time.December, 31), date(2026, time.December, 1), date(2027, time.January, 1)},
+		{"quarterly", models.Budget{Period: BudgetQuarterly}, date(2026, time.August, 15), date(2026, time.July, 1), date(2026, time.October, 1)},
+		{"yearly", models.Budget{Period: BudgetYearly}, date(2026, time.August, 15), date(2026, time.January, 1), date(2027, time.January, 1)},
+		{"custom includes its end date", models.Budget{Period: BudgetCustom, StartDate: &start, EndDate: &end}, date(2026, time.March, 20), start, date(2026, time.April, 10)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, to := BudgetPeriodWindow(tt.budget, tt.at)
+			if !from.Equal(tt.from) || !to.Equal(tt.to) {
+				t.Errorf("window = [%s, %s), want [%s, %s)", from.Format("2006-01-02"), to.Format("2006-01-02"), tt.from.Format("2006-01-02"), tt.to.Format("2006-01-02"))
+			}
+		})
+	}
+}
+
+func TestValidateBudget(t *testing.T) {
+	start, end := date(2026, time.March, 10), date(2026, time.April, 9)
+	tests := []struct {
+		name    string
+		budget  models.Budget
+		wantErr error
+	}{
+		{"defaults", models.Budget{}, nil},
+		{"custom", models.Budget{Period: BudgetCustom, StartDate: &start, EndDate: &end}, nil},
+		{"custom of one day", models.Budget{Period: BudgetCustom, StartDate: &start, EndDate: &start}, nil},
+		{"custom without end", models.Budget{Period: BudgetCustom, StartDate: &start}, ErrCustomBudgetDates},
+		{"custom ending before it starts", models.Budget{Period: BudgetCustom, StartDate: &end, EndDate: &start}, ErrCustomBudgetDates},
+		{"unknown period", models.Budget{Period: "daily"}, ErrInvalidBudgetPeriod},
+		{"unknown rollover", models.Budget{Rollover: "all"}, ErrInvalidRollover},
+		{"zero threshold", models.Budget{Thresholds: models.Percentages{0, 80}}, ErrInvalidThreshold},
+		{"threshold too high", models.Budget{Thresholds: models.Percentages{1001}}, ErrInvalidThreshold},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := tt.budget
+			if err := validateBudget(&b); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	b := models.Budget{Thresholds: models.Percentages{100, 50, 120}}
+	if err := validateBudget(&b); err != nil {
+		t.Fatal(err)
+	}
+	if b.Period != BudgetMonthly || b.Rollover != RolloverNone || b.Thresholds[0] != 50 || b.Thresholds[2] != 120 {
+		t.Errorf("budget = %s %s %v, want monthly none [50 100 120]", b.Period, b.Rollover, b.Thresholds)
+	}
+}
+
+func TestBuildBudgetReport(t *testing.T) {
+	budget := models.Budget{Category: "Food", Period: BudgetMonthly, Amount: money.MustParse("300.00")}
+	from, to := date(2026, time.April, 1), date(2026, time.May, 1)
+	chain := []models.RolloverStep{{PeriodStart: from, PeriodEnd: to, EffectiveAmount: budget.Amount, Spent: money.MustParse("100.00")}}
+
+	tests := []struct {
+		name      string
+		now       time.Time
+		projected string
+	}{
+		{"a third into the period", date(2026, time.April, 11), "300.00"},
+		{"at the start", from, "100.00"},
+		{"after the period", date(2026, time.May, 3), "100.00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := buildBudgetReport(budget, chain, tt.now)
+			if r.Remaining != money.MustParse("200.00") || r.PercentUsed != 33.33 {
+				t.Errorf("remaining %s, used %v%%, want 200.00 and 33.33%%", r.Remaining, r.PercentUsed)
+			}
+			if r.ProjectedSpend != money.MustParse(tt.projected) {
+				t.Errorf("projected = %s, want %s", r.ProjectedSpend, tt.projected)
+			}
+		})
+	}
+}
+
+func TestCarryOver(t *testing.T) {
+	left, over := money.MustParse("20.00"), money.MustParse("-20.00")
+	tests := []struct {
+		mode       string
+		left, want money.Amount
+	}{
+		{RolloverNone, left, 0},
+		{RolloverNone, over, 0},
+		{RolloverSurplus, left, left},
+		{RolloverSurplus, over, 0},
+		{RolloverDeficit, left, 0},
+		{RolloverDeficit, over, over},
+		{RolloverBoth, left, left},
+		{RolloverBoth, over, over},
+		{RolloverBoth, 0, 0},
+	}
+	for _, tt := range tests {
+		if got := carryOver(tt.mode, tt.left); got != tt.want {
+			t.Errorf("carryOver(%s, %s) = %s, want %s", tt.mode, tt.left, got, tt.want)
+		}
+	}
+}
+
+func TestBuildRolloverChain(t *testing.T) {
+	windows := []models.SpendWindow{
+		{From: date(2026, time.January, 1), To: date(2026, time.February, 1)},
+		{From: date(2026, time.February, 1), To: date(2026, time.March, 1)},
+		{From: date(2026, time.March, 1), To: date(2026, time.April, 1)},
+	}
+	// 100 a month: 60 spent, then 150, then 20
+	spent := []money.Amount{money.MustParse("60.00"), money.MustParse("150.00"), money.MustParse("20.00")}
+
+	tests := []struct {
+		mode      string
+		effective []string // per period
+	}{
+		{RolloverNone, []string{"100.00", "100.00", "100.00"}},
+		{RolloverSurplus, []string{"100.00", "140.00", "100.00"}},
+		{RolloverDeficit, []string{"100.00", "100.00", "50.00"}},
+		{RolloverBoth, []string{"100.00", "140.00", "90.00"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			budget := models.Budget{Amount: money.MustParse("100.00"), Rollover: tt.mode}
+			chain := buildRolloverChain(budget, windows, spent)
+			if len(chain) != len(windows) {
+				t.Fatalf("got %d steps, want %d", len(chain), len(windows))
+			}
+			for i, step := range chain {
+				if want := money.MustParse(tt.effective[i]); step.EffectiveAmount != want {
+					t.Errorf("period %d: effective %s, want %s", i, step.EffectiveAmount, want)
+				}
+				if step.CarriedIn != step.EffectiveAmount-budget.Amount {
+					t.Errorf("period %d: carried in %s, but effective %s", i, step.CarriedIn, step.EffectiveAmount)
+				}
+				if i > 0 && step.CarriedIn != chain[i-1].CarriedOut {
+					t.Errorf("period %d: carried in %s, but the previous period carried out %s", i, step.CarriedIn, chain[i-1].CarriedOut)
+				}
+				if !step.PeriodStart.Equal(windows[i].From) || step.Spent != spent[i] {
+					t.Errorf("period %d = %+v, does not match its window", i, step)
+				}
+			}
+		})
+	}
+}
+
+func TestBudgetHistoryWindows(t *testing.T) {
+	created := time.Date(2026, time.January, 20, 9, 0, 0, 0, time.UTC)
+	at := date(2026, time.April, 5)
+
+	tests := []struct {
+		name   string
+		budget models.Budget
+		want   []time.Time // period starts
+	}{
+		{"no rollover", models.Budget{Period: BudgetMonthly, Rollover: RolloverNone}, []time.Time{date(2026, time.April, 1)}},
+		{"monthly since creation", models.Budget{Period: BudgetMonthly, Rollover: RolloverBoth},
+			[]time.Time{date(2026, time.January, 1), date(2026, time.February, 1), date(2026, time.March, 1), date(2026, time.April, 1)}},
+		{"quarterly since creation", models.Budget{Period: BudgetQuarterly, Rollover: RolloverSurplus},
+			[]time.Time{date(2026, time.January, 1), date(2026, time.April, 1)}},
+		{"created this period", models.Budget{Period: BudgetYearly, Rollover: RolloverSurplus}, []time.Time{date(2026, time.January, 1)}},
+		{"custom never rolls over", models.Budget{Period: BudgetCustom, Rollover: RolloverBoth}, []time.Time{date(2026, time.April, 1)}},
+		{"weekly capped", models.Budget{Period: BudgetWeekly, Rollover: RolloverBoth, Model: gorm.Model{CreatedAt: date(2025, time.June, 1)}},
+			weekStarts(date(2026, time.March, 30), maxRolloverPeriods)},
+		{"monthly capped", models.Budget{Period: BudgetMonthly, Rollover: RolloverDeficit, Model: gorm.Model{CreatedAt: date(2023, time.March, 15)}},
+			[]time.Time{date(2025, time.May, 1), date(2025, time.June, 1), date(2025, time.July, 1), date(2025, time.August, 1),
+				date(2025, time.September, 1), date(2025, time.October, 1), date(2025, time.November, 1), date(2025, time.December, 1),
+				date(2026, time.January, 1), date(2026, time.February, 1), date(2026, time.March, 1), date(2026, time.April, 1)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := tt.budget
+			if b.CreatedAt.IsZero() {
+				b.CreatedAt = created
+			}
+			b.Category = "Food"
+			windows := budgetHistoryWindows(b, at)
+			if len(windows) != len(tt.want) {
+				t.Fatalf("got %d windows, want %d", len(windows), len(tt.want))
+			}
+			for i, w := range windows {
+				if !w.From.Equal(tt.want[i]) || w.Category != "Food" {
+					t.Errorf("window %d = %+v, want from %s", i, w, tt.want[i].Format("2006-01-02"))
+				}
+				if i > 0 && !w.From.Equal(windows[i-1].To) {
+					t.Errorf("window %d starts %s, the previous one ends %s", i, w.From, windows[i-1].To)
+				}
+			}
+		})
+	}
+}
+
+func TestBudgetReportInBaseCurrency(t *testing.T) {
+	budgets := &memBudgetRepo{
+		budgets: []models.Budget{{UserID: 1, Category: "Food", Period: BudgetMonthly, Amount: money.MustParse("125"), Currency: "USD"}},
+		spent:   money.MustParse("40"),
+	}
+	fx := &ExchangeService{
+		Repo:  &memRateRepo{rates: map[string]float64{"USD": 1.25}},
+		Users: &memUserRepo{users: map[uint]*models.User{1: {BaseCurrency: "EUR"}}},
+	}
+	s := &BudgetService{Repo: budgets, FX: fx}
+
+	_, reports, err := s.GetCategoryReports(1, nil, "Food", date(2026, time.April, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := reports[0]
+	if r.Currency != "EUR" || r.Amount != money.MustParse("100") || r.Remaining != money.MustParse("60") || r.PercentUsed != 40 {
+		t.Errorf("report = %s %s, %s left, %v%% used, want 100.00 EUR with 60.00 left", r.Amount, r.Currency, r.Remaining, r.PercentUsed)
+	}
+
+	fx.Repo = &memRateRepo{}
+	if _, _, err := s.GetCategoryReports(1, nil, "Food", date(2026, time.April, 10)); !errors.Is(err, ErrMissingExchangeRate) {
+		t.Errorf("err = %v, want %v", err, ErrMissingExchangeRate)
+	}
+}
+
+// weekStarts lists the n weeks up to and including the one starting at last
+func weekStarts(last time.Time, n int) []time.Time {
+	starts := make([]time.Time, n)
+	for i := range starts {
+		starts[i] = last.AddDate(0, 0, 7*(i-n+1))
+	}
+	return starts
+}
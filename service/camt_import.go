@@ -0,0 +1,250 @@
+package service
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"tracker/models"
+	"tracker/money"
+)
+
+// camt.053 documents of every version share the elements read here; names are
+// matched without namespace so 001.02 up to 001.13 all work
+type camtDocument struct {
+	Statements []camtStatement `xml:"BkToCstmrStmt>Stmt"`
+}
+
+type camtStatement struct {
+	ID       string        `xml:"Id"`
+	IBAN     string        `xml:"Acct>Id>IBAN"`
+	Other    string        `xml:"Acct>Id>Othr>Id"`
+	Currency string        `xml:"Acct>Ccy"`
+	Balances []camtBalance `xml:"Bal"`
+	Entries  []camtEntry   `xml:"Ntry"`
+}
+
+type camtBalance struct {
+	Code      string     `xml:"Tp>CdOrPrtry>Cd"`
+	Amount    camtAmount `xml:"Amt"`
+	Indicator string     `xml:"CdtDbtInd"`
+	Date      camtDate   `xml:"Dt"`
+}
+
+type camtAmount struct {
+	Value    string `xml:",chardata"`
+	Currency string `xml:"Ccy,attr"`
+}
+
+type camtDate struct {
+	Date     string `xml:"Dt"`
+	DateTime string `xml:"DtTm"`
+}
+
+// camtStatus is plain text up to version 7 and a code element from version 8
+type camtStatus struct {
+	Text string `xml:",chardata"`
+	Code string `xml:"Cd"`
+}
+
+type camtEntry struct {
+	Ref         string          `xml:"NtryRef"`
+	Amount      camtAmount      `xml:"Amt"`
+	Indicator   string          `xml:"CdtDbtInd"`
+	Status      camtStatus      `xml:"Sts"`
+	BookingDate camtDate        `xml:"BookgDt"`
+	ValueDate   camtDate        `xml:"ValDt"`
+	ServicerRef string          `xml:"AcctSvcrRef"`
+	Details     []camtTxDetails `xml:"NtryDtls>TxDtls"`
+	Info        string          `xml:"AddtlNtryInf"`
+}
+
+type camtTxDetails struct {
+	ServicerRef  string    `xml:"Refs>AcctSvcrRef"`
+	EndToEndID   string    `xml:"Refs>EndToEndId"`
+	Debtor       camtParty `xml:"RltdPties>Dbtr"`
+	Creditor     camtParty `xml:"RltdPties>Cdtr"`
+	Unstructured []string  `xml:"RmtInf>Ustrd"`
+	References   []string  `xml:"RmtInf>Strd>CdtrRefInf>Ref"`
+	Info         string    `xml:"AddtlTxInf"`
+}
+
+// camtParty has its name directly up to version 7 and inside Pty from version 8
+type camtParty struct {
+	Name      string `xml:"Nm"`
+	PartyName string `xml:"Pty>Nm"`
+}
+
+// ParseCamt053 reads an ISO 20022 camt.053 bank to customer statement. Every
+// booked entry becomes a row with its booking and value date, the
+// counterparty and remittance information in the note and the bank's entry
+// reference as external ID. Pending and informational entries are left out.
+func ParseCamt053(r io.Reader) ([]models.ImportRow, []models.StatementBalance, error) {
+	dec := xml.NewDecoder(r)
+	dec.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		return DecodeReader(input, charset)
+	}
+
+	var doc camtDocument
+	if err := dec.Decode(&doc); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrMalformedImport, err)
+	}
+
+	var rows []models.ImportRow
+	var statements []models.StatementBalance
+	for _, stmt := range doc.Statements {
+		summary := models.StatementBalance{StatementID: stmt.ID, Account: stmt.IBAN, Currency: stmt.Currency}
+		if summary.Account == "" {
+			summary.Account = stmt.Other
+		}
+		opened, closed := false, false
+		for _, bal := range stmt.Balances {
+			amount, err := camtSigned(bal.Amount, bal.Indicator)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%w: balance %q", ErrMalformedImport, bal.Amount.Value)
+			}
+			date := camtDay(bal.Date)
+			switch bal.Code {
+			case "OPBD", "PRCD":
+				summary.OpeningBalance, summary.OpeningDate = amount, date
+				opened = true
+			case "CLBD":
+				summary.ClosingBalance, summary.ClosingDate = amount, date
+				closed = true
+			}
+			if summary.Currency == "" {
+				summary.Currency = bal.Amount.Currency
+			}
+		}
+
+		for _, entry := range stmt.Entries {
+			if status := firstNonEmpty(entry.Status.Code, entry.Status.Text); status != "" && status != "BOOK" {
+				continue
+			}
+			row := camtRow(entry, len(rows)+1)
+			if row.Transaction.Currency == "" {
+				row.Transaction.Currency = summary.Currency
+			}
+			if len(row.Errors) == 0 {
+				summary.Entries++
+				summary.Movement += signedAmount(row.Transaction)
+			}
+			rows = append(rows, row)
+		}
+
+		// A missing balance reads as zero, which must not pass for a match
+		summary.Reconciled = opened && closed && summary.OpeningBalance+summary.Movement == summary.ClosingBalance
+		statements = append(statements, summary)
+	}
+
+	if len(rows) == 0 {
+		return nil, statements, ErrEmptyImportFile
+	}
+	return rows, statements, nil
+}
+
+// camtRow maps one booked entry onto a transaction
+func camtRow(e camtEntry, n int) models.ImportRow {
+	row := models.ImportRow{Line: n}
+	tx := &row.Transaction
+
+	if date := camtDay(e.BookingDate); date != nil {
+		tx.Date = *date
+	} else if date := camtDay(e.ValueDate); date != nil {
+		tx.Date = *date
+	} else {
+		row.Errors = append(row.Errors, "entry has no booking date")
+	}
+	if date := camtDay(e.ValueDate); date != nil && !date.Equal(tx.Date) {
+		tx.ValueDate = date
+	}
+
+	amount, err := camtSigned(e.Amount, e.Indicator)
+	if err != nil {
+		row.Errors = append(row.Errors, fmt.Sprintf("amount %q is not a number", e.Amount.Value))
+	}
+	tx.Type = "income"
+	if amount < 0 {
+		tx.Type = "expense"
+	}
+	tx.Amount = amount.Abs()
+	tx.Currency = e.Amount.Currency
+
+	// The counterparty is whoever is on the other side of the money flow
+	var counterparty string
+	var remittance []string
+	for _, d := range e.Details {
+		party := d.Debtor
+		if amount < 0 {
+			party = d.Creditor
+		}
+		if counterparty == "" {
+			counterparty = firstNonEmpty(party.Name, party.PartyName)
+		}
+		remittance = append(remittance, d.Unstructured...)
+		remittance = append(remittance, d.References...)
+		if len(d.Unstructured) == 0 && len(d.References) == 0 && d.Info != "" {
+			remittance = append(remittance, d.Info)
+		}
+	}
+	if len(remittance) == 0 && e.Info != "" {
+		remittance = append(remittance, e.Info)
+	}
+	tx.Note = joinNote(counterparty, strings.Join(remittance, " "))
+
+	tx.ExternalID = firstNonEmpty(e.ServicerRef, e.Ref)
+	for _, d := range e.Details {
+		if tx.ExternalID == "" {
+			tx.ExternalID = firstNonEmpty(d.ServicerRef, strings.TrimPrefix(d.EndToEndID, "NOTPROVIDED"))
+		}
+	}
+	if tx.ExternalID == "" {
+		row.Errors = append(row.Errors, "entry has no reference")
+	}
+	return row
+}
+
+// camtSigned reads an amount in its Ccy and makes it negative for debits
+func camtSigned(a camtAmount, indicator string) (money.Amount, error) {
+	amount, err := money.ParseIn(a.Value, a.Currency)
+	if err != nil {
+		return 0, err
+	}
+	if indicator == "DBIT" {
+		amount = -amount
+	}
+	return amount, nil
+}
+
+// camtDay reads the day of a date or date-time element, nil when absent
+func camtDay(d camtDate) *time.Time {
+	s := strings.TrimSpace(firstNonEmpty(d.Date, d.DateTime))
+	if len(s) < 10 {
+		return nil
+	}
+	t, err := time.Parse("2006-01-02", s[:10])
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+// signedAmount returns a transaction's amount with money out negative
+func signedAmount(tx models.Transaction) money.Amount {
+	if tx.Type == "expense" {
+		return -tx.Amount
+	}
+	return tx.Amount
+}
+
+// firstNonEmpty returns the first argument that is not blank
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+	return ""
+}
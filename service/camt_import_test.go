@@ -0,0 +1,171 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"tracker/money"
+)
+
+// camtBalanceXML renders a balance element of the given code
+func camtBalanceXML(code, amount, indicator string) string {
+	return `<Bal><Tp><CdOrPrtry><Cd>` + code + `</Cd></CdOrPrtry></Tp><Amt Ccy="EUR">` + amount +
+		`</Amt><CdtDbtInd>` + indicator + `</CdtDbtInd><Dt><Dt>2026-03-01</Dt></Dt></Bal>`
+}
+
+// camtStatementXML builds a statement with the given balances around one
+// debit of 25.00 and one credit of 100.00
+func camtStatementXML(balances ...string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<Document xmlns="urn:iso:std:iso:20022:tech:xsd:camt.053.001.02"><BkToCstmrStmt><Stmt>
+<Id>STMT1</Id><Acct><Id><IBAN>DE89370400440532013000</IBAN></Id><Ccy>EUR</Ccy></Acct>` +
+		strings.Join(balances, "") + `
+<Ntry><NtryRef>N1</NtryRef><Amt Ccy="EUR">25.00</Amt><CdtDbtInd>DBIT</CdtDbtInd><Sts>BOOK</Sts>
+<BookgDt><Dt>2026-03-02</Dt></BookgDt><ValDt><Dt>2026-03-02</Dt></ValDt>
+<NtryDtls><TxDtls><RltdPties><Cdtr><Nm>ACME MARKT</Nm></Cdtr></RltdPties><RmtInf><Ustrd>Groceries</Ustrd></RmtInf></TxDtls></NtryDtls></Ntry>
+<Ntry><NtryRef>N2</NtryRef><Amt Ccy="EUR">100.00</Amt><CdtDbtInd>CRDT</CdtDbtInd><Sts>BOOK</Sts>
+<BookgDt><Dt>2026-03-03</Dt></BookgDt>
+<NtryDtls><TxDtls><RltdPties><Dbtr><Nm>EMPLOYER</Nm></Dbtr></RltdPties><RmtInf><Ustrd>Salary</Ustrd></RmtInf></TxDtls></NtryDtls></Ntry>
+</Stmt></BkToCstmrStmt></Document>`
+}
+
+func TestCamtReconciliation(t *testing.T) {
+	tests := []struct {
+		name     string
+		balances []string
+		want     bool
+	}{
+		{"balances match", []string{camtBalanceXML("OPBD", "500.00", "CRDT"), camtBalanceXML("CLBD", "575.00", "CRDT")}, true},
+		{"balances differ", []string{camtBalanceXML("OPBD", "500.00", "CRDT"), camtBalanceXML("CLBD", "570.00", "CRDT")}, false},
+		{"overdrawn", []string{camtBalanceXML("PRCD", "100.00", "DBIT"), camtBalanceXML("CLBD", "25.00", "DBIT")}, true},
+		{"no opening balance", []string{camtBalanceXML("CLBD", "75.00", "CRDT")}, false},
+		{"no closing balance", []string{camtBalanceXML("OPBD", "75.00", "DBIT")}, false},
+		{"no balances", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, statements, err := ParseCamt053(strings.NewReader(camtStatementXML(tt.balances...)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(statements) != 1 {
+				t.Fatalf("got %d statements, want 1", len(statements))
+			}
+			if got := statements[0].Reconciled; got != tt.want {
+				t.Errorf("reconciled = %v, want %v (%+v)", got, tt.want, statements[0])
+			}
+		})
+	}
+}
+
+func TestParseCamt053(t *testing.T) {
+	// version 8 layout: status and party names one level deeper
+	v8 := `<?xml version="1.0" encoding="UTF-8"?>
+<Document xmlns="urn:iso:std:iso:20022:tech:xsd:camt.053.001.08"><BkToCstmrStmt><Stmt>
+<Id>STMT2</Id><Acct><Id><Othr><Id>0532013000</Id></Othr></Id></Acct>
+<Ntry><Amt Ccy="CHF">12.50</Amt><CdtDbtInd>DBIT</CdtDbtInd><Sts><Cd>BOOK</Cd></Sts>
+<BookgDt><DtTm>2026-03-04T10:15:00</DtTm></BookgDt><ValDt><Dt>2026-03-05</Dt></ValDt>
+<NtryDtls><TxDtls><Refs><EndToEndId>E2E-7</EndToEndId></Refs><RltdPties><Cdtr><Pty><Nm>KIOSK</Nm></Pty></Cdtr></RltdPties>
+<RmtInf><Strd><CdtrRefInf><Ref>RF18539007547034</Ref></CdtrRefInf></Strd></RmtInf></TxDtls></NtryDtls></Ntry>
+<Ntry><NtryRef>P1</NtryRef><Amt Ccy="CHF">1.00</Amt><CdtDbtInd>DBIT</CdtDbtInd><Sts><Cd>PDNG</Cd></Sts>
+<BookgDt><Dt>2026-03-06</Dt></BookgDt></Ntry>
+<Ntry><Amt Ccy="CHF">2.00</Amt><CdtDbtInd>CRDT</CdtDbtInd><Sts><Cd>BOOK</Cd></Sts><AddtlNtryInf>Interest</AddtlNtryInf></Ntry>
+</Stmt></BkToCstmrStmt></Document>`
+
+	type want struct {
+		date, valueDate string
+		typ, amount     string
+		currency        string
+		note            string
+		externalID      string
+		errs            int
+	}
+	tests := []struct {
+		name    string
+		file    string
+		account string
+		want    []want
+	}{
+		{"version 2", camtStatementXML(), "DE89370400440532013000", []want{
+			{"2026-03-02", "", "expense", "25.00", "EUR", "ACME MARKT - Groceries", "N1", 0},
+			{"2026-03-03", "", "income", "100.00", "EUR", "EMPLOYER - Salary", "N2", 0},
+		}},
+		{"version 8", v8, "0532013000", []want{
+			{"2026-03-04", "2026-03-05", "expense", "12.50", "CHF", "KIOSK - RF18539007547034", "E2E-7", 0},
+			{"0001-01-01", "", "income", "2.00", "CHF", "Interest", "", 2},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, statements, err := ParseCamt053(strings.NewReader(tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(statements) != 1 || statements[0].Account != tt.account {
+				t.Errorf("statements = %+v, want one of account %s", statements, tt.account)
+			}
+			if len(rows) != len(tt.want) {
+				t.Fatalf("got %d rows, want %d", len(rows), len(tt.want))
+			}
+			for i, w := range tt.want {
+				row, tx := rows[i], rows[i].Transaction
+				if len(row.Errors) != w.errs {
+					t.Errorf("row %d: errors %v, want %d", i, row.Errors, w.errs)
+				}
+				valueDate := ""
+				if tx.ValueDate != nil {
+					valueDate = tx.ValueDate.Format("2006-01-02")
+				}
+				if got := tx.Date.Format("2006-01-02"); got != w.date || valueDate != w.valueDate {
+					t.Errorf("row %d: dates %s / %q, want %s / %q", i, got, valueDate, w.date, w.valueDate)
+				}
+				if tx.Type != w.typ || tx.Amount != money.MustParse(w.amount) || tx.Currency != w.currency {
+					t.Errorf("row %d = %s %s %s, want %s %s %s", i, tx.Type, tx.Amount, tx.Currency, w.typ, w.amount, w.currency)
+				}
+				if tx.Note != w.note || tx.ExternalID != w.externalID {
+					t.Errorf("row %d = %q %q, want %q %q", i, tx.Note, tx.ExternalID, w.note, w.externalID)
+				}
+			}
+		})
+	}
+}
+
+func TestParseCamt053Errors(t *testing.T) {
+	tests := []struct {
+		name, file string
+		wantErr    error
+	}{
+		{"not xml", "Date,Amount\n", ErrMalformedImport},
+		{"bad balance", camtStatementXML(camtBalanceXML("OPBD", "lots", "CRDT")), ErrMalformedImport},
+		{"no entries", `<Document><BkToCstmrStmt><Stmt><Id>S</Id></Stmt></BkToCstmrStmt></Document>`, ErrEmptyImportFile},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := ParseCamt053(strings.NewReader(tt.file)); !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCamtDay(t *testing.T) {
+	day := time.Date(2026, time.March, 4, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		in   camtDate
+		want *time.Time
+	}{
+		{"date", camtDate{Date: "2026-03-04"}, &day},
+		{"date-time", camtDate{DateTime: "2026-03-04T23:59:59+01:00"}, &day},
+		{"empty", camtDate{}, nil},
+		{"garbage", camtDate{Date: "04.03.2026"}, nil},
+	}
+	for _, tt := range tests {
+		got := camtDay(tt.in)
+		if (got == nil) != (tt.want == nil) || got != nil && !got.Equal(*tt.want) {
+			t.Errorf("%s: camtDay = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"regexp"
+	"strings"
+
+	"tracker/models"
+	"tracker/repository"
+)
+
+var (
+	ErrCategoryNotFound     = errors.New("category not found")
+	ErrCategoryArchived     = errors.New("category is archived")
+	ErrCategoryInUse        = errors.New("category is in use; archive it instead")
+	ErrInvalidCategoryName  = errors.New("name is required")
+	ErrInvalidCategoryKind  = errors.New("kind must be income or expense")
+	ErrCategoryKindMismatch = errors.New("category is of another kind than the transaction")
+	ErrCategoryKindChange   = errors.New("kind cannot be changed")
+	ErrDuplicateCategory    = errors.New("a category of this kind and name already exists")
+	ErrInvalidCategoryColor = errors.New("color must be #rrggbb")
+	ErrInvalidParent        = errors.New("parent must be another category of the same kind, not one below it")
+)
+
+var categoryColor = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+type CategoryService struct {
+	Repo        repository.CategoryRepository
+	Suggestions *SuggestionService // optional, relearns category names after a rename
+}
+
+// CreateCategory creates a new category
+func (c *CategoryService) CreateCategory(category *models.Category) error {
+	if err := c.validateCategory(category); err != nil {
+		return err
+	}
+	return c.Repo.CreateCategory(category)
+}
+
+// GetCategoriesByUserID fetches the categories of a user
+func (c *CategoryService) GetCategoriesByUserID(userID uint, includeArchived bool) ([]models.Category, error) {
+	return c.Repo.GetCategoriesByUserID(userID, includeArchived)
+}
+
+// GetCategoryByID fetches a category owned by the user
+func (c *CategoryService) GetCategoryByID(id uint, userID uint) (*models.Category, error) {
+	if !c.Repo.CheckCategoryExistsForUser(id, userID) {
+		return nil, ErrCategoryNotFound
+	}
+	return c.Repo.GetCategoryByID(id)
+}
+
+// UpdateCategory updates a category owned by the user. A new name is carried
+// over to everything booked on the category; the kind cannot change.
+func (c *CategoryService) UpdateCategory(category *models.Category) error {
+	existing, err := c.GetCategoryByID(category.ID, category.UserID)
+	if err != nil {
+		return err
+	}
+	if category.Kind == "" {
+		category.Kind = existing.Kind
+	}
+	if category.Kind != existing.Kind {
+		return ErrCategoryKindChange
+	}
+	if err := c.validateCategory(category); err != nil {
+		return err
+	}
+	category.CreatedAt = existing.CreatedAt
+	if err := c.Repo.UpdateCategory(category, existing.Name); err != nil {
+		return err
+	}
+	// Suggestions learned the old name from every transaction booked on it
+	if category.Name != existing.Name && c.Suggestions != nil {
+		c.Suggestions.Reset(category.UserID)
+	}
+	return nil
+}
+
+// DeleteCategory deletes a category that nothing refers to
+func (c *CategoryService) DeleteCategory(id uint, userID uint) error {
+	if !c.Repo.CheckCategoryExistsForUser(id, userID) {
+		return ErrCategoryNotFound
+	}
+
+	count, err := c.Repo.CountCategoryUses(id)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrCategoryInUse
+	}
+
+	log.Printf("Category with ID %d found for user %d, proceeding to delete", id, userID)
+	return c.Repo.DeleteCategory(id)
+}
+
+// validateCategory checks a category and tidies up its fields
+func (c *CategoryService) validateCategory(category *models.Category) error {
+	category.Name = strings.TrimSpace(category.Name)
+	category.Icon = strings.TrimSpace(category.Icon)
+	if category.Name == "" {
+		return ErrInvalidCategoryName
+	}
+	if err := validateTransactionType(category.Kind); err != nil {
+		return ErrInvalidCategoryKind
+	}
+	if category.Color != "" && !categoryColor.MatchString(category.Color) {
+		return ErrInvalidCategoryColor
+	}
+
+	index, err := c.index(category.UserID)
+	if err != nil {
+		return err
+	}
+	if other := index.byName[categoryKey(category.Kind, category.Name)]; other != nil && other.ID != category.ID {
+		return ErrDuplicateCategory
+	}
+
+	if category.ParentID == nil {
+		return nil
+	}
+	parent := index.byID[*category.ParentID]
+	if parent == nil || parent.Kind != category.Kind || parent.ID == category.ID {
+		return ErrInvalidParent
+	}
+	if category.ID != 0 {
+		// Moving a category below one of its own subcategories would make a loop
+		below, err := c.Repo.GetDescendantIDs(category.ID, category.UserID)
+		if err != nil {
+			return err
+		}
+		for _, id := range below {
+			if id == parent.ID {
+				return ErrInvalidParent
+			}
+		}
+	}
+	return nil
+}
+
+// categoryLine is one place a category is named: a transaction, a split
+// line, a budget or a recurring transaction
+type categoryLine struct {
+	kind string
+	id   **uint
+	name *string
+}
+
+// assignTransactions links the category of each transaction, and of each of
+// its split lines, to one of the user's categories of the transaction's type.
+// See link for create and archived. Transfers are left without a category.
+func (c *CategoryService) assignTransactions(userID uint, txs []*models.Transaction, create, archived bool) error {
+	var lines []categoryLine
+	for _, tx := range txs {
+		if tx.Type == TypeTransfer {
+			tx.CategoryID = nil
+			continue
+		}
+		lines = append(lines, categoryLine{tx.Type, &tx.CategoryID, &tx.Category})
+		for i := range tx.Splits {
+			split := &tx.Splits[i]
+			lines = append(lines, categoryLine{tx.Type, &split.CategoryID, &split.Category})
+		}
+	}
+	return c.link(userID, lines, create, archived)
+}
+
+// assignBudget links a budget to one of the user's expense categories
+func (c *CategoryService) assignBudget(budget *models.Budget, archived bool) error {
+	return c.link(budget.UserID, []categoryLine{{"expense", &budget.CategoryID, &budget.Category}}, true, archived)
+}
+
+// assignRecurring links a recurring transaction to one of the user's
+// categories of its type
+func (c *CategoryService) assignRecurring(rt *models.RecurringTransaction, archived bool) error {
+	return c.link(rt.UserID, []categoryLine{{rt.Type, &rt.CategoryID, &rt.Category}}, true, archived)
+}
+
+// link resolves each line to one of the user's categories: by ID when one is
+// given, otherwise by name ignoring case. The line then carries both the ID
+// and the category's own spelling of the name. Names the user has no
+// category for yet are created with create set, and left unlinked without.
+// Archived categories are only accepted with archived set.
+func (c *CategoryService) link(userID uint, lines []categoryLine, create, archived bool) error {
+	if len(lines) == 0 {
+		return nil
+	}
+	index, err := c.index(userID)
+	if err != nil {
+		return err
+	}
+
+	if create {
+		var missing []models.Category
+		seen := map[string]bool{}
+		for _, l := range lines {
+			name := strings.TrimSpace(*l.name)
+			key := categoryKey(l.kind, name)
+			if *l.id != nil || name == "" || index.byName[key] != nil || seen[key] {
+				continue
+			}
+			seen[key] = true
+			missing = append(missing, models.Category{UserID: userID, Name: name, Kind: l.kind})
+		}
+		if len(missing) > 0 {
+			if err := c.Repo.CreateMissingCategories(missing); err != nil {
+				return err
+			}
+			if index, err = c.index(userID); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, l := range lines {
+		var category *models.Category
+		if *l.id != nil {
+			category = index.byID[**l.id]
+			if category == nil {
+				return ErrCategoryNotFound
+			}
+			if category.Kind != l.kind {
+				return ErrCategoryKindMismatch
+			}
+		} else {
+			category = index.byName[categoryKey(l.kind, strings.TrimSpace(*l.name))]
+			if category == nil {
+				continue
+			}
+		}
+		if category.Archived && !archived {
+			return ErrCategoryArchived
+		}
+		id := category.ID
+		*l.id = &id
+		*l.name = category.Name
+	}
+	return nil
+}
+
+// categoryIndex looks up a user's categories by ID and by kind and name
+type categoryIndex struct {
+	byID   map[uint]*models.Category
+	byName map[string]*models.Category
+}
+
+func (c *CategoryService) index(userID uint) (*categoryIndex, error) {
+	categories, err := c.Repo.GetCategoriesByUserID(userID, true)
+	if err != nil {
+		return nil, err
+	}
+	index := &categoryIndex{byID: map[uint]*models.Category{}, byName: map[string]*models.Category{}}
+	for i := range categories {
+		category := &categories[i]
+		index.byID[category.ID] = category
+		index.byName[categoryKey(category.Kind, category.Name)] = category
+	}
+	return index, nil
+}
+
+// categoryKey is how a category name is looked up: per kind, ignoring case
+func categoryKey(kind, name string) string {
+	return kind + "\x00" + strings.ToLower(name)
+}
@@ -0,0 +1,204 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"tracker/models"
+	"tracker/money"
+	"tracker/repository"
+
+	"gorm.io/gorm"
+)
+
+// memCategoryRepo keeps categories and the transactions booked on them in
+// memory; a rename is carried over to the transactions like the real one
+type memCategoryRepo struct {
+	repository.CategoryRepository
+	categories []models.Category
+	txs        *memStreamRepo
+}
+
+func (m *memCategoryRepo) GetCategoriesByUserID(userID uint, includeArchived bool) ([]models.Category, error) {
+	return m.categories, nil
+}
+
+func (m *memCategoryRepo) CreateMissingCategories(categories []models.Category) error {
+	for _, c := range categories {
+		c.ID = uint(len(m.categories) + 1)
+		m.categories = append(m.categories, c)
+	}
+	return nil
+}
+
+func (m *memCategoryRepo) CheckCategoryExistsForUser(id uint, userID uint) bool {
+	return m.find(id) != nil
+}
+
+func (m *memCategoryRepo) GetCategoryByID(id uint) (*models.Category, error) {
+	c := *m.find(id)
+	return &c, nil
+}
+
+func (m *memCategoryRepo) UpdateCategory(category *models.Category, oldName string) error {
+	*m.find(category.ID) = *category
+	for i := range m.txs.txs {
+		if m.txs.txs[i].Category == oldName {
+			m.txs.txs[i].Category = category.Name
+		}
+	}
+	return nil
+}
+
+func (m *memCategoryRepo) find(id uint) *models.Category {
+	for i := range m.categories {
+		if m.categories[i].ID == id {
+			return &m.categories[i]
+		}
+	}
+	return nil
+}
+
+// GetDescendantIDs walks the parent links down from the category
+func (m *memCategoryRepo) GetDescendantIDs(id uint, userID uint) ([]uint, error) {
+	var ids []uint
+	for _, c := range m.categories {
+		if c.ParentID != nil && *c.ParentID == id {
+			below, _ := m.GetDescendantIDs(c.ID, userID)
+			ids = append(append(ids, c.ID), below...)
+		}
+	}
+	return ids, nil
+}
+
+// categoryTree is Food with Groceries below it, Salary, and an archived Old
+func categoryTree() *memCategoryRepo {
+	food := uint(1)
+	return &memCategoryRepo{categories: []models.Category{
+		{Model: gorm.Model{ID: 1}, UserID: 1, Kind: "expense", Name: "Food"},
+		{Model: gorm.Model{ID: 2}, UserID: 1, Kind: "expense", Name: "Groceries", ParentID: &food},
+		{Model: gorm.Model{ID: 3}, UserID: 1, Kind: "income", Name: "Salary"},
+		{Model: gorm.Model{ID: 4}, UserID: 1, Kind: "expense", Name: "Old", Archived: true},
+	}}
+}
+
+func TestValidateCategory(t *testing.T) {
+	food, groceries, salary := uint(1), uint(2), uint(3)
+	tests := []struct {
+		name     string
+		category models.Category
+		wantErr  error
+	}{
+		{"new", models.Category{Kind: "expense", Name: "Rent", Color: "#aa00FF"}, nil},
+		{"subcategory", models.Category{Kind: "expense", Name: "Eating out", ParentID: &food}, nil},
+		{"same name of another kind", models.Category{Kind: "income", Name: "Food"}, nil},
+		{"renamed onto itself", models.Category{Model: gorm.Model{ID: 1}, Kind: "expense", Name: "food"}, nil},
+		{"no name", models.Category{Kind: "expense", Name: " "}, ErrInvalidCategoryName},
+		{"unknown kind", models.Category{Kind: "transfer", Name: "Moves"}, ErrInvalidCategoryKind},
+		{"bad color", models.Category{Kind: "expense", Name: "Rent", Color: "red"}, ErrInvalidCategoryColor},
+		{"duplicate ignoring case", models.Category{Kind: "expense", Name: "GROCERIES"}, ErrDuplicateCategory},
+		{"parent of another kind", models.Category{Kind: "expense", Name: "Rent", ParentID: &salary}, ErrInvalidParent},
+		{"own parent", models.Category{Model: gorm.Model{ID: 1}, Kind: "expense", Name: "Food", ParentID: &food}, ErrInvalidParent},
+		{"below its own subcategory", models.Category{Model: gorm.Model{ID: 1}, Kind: "expense", Name: "Food", ParentID: &groceries}, ErrInvalidParent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &CategoryService{Repo: categoryTree()}
+			category := tt.category
+			category.UserID = 1
+			if err := c.validateCategory(&category); !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAssignTransactions(t *testing.T) {
+	salary, old := uint(3), uint(4)
+	tests := []struct {
+		name     string
+		tx       models.Transaction
+		create   bool
+		archived bool
+		wantID   uint // 0 when left unlinked
+		wantName string
+		wantErr  error
+	}{
+		{"by name ignoring case", models.Transaction{Type: "expense", Category: " groceries"}, false, false, 2, "Groceries", nil},
+		{"by ID", models.Transaction{Type: "income", CategoryID: &salary, Category: "whatever"}, false, false, 3, "Salary", nil},
+		{"unknown name left alone", models.Transaction{Type: "expense", Category: "Rent"}, false, false, 0, "Rent", nil},
+		{"unknown name created", models.Transaction{Type: "expense", Category: "Rent"}, true, false, 5, "Rent", nil},
+		{"name of another kind", models.Transaction{Type: "income", Category: "Food"}, false, false, 0, "Food", nil},
+		{"ID of another kind", models.Transaction{Type: "expense", CategoryID: &salary}, false, false, 0, "", ErrCategoryKindMismatch},
+		{"archived", models.Transaction{Type: "expense", Category: "Old"}, false, false, 0, "Old", ErrCategoryArchived},
+		{"archived allowed", models.Transaction{Type: "expense", CategoryID: &old}, false, true, 4, "Old", nil},
+		{"transfers have none", models.Transaction{Type: TypeTransfer, CategoryID: &salary, Category: "Transfer"}, false, false, 0, "Transfer", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &CategoryService{Repo: categoryTree()}
+			tx := tt.tx
+			if err := c.assignTransactions(1, []*models.Transaction{&tx}, tt.create, tt.archived); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if got := accountID(tx.CategoryID); got != tt.wantID || tx.Category != tt.wantName {
+				t.Errorf("category = %d %q, want %d %q", got, tx.Category, tt.wantID, tt.wantName)
+			}
+		})
+	}
+
+	// Split lines are linked on their own
+	c := &CategoryService{Repo: categoryTree()}
+	tx := models.Transaction{Type: "expense", Category: "Split", Splits: []models.TransactionSplit{{Category: "food"}, {Category: "Groceries"}}}
+	if err := c.assignTransactions(1, []*models.Transaction{&tx}, false, false); err != nil {
+		t.Fatal(err)
+	}
+	if accountID(tx.Splits[0].CategoryID) != 1 || accountID(tx.Splits[1].CategoryID) != 2 || tx.Splits[0].Category != "Food" {
+		t.Errorf("splits = %+v, want linked to Food and Groceries", tx.Splits)
+	}
+}
+
+// memStreamRepo streams a fixed set of transactions
+type memStreamRepo struct {
+	repository.TransactionRepository
+	txs []models.Transaction
+}
+
+func (m *memStreamRepo) StreamTransactions(filter models.TransactionFilter, fn func(models.Transaction) error) error {
+	for _, tx := range m.txs {
+		if err := fn(tx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestRenameCategoryRetrainsSuggestions(t *testing.T) {
+	var history []models.Transaction
+	for i := 0; i < 5; i++ {
+		history = append(history, models.Transaction{UserID: 1, Type: "expense", Category: "Food", Amount: money.MustParse("12.00"), Note: "ACME MARKT"})
+	}
+	txs := &memStreamRepo{txs: history}
+	sug := &SuggestionService{Transactions: txs}
+	repo := &memCategoryRepo{categories: []models.Category{{Model: gorm.Model{ID: 3}, UserID: 1, Kind: "expense", Name: "Food"}}, txs: txs}
+	svc := &CategoryService{Repo: repo, Suggestions: sug}
+
+	probe := models.Transaction{UserID: 1, Type: "expense", Amount: money.MustParse("12.00"), Note: "ACME MARKT"}
+	if got, err := sug.Suggest(probe, 1); err != nil || len(got) == 0 || got[0].Category != "Food" {
+		t.Fatalf("before rename: suggestions = %v, %v", got, err)
+	}
+
+	if err := svc.UpdateCategory(&models.Category{Model: gorm.Model{ID: 3}, UserID: 1, Name: "Groceries"}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := sug.Suggest(probe, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) == 0 || got[0].Category != "Groceries" {
+		t.Errorf("after rename: suggestions = %v, want Groceries", got)
+	}
+}
@@ -0,0 +1,157 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"tracker/models"
+	"tracker/money"
+)
+
+// categoryModel is a multinomial naive Bayes classifier of one user's
+// transactions, kept apart per type so incomes are never suggested an
+// expense category. It is updated one transaction at a time.
+type categoryModel struct {
+	byType map[string]*naiveBayes
+}
+
+type naiveBayes struct {
+	docs   map[string]int            // category lines learned per category
+	tokens map[string]map[string]int // token counts per category
+	totals map[string]int            // all token counts per category
+	vocab  map[string]int            // token counts over every category
+	lines  int
+}
+
+func newCategoryModel() *categoryModel {
+	return &categoryModel{byType: map[string]*naiveBayes{}}
+}
+
+// learn adds a transaction to the model; delta -1 removes it again
+func (m *categoryModel) learn(tx models.Transaction, delta int) {
+	if tx.Type == TypeTransfer {
+		return
+	}
+	nb := m.byType[tx.Type]
+	if nb == nil {
+		nb = &naiveBayes{docs: map[string]int{}, tokens: map[string]map[string]int{}, totals: map[string]int{}, vocab: map[string]int{}}
+		m.byType[tx.Type] = nb
+	}
+
+	// Each split line counts as a transaction of its own category
+	if len(tx.Splits) == 0 {
+		nb.add(strings.TrimSpace(tx.Category), classifierTokens(tx.Note, tx.Amount, tx.Currency, tx.AccountID, tx.PayeeID), delta)
+		return
+	}
+	for _, s := range tx.Splits {
+		nb.add(strings.TrimSpace(s.Category), classifierTokens(tx.Note+" "+s.Note, s.Amount, tx.Currency, tx.AccountID, tx.PayeeID), delta)
+	}
+}
+
+func (nb *naiveBayes) add(category string, tokens []string, delta int) {
+	if category == "" || category == DefaultImportCategory {
+		return
+	}
+	if delta < 0 && nb.docs[category] == 0 {
+		return
+	}
+
+	nb.docs[category] += delta
+	nb.lines += delta
+	if nb.tokens[category] == nil {
+		nb.tokens[category] = map[string]int{}
+	}
+	for _, t := range tokens {
+		if delta < 0 && nb.tokens[category][t] == 0 {
+			continue
+		}
+		nb.tokens[category][t] += delta
+		nb.totals[category] += delta
+		nb.vocab[t] += delta
+		if nb.tokens[category][t] == 0 {
+			delete(nb.tokens[category], t)
+		}
+		if nb.vocab[t] == 0 {
+			delete(nb.vocab, t)
+		}
+	}
+	if nb.docs[category] == 0 {
+		delete(nb.docs, category)
+		delete(nb.tokens, category)
+		delete(nb.totals, category)
+	}
+}
+
+// suggest ranks the categories the transaction most likely belongs to, with
+// the posterior probability of each, best first
+func (m *categoryModel) suggest(tx models.Transaction, limit int) []models.CategorySuggestion {
+	suggestions := []models.CategorySuggestion{}
+	nb := m.byType[tx.Type]
+	if nb == nil || nb.lines == 0 {
+		return suggestions
+	}
+
+	// Laplace smoothed log likelihoods; tokens never seen carry no signal
+	tokens := classifierTokens(tx.Note, tx.Amount, tx.Currency, tx.AccountID, tx.PayeeID)
+	vocabSize := float64(len(nb.vocab))
+	scores := map[string]float64{}
+	best := math.Inf(-1)
+	for category, docs := range nb.docs {
+		score := math.Log(float64(docs) / float64(nb.lines))
+		for _, t := range tokens {
+			if nb.vocab[t] == 0 {
+				continue
+			}
+			score += math.Log((float64(nb.tokens[category][t]) + 1) / (float64(nb.totals[category]) + vocabSize))
+		}
+		scores[category] = score
+		best = math.Max(best, score)
+	}
+
+	// Normalize into probabilities, shifted by the best score to stay in range
+	var sum float64
+	for _, score := range scores {
+		sum += math.Exp(score - best)
+	}
+	for category, score := range scores {
+		suggestions = append(suggestions, models.CategorySuggestion{
+			Category:   category,
+			Confidence: math.Round(math.Exp(score-best)/sum*100) / 100,
+		})
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].Confidence != suggestions[j].Confidence {
+			return suggestions[i].Confidence > suggestions[j].Confidence
+		}
+		return suggestions[i].Category < suggestions[j].Category
+	})
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions
+}
+
+// classifierTokens describes a transaction as the words of its note, the
+// order of magnitude of its amount in major units, its account and its
+// payee. Bare numbers such as card numbers and dates change every time, so
+// they are left out.
+func classifierTokens(note string, amount money.Amount, currency string, accountID, payeeID *uint) []string {
+	var tokens []string
+	for _, w := range noteWords(note) {
+		if len([]rune(w)) < 2 || strings.IndexFunc(w, unicode.IsLetter) < 0 {
+			continue
+		}
+		tokens = append(tokens, w)
+	}
+	tokens = append(tokens, fmt.Sprintf("amount:%d", int(math.Log2(amount.Abs().Major(currency)+1))))
+	if accountID != nil {
+		tokens = append(tokens, fmt.Sprintf("account:%d", *accountID))
+	}
+	if payeeID != nil {
+		tokens = append(tokens, fmt.Sprintf("payee:%d", *payeeID))
+	}
+	return tokens
+}
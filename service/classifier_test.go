@@ -0,0 +1,146 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"tracker/models"
+	"tracker/money"
+)
+
+func expense(note, category, amount string) models.Transaction {
+	return models.Transaction{UserID: 1, Type: "expense", Note: note, Category: category,
+		Amount: money.MustParse(amount), Currency: "EUR", Date: date(2026, time.March, 1)}
+}
+
+func TestClassifierTokens(t *testing.T) {
+	account, payee := uint(3), uint(9)
+	tests := []struct {
+		name     string
+		note     string
+		amount   string
+		currency string
+		account  *uint
+		payee    *uint
+		want     []string
+	}{
+		{"words and magnitude", "REWE Markt 4711 Berlin", "23.90", "EUR", nil, nil, []string{"rewe", "markt", "berlin", "amount:4"}},
+		{"account and payee", "coffee", "3.20", "EUR", &account, &payee, []string{"coffee", "amount:2", "account:3", "payee:9"}},
+		{"magnitude in major units", "", "1500", "JPY", nil, nil, []string{"amount:10"}},
+		{"short words are dropped", "a b cd", "0.50", "EUR", nil, nil, []string{"cd", "amount:0"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			amount := money.MustParseIn(tt.amount, tt.currency)
+			got := classifierTokens(tt.note, amount, tt.currency, tt.account, tt.payee)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("tokens = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCategoryModelForgetUndoesLearn(t *testing.T) {
+	payee := uint(9)
+	history := []models.Transaction{
+		expense("REWE Markt", "Groceries", "23.90"),
+		expense("Aldi", "Groceries", "12.10"),
+		expense("Shell station", "Fuel", "60.00"),
+	}
+	split := expense("Kaufhaus", "Split", "50.00")
+	split.PayeeID = &payee
+	split.Splits = []models.TransactionSplit{
+		{Category: "Groceries", Amount: money.MustParse("20.00")},
+		{Category: "Household", Amount: money.MustParse("30.00"), Note: "detergent"},
+	}
+
+	m := newCategoryModel()
+	for _, tx := range history {
+		m.learn(tx, 1)
+	}
+	before := *m.byType["expense"]
+	before.docs, before.totals, before.vocab = copyCounts(before.docs), copyCounts(before.totals), copyCounts(before.vocab)
+
+	m.learn(split, 1)
+	if m.byType["expense"].docs["Household"] != 1 {
+		t.Fatalf("split line not learned: %v", m.byType["expense"].docs)
+	}
+	m.learn(split, -1)
+
+	after := m.byType["expense"]
+	if !reflect.DeepEqual(after.docs, before.docs) || !reflect.DeepEqual(after.totals, before.totals) ||
+		!reflect.DeepEqual(after.vocab, before.vocab) || after.lines != before.lines {
+		t.Errorf("forgetting what was learned left %+v, want %+v", *after, before)
+	}
+	if _, ok := after.tokens["Household"]; ok {
+		t.Error("a category with nothing left keeps its tokens")
+	}
+
+	// Forgetting what was never learned changes nothing
+	m.learn(expense("cinema", "Fun", "12.00"), -1)
+	if !reflect.DeepEqual(after.docs, before.docs) || after.lines != before.lines {
+		t.Errorf("forgetting an unknown entry changed the model: %v", after.docs)
+	}
+}
+
+func copyCounts(in map[string]int) map[string]int {
+	out := make(map[string]int, len(in))
+	for k, v := range in {
+		out[k] = v
+	}
+	return out
+}
+
+func TestCategoryModelRanking(t *testing.T) {
+	bakery, market := uint(1), uint(2)
+	m := newCategoryModel()
+	for i := 0; i < 3; i++ {
+		m.learn(expense("REWE Markt", "Groceries", "23.90"), 1)
+		m.learn(expense("Shell station", "Fuel", "60.00"), 1)
+	}
+	m.learn(expense("Cinema tickets", "Fun", "24.00"), 1)
+	withPayee := func(tx models.Transaction, payee *uint) models.Transaction {
+		tx.PayeeID = payee
+		return tx
+	}
+	m.learn(withPayee(expense("card payment", "Eating out", "4.50"), &bakery), 1)
+	m.learn(withPayee(expense("card payment", "Eating out", "4.50"), &bakery), 1)
+	m.learn(withPayee(expense("card payment", "Snacks", "4.50"), &market), 1)
+	m.learn(withPayee(expense("card payment", "Snacks", "4.50"), &market), 1)
+
+	income := models.Transaction{UserID: 1, Type: "income", Note: "salary", Category: "Salary", Amount: money.MustParse("3000.00"), Currency: "EUR"}
+	m.learn(income, 1)
+
+	tests := []struct {
+		name  string
+		tx    models.Transaction
+		limit int
+		want  []string
+	}{
+		{"note decides", expense("REWE Markt Berlin", "", "25.00"), 1, []string{"Groceries"}},
+		{"other note", expense("Shell", "", "55.00"), 1, []string{"Fuel"}},
+		{"runners-up", expense("Shell", "", "55.00"), 2, []string{"Fuel", "Groceries"}},
+		{"payee decides between equal notes", withPayee(expense("card payment", "", "4.50"), &market), 1, []string{"Snacks"}},
+		{"the other payee", withPayee(expense("card payment", "", "4.50"), &bakery), 1, []string{"Eating out"}},
+		{"income is kept apart", models.Transaction{Type: "income", Note: "REWE"}, 5, []string{"Salary"}},
+		{"transfers learn nothing", models.Transaction{Type: TypeTransfer, Note: "REWE"}, 5, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := m.suggest(tt.tx, tt.limit)
+			var names []string
+			for _, s := range got {
+				names = append(names, s.Category)
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("suggest = %v, want %v", got, tt.want)
+			}
+			for i := 1; i < len(got); i++ {
+				if got[i].Confidence > got[i-1].Confidence {
+					t.Errorf("suggestions not ranked best first: %v", got)
+				}
+			}
+		})
+	}
+}
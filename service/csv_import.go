@@ -0,0 +1,373 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"tracker/models"
+	"tracker/money"
+
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+const (
+	AmountSigned      = "signed"
+	AmountDebitCredit = "debit_credit"
+)
+
+var (
+	ErrInvalidEncoding    = errors.New("unknown encoding")
+	ErrInvalidDelimiter   = errors.New("delimiter must be a single character")
+	ErrInvalidDateFormat  = errors.New("date_format needs YYYY or YY, MM or M and DD or D")
+	ErrInvalidDecimalSep  = errors.New("decimal_separator must be . or ,")
+	ErrInvalidAmountMode  = errors.New("amount_mode must be signed or debit_credit")
+	ErrMissingColumn      = errors.New("profile is missing a column mapping")
+	ErrInvalidProfileName = errors.New("name is required")
+	ErrColumnNotFound     = errors.New("column not found in file")
+	ErrEmptyImportFile    = errors.New("file has no rows")
+	ErrMalformedImport    = errors.New("file cannot be parsed")
+	errAmountMissing      = errors.New("amount is empty")
+	errDebitAndCredit     = errors.New("both debit and credit are set")
+)
+
+// dateTokens turns the profile's date format into a Go layout. Longer tokens
+// come first so YYYY is not read as two YY.
+var dateTokens = strings.NewReplacer(
+	"YYYY", "2006",
+	"YY", "06",
+	"MM", "01",
+	"M", "1",
+	"DD", "02",
+	"D", "2",
+)
+
+// DateLayout converts a format such as DD.MM.YYYY into a Go time layout
+func DateLayout(format string) (string, error) {
+	upper := strings.ToUpper(format)
+	if !strings.Contains(upper, "YY") || !strings.Contains(upper, "M") || !strings.Contains(upper, "D") {
+		return "", ErrInvalidDateFormat
+	}
+	return dateTokens.Replace(upper), nil
+}
+
+// ParseDecimal reads a bank formatted number such as "1.234,56", "-12.30",
+// "12.30-" or "(12.30)". sep is the decimal separator; the other one, spaces
+// and apostrophes are taken as thousands separators. The number may have as
+// many decimal places as currency has; an empty currency allows two.
+func ParseDecimal(s, sep, currency string) (money.Amount, error) {
+	s = strings.TrimSpace(s)
+	neg := false
+	if strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+		neg = true
+		s = s[1 : len(s)-1]
+	}
+	if strings.HasSuffix(s, "-") {
+		neg = true
+		s = strings.TrimSuffix(s, "-")
+	}
+
+	thousands := ","
+	if sep == "," {
+		thousands = "."
+	}
+	s = strings.NewReplacer(thousands, "", " ", "", "\u00a0", "", "'", "").Replace(s)
+	if sep == "," {
+		s = strings.Replace(s, ",", ".", 1)
+	}
+
+	a, err := money.ParseIn(s, currency)
+	if err != nil {
+		return 0, err
+	}
+	if neg {
+		a = -a
+	}
+	return a, nil
+}
+
+// DecodeReader wraps r so it yields UTF-8 from the named encoding.
+// A leading byte order mark is dropped.
+func DecodeReader(r io.Reader, encoding string) (io.Reader, error) {
+	name := strings.ToLower(strings.TrimSpace(encoding))
+	if name == "" {
+		name = "utf-8"
+	}
+	enc, err := htmlindex.Get(name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidEncoding, encoding)
+	}
+	if name != "utf-8" && name != "utf8" {
+		r = enc.NewDecoder().Reader(r)
+	}
+
+	br := bufio.NewReader(r)
+	if bom, err := br.Peek(3); err == nil && bytes.Equal(bom, []byte{0xEF, 0xBB, 0xBF}) {
+		br.Discard(3)
+	}
+	return br, nil
+}
+
+// ValidateImportProfile fills in defaults and checks that a profile can parse a file
+func ValidateImportProfile(p *models.ImportProfile) error {
+	p.Name = strings.TrimSpace(p.Name)
+	if p.Name == "" {
+		return ErrInvalidProfileName
+	}
+
+	if p.Encoding == "" {
+		p.Encoding = "utf-8"
+	}
+	if _, err := htmlindex.Get(strings.ToLower(p.Encoding)); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidEncoding, p.Encoding)
+	}
+
+	if p.Delimiter == "" {
+		p.Delimiter = ","
+	}
+	if p.Delimiter == `\t` {
+		p.Delimiter = "\t"
+	}
+	if utf8.RuneCountInString(p.Delimiter) != 1 {
+		return ErrInvalidDelimiter
+	}
+
+	if p.DateFormat == "" {
+		p.DateFormat = "YYYY-MM-DD"
+	}
+	if _, err := DateLayout(p.DateFormat); err != nil {
+		return err
+	}
+
+	switch p.DecimalSeparator {
+	case "":
+		p.DecimalSeparator = "."
+	case ".", ",":
+	default:
+		return ErrInvalidDecimalSep
+	}
+
+	if p.SkipRows < 0 {
+		p.SkipRows = 0
+	}
+
+	if p.DateColumn == "" {
+		return fmt.Errorf("%w: date_column", ErrMissingColumn)
+	}
+	switch p.AmountMode {
+	case "":
+		p.AmountMode = AmountSigned
+		fallthrough
+	case AmountSigned:
+		if p.AmountColumn == "" {
+			return fmt.Errorf("%w: amount_column", ErrMissingColumn)
+		}
+	case AmountDebitCredit:
+		if p.DebitColumn == "" || p.CreditColumn == "" {
+			return fmt.Errorf("%w: debit_column and credit_column", ErrMissingColumn)
+		}
+	default:
+		return ErrInvalidAmountMode
+	}
+	return nil
+}
+
+// csvColumns holds the resolved column positions of a profile, -1 when unmapped
+type csvColumns struct {
+	date, amount, debit, credit, note, category, currency int
+}
+
+// ParseCSV reads a bank statement with the given profile. Problems with single
+// lines end up in the row's errors; only an unreadable file fails as a whole.
+// The returned transactions carry no user, default category or currency yet.
+func ParseCSV(r io.Reader, p models.ImportProfile) ([]models.ImportRow, error) {
+	layout, err := DateLayout(p.DateFormat)
+	if err != nil {
+		return nil, err
+	}
+	decoded, err := DecodeReader(r, p.Encoding)
+	if err != nil {
+		return nil, err
+	}
+
+	cr := csv.NewReader(decoded)
+	cr.Comma, _ = utf8.DecodeRuneInString(p.Delimiter)
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+
+	line := 0
+	next := func() ([]string, error) {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return nil, err
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrMalformedImport, err)
+		}
+		line, _ = cr.FieldPos(0)
+		return rec, nil
+	}
+
+	for i := 0; i < p.SkipRows; i++ {
+		if _, err := next(); err != nil {
+			if err == io.EOF {
+				return nil, ErrEmptyImportFile
+			}
+			return nil, err
+		}
+	}
+
+	var header []string
+	if p.HasHeader {
+		if header, err = next(); err != nil {
+			if err == io.EOF {
+				return nil, ErrEmptyImportFile
+			}
+			return nil, err
+		}
+	}
+
+	cols := csvColumns{}
+	for _, c := range []struct {
+		ref string
+		idx *int
+	}{
+		{p.DateColumn, &cols.date},
+		{p.AmountColumn, &cols.amount},
+		{p.DebitColumn, &cols.debit},
+		{p.CreditColumn, &cols.credit},
+		{p.NoteColumn, &cols.note},
+		{p.CategoryColumn, &cols.category},
+		{p.CurrencyColumn, &cols.currency},
+	} {
+		if *c.idx, err = columnIndex(header, c.ref); err != nil {
+			return nil, err
+		}
+	}
+
+	var rows []models.ImportRow
+	for {
+		rec, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if isBlankRecord(rec) {
+			continue
+		}
+		rows = append(rows, parseCSVRecord(rec, line, cols, layout, p))
+	}
+	if len(rows) == 0 {
+		return nil, ErrEmptyImportFile
+	}
+	return rows, nil
+}
+
+// parseCSVRecord turns one CSV record into an import row
+func parseCSVRecord(rec []string, line int, cols csvColumns, layout string, p models.ImportProfile) models.ImportRow {
+	row := models.ImportRow{Line: line}
+	tx := &row.Transaction
+	field := func(idx int) string {
+		if idx < 0 || idx >= len(rec) {
+			return ""
+		}
+		return strings.TrimSpace(rec[idx])
+	}
+
+	date, err := time.Parse(layout, field(cols.date))
+	if err != nil {
+		row.Errors = append(row.Errors, fmt.Sprintf("date %q does not match %s", field(cols.date), p.DateFormat))
+	}
+	tx.Date = date
+
+	tx.Currency = strings.ToUpper(field(cols.currency))
+	amount, err := csvAmount(field, cols, p, tx.Currency)
+	if err != nil {
+		row.Errors = append(row.Errors, err.Error())
+	}
+	tx.Type = "income"
+	if amount < 0 {
+		tx.Type = "expense"
+	}
+	tx.Amount = amount.Abs()
+
+	tx.Note = field(cols.note)
+	tx.Category = field(cols.category)
+	tx.AccountID = p.AccountID
+	return row
+}
+
+// csvAmount reads the signed amount of a record in currency; money out is negative
+func csvAmount(field func(int) string, cols csvColumns, p models.ImportProfile, currency string) (money.Amount, error) {
+	if p.AmountMode != AmountDebitCredit {
+		v := field(cols.amount)
+		if v == "" {
+			return 0, errAmountMissing
+		}
+		a, err := ParseDecimal(v, p.DecimalSeparator, currency)
+		if err != nil {
+			return 0, fmt.Errorf("amount %q is not a number", v)
+		}
+		return a, nil
+	}
+
+	debit, credit := field(cols.debit), field(cols.credit)
+	var d, c money.Amount
+	var err error
+	if debit != "" {
+		if d, err = ParseDecimal(debit, p.DecimalSeparator, currency); err != nil {
+			return 0, fmt.Errorf("debit %q is not a number", debit)
+		}
+	}
+	if credit != "" {
+		if c, err = ParseDecimal(credit, p.DecimalSeparator, currency); err != nil {
+			return 0, fmt.Errorf("credit %q is not a number", credit)
+		}
+	}
+	switch {
+	case d == 0 && c == 0:
+		return 0, errAmountMissing
+	case d != 0 && c != 0:
+		return 0, errDebitAndCredit
+	case d != 0:
+		return -d.Abs(), nil
+	}
+	return c.Abs(), nil
+}
+
+// columnIndex finds a mapped column by 1-based number or by header name; an
+// empty reference yields -1
+func columnIndex(header []string, ref string) (int, error) {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return -1, nil
+	}
+	if n, err := strconv.Atoi(ref); err == nil && n > 0 {
+		return n - 1, nil
+	}
+	for i, h := range header {
+		if strings.EqualFold(strings.TrimSpace(h), ref) {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("%w: %s", ErrColumnNotFound, ref)
+}
+
+// isBlankRecord reports whether every field of a record is empty
+func isBlankRecord(rec []string) bool {
+	for _, f := range rec {
+		if strings.TrimSpace(f) != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,248 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"tracker/models"
+	"tracker/money"
+)
+
+func TestDateLayout(t *testing.T) {
+	tests := []struct {
+		format, value string
+		want          time.Time
+	}{
+		{"YYYY-MM-DD", "2026-03-07", time.Date(2026, time.March, 7, 0, 0, 0, 0, time.UTC)},
+		{"DD.MM.YYYY", "07.03.2026", time.Date(2026, time.March, 7, 0, 0, 0, 0, time.UTC)},
+		{"M/D/YY", "3/7/26", time.Date(2026, time.March, 7, 0, 0, 0, 0, time.UTC)},
+		{"dd/mm/yyyy", "07/03/2026", time.Date(2026, time.March, 7, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			layout, err := DateLayout(tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := time.Parse(layout, tt.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("parsed %s as %s, want %s", tt.value, got, tt.want)
+			}
+		})
+	}
+
+	for _, format := range []string{"", "MM-DD", "YYYY-DD", "YYYY-MM"} {
+		if _, err := DateLayout(format); !errors.Is(err, ErrInvalidDateFormat) {
+			t.Errorf("DateLayout(%q): err = %v, want ErrInvalidDateFormat", format, err)
+		}
+	}
+}
+
+func TestParseDecimal(t *testing.T) {
+	tests := []struct {
+		in, sep, currency string
+		want              string
+	}{
+		{"12.30", ".", "", "12.30"},
+		{"-12.30", ".", "", "-12.30"},
+		{"1,234.56", ".", "", "1234.56"},
+		{"1.234,56", ",", "", "1234.56"},
+		{"1 234,56", ",", "", "1234.56"},
+		{"1'234.56", ".", "", "1234.56"},
+		{"12.30-", ".", "", "-12.30"},
+		{"(12.30)", ".", "", "-12.30"},
+		{" 7 ", ".", "", "7.00"},
+		{"1.234", ",", "JPY", "1234"},
+		{"12,345", ",", "KWD", "12.345"},
+	}
+	for _, tt := range tests {
+		got, err := ParseDecimal(tt.in, tt.sep, tt.currency)
+		if err != nil {
+			t.Errorf("ParseDecimal(%q, %q, %q): %v", tt.in, tt.sep, tt.currency, err)
+			continue
+		}
+		if want := money.MustParseIn(tt.want, tt.currency); got != want {
+			t.Errorf("ParseDecimal(%q, %q, %q) = %s, want %s", tt.in, tt.sep, tt.currency, got.Format(tt.currency), want.Format(tt.currency))
+		}
+	}
+
+	invalid := []struct{ in, currency string }{
+		{"", ""}, {"abc", ""}, {"1.2.3", ""}, {"12.345", ""}, {"12.5", "JPY"},
+	}
+	for _, tt := range invalid {
+		if _, err := ParseDecimal(tt.in, ".", tt.currency); err == nil {
+			t.Errorf("ParseDecimal(%q, %q) succeeded", tt.in, tt.currency)
+		}
+	}
+}
+
+func TestValidateImportProfile(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile models.ImportProfile
+		wantErr error
+	}{
+		{"defaults", models.ImportProfile{Name: "Bank", DateColumn: "1", AmountColumn: "2"}, nil},
+		{"debit and credit", models.ImportProfile{Name: "Bank", AmountMode: AmountDebitCredit, DateColumn: "1", DebitColumn: "2", CreditColumn: "3"}, nil},
+		{"no name", models.ImportProfile{Name: " ", DateColumn: "1", AmountColumn: "2"}, ErrInvalidProfileName},
+		{"unknown encoding", models.ImportProfile{Name: "Bank", Encoding: "klingon", DateColumn: "1", AmountColumn: "2"}, ErrInvalidEncoding},
+		{"long delimiter", models.ImportProfile{Name: "Bank", Delimiter: ";;", DateColumn: "1", AmountColumn: "2"}, ErrInvalidDelimiter},
+		{"bad date format", models.ImportProfile{Name: "Bank", DateFormat: "MM/DD", DateColumn: "1", AmountColumn: "2"}, ErrInvalidDateFormat},
+		{"bad decimal separator", models.ImportProfile{Name: "Bank", DecimalSeparator: "'", DateColumn: "1", AmountColumn: "2"}, ErrInvalidDecimalSep},
+		{"no date column", models.ImportProfile{Name: "Bank", AmountColumn: "2"}, ErrMissingColumn},
+		{"no amount column", models.ImportProfile{Name: "Bank", DateColumn: "1"}, ErrMissingColumn},
+		{"no credit column", models.ImportProfile{Name: "Bank", AmountMode: AmountDebitCredit, DateColumn: "1", DebitColumn: "2"}, ErrMissingColumn},
+		{"unknown amount mode", models.ImportProfile{Name: "Bank", AmountMode: "net", DateColumn: "1", AmountColumn: "2"}, ErrInvalidAmountMode},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.profile
+			err := ValidateImportProfile(&p)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && (p.Encoding == "" || p.Delimiter == "" || p.DateFormat == "" || p.DecimalSeparator == "" || p.AmountMode == "") {
+				t.Errorf("defaults not filled in: %+v", p)
+			}
+		})
+	}
+
+	p := models.ImportProfile{Name: "Bank", Delimiter: `\t`, DateColumn: "1", AmountColumn: "2"}
+	if err := ValidateImportProfile(&p); err != nil || p.Delimiter != "\t" {
+		t.Errorf(`delimiter \t = %q, %v, want a tab`, p.Delimiter, err)
+	}
+}
+
+func TestParseCSV(t *testing.T) {
+	signed := models.ImportProfile{
+		Encoding: "utf-8", Delimiter: ";", HasHeader: true, DateFormat: "DD.MM.YYYY", DecimalSeparator: ",",
+		AmountMode: AmountSigned, DateColumn: "Buchungstag", AmountColumn: "Betrag", NoteColumn: "Verwendungszweck", CurrencyColumn: "Währung",
+	}
+	debitCredit := models.ImportProfile{
+		Encoding: "utf-8", Delimiter: ",", DateFormat: "YYYY-MM-DD", DecimalSeparator: ".",
+		AmountMode: AmountDebitCredit, DateColumn: "1", DebitColumn: "2", CreditColumn: "3", NoteColumn: "4",
+	}
+	preamble := signed
+	preamble.SkipRows = 2
+	latin1 := signed
+	latin1.Encoding = "windows-1252"
+
+	type want struct {
+		line   int
+		typ    string
+		amount string
+		note   string
+		errs   int
+	}
+	tests := []struct {
+		name    string
+		profile models.ImportProfile
+		file    string
+		want    []want
+	}{
+		{
+			"signed with header", signed,
+			"Buchungstag;Betrag;Verwendungszweck;Währung\n" +
+				"03.02.2026;-1.234,50;Miete;eur\n" +
+				"04.02.2026;2.500,00;Gehalt;EUR\n",
+			[]want{{2, "expense", "1234.50", "Miete", 0}, {3, "income", "2500.00", "Gehalt", 0}},
+		},
+		{
+			"debit and credit by number", debitCredit,
+			"2026-02-03,12.30,,Bakery\n" +
+				"2026-02-04,,40.00,Refund\n" +
+				"2026-02-05,1.00,2.00,Both\n" +
+				"2026-02-06,,,Neither\n",
+			[]want{{1, "expense", "12.30", "Bakery", 0}, {2, "income", "40.00", "Refund", 0}, {3, "", "", "Both", 1}, {4, "", "", "Neither", 1}},
+		},
+		{
+			"bank preamble and blank lines", preamble,
+			"Kontoauszug\nIBAN;DE00\n" +
+				"Buchungstag;Betrag;Verwendungszweck;Währung\n" +
+				";;;\n" +
+				"03.02.2026;-5,00;Kiosk;EUR\n",
+			[]want{{5, "expense", "5.00", "Kiosk", 0}},
+		},
+		{
+			"row errors", signed,
+			"Buchungstag;Betrag;Verwendungszweck;Währung\n" +
+				"2026-02-03;-5,00;wrong date;EUR\n" +
+				"03.02.2026;five;not a number;EUR\n" +
+				"03.02.2026\n",
+			[]want{{2, "expense", "5.00", "wrong date", 1}, {3, "", "", "not a number", 1}, {4, "", "", "", 1}},
+		},
+		{
+			"windows-1252", latin1,
+			"Buchungstag;Betrag;Verwendungszweck;W\xe4hrung\n" +
+				"03.02.2026;-3,20;B\xe4ckerei;EUR\n",
+			[]want{{2, "expense", "3.20", "Bäckerei", 0}},
+		},
+		{
+			"byte order mark", signed,
+			"\xef\xbb\xbfBuchungstag;Betrag;Verwendungszweck;Währung\n" +
+				"03.02.2026;-3,20;Kiosk;EUR\n",
+			[]want{{2, "expense", "3.20", "Kiosk", 0}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := ParseCSV(strings.NewReader(tt.file), tt.profile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rows) != len(tt.want) {
+				t.Fatalf("got %d rows, want %d", len(rows), len(tt.want))
+			}
+			for i, w := range tt.want {
+				row := rows[i]
+				if row.Line != w.line || len(row.Errors) != w.errs || row.Transaction.Note != w.note {
+					t.Errorf("row %d = line %d note %q errors %v, want line %d note %q and %d errors",
+						i, row.Line, row.Transaction.Note, row.Errors, w.line, w.note, w.errs)
+				}
+				if w.typ == "" {
+					continue
+				}
+				if row.Transaction.Type != w.typ || row.Transaction.Amount != money.MustParse(w.amount) {
+					t.Errorf("row %d = %s %s, want %s %s", i, row.Transaction.Type, row.Transaction.Amount, w.typ, w.amount)
+				}
+			}
+		})
+	}
+
+	rows, err := ParseCSV(strings.NewReader("Buchungstag;Betrag;Verwendungszweck;Währung\n03.02.2026;1,00;x;eur\n"), signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := rows[0].Transaction; got.Currency != "EUR" || !got.Date.Equal(time.Date(2026, time.February, 3, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("currency %s date %s, want EUR 2026-02-03", got.Currency, got.Date)
+	}
+}
+
+func TestParseCSVErrors(t *testing.T) {
+	profile := models.ImportProfile{
+		Encoding: "utf-8", Delimiter: ",", HasHeader: true, DateFormat: "YYYY-MM-DD", DecimalSeparator: ".",
+		AmountMode: AmountSigned, DateColumn: "Date", AmountColumn: "Amount",
+	}
+	tests := []struct {
+		name, file string
+		wantErr    error
+	}{
+		{"empty", "", ErrEmptyImportFile},
+		{"header only", "Date,Amount\n", ErrEmptyImportFile},
+		{"unknown column", "Day,Amount\n2026-01-01,1.00\n", ErrColumnNotFound},
+		{"stray quotes are tolerated", "Date,Amount\n2026-01-01,\"1.00\"x\"\n", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseCSV(strings.NewReader(tt.file), profile)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
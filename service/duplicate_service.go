@@ -0,0 +1,303 @@
+package service
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"tracker/models"
+	"tracker/money"
+	"tracker/repository"
+)
+
+// Statuses of a duplicate candidate
+const (
+	DuplicateOpen      = "open"
+	DuplicateMerged    = "merged"
+	DuplicateDismissed = "dismissed"
+)
+
+const (
+	// duplicateWindow is how many days apart two entries of the same payment
+	// may be booked, e.g. typed in on the day and cleared by the bank later
+	duplicateWindow = 3
+
+	// duplicateThreshold is the score from which a pair is flagged
+	duplicateThreshold = 0.6
+)
+
+var (
+	ErrDuplicateNotFound = errors.New("duplicate candidate not found")
+	ErrDuplicateResolved = errors.New("duplicate candidate was already merged or dismissed")
+	ErrInvalidMergeKeep  = errors.New("keep must be one of the two transactions")
+)
+
+type DuplicateService struct {
+	Repo        repository.DuplicateRepository
+	Suggestions *SuggestionService // optional, relearns categories after a merge
+}
+
+// Flag fills in PossibleDuplicates of each transaction: the earlier incomes
+// and expenses of the same amount booked within a few days whose note is
+// alike, best match first. Unsaved transactions are compared with every
+// saved one, saved ones only with those saved before the batch, so two
+// identical rows of one statement do not flag each other. With record set,
+// saved transactions get their matches stored as candidates for review.
+// Transfers are never flagged.
+func (d *DuplicateService) Flag(txs []*models.Transaction, record bool) error {
+	var amounts []money.Amount
+	var from, to time.Time
+	batch := map[uint]bool{}
+	for _, tx := range txs {
+		if tx.ID != 0 {
+			batch[tx.ID] = true
+		}
+		if tx.Type == TypeTransfer {
+			continue
+		}
+		if len(amounts) == 0 || tx.Date.Before(from) {
+			from = tx.Date
+		}
+		if len(amounts) == 0 || tx.Date.After(to) {
+			to = tx.Date
+		}
+		amounts = append(amounts, tx.Amount)
+	}
+	if len(amounts) == 0 {
+		return nil
+	}
+
+	userID := txs[0].UserID
+	similar, err := d.Repo.FindSimilar(userID, amounts, from.AddDate(0, 0, -duplicateWindow-1), to.AddDate(0, 0, duplicateWindow+1))
+	if err != nil {
+		return err
+	}
+	byAmount := map[money.Amount][]models.Transaction{}
+	for _, s := range similar {
+		byAmount[s.Amount] = append(byAmount[s.Amount], s)
+	}
+
+	var candidates []models.DuplicateCandidate
+	for _, tx := range txs {
+		if tx.Type == TypeTransfer {
+			continue
+		}
+		type match struct {
+			id    uint
+			score float64
+		}
+		var matches []match
+		for _, other := range byAmount[tx.Amount] {
+			// Only entries from before the batch count, so each pair is
+			// flagged once
+			if batch[other.ID] || (tx.ID != 0 && other.ID > tx.ID) {
+				continue
+			}
+			if score := duplicateScore(*tx, other); score >= duplicateThreshold {
+				matches = append(matches, match{other.ID, score})
+			}
+		}
+		sort.SliceStable(matches, func(i, j int) bool { return matches[i].score > matches[j].score })
+
+		tx.PossibleDuplicates = nil
+		for _, m := range matches {
+			tx.PossibleDuplicates = append(tx.PossibleDuplicates, m.id)
+			if record && tx.ID != 0 {
+				candidates = append(candidates, models.DuplicateCandidate{
+					UserID:        userID,
+					TransactionID: tx.ID,
+					DuplicateOfID: m.id,
+					Score:         math.Round(m.score*100) / 100,
+					Status:        DuplicateOpen,
+				})
+			}
+		}
+	}
+	return d.Repo.CreateCandidates(candidates)
+}
+
+// GetOpenCandidates lists the suspected duplicates waiting for review
+func (d *DuplicateService) GetOpenCandidates(userID uint) ([]models.DuplicateCandidate, error) {
+	candidates, err := d.Repo.GetOpenCandidates(userID)
+	if err != nil {
+		return nil, err
+	}
+	if candidates == nil {
+		candidates = []models.DuplicateCandidate{}
+	}
+	return candidates, nil
+}
+
+// Merge resolves a candidate by keeping one of the two transactions and
+// deleting the other. keepID picks the survivor and defaults to the earlier
+// entry. The survivor takes over the note, bank reference, value date,
+// account and payee the other has and it lacks, its category if it had the
+// import default, and its tags.
+func (d *DuplicateService) Merge(id uint, userID uint, keepID uint) (*models.Transaction, error) {
+	candidate, err := d.openCandidate(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if candidate.Transaction == nil || candidate.DuplicateOf == nil {
+		return nil, ErrTransactionNotFound
+	}
+
+	keep, other := candidate.DuplicateOf, candidate.Transaction
+	switch keepID {
+	case 0, keep.ID:
+	case other.ID:
+		keep, other = other, keep
+	default:
+		return nil, ErrInvalidMergeKeep
+	}
+
+	if keep.Note == "" {
+		keep.Note = other.Note
+	}
+	if keep.ExternalID == "" {
+		keep.ExternalID = other.ExternalID
+	}
+	if keep.ValueDate == nil {
+		keep.ValueDate = other.ValueDate
+	}
+	if keep.AccountID == nil {
+		keep.AccountID = other.AccountID
+	}
+	if keep.PayeeID == nil && keep.Payee == "" {
+		keep.PayeeID, keep.Payee = other.PayeeID, other.Payee
+	}
+	if keep.Category == DefaultImportCategory && len(keep.Splits) == 0 && len(other.Splits) == 0 {
+		keep.Category = other.Category
+		keep.CategoryID = other.CategoryID
+	}
+
+	if err := d.Repo.MergeCandidate(candidate.ID, keep, other.ID, DuplicateMerged); err != nil {
+		return nil, err
+	}
+	for _, tag := range other.Tags {
+		if !hasTag(keep.Tags, tag.ID) {
+			keep.Tags = append(keep.Tags, tag)
+		}
+	}
+	if d.Suggestions != nil {
+		d.Suggestions.Reset(userID)
+	}
+	return keep, nil
+}
+
+// Dismiss marks a candidate as not a duplicate; the pair is not flagged again
+func (d *DuplicateService) Dismiss(id uint, userID uint) error {
+	if _, err := d.openCandidate(id, userID); err != nil {
+		return err
+	}
+	return d.Repo.UpdateCandidateStatus(id, DuplicateDismissed)
+}
+
+// openCandidate fetches an unresolved candidate owned by the user
+func (d *DuplicateService) openCandidate(id uint, userID uint) (*models.DuplicateCandidate, error) {
+	if !d.Repo.CheckCandidateExistsForUser(id, userID) {
+		return nil, ErrDuplicateNotFound
+	}
+	candidate, err := d.Repo.GetCandidateByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if candidate.Status != DuplicateOpen {
+		return nil, ErrDuplicateResolved
+	}
+	return candidate, nil
+}
+
+// duplicateScore rates from 0 to 1 how likely b is the same payment as a:
+// half for how close the dates are, half for how alike the notes are. Both
+// must be of the same type and currency and on the same account, or one on none.
+func duplicateScore(a, b models.Transaction) float64 {
+	if a.Type != b.Type || a.Currency != b.Currency || a.Amount != b.Amount {
+		return 0
+	}
+	if a.AccountID != nil && b.AccountID != nil && *a.AccountID != *b.AccountID {
+		return 0
+	}
+
+	days := a.Date.Sub(b.Date).Hours() / 24
+	if days < 0 {
+		days = -days
+	}
+	if days > duplicateWindow+0.5 {
+		return 0
+	}
+	dateScore := 1 - float64(int(days+0.5))/float64(duplicateWindow+1)
+
+	// Without a note to compare, neither rule it in nor out
+	noteScore := 0.5
+	if strings.TrimSpace(a.Note) != "" && strings.TrimSpace(b.Note) != "" {
+		noteScore = noteSimilarity(a.Note, b.Note)
+	}
+	return dateScore/2 + noteScore/2
+}
+
+// noteSimilarity compares two notes from 0 to 1. Bank texts often wrap what
+// the user typed ("coffee" vs "CARD 1234 STARBUCKS COFFEE"), so a note whose
+// words all appear in the other counts as a full match; otherwise the
+// overlap of letter pairs (Dice coefficient) measures how alike they are.
+func noteSimilarity(a, b string) float64 {
+	wa, wb := noteWords(a), noteWords(b)
+	if len(wa) == 0 || len(wb) == 0 {
+		return 0
+	}
+	if len(wa) > len(wb) {
+		wa, wb = wb, wa
+	}
+	inLonger := map[string]bool{}
+	for _, w := range wb {
+		inLonger[w] = true
+	}
+	contained := 0
+	for _, w := range wa {
+		if inLonger[w] {
+			contained++
+		}
+	}
+	if contained == len(wa) {
+		return 1
+	}
+
+	pa, pb := letterPairs(strings.Join(wa, " ")), letterPairs(strings.Join(wb, " "))
+	if len(pa)+len(pb) == 0 {
+		return 0
+	}
+	count := map[string]int{}
+	for _, p := range pa {
+		count[p]++
+	}
+	shared := 0
+	for _, p := range pb {
+		if count[p] > 0 {
+			count[p]--
+			shared++
+		}
+	}
+	return 2 * float64(shared) / float64(len(pa)+len(pb))
+}
+
+// noteWords lower-cases a note and splits it into words of letters and digits
+func noteWords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// letterPairs returns the adjacent letter pairs within each word of s
+func letterPairs(s string) []string {
+	var pairs []string
+	for _, w := range strings.Fields(s) {
+		r := []rune(w)
+		for i := 0; i+1 < len(r); i++ {
+			pairs = append(pairs, string(r[i:i+2]))
+		}
+	}
+	return pairs
+}
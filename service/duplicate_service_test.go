@@ -0,0 +1,221 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"tracker/models"
+	"tracker/money"
+	"tracker/repository"
+)
+
+// memDuplicateRepo finds similar transactions among a fixed set
+type memDuplicateRepo struct {
+	repository.DuplicateRepository
+	saved      []models.Transaction
+	candidates []models.DuplicateCandidate
+
+	merged   *models.Transaction // survivor passed to MergeCandidate
+	removed  uint
+	resolved string
+}
+
+func (m *memDuplicateRepo) FindSimilar(userID uint, amounts []money.Amount, from, to time.Time) ([]models.Transaction, error) {
+	var found []models.Transaction
+	for _, tx := range m.saved {
+		for _, a := range amounts {
+			if tx.Amount == a && !tx.Date.Before(from) && tx.Date.Before(to) {
+				found = append(found, tx)
+				break
+			}
+		}
+	}
+	return found, nil
+}
+
+func (m *memDuplicateRepo) CreateCandidates(candidates []models.DuplicateCandidate) error {
+	m.candidates = append(m.candidates, candidates...)
+	return nil
+}
+
+func (m *memDuplicateRepo) CheckCandidateExistsForUser(id uint, userID uint) bool {
+	for _, c := range m.candidates {
+		if c.ID == id && c.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *memDuplicateRepo) GetCandidateByID(id uint) (*models.DuplicateCandidate, error) {
+	for _, c := range m.candidates {
+		if c.ID == id {
+			return &c, nil
+		}
+	}
+	return nil, ErrDuplicateNotFound
+}
+
+func (m *memDuplicateRepo) MergeCandidate(id uint, keep *models.Transaction, removeID uint, status string) error {
+	m.merged, m.removed, m.resolved = keep, removeID, status
+	return nil
+}
+
+func coffee(id uint, day int) models.Transaction {
+	tx := models.Transaction{UserID: 1, Type: "expense", Amount: money.MustParse("3.20"), Currency: "EUR",
+		Note: "CARD STARBUCKS COFFEE", Date: date(2026, time.March, day)}
+	tx.ID = id
+	return tx
+}
+
+func TestFlagIgnoresItsOwnBatch(t *testing.T) {
+	earlier := coffee(1, 2)
+	first, second := coffee(10, 3), coffee(11, 3)
+	repo := &memDuplicateRepo{saved: []models.Transaction{earlier, first, second}}
+	d := &DuplicateService{Repo: repo}
+
+	if err := d.Flag([]*models.Transaction{&first, &second}, true); err != nil {
+		t.Fatal(err)
+	}
+	for _, tx := range []models.Transaction{first, second} {
+		if len(tx.PossibleDuplicates) != 1 || tx.PossibleDuplicates[0] != earlier.ID {
+			t.Errorf("transaction %d flagged as duplicate of %v, want only %d", tx.ID, tx.PossibleDuplicates, earlier.ID)
+		}
+	}
+	if len(repo.candidates) != 2 {
+		t.Errorf("recorded %d candidates, want 2", len(repo.candidates))
+	}
+}
+
+func TestNoteSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b string
+		min  float64
+		max  float64
+	}{
+		{"coffee", "CARD 1234 STARBUCKS COFFEE", 1, 1},
+		{"Rent March", "rent march", 1, 1},
+		{"Groceries Acme", "Acme Markt", 0.3, 0.8},
+		{"rent", "coffee", 0, 0.1},
+		{"", "coffee", 0, 0},
+	}
+	for _, tt := range tests {
+		if got := noteSimilarity(tt.a, tt.b); got < tt.min || got > tt.max {
+			t.Errorf("noteSimilarity(%q, %q) = %.2f, want between %.2f and %.2f", tt.a, tt.b, got, tt.min, tt.max)
+		}
+	}
+}
+
+func TestDuplicateScore(t *testing.T) {
+	account, other := uint(1), uint(2)
+	onAccount := func(tx models.Transaction, id *uint) models.Transaction {
+		tx.AccountID = id
+		return tx
+	}
+	income := coffee(2, 2)
+	income.Type = "income"
+	tests := []struct {
+		name    string
+		a, b    models.Transaction
+		flagged bool
+	}{
+		{"same day", coffee(1, 2), coffee(2, 2), true},
+		{"within the window", coffee(1, 2), coffee(2, 5), true},
+		{"outside the window", coffee(1, 2), coffee(2, 6), false},
+		{"one without an account", onAccount(coffee(1, 2), &account), coffee(2, 2), true},
+		{"different accounts", onAccount(coffee(1, 2), &account), onAccount(coffee(2, 2), &other), false},
+		{"different type", coffee(1, 2), income, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := duplicateScore(tt.a, tt.b) >= duplicateThreshold; got != tt.flagged {
+				t.Errorf("flagged = %v, want %v (score %.2f)", got, tt.flagged, duplicateScore(tt.a, tt.b))
+			}
+		})
+	}
+}
+
+func TestFlagSingleEntry(t *testing.T) {
+	tests := []struct {
+		name  string
+		saved []models.Transaction
+		tx    models.Transaction
+		want  []uint
+	}{
+		{name: "same payment a day later", saved: []models.Transaction{coffee(1, 2)}, tx: coffee(2, 3), want: []uint{1}},
+		{name: "outside the window", saved: []models.Transaction{coffee(1, 2)}, tx: coffee(2, 9)},
+		{name: "later entries are not flagged", saved: []models.Transaction{coffee(5, 2)}, tx: coffee(2, 3)},
+		{name: "unsaved entry of a dry run", saved: []models.Transaction{coffee(1, 2)}, tx: coffee(0, 3), want: []uint{1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saved := tt.saved
+			if tt.tx.ID != 0 {
+				saved = append(saved, tt.tx)
+			}
+			d := &DuplicateService{Repo: &memDuplicateRepo{saved: saved}}
+			tx := tt.tx
+			if err := d.Flag([]*models.Transaction{&tx}, false); err != nil {
+				t.Fatal(err)
+			}
+			if len(tx.PossibleDuplicates) != len(tt.want) {
+				t.Fatalf("flagged %v, want %v", tx.PossibleDuplicates, tt.want)
+			}
+			for i := range tt.want {
+				if tx.PossibleDuplicates[i] != tt.want[i] {
+					t.Errorf("flagged %v, want %v", tx.PossibleDuplicates, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestMergeManualWithImported(t *testing.T) {
+	manual := coffee(1, 2)
+	manual.Note, manual.Category = "coffee with Sam", "Eating out"
+	imported := coffee(2, 3)
+	imported.Category, imported.ExternalID = DefaultImportCategory, "2026030300017"
+	account := uint(4)
+	imported.AccountID = &account
+
+	tests := []struct {
+		name     string
+		keepID   uint
+		wantKeep uint
+		wantNote string
+		wantCat  string
+	}{
+		{"keeps the manual entry by default", 0, manual.ID, "coffee with Sam", "Eating out"},
+		{"keeps the imported entry", imported.ID, imported.ID, "CARD STARBUCKS COFFEE", "Eating out"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, i := manual, imported
+			candidate := models.DuplicateCandidate{UserID: 1, TransactionID: i.ID, DuplicateOfID: m.ID,
+				Status: DuplicateOpen, Transaction: &i, DuplicateOf: &m}
+			candidate.ID = 7
+			repo := &memDuplicateRepo{candidates: []models.DuplicateCandidate{candidate}}
+			d := &DuplicateService{Repo: repo}
+
+			kept, err := d.Merge(candidate.ID, 1, tt.keepID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if kept.ID != tt.wantKeep || repo.merged.ID != tt.wantKeep {
+				t.Fatalf("kept %d, want %d", kept.ID, tt.wantKeep)
+			}
+			if want := manual.ID + imported.ID - tt.wantKeep; repo.removed != want {
+				t.Errorf("removed %d, want %d", repo.removed, want)
+			}
+			if kept.ExternalID != imported.ExternalID || kept.AccountID == nil || *kept.AccountID != account {
+				t.Errorf("kept bank reference %q on account %v, want %q on %d", kept.ExternalID, kept.AccountID, imported.ExternalID, account)
+			}
+			if kept.Note != tt.wantNote || kept.Category != tt.wantCat {
+				t.Errorf("kept %q in %q, want %q in %q", kept.Note, kept.Category, tt.wantNote, tt.wantCat)
+			}
+			if repo.resolved != DuplicateMerged {
+				t.Errorf("candidate resolved as %q, want %q", repo.resolved, DuplicateMerged)
+			}
+		})
+	}
+}
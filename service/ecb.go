@@ -0,0 +1,128 @@
+package service
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"tracker/models"
+)
+
+// ecbDateLayouts covers the historical files (2006-01-02) and the daily file
+// ("17 October 2026")
+var ecbDateLayouts = []string{"2006-01-02", "2 January 2006", "02 January 2006"}
+
+// ParseECBCSV reads the ECB eurofxref CSV layout: a Date column followed by
+// one column per currency, one row per day. "N/A" cells are skipped.
+func ParseECBCSV(r io.Reader) ([]models.ExchangeRate, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+	if len(header) == 0 || !strings.EqualFold(strings.TrimSpace(header[0]), "date") {
+		return nil, errors.New("not an ECB rate file: first column must be Date")
+	}
+
+	var rates []models.ExchangeRate
+	for line := 2; ; line++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if len(record) == 0 || strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+
+		date, err := parseECBDate(record[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		for i := 1; i < len(record) && i < len(header); i++ {
+			currency := strings.ToUpper(strings.TrimSpace(header[i]))
+			value := strings.TrimSpace(record[i])
+			if currency == "" || value == "" || value == "N/A" {
+				continue
+			}
+			rate, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d, %s: invalid rate %q", line, currency, value)
+			}
+			rates = append(rates, models.ExchangeRate{Date: date, Currency: currency, Rate: rate})
+		}
+	}
+	return rates, nil
+}
+
+// ParseECBXML reads the ECB eurofxref XML layout:
+// <Cube><Cube time="..."><Cube currency="USD" rate="1.08"/>...</Cube></Cube>
+func ParseECBXML(r io.Reader) ([]models.ExchangeRate, error) {
+	dec := xml.NewDecoder(r)
+
+	var rates []models.ExchangeRate
+	var date time.Time
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse xml: %w", err)
+		}
+
+		el, ok := tok.(xml.StartElement)
+		if !ok || el.Name.Local != "Cube" {
+			continue
+		}
+
+		var currency, rate string
+		for _, attr := range el.Attr {
+			switch attr.Name.Local {
+			case "time":
+				if date, err = parseECBDate(attr.Value); err != nil {
+					return nil, err
+				}
+			case "currency":
+				currency = strings.ToUpper(attr.Value)
+			case "rate":
+				rate = attr.Value
+			}
+		}
+		if currency == "" {
+			continue
+		}
+		if date.IsZero() {
+			return nil, fmt.Errorf("rate for %s outside a dated Cube", currency)
+		}
+
+		value, err := strconv.ParseFloat(rate, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s on %s: invalid rate %q", currency, date.Format("2006-01-02"), rate)
+		}
+		rates = append(rates, models.ExchangeRate{Date: date, Currency: currency, Rate: value})
+	}
+	return rates, nil
+}
+
+// parseECBDate parses the date formats used across ECB files
+func parseECBDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range ecbDateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", s)
+}
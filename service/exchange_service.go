@@ -0,0 +1,165 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"tracker/models"
+	"tracker/money"
+	"tracker/repository"
+)
+
+// DefaultBaseCurrency is used when no user preference is available
+const DefaultBaseCurrency = "USD"
+
+var (
+	ErrMissingExchangeRate = repository.ErrMissingExchangeRate
+	ErrInvalidAmount       = money.ErrInvalidAmount
+)
+
+type ExchangeService struct {
+	Repo  repository.ExchangeRateRepository
+	Users UserRepo
+}
+
+// BaseCurrency returns the currency a user's totals and reports are shown in
+func (e *ExchangeService) BaseCurrency(userID uint) (string, error) {
+	if e == nil || e.Users == nil {
+		return DefaultBaseCurrency, nil
+	}
+	user, err := e.Users.GetUserByID(userID)
+	if err != nil {
+		return "", err
+	}
+	if user.BaseCurrency == "" {
+		return DefaultBaseCurrency, nil
+	}
+	return user.BaseCurrency, nil
+}
+
+// ResolveCurrency defaults an empty currency to the user's base currency,
+// upper-cases it and checks that it is an ISO 4217 code. Amounts sent without
+// a currency were read with two decimals; when the currency is defaulted,
+// amounts are moved onto its decimal places.
+func (e *ExchangeService) ResolveCurrency(currency *string, userID uint, amounts ...*money.Amount) error {
+	given := *currency
+	if *currency == "" {
+		base, err := e.BaseCurrency(userID)
+		if err != nil {
+			return err
+		}
+		*currency = base
+	}
+
+	*currency = strings.ToUpper(strings.TrimSpace(*currency))
+	if !isCurrencyCode(*currency) {
+		return ErrInvalidCurrency
+	}
+	if given == "" {
+		return rescaleAmounts(*currency, amounts...)
+	}
+	return nil
+}
+
+// rescaleAmounts moves amounts read with two decimals onto the decimal
+// places of currency
+func rescaleAmounts(currency string, amounts ...*money.Amount) error {
+	for _, a := range amounts {
+		v, err := a.Rescale("", currency)
+		if err != nil {
+			return err
+		}
+		*a = v
+	}
+	return nil
+}
+
+// Convert converts an amount between currencies at the latest rates on or before at
+func (e *ExchangeService) Convert(amount money.Amount, from, to string, at time.Time) (money.Amount, error) {
+	if from == to || amount == 0 {
+		return amount, nil
+	}
+	if e == nil {
+		return 0, fmt.Errorf("%w: %s to %s", ErrMissingExchangeRate, from, to)
+	}
+
+	fromRate, err := e.Repo.GetRate(from, at)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s on %s", err, from, at.Format("2006-01-02"))
+	}
+	toRate, err := e.Repo.GetRate(to, at)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s on %s", err, to, at.Format("2006-01-02"))
+	}
+	return amount.Convert(from, to, toRate/fromRate), nil
+}
+
+// GetRatesOn returns the latest known rate of every currency on or before date
+func (e *ExchangeService) GetRatesOn(date time.Time) ([]models.ExchangeRate, error) {
+	return e.Repo.GetRatesOn(date)
+}
+
+// ImportPath loads ECB reference rate files from a file or from every .csv and
+// .xml file in a directory, and returns how many rates were stored
+func (e *ExchangeService) ImportPath(path string) (int, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+
+	files := []string{path}
+	if info.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return 0, err
+		}
+		files = files[:0]
+		for _, entry := range entries {
+			ext := strings.ToLower(filepath.Ext(entry.Name()))
+			if !entry.IsDir() && (ext == ".csv" || ext == ".xml") {
+				files = append(files, filepath.Join(path, entry.Name()))
+			}
+		}
+	}
+
+	total := 0
+	for _, file := range files {
+		n, err := e.ImportFile(file)
+		if err != nil {
+			return total, fmt.Errorf("%s: %w", file, err)
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// ImportFile loads one ECB CSV or XML rate file
+func (e *ExchangeService) ImportFile(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var rates []models.ExchangeRate
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		rates, err = ParseECBCSV(f)
+	case ".xml":
+		rates, err = ParseECBXML(f)
+	default:
+		err = errors.New("unsupported rate file, expected .csv or .xml")
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if err := e.Repo.SaveRates(rates); err != nil {
+		return 0, err
+	}
+	return len(rates), nil
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"tracker/models"
+	"tracker/money"
+	"tracker/repository"
+)
+
+// memRateRepo serves fixed rates per euro, whatever the date
+type memRateRepo struct {
+	repository.ExchangeRateRepository
+	rates map[string]float64
+}
+
+func (m *memRateRepo) GetRate(currency string, at time.Time) (float64, error) {
+	if currency == "EUR" {
+		return 1, nil
+	}
+	if rate, ok := m.rates[currency]; ok {
+		return rate, nil
+	}
+	return 0, repository.ErrMissingExchangeRate
+}
+
+func TestConvert(t *testing.T) {
+	fx := &ExchangeService{Repo: &memRateRepo{rates: map[string]float64{"USD": 1.25, "GBP": 0.8}}}
+	day := date(2026, time.March, 2)
+	tests := []struct {
+		name     string
+		amount   string
+		from, to string
+		want     string
+		err      error
+	}{
+		{"same currency", "10.00", "USD", "USD", "10.00", nil},
+		{"from euro", "10.00", "EUR", "USD", "12.50", nil},
+		{"into euro", "12.50", "USD", "EUR", "10.00", nil},
+		{"crossed through euro", "10.00", "USD", "GBP", "6.40", nil},
+		{"rounded to the cent", "0.01", "EUR", "USD", "0.01", nil},
+		{"negative", "-10.00", "EUR", "GBP", "-8.00", nil},
+		{"no rate", "10.00", "EUR", "CHF", "", ErrMissingExchangeRate},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := fx.Convert(money.MustParse(tt.amount), tt.from, tt.to, day)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if err == nil && got != money.MustParse(tt.want) {
+				t.Errorf("Convert(%s %s to %s) = %s, want %s", tt.amount, tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+
+	// Without a service only amounts that need no conversion go through
+	var none *ExchangeService
+	if got, err := none.Convert(money.MustParse("5"), "USD", "USD", day); err != nil || got != money.MustParse("5") {
+		t.Errorf("nil service, same currency = %s, %v", got, err)
+	}
+	if _, err := none.Convert(money.MustParse("5"), "USD", "EUR", day); !errors.Is(err, ErrMissingExchangeRate) {
+		t.Errorf("nil service: err = %v, want %v", err, ErrMissingExchangeRate)
+	}
+}
+
+func TestResolveCurrency(t *testing.T) {
+	fx := &ExchangeService{Users: &memUserRepo{users: map[uint]*models.User{1: {BaseCurrency: "EUR"}, 2: {}}}}
+	tests := []struct {
+		name     string
+		currency string
+		userID   uint
+		want     string
+		err      error
+	}{
+		{"user's base currency", "", 1, "EUR", nil},
+		{"default base currency", "", 2, DefaultBaseCurrency, nil},
+		{"upper-cased", " gbp ", 1, "GBP", nil},
+		{"not a code", "EURO", 1, "", ErrInvalidCurrency},
+		{"no cents", "JPY", 1, "JPY", nil},
+		{"three decimals", "kwd", 1, "KWD", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cur := tt.currency
+			if err := fx.ResolveCurrency(&cur, tt.userID); !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if tt.err == nil && cur != tt.want {
+				t.Errorf("currency = %q, want %q", cur, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseECBCSV(t *testing.T) {
+	in := "Date, USD, JPY, CYP,\n2026-03-02, 1.0812, 162.5, N/A,\n2026-02-27, 1.08, 161.9, N/A,\n"
+	rates, err := ParseECBCSV(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rates) != 4 {
+		t.Fatalf("got %d rates, want 4 without the N/A cells", len(rates))
+	}
+	if r := rates[0]; !r.Date.Equal(date(2026, time.March, 2)) || r.Currency != "USD" || r.Rate != 1.0812 {
+		t.Errorf("first rate = %+v", r)
+	}
+
+	for _, bad := range []string{"Currency, USD\n2026-03-02, 1.08\n", "Date, USD\nyesterday, 1.08\n", "Date, USD\n2026-03-02, lots\n"} {
+		if _, err := ParseECBCSV(strings.NewReader(bad)); err == nil {
+			t.Errorf("ParseECBCSV(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestParseECBXML(t *testing.T) {
+	in := `<gesmes:Envelope xmlns:gesmes="http://www.gesmes.org/xml/2002-08-01" xmlns="http://www.ecb.int/vocabulary/2002-08-01/eurofxref">
+	<Cube>
+		<Cube time="2026-03-02">
+			<Cube currency="USD" rate="1.0812"/>
+			<Cube currency="jpy" rate="162.5"/>
+		</Cube>
+		<Cube time="2026-02-27">
+			<Cube currency="USD" rate="1.08"/>
+		</Cube>
+	</Cube>
+</gesmes:Envelope>`
+	rates, err := ParseECBXML(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []models.ExchangeRate{
+		{Date: date(2026, time.March, 2), Currency: "USD", Rate: 1.0812},
+		{Date: date(2026, time.March, 2), Currency: "JPY", Rate: 162.5},
+		{Date: date(2026, time.February, 27), Currency: "USD", Rate: 1.08},
+	}
+	if len(rates) != len(want) {
+		t.Fatalf("got %d rates, want %d", len(rates), len(want))
+	}
+	for i, r := range rates {
+		if !r.Date.Equal(want[i].Date) || r.Currency != want[i].Currency || r.Rate != want[i].Rate {
+			t.Errorf("rate %d = %+v, want %+v", i, r, want[i])
+		}
+	}
+
+	if _, err := ParseECBXML(strings.NewReader(`<Cube><Cube currency="USD" rate="1.08"/></Cube>`)); err == nil {
+		t.Error("a rate without a date was accepted")
+	}
+}
@@ -0,0 +1,217 @@
+package service
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"tracker/models"
+)
+
+// Formats a transaction export can be written in
+const (
+	ExportCSV   = "csv"
+	ExportJSONL = "jsonl"
+	ExportXLSX  = "xlsx"
+)
+
+var ErrUnknownExportFormat = errors.New("format must be csv, jsonl, xlsx, ledger, hledger or beancount")
+
+// exportColumns are the header of the tabular formats, in column order
+var exportColumns = []string{
+	"id", "date", "value_date", "type", "category", "amount", "currency",
+	"account_id", "note", "external_id", "splits", "tags", "payee",
+}
+
+// TransactionWriter writes transactions one at a time in an export format.
+// Close finishes the file; nothing valid has been written before it returns.
+type TransactionWriter interface {
+	Write(tx models.Transaction) error
+	Close() error
+}
+
+// ExportFileType returns the media type and file extension of an export format
+func ExportFileType(format string) (contentType, ext string, err error) {
+	switch format {
+	case ExportCSV:
+		return "text/csv; charset=utf-8", "csv", nil
+	case ExportJSONL:
+		return "application/x-ndjson", "jsonl", nil
+	case ExportXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", "xlsx", nil
+	case ExportLedger:
+		return "text/plain; charset=utf-8", "ledger", nil
+	case ExportHledger:
+		return "text/plain; charset=utf-8", "journal", nil
+	case ExportBeancount:
+		return "text/plain; charset=utf-8", "beancount", nil
+	}
+	return "", "", ErrUnknownExportFormat
+}
+
+// newTransactionWriter returns a writer for the format. Writers may start
+// writing to w right away, so response headers must be set before.
+func newTransactionWriter(format string, w io.Writer, opts JournalOptions) (TransactionWriter, error) {
+	switch format {
+	case ExportCSV:
+		return newCSVWriter(w), nil
+	case ExportJSONL:
+		return newJSONLWriter(w), nil
+	case ExportXLSX:
+		return newXLSXWriter(w)
+	case ExportLedger, ExportHledger, ExportBeancount:
+		return newJournalWriter(w, format, opts), nil
+	}
+	return nil, ErrUnknownExportFormat
+}
+
+// ExportTransactions streams every transaction matching the filter to w in
+// the format, row by row as the database returns them. Limit and cursor do
+// not apply. Journals are always in date order and also carry the user's
+// accounts and budgets.
+func (t *TransactionService) ExportTransactions(filter models.TransactionFilter, format string, w io.Writer) error {
+	if err := t.resolveAmountFilter(&filter); err != nil {
+		return err
+	}
+	var opts JournalOptions
+	if isJournalFormat(format) {
+		var err error
+		if opts, err = t.journalOptions(filter.UserID); err != nil {
+			return err
+		}
+		filter.SortBy, filter.SortDesc = "date", false
+	}
+
+	out, err := newTransactionWriter(format, w, opts)
+	if err != nil {
+		return err
+	}
+	if err := t.Repo.StreamTransactions(filter, out.Write); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// journalOptions gathers the accounts, budgets and base currency of a user
+// and how to find transfer legs the filter left out
+func (t *TransactionService) journalOptions(userID uint) (JournalOptions, error) {
+	var opts JournalOptions
+	var err error
+	if t.Accounts != nil {
+		if opts.Accounts, err = t.Accounts.GetAccountsByUserID(userID, true); err != nil {
+			return opts, err
+		}
+	}
+	if t.Budgets != nil {
+		if opts.Budgets, err = t.Budgets.GetBudgetsByUserID(userID); err != nil {
+			return opts, err
+		}
+	}
+	opts.LinkedLeg = t.Repo.GetTransactionByID
+	opts.BaseCurrency = DefaultBaseCurrency
+	if t.FX != nil {
+		opts.BaseCurrency, err = t.FX.BaseCurrency(userID)
+	}
+	return opts, err
+}
+
+// csvWriter writes one line per transaction; splits are listed in one column
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func newCSVWriter(w io.Writer) *csvWriter {
+	cw := &csvWriter{w: csv.NewWriter(w)}
+	cw.w.Write(exportColumns)
+	return cw
+}
+
+func (c *csvWriter) Write(tx models.Transaction) error {
+	return c.w.Write(exportRecord(tx))
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// jsonlWriter writes each transaction as one JSON object per line, the same
+// shape the API returns
+type jsonlWriter struct {
+	buf *bufio.Writer
+	enc *json.Encoder
+}
+
+func newJSONLWriter(w io.Writer) *jsonlWriter {
+	buf := bufio.NewWriter(w)
+	return &jsonlWriter{buf: buf, enc: json.NewEncoder(buf)}
+}
+
+func (j *jsonlWriter) Write(tx models.Transaction) error {
+	return j.enc.Encode(tx)
+}
+
+func (j *jsonlWriter) Close() error {
+	return j.buf.Flush()
+}
+
+// exportRecord renders a transaction as text fields in exportColumns order
+func exportRecord(tx models.Transaction) []string {
+	valueDate, accountID := "", ""
+	if tx.ValueDate != nil {
+		valueDate = tx.ValueDate.Format("2006-01-02")
+	}
+	if tx.AccountID != nil {
+		accountID = strconv.FormatUint(uint64(*tx.AccountID), 10)
+	}
+	return []string{
+		strconv.FormatUint(uint64(tx.ID), 10),
+		tx.Date.Format("2006-01-02"),
+		valueDate,
+		tx.Type,
+		spreadsheetText(tx.Category),
+		tx.Amount.Format(tx.Currency),
+		tx.Currency,
+		accountID,
+		spreadsheetText(tx.Note),
+		spreadsheetText(tx.ExternalID),
+		spreadsheetText(formatSplits(tx.Splits, tx.Currency)),
+		spreadsheetText(strings.Join(tagNames(tx.Tags), ", ")),
+		spreadsheetText(tx.Payee),
+	}
+}
+
+// spreadsheetText keeps user supplied text from being run as a formula
+// when the file is opened in a spreadsheet: text starting with =, +, -, @,
+// a tab or a carriage return is prefixed with a single quote
+func spreadsheetText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// formatSplits lists split lines as "Category: amount", separated by "; ",
+// with the amounts in the decimal places of currency
+func formatSplits(splits []models.TransactionSplit, currency string) string {
+	parts := make([]string, len(splits))
+	for i, s := range splits {
+		parts[i] = s.Category + ": " + s.Amount.Format(currency)
+	}
+	return strings.Join(parts, "; ")
+}
+
+// excelEpoch is day zero of spreadsheet date serials
+var excelEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// excelDate converts a date to a spreadsheet serial number (days since excelEpoch)
+func excelDate(t time.Time) string {
+	y, m, d := t.Date()
+	days := time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Sub(excelEpoch).Hours() / 24
+	return strconv.FormatFloat(days, 'f', 0, 64)
+}
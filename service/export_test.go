@@ -0,0 +1,250 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"tracker/models"
+	"tracker/money"
+)
+
+// exportSample is a split expense on an account with a value date
+func exportSample() models.Transaction {
+	accountID := uint(4)
+	valueDate := date(2026, time.March, 3)
+	tx := models.Transaction{
+		Type:      "expense",
+		Category:  "Shopping",
+		Amount:    money.MustParse("12.50"),
+		Currency:  "EUR",
+		AccountID: &accountID,
+		Note:      `Market "Hall" & co`,
+		Date:      date(2026, time.March, 1),
+		ValueDate: &valueDate,
+		Splits: []models.TransactionSplit{
+			{Category: "Groceries", Amount: money.MustParse("10")},
+			{Category: "Household", Amount: money.MustParse("2.50")},
+		},
+	}
+	tx.ID = 7
+	return tx
+}
+
+func TestExportFileType(t *testing.T) {
+	tests := map[string]string{
+		ExportCSV: "csv", ExportJSONL: "jsonl", ExportXLSX: "xlsx",
+		ExportLedger: "ledger", ExportHledger: "journal", ExportBeancount: "beancount",
+	}
+	for format, want := range tests {
+		if _, ext, err := ExportFileType(format); err != nil || ext != want {
+			t.Errorf("ExportFileType(%q) = %q, %v, want %q", format, ext, err, want)
+		}
+		if _, err := newTransactionWriter(format, io.Discard, JournalOptions{}); err != nil {
+			t.Errorf("newTransactionWriter(%q): %v", format, err)
+		}
+	}
+	if _, _, err := ExportFileType("pdf"); err != ErrUnknownExportFormat {
+		t.Errorf("err = %v, want %v", err, ErrUnknownExportFormat)
+	}
+	if _, err := newTransactionWriter("pdf", io.Discard, JournalOptions{}); err != ErrUnknownExportFormat {
+		t.Errorf("err = %v, want %v", err, ErrUnknownExportFormat)
+	}
+}
+
+func TestCSVExport(t *testing.T) {
+	var buf bytes.Buffer
+	w := newCSVWriter(&buf)
+	if err := w.Write(exportSample()); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || strings.Join(records[0], ",") != strings.Join(exportColumns, ",") {
+		t.Fatalf("records = %q, want the header and one row", records)
+	}
+	row := map[string]string{}
+	for i, column := range exportColumns {
+		row[column] = records[1][i]
+	}
+	want := map[string]string{
+		"id": "7", "date": "2026-03-01", "value_date": "2026-03-03", "type": "expense", "amount": "12.50",
+		"currency": "EUR", "account_id": "4", "note": `Market "Hall" & co`, "splits": "Groceries: 10.00; Household: 2.50",
+	}
+	for column, v := range want {
+		if row[column] != v {
+			t.Errorf("%s = %q, want %q", column, row[column], v)
+		}
+	}
+}
+
+func TestJSONLExport(t *testing.T) {
+	var buf bytes.Buffer
+	w := newJSONLWriter(&buf)
+	for i := 0; i < 2; i++ {
+		if err := w.Write(exportSample()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2", len(lines))
+	}
+	var tx models.Transaction
+	if err := json.Unmarshal([]byte(lines[0]), &tx); err != nil {
+		t.Fatal(err)
+	}
+	if tx.Amount != money.MustParse("12.50") || len(tx.Splits) != 2 || tx.Note != exportSample().Note {
+		t.Errorf("line decodes to %+v, want the exported transaction", tx)
+	}
+}
+
+func TestXLSXExport(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := newXLSXWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(exportSample()); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	z, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sheet string
+	for _, f := range z.File {
+		if f.Name == "xl/worksheets/sheet1.xml" {
+			rc, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, _ := io.ReadAll(rc)
+			rc.Close()
+			sheet = string(b)
+		}
+	}
+	for _, want := range []string{
+		`<c r="A1" t="inlineStr"><is><t xml:space="preserve">id</t></is></c>`,
+		`<c r="A2"><v>7</v></c>`,
+		`<c r="B2" s="1"><v>46082</v></c>`, // 2026-03-01 as a date serial
+		`<c r="F2" s="2"><v>12.50</v></c>`,
+		`Market &#34;Hall&#34; &amp; co`,
+	} {
+		if !strings.Contains(sheet, want) {
+			t.Errorf("sheet does not contain %s:\n%s", want, sheet)
+		}
+	}
+}
+
+func TestXLSXColumn(t *testing.T) {
+	tests := map[int]string{0: "A", 25: "Z", 26: "AA", 27: "AB", 701: "ZZ", 702: "AAA"}
+	for i, want := range tests {
+		if got := xlsxColumn(i); got != want {
+			t.Errorf("xlsxColumn(%d) = %q, want %q", i, got, want)
+		}
+	}
+}
+
+func TestSpreadsheetText(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"", ""},
+		{"Groceries", "Groceries"},
+		{"=HYPERLINK(\"http://evil\")", "'=HYPERLINK(\"http://evil\")"},
+		{"+1 555", "'+1 555"},
+		{"-2+3", "'-2+3"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\tcmd", "'\tcmd"},
+		{"\rcmd", "'\rcmd"},
+		{"a=b", "a=b"},
+	}
+	for _, tt := range tests {
+		if got := spreadsheetText(tt.in); got != tt.want {
+			t.Errorf("spreadsheetText(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCSVExportNeutralisesFormulas(t *testing.T) {
+	var buf bytes.Buffer
+	w := newCSVWriter(&buf)
+	tx := models.Transaction{
+		Type:     "expense",
+		Category: "=cmd",
+		Amount:   money.MustParse("-12.50"),
+		Currency: "EUR",
+		Note:     "@note",
+		Payee:    "+payee",
+		Tags:     []models.Tag{{Name: "-tag"}},
+		Date:     time.Date(2026, time.March, 1, 0, 0, 0, 0, time.UTC),
+	}
+	if err := w.Write(tx); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	row := map[string]string{}
+	for i, column := range exportColumns {
+		row[column] = records[1][i]
+	}
+	for column, want := range map[string]string{"category": "'=cmd", "note": "'@note", "payee": "'+payee", "tags": "'-tag", "amount": "-12.50"} {
+		if row[column] != want {
+			t.Errorf("%s = %q, want %q", column, row[column], want)
+		}
+	}
+}
+
+func TestLedgerPayeeAndTags(t *testing.T) {
+	checking := uint(1)
+	tx := models.Transaction{UserID: 1, Type: "expense", Category: "Groceries", Amount: money.MustParse("23.90"), Currency: "EUR",
+		Date: time.Date(2026, time.March, 2, 0, 0, 0, 0, time.UTC), AccountID: &checking,
+		Payee: "Acme Markt", Note: "weekly shop", Tags: []models.Tag{{Name: "Japan 2026"}, {Name: "food"}}}
+
+	tests := []struct {
+		dialect string
+		want    string
+	}{
+		{ExportLedger, "2026-03-02 * weekly shop\n    ; Payee: Acme Markt\n    ; :Japan-2026:food:\n"},
+		{ExportHledger, "2026-03-02 * Acme Markt | weekly shop\n    ; Japan-2026:, food:\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dialect, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := newJournalWriter(&buf, tt.dialect, JournalOptions{Accounts: journalAccounts})
+			if err := w.Write(tx); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(buf.String(), tt.want) {
+				t.Errorf("entry =\n%s\nwant it to start with\n%s", buf.String(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"tracker/models"
+	"tracker/repository"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// IdempotencyTTL is how long a stored response is replayed
+	IdempotencyTTL = 24 * time.Hour
+	// IdempotencyLease is how long a key stays reserved for a request that
+	// has not been answered yet. A running request keeps renewing it; one
+	// that crashed the server never releases its key, so a retry takes it
+	// over once the lease runs out.
+	IdempotencyLease = 5 * time.Minute
+	// IdempotencyRenewal is how often a running request renews its lease
+	IdempotencyRenewal = IdempotencyLease / 3
+)
+
+var (
+	ErrIdempotencyKeyReused   = errors.New("idempotency key was already used for a different request")
+	ErrIdempotencyKeyInFlight = errors.New("a request with this idempotency key is still being processed")
+)
+
+type IdempotencyService struct {
+	Repo repository.IdempotencyRepository
+}
+
+// Begin reserves the key for a request. It returns the stored response when
+// the same request was already answered, and nil when the caller should go
+// ahead and answer it, then call Complete or Release.
+func (s *IdempotencyService) Begin(userID uint, key, requestHash string) (*models.IdempotencyKey, error) {
+	now := time.Now()
+	reserved, err := s.Repo.ReserveKey(&models.IdempotencyKey{
+		UserID:      userID,
+		Key:         key,
+		RequestHash: requestHash,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(IdempotencyLease),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if reserved {
+		return nil, nil
+	}
+
+	stored, err := s.Repo.GetKey(userID, key)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// Released or purged in the meantime; the client may simply retry
+		return nil, ErrIdempotencyKeyInFlight
+	}
+	if err != nil {
+		return nil, err
+	}
+	if stored.RequestHash != requestHash {
+		return nil, ErrIdempotencyKeyReused
+	}
+	if stored.StatusCode == 0 {
+		return nil, ErrIdempotencyKeyInFlight
+	}
+	return stored, nil
+}
+
+// Hold keeps the key reserved while its request runs, so a retry of a slow
+// request gets 409 instead of running it a second time. It renews the lease
+// every IdempotencyRenewal until the returned function is called.
+func (s *IdempotencyService) Hold(userID uint, key string) (stop func()) {
+	return s.hold(userID, key, IdempotencyRenewal)
+}
+
+// hold is Hold renewing every interval
+func (s *IdempotencyService) hold(userID uint, key string, every time.Duration) func() {
+	stored, err := s.Repo.GetKey(userID, key)
+	if err != nil {
+		log.Printf("idempotency key %q: hold: %v", key, err)
+		return func() {}
+	}
+
+	done, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(every)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := s.Repo.RenewLease(stored.ID, time.Now().Add(IdempotencyLease)); err != nil {
+					log.Printf("idempotency key %q: renew lease: %v", key, err)
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			<-stopped
+		})
+	}
+}
+
+// Complete stores the response to replay for the key and keeps it for
+// IdempotencyTTL
+func (s *IdempotencyService) Complete(userID uint, key string, status int, contentType string, body []byte) error {
+	stored, err := s.Repo.GetKey(userID, key)
+	if err != nil {
+		return err
+	}
+	return s.Repo.SaveResponse(stored.ID, status, contentType, body, stored.CreatedAt.Add(IdempotencyTTL))
+}
+
+// Release frees the key without storing a response, so a retry runs again
+func (s *IdempotencyService) Release(userID uint, key string) error {
+	stored, err := s.Repo.GetKey(userID, key)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return s.Repo.DeleteKey(stored.ID)
+}
+
+// Run purges expired keys every interval until ctx is cancelled
+func (s *IdempotencyService) Run(ctx context.Context, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for {
+		if n, err := s.Repo.DeleteExpired(time.Now()); err != nil {
+			log.Printf("idempotency keys: %v", err)
+		} else if n > 0 {
+			log.Printf("idempotency keys: purged %d expired key(s)", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
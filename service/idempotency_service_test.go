@@ -0,0 +1,152 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"tracker/models"
+
+	"gorm.io/gorm"
+)
+
+// memIdempotencyRepo keeps keys in memory the way IdempotencyRepo keeps them
+// in the database
+type memIdempotencyRepo struct {
+	keys   map[string]*models.IdempotencyKey
+	nextID uint
+}
+
+func (m *memIdempotencyRepo) ReserveKey(key *models.IdempotencyKey) (bool, error) {
+	if k, ok := m.keys[key.Key]; ok {
+		if k.ExpiresAt.After(time.Now()) {
+			return false, nil
+		}
+	}
+	m.nextID++
+	key.ID = m.nextID
+	m.keys[key.Key] = key
+	return true, nil
+}
+
+func (m *memIdempotencyRepo) GetKey(userID uint, key string) (*models.IdempotencyKey, error) {
+	if k, ok := m.keys[key]; ok {
+		copied := *k
+		return &copied, nil
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (m *memIdempotencyRepo) SaveResponse(id uint, status int, contentType string, body []byte, expiresAt time.Time) error {
+	for _, k := range m.keys {
+		if k.ID == id {
+			k.StatusCode, k.ContentType, k.Body, k.ExpiresAt = status, contentType, body, expiresAt
+		}
+	}
+	return nil
+}
+
+func (m *memIdempotencyRepo) RenewLease(id uint, expiresAt time.Time) error {
+	for _, k := range m.keys {
+		if k.ID == id && k.StatusCode == 0 {
+			k.ExpiresAt = expiresAt
+		}
+	}
+	return nil
+}
+
+func (m *memIdempotencyRepo) DeleteKey(id uint) error {
+	for name, k := range m.keys {
+		if k.ID == id {
+			delete(m.keys, name)
+		}
+	}
+	return nil
+}
+
+func (m *memIdempotencyRepo) DeleteExpired(now time.Time) (int64, error) { return 0, nil }
+
+func TestIdempotencyBegin(t *testing.T) {
+	repo := &memIdempotencyRepo{keys: map[string]*models.IdempotencyKey{}}
+	s := &IdempotencyService{Repo: repo}
+
+	if stored, err := s.Begin(1, "k", "h1"); err != nil || stored != nil {
+		t.Fatalf("first Begin = %v, %v; want a fresh reservation", stored, err)
+	}
+	if _, err := s.Begin(1, "k", "h1"); !errors.Is(err, ErrIdempotencyKeyInFlight) {
+		t.Fatalf("retry while in flight: err = %v, want ErrIdempotencyKeyInFlight", err)
+	}
+	if _, err := s.Begin(1, "k", "h2"); !errors.Is(err, ErrIdempotencyKeyReused) {
+		t.Fatalf("other request: err = %v, want ErrIdempotencyKeyReused", err)
+	}
+
+	if err := s.Complete(1, "k", 201, "application/json", []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := s.Begin(1, "k", "h1")
+	if err != nil || stored == nil || stored.StatusCode != 201 || string(stored.Body) != `{}` {
+		t.Fatalf("replay = %+v, %v; want the stored 201", stored, err)
+	}
+	if ttl := time.Until(stored.ExpiresAt); ttl < IdempotencyTTL-time.Minute {
+		t.Errorf("completed key expires in %s, want about %s", ttl, IdempotencyTTL)
+	}
+}
+
+func TestIdempotencyLeaseExpires(t *testing.T) {
+	repo := &memIdempotencyRepo{keys: map[string]*models.IdempotencyKey{}}
+	s := &IdempotencyService{Repo: repo}
+
+	if _, err := s.Begin(1, "k", "h"); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := time.Until(repo.keys["k"].ExpiresAt); ttl > IdempotencyLease {
+		t.Fatalf("in-flight key reserved for %s, want at most %s", ttl, IdempotencyLease)
+	}
+
+	// The first request crashed without releasing the key
+	repo.keys["k"].ExpiresAt = time.Now().Add(-time.Second)
+	if stored, err := s.Begin(1, "k", "h"); err != nil || stored != nil {
+		t.Fatalf("Begin after the lease = %v, %v; want the retry to take over", stored, err)
+	}
+}
+
+func TestIdempotencyRelease(t *testing.T) {
+	repo := &memIdempotencyRepo{keys: map[string]*models.IdempotencyKey{}}
+	s := &IdempotencyService{Repo: repo}
+
+	if _, err := s.Begin(1, "k", "h"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Release(1, "k"); err != nil {
+		t.Fatal(err)
+	}
+	if stored, err := s.Begin(1, "k", "h"); err != nil || stored != nil {
+		t.Fatalf("Begin after Release = %v, %v; want the retry to run again", stored, err)
+	}
+	if err := s.Release(1, "unknown"); err != nil {
+		t.Errorf("releasing an unknown key: %v", err)
+	}
+}
+
+func TestIdempotencyHoldRenewsLease(t *testing.T) {
+	repo := &memIdempotencyRepo{keys: map[string]*models.IdempotencyKey{}}
+	s := &IdempotencyService{Repo: repo}
+
+	if _, err := s.Begin(1, "k", "h"); err != nil {
+		t.Fatal(err)
+	}
+	// The lease of a slow request would have run out by now
+	repo.keys["k"].ExpiresAt = time.Now().Add(time.Millisecond)
+
+	stop := s.hold(1, "k", 5*time.Millisecond)
+	time.Sleep(30 * time.Millisecond)
+	stop()
+	stop()
+
+	if ttl := time.Until(repo.keys["k"].ExpiresAt); ttl < IdempotencyLease-time.Minute {
+		t.Fatalf("held key expires in %s, want about %s", ttl, IdempotencyLease)
+	}
+	if _, err := s.Begin(1, "k", "h"); !errors.Is(err, ErrIdempotencyKeyInFlight) {
+		t.Errorf("retry of a held request: err = %v, want ErrIdempotencyKeyInFlight", err)
+	}
+}
@@ -0,0 +1,538 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"strings"
+
+	"tracker/models"
+	"tracker/repository"
+)
+
+var (
+	ErrImportProfileNotFound = errors.New("import profile not found")
+	ErrImportHasErrors       = errors.New("some rows cannot be imported, nothing was saved")
+	ErrUnknownImportFormat   = errors.New("format must be ofx, qif, camt053 or mt940")
+)
+
+// Statement formats ImportStatement understands besides profile based CSV
+const (
+	FormatOFX     = "ofx"
+	FormatQIF     = "qif"
+	FormatCamt053 = "camt053"
+	FormatMT940   = "mt940"
+)
+
+// DefaultImportCategory is booked for entries whose file carries no category
+const DefaultImportCategory = "Uncategorized"
+
+// ImportOptions apply to every entry of a statement file
+type ImportOptions struct {
+	AccountID *uint  // account the statement belongs to
+	Category  string // category of entries without one, DefaultImportCategory when empty
+	DateOrder string // QIF only: mdy (default), dmy or ymd
+}
+
+type ImportService struct {
+	Repo         repository.ImportProfileRepository
+	Transactions *TransactionService
+}
+
+// CreateProfile saves a new column mapping profile
+func (s *ImportService) CreateProfile(profile *models.ImportProfile) error {
+	if err := ValidateImportProfile(profile); err != nil {
+		return err
+	}
+	if err := s.Transactions.checkAccount(profile.AccountID, profile.UserID); err != nil {
+		return err
+	}
+	return s.Repo.CreateProfile(profile)
+}
+
+// GetProfilesByUserID fetches the import profiles of a user
+func (s *ImportService) GetProfilesByUserID(userID uint) ([]models.ImportProfile, error) {
+	return s.Repo.GetProfilesByUserID(userID)
+}
+
+// GetProfileByID fetches an import profile owned by the user
+func (s *ImportService) GetProfileByID(id uint, userID uint) (*models.ImportProfile, error) {
+	if !s.Repo.CheckProfileExistsForUser(id, userID) {
+		return nil, ErrImportProfileNotFound
+	}
+	return s.Repo.GetProfileByID(id)
+}
+
+// UpdateProfile updates an import profile owned by the user
+func (s *ImportService) UpdateProfile(profile *models.ImportProfile) error {
+	if err := ValidateImportProfile(profile); err != nil {
+		return err
+	}
+	existing, err := s.GetProfileByID(profile.ID, profile.UserID)
+	if err != nil {
+		return err
+	}
+	if !sameAccount(existing.AccountID, profile.AccountID) {
+		if err := s.Transactions.checkAccount(profile.AccountID, profile.UserID); err != nil {
+			return err
+		}
+	}
+	profile.CreatedAt = existing.CreatedAt
+	return s.Repo.UpdateProfile(profile)
+}
+
+// DeleteProfile deletes an import profile owned by the user
+func (s *ImportService) DeleteProfile(id uint, userID uint) error {
+	if !s.Repo.CheckProfileExistsForUser(id, userID) {
+		return ErrImportProfileNotFound
+	}
+
+	log.Printf("Import profile with ID %d found for user %d, proceeding to delete", id, userID)
+	return s.Repo.DeleteProfile(id)
+}
+
+// ImportCSV parses a CSV statement with one of the user's profiles. With dryRun
+// it only reports what would be imported; otherwise every row is saved in one
+// DB transaction, or none when any row has errors.
+func (s *ImportService) ImportCSV(userID uint, profileID uint, r io.Reader, dryRun bool) (*models.ImportResult, error) {
+	profile, err := s.GetProfileByID(profileID, userID)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := ParseCSV(r, *profile)
+	if err != nil {
+		return nil, err
+	}
+	return s.importRows(userID, rows, profile.DefaultCategory, dryRun)
+}
+
+// ImportStatement imports an OFX, QFX, QIF, camt.053 or MT940 file; an empty
+// format is detected from the content. It works like ImportCSV but skips
+// entries whose bank ID was imported on the same account before. Formats with
+// balances report them per statement next to the account's own balance.
+func (s *ImportService) ImportStatement(userID uint, format string, r io.Reader, opts ImportOptions, dryRun bool) (*models.ImportResult, error) {
+	if err := s.Transactions.checkAccount(opts.AccountID, userID); err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(r)
+	if format == "" {
+		format = DetectFormat(br)
+	}
+
+	var rows []models.ImportRow
+	var statements []models.StatementBalance
+	var err error
+	switch strings.ToLower(format) {
+	case FormatOFX, "qfx":
+		rows, err = ParseOFX(br)
+	case FormatQIF:
+		rows, err = ParseQIF(br, opts.DateOrder)
+	case FormatCamt053, "camt.053":
+		rows, statements, err = ParseCamt053(br)
+	case FormatMT940:
+		rows, statements, err = ParseMT940(br)
+	default:
+		return nil, ErrUnknownImportFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	category := strings.TrimSpace(opts.Category)
+	if category == "" {
+		category = DefaultImportCategory
+	}
+	for i := range rows {
+		rows[i].Transaction.AccountID = opts.AccountID
+	}
+
+	result, err := s.importRows(userID, rows, category, dryRun)
+	if result != nil {
+		result.Statements = statements
+	}
+	if err != nil || len(statements) == 0 || opts.AccountID == nil || s.Transactions.Accounts == nil {
+		return result, err
+	}
+
+	balance, err := s.Transactions.Accounts.GetAccountBalance(*opts.AccountID, userID)
+	if err != nil {
+		// The import itself went through; reconciliation is best effort
+		log.Printf("import: balance of account %d: %v", *opts.AccountID, err)
+		return result, nil
+	}
+	result.AccountBalance, result.AccountCurrency = &balance.Balance, balance.Currency
+	return result, nil
+}
+
+// ImportBeancount imports the transactions and budgets of a beancount
+// journal, such as one exported from here. Accounts are matched by their
+// journal names, so entries keep their accounts and transfers come back as
+// linked legs.
+func (s *ImportService) ImportBeancount(userID uint, r io.Reader, dryRun bool) (*models.ImportResult, error) {
+	var accounts []models.Account
+	if s.Transactions.Accounts != nil {
+		var err error
+		if accounts, err = s.Transactions.Accounts.GetAccountsByUserID(userID, true); err != nil {
+			return nil, err
+		}
+	}
+	rows, budgets, err := ParseBeancount(r, accounts)
+	if err != nil {
+		return nil, err
+	}
+	result, err := s.importRows(userID, rows, "", dryRun)
+	if err != nil {
+		return nil, err
+	}
+	if result.Budgets, err = s.importBudgets(userID, budgets, dryRun); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// importBudgets adds the budgets of a journal that the user does not have
+// yet, matched on category and period, and returns them
+func (s *ImportService) importBudgets(userID uint, budgets []models.Budget, dryRun bool) ([]models.Budget, error) {
+	b := s.Transactions.Budgets
+	if b == nil || len(budgets) == 0 {
+		return nil, nil
+	}
+	existing, err := b.GetBudgetsByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	have := map[string]bool{}
+	for _, e := range existing {
+		have[strings.ToLower(e.Category)+"|"+e.Period] = true
+	}
+
+	var added []models.Budget
+	for _, budget := range budgets {
+		key := strings.ToLower(budget.Category) + "|" + budget.Period
+		if have[key] {
+			continue
+		}
+		have[key] = true
+		budget.UserID = userID
+		if !dryRun {
+			if err := b.CreateBudget(&budget); err != nil {
+				return nil, err
+			}
+		}
+		added = append(added, budget)
+	}
+	return added, nil
+}
+
+// DetectFormat guesses the format of a statement from its first bytes
+// without consuming them; it returns an empty string when unsure
+func DetectFormat(br *bufio.Reader) string {
+	head, _ := br.Peek(1024)
+	text := strings.ToUpper(string(bytes.TrimPrefix(head, []byte{0xEF, 0xBB, 0xBF})))
+	switch {
+	case strings.HasPrefix(text, "OFXHEADER") || strings.Contains(text, "<OFX>") || strings.Contains(text, "<?OFX"):
+		return FormatOFX
+	case strings.HasPrefix(text, "!TYPE:") || strings.HasPrefix(text, "!ACCOUNT") || strings.HasPrefix(text, "!OPTION"):
+		return FormatQIF
+	case strings.Contains(text, "CAMT.053") || strings.Contains(text, "<BKTOCSTMRSTMT"):
+		return FormatCamt053
+	case strings.HasPrefix(text, ":20:") || strings.HasPrefix(text, "{1:") || strings.Contains(text, "\n:20:") && strings.Contains(text, ":60F:"):
+		return FormatMT940
+	}
+	return ""
+}
+
+// importRows validates parsed rows like CreateTransaction would and, unless
+// dryRun is set, saves them all at once. Entries imported before are skipped.
+// The user's rules categorize entries the file left without a category, and
+// those no rule matches get the fallback category.
+func (s *ImportService) importRows(userID uint, rows []models.ImportRow, fallbackCategory string, dryRun bool) (*models.ImportResult, error) {
+	result := &models.ImportResult{DryRun: dryRun, Total: len(rows), Rows: rows}
+	for i := range rows {
+		rows[i].Transaction.UserID = userID
+		rows[i].Transaction.RecurringID = nil
+		if c := rows[i].Counterpart; c != nil {
+			c.UserID = userID
+			c.RecurringID = nil
+		}
+	}
+	if err := s.markDuplicates(userID, rows); err != nil {
+		return nil, err
+	}
+	s.categorize(rows, fallbackCategory, dryRun)
+
+	// A statement usually books everything on one account, so look each one up once
+	accounts := map[uint]error{}
+	currencies := map[uint]string{}
+	for i := range rows {
+		row := &rows[i]
+		switch {
+		case row.Duplicate:
+			result.Skipped++
+			continue
+		case len(row.Errors) == 0 && row.Counterpart != nil:
+			row.Errors = s.prepareTransfer(&row.Transaction, row.Counterpart)
+		case len(row.Errors) == 0:
+			row.Errors = s.prepareRow(&row.Transaction, accounts, currencies)
+		}
+
+		if len(row.Errors) == 0 {
+			result.Valid++
+		} else {
+			result.Invalid++
+		}
+	}
+
+	if dryRun {
+		s.previewDuplicates(rows)
+		return result, nil
+	}
+	if result.Invalid > 0 {
+		return result, ErrImportHasErrors
+	}
+
+	// Transfers are booked as two legs: money leaves the first and arrives at the second
+	var transactions []models.Transaction
+	var transfers [][2]int
+	positions := map[int]int{}
+	for i, row := range rows {
+		if row.Duplicate {
+			continue
+		}
+		positions[i] = len(transactions)
+		if row.Counterpart == nil {
+			transactions = append(transactions, row.Transaction)
+			continue
+		}
+		out, in := row.Transaction, *row.Counterpart
+		out.Amount = -out.Amount
+		transfers = append(transfers, [2]int{len(transactions), len(transactions) + 1})
+		transactions = append(transactions, out, in)
+	}
+	linked := make([]*models.Transaction, len(transactions))
+	for i := range transactions {
+		linked[i] = &transactions[i]
+	}
+	if err := s.Transactions.assignCategories(true, true, linked...); err != nil {
+		return nil, err
+	}
+	if err := s.Transactions.assignTags(true, linked...); err != nil {
+		return nil, err
+	}
+	if err := s.Transactions.Repo.CreateTransactions(transactions, transfers); err != nil {
+		return nil, err
+	}
+	for i, pos := range positions {
+		rows[i].Transaction = transactions[pos]
+		if rows[i].Counterpart != nil {
+			rows[i].Counterpart = &transactions[pos+1]
+		}
+		// Another import booked the entry since it was checked above
+		if transactions[pos].ID == 0 {
+			rows[i].Duplicate = true
+			result.Valid--
+			result.Skipped++
+		}
+	}
+
+	var created []models.Transaction
+	for _, tx := range transactions {
+		if tx.ID != 0 {
+			created = append(created, tx)
+		}
+	}
+	result.Imported = len(created)
+
+	imported := make([]*models.Transaction, 0, len(positions))
+	for i := range rows {
+		if !rows[i].Duplicate {
+			imported = append(imported, &rows[i].Transaction)
+		}
+	}
+	s.Transactions.flagDuplicates(imported...)
+	s.Transactions.learn(created...)
+
+	s.checkAlerts(created)
+	return result, nil
+}
+
+// markDuplicates flags rows whose external ID was already imported on the
+// same account, or appears earlier in the same file
+func (s *ImportService) markDuplicates(userID uint, rows []models.ImportRow) error {
+	type key struct {
+		account    uint
+		externalID string
+	}
+	byAccount := map[uint][]string{}
+	accountIDs := map[uint]*uint{}
+	seen := map[key]bool{}
+	for i := range rows {
+		tx := &rows[i].Transaction
+		if tx.ExternalID == "" {
+			continue
+		}
+		var account uint
+		if tx.AccountID != nil {
+			account = *tx.AccountID
+		}
+		k := key{account, tx.ExternalID}
+		if seen[k] {
+			rows[i].Duplicate = true
+			continue
+		}
+		seen[k] = true
+		byAccount[account] = append(byAccount[account], tx.ExternalID)
+		accountIDs[account] = tx.AccountID
+	}
+
+	for account, ids := range byAccount {
+		imported, err := s.Transactions.Repo.GetImportedIDs(userID, accountIDs[account], ids)
+		if err != nil {
+			return err
+		}
+		for i := range rows {
+			tx := rows[i].Transaction
+			if tx.ExternalID != "" && imported[tx.ExternalID] && sameAccount(tx.AccountID, accountIDs[account]) {
+				rows[i].Duplicate = true
+			}
+		}
+	}
+	return nil
+}
+
+// prepareRow fills in the currency of an imported transaction and returns
+// everything that keeps it from being booked
+func (s *ImportService) prepareRow(tx *models.Transaction, accounts map[uint]error, currencies map[uint]string) []string {
+	var errs []string
+	if err := validateTransactionType(tx.Type); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if tx.Amount <= 0 {
+		errs = append(errs, "amount must not be zero")
+	}
+	if strings.TrimSpace(tx.Category) == "" {
+		errs = append(errs, "category is empty and no default category was given")
+	}
+	if err := validateSplits(tx); err != nil {
+		errs = append(errs, err.Error())
+	}
+	// A dry run must not create categories, so only existing ones are linked yet
+	if err := s.Transactions.assignCategories(false, true, tx); err != nil {
+		errs = append(errs, err.Error())
+	}
+
+	// Key 0 stands for transactions without an account
+	var key uint
+	if tx.AccountID != nil {
+		key = *tx.AccountID
+	}
+	err, seen := accounts[key]
+	if !seen {
+		err = s.Transactions.checkAccount(tx.AccountID, tx.UserID)
+		if err == nil {
+			currency := ""
+			err = s.Transactions.Accounts.resolveCurrency(&currency, tx.AccountID, tx.UserID)
+			currencies[key] = currency
+		}
+		accounts[key] = err
+	}
+	if err != nil {
+		return append(errs, err.Error())
+	}
+
+	// Amounts without a currency were read with two decimals
+	if tx.Currency == "" {
+		tx.Currency = currencies[key]
+		if err := rescaleAmounts(tx.Currency, transactionAmounts(tx)...); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	tx.Currency = strings.ToUpper(tx.Currency)
+	if !isCurrencyCode(tx.Currency) {
+		errs = append(errs, ErrInvalidCurrency.Error())
+	}
+	return errs
+}
+
+// categorize recognizes the payees of the new entries other than transfers
+// and runs the user's rules over them, then books those still without a
+// category on the fallback. Payees a journal names are created unless it is
+// a dry run.
+func (s *ImportService) categorize(rows []models.ImportRow, fallbackCategory string, dryRun bool) {
+	var entries []*models.Transaction
+	for i := range rows {
+		if !rows[i].Duplicate && rows[i].Counterpart == nil {
+			entries = append(entries, &rows[i].Transaction)
+		}
+	}
+	// Statements name no payees, so they are only recognized from the notes;
+	// that happens first so rules can match on them
+	if err := s.Transactions.assignPayees(!dryRun, entries...); err != nil {
+		log.Printf("payees: match imported entries of user %d: %v", entries[0].UserID, err)
+	}
+	s.Transactions.categorize(entries...)
+
+	for _, tx := range entries {
+		if strings.TrimSpace(tx.Category) == "" {
+			tx.Category = fallbackCategory
+		}
+	}
+}
+
+// previewDuplicates flags the valid rows of a dry run that look like
+// transactions already saved, without recording anything
+func (s *ImportService) previewDuplicates(rows []models.ImportRow) {
+	if s.Transactions.Duplicates == nil {
+		return
+	}
+	var valid []*models.Transaction
+	for i := range rows {
+		if !rows[i].Duplicate && len(rows[i].Errors) == 0 {
+			valid = append(valid, &rows[i].Transaction)
+		}
+	}
+	if len(valid) == 0 {
+		return
+	}
+	if err := s.Transactions.Duplicates.Flag(valid, false); err != nil {
+		log.Printf("import: look for duplicates: %v", err)
+	}
+}
+
+// prepareTransfer fills in the currencies of both legs of an imported
+// transfer and returns everything that keeps it from being booked
+func (s *ImportService) prepareTransfer(out, in *models.Transaction) []string {
+	var errs []string
+	if out.Amount <= 0 || in.Amount <= 0 {
+		errs = append(errs, ErrTransferAmount.Error())
+	}
+	if err := s.Transactions.checkTransferAccounts(out.AccountID, in.AccountID, out.UserID); err != nil {
+		return append(errs, err.Error())
+	}
+	for _, leg := range []*models.Transaction{out, in} {
+		if err := s.Transactions.Accounts.resolveCurrency(&leg.Currency, leg.AccountID, leg.UserID, &leg.Amount); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	return errs
+}
+
+// checkAlerts evaluates budgets once per category touched by an import rather
+// than once per row; the latest expense of each category stands in for all
+func (s *ImportService) checkAlerts(transactions []models.Transaction) {
+	latest := map[string]int{}
+	for i, tx := range transactions {
+		if tx.Type != "expense" {
+			continue
+		}
+		if j, ok := latest[tx.Category]; !ok || tx.Date.After(transactions[j].Date) {
+			latest[tx.Category] = i
+		}
+	}
+	for _, i := range latest {
+		s.Transactions.checkAlerts(&transactions[i])
+	}
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"tracker/models"
+	"tracker/money"
+	"tracker/repository"
+)
+
+// racingImportRepo books a batch like the real repository does when another
+// import already booked some of its external IDs after they were checked
+type racingImportRepo struct {
+	repository.TransactionRepository
+	bookedMeanwhile map[string]bool
+	nextID          uint
+}
+
+func (r *racingImportRepo) GetImportedIDs(userID uint, accountID *uint, ids []string) (map[string]bool, error) {
+	return map[string]bool{}, nil
+}
+
+func (r *racingImportRepo) CreateTransactions(transactions []models.Transaction, transfers [][2]int) error {
+	for i := range transactions {
+		if r.bookedMeanwhile[transactions[i].ExternalID] {
+			continue
+		}
+		r.nextID++
+		transactions[i].ID = r.nextID
+	}
+	return nil
+}
+
+func TestImportSkipsEntriesBookedMeanwhile(t *testing.T) {
+	repo := &racingImportRepo{bookedMeanwhile: map[string]bool{"B2": true}}
+	s := &ImportService{Transactions: &TransactionService{Repo: repo}}
+
+	var rows []models.ImportRow
+	for i, id := range []string{"B1", "B2", "B3"} {
+		rows = append(rows, models.ImportRow{Line: i + 1, Transaction: models.Transaction{
+			Type: "expense", Category: "Groceries", Amount: money.MustParse("9.99"), Currency: "EUR",
+			ExternalID: id, Date: time.Date(2026, time.March, i+1, 0, 0, 0, 0, time.UTC),
+		}})
+	}
+
+	result, err := s.importRows(1, rows, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Imported != 2 || result.Skipped != 1 || result.Valid != 2 {
+		t.Errorf("imported %d, skipped %d, valid %d; want 2, 1, 2", result.Imported, result.Skipped, result.Valid)
+	}
+	if !result.Rows[1].Duplicate || result.Rows[0].Duplicate || result.Rows[2].Duplicate {
+		t.Errorf("only the entry booked meanwhile should be reported as a duplicate")
+	}
+}
@@ -0,0 +1,493 @@
+package service
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"tracker/models"
+	"tracker/money"
+)
+
+// Plain-text accounting journal formats
+const (
+	ExportLedger    = "ledger"
+	ExportHledger   = "hledger"
+	ExportBeancount = "beancount"
+)
+
+// Journal accounts that do not come from the user's own accounts
+const (
+	JournalUnassigned = "Assets:Unassigned" // transactions booked on no account
+	JournalTransfers  = "Equity:Transfers"  // the other side of a transfer leg exported alone
+	JournalBudgetPool = "Assets"            // what periodic budget entries are balanced against
+)
+
+// JournalOptions holds what a journal needs besides the transactions
+type JournalOptions struct {
+	Accounts     []models.Account
+	Budgets      []models.Budget
+	BaseCurrency string
+	// optional, finds the other leg of a transfer that is not in the export
+	LinkedLeg func(id uint) (*models.Transaction, error)
+}
+
+// isJournalFormat reports whether an export format is a plain-text journal
+func isJournalFormat(format string) bool {
+	return format == ExportLedger || format == ExportHledger || format == ExportBeancount
+}
+
+// journalWriter renders transactions as double-entry journal entries: the
+// category side goes to Expenses: or Income:, the money side to the account.
+// Both legs of a transfer become one entry; as they share a date and the
+// export is in date order, a leg only waits until the other one shows up.
+// A leg whose other leg is filtered out is completed from LinkedLeg.
+// Metadata carries what account names cannot, so a beancount journal can be
+// imported back unchanged.
+type journalWriter struct {
+	w        *bufio.Writer
+	dialect  string
+	accounts map[uint]string             // account ID to journal account name
+	opened   map[string]time.Time        // beancount: first use of every account
+	pending  map[uint]models.Transaction // transfer legs waiting for the other leg, by ID
+	linked   func(id uint) (*models.Transaction, error)
+}
+
+// journalPosting is one line of an entry, with metadata shown under it
+type journalPosting struct {
+	account string
+	amount  string
+	meta    [][2]string
+}
+
+func newJournalWriter(w io.Writer, dialect string, opts JournalOptions) *journalWriter {
+	j := &journalWriter{
+		w:        bufio.NewWriter(w),
+		dialect:  dialect,
+		accounts: JournalAccountNames(opts.Accounts, dialect),
+		opened:   map[string]time.Time{},
+		pending:  map[uint]models.Transaction{},
+		linked:   opts.LinkedLeg,
+	}
+	if dialect == ExportBeancount && opts.BaseCurrency != "" {
+		fmt.Fprintf(j.w, "option \"operating_currency\" %s\n\n", beancountString(opts.BaseCurrency))
+	}
+	j.writeBudgets(opts.Budgets)
+	return j
+}
+
+func (j *journalWriter) Write(tx models.Transaction) error {
+	// A leg from an earlier date has no other leg in this export
+	j.flushPending(func(leg models.Transaction) bool { return !leg.Date.Equal(tx.Date) })
+
+	if tx.Type != TypeTransfer {
+		j.writeEntry(tx)
+		return nil
+	}
+	if tx.LinkedID != nil {
+		if other, ok := j.pending[*tx.LinkedID]; ok {
+			delete(j.pending, other.ID)
+			j.writeTransfer(tx, other)
+			return nil
+		}
+		j.pending[tx.ID] = tx
+		return nil
+	}
+	j.writeLeg(tx)
+	return nil
+}
+
+func (j *journalWriter) Close() error {
+	j.flushPending(func(models.Transaction) bool { return true })
+
+	// Beancount wants every account opened on or before its first use; the
+	// order of directives does not matter to it, so they can come last
+	if j.dialect == ExportBeancount && len(j.opened) > 0 {
+		names := make([]string, 0, len(j.opened))
+		for name := range j.opened {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(j.w, "%s open %s\n", j.opened[name].Format("2006-01-02"), name)
+		}
+	}
+	return j.w.Flush()
+}
+
+// flushPending writes the waiting transfer legs that match, in ID order,
+// together with their other leg when it can still be found
+func (j *journalWriter) flushPending(match func(models.Transaction) bool) {
+	var ids []uint
+	for id, leg := range j.pending {
+		if match(leg) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(a, b int) bool { return ids[a] < ids[b] })
+	for _, id := range ids {
+		leg := j.pending[id]
+		delete(j.pending, id)
+		if other := j.otherLeg(leg); other != nil {
+			j.writeTransfer(leg, *other)
+		} else {
+			j.writeLeg(leg)
+		}
+	}
+}
+
+// otherLeg looks up the other leg of a transfer outside the export
+func (j *journalWriter) otherLeg(leg models.Transaction) *models.Transaction {
+	if j.linked == nil || leg.LinkedID == nil {
+		return nil
+	}
+	other, err := j.linked(*leg.LinkedID)
+	if err != nil || other.Type != TypeTransfer || other.UserID != leg.UserID {
+		return nil
+	}
+	return other
+}
+
+// writeEntry renders an income or expense with one category posting per split
+func (j *journalWriter) writeEntry(tx models.Transaction) {
+	// Expenses are debited and income credited; the account takes the other side
+	signed := func(a money.Amount) money.Amount {
+		if tx.Type == "income" {
+			return -a
+		}
+		return a
+	}
+
+	var postings []journalPosting
+	var meta [][2]string
+	if len(tx.Splits) > 0 {
+		for _, s := range tx.Splits {
+			postings = append(postings, j.categoryPosting(tx.Type, s.Category, signed(s.Amount), tx.Currency, s.Note))
+		}
+		meta = append(meta, [2]string{"category", tx.Category})
+	} else {
+		postings = append(postings, j.categoryPosting(tx.Type, tx.Category, signed(tx.Amount), tx.Currency, ""))
+	}
+	postings = append(postings, journalPosting{
+		account: j.accountName(tx.AccountID),
+		amount:  journalAmount(-signed(tx.Amount), tx.Currency),
+	})
+	j.writeTransaction(tx, meta, postings)
+}
+
+// writeTransfer renders both legs of a transfer as one entry, with the price
+// of what was sent in what was received when the currencies differ
+func (j *journalWriter) writeTransfer(a, b models.Transaction) {
+	out, in := a, b
+	if a.Amount > 0 {
+		out, in = b, a
+	}
+
+	sent := journalAmount(out.Amount, out.Currency)
+	if out.Currency != in.Currency {
+		sent += " @@ " + journalAmount(in.Amount, in.Currency)
+	}
+	j.writeTransaction(out, transferMeta(out), []journalPosting{
+		{account: j.accountName(in.AccountID), amount: journalAmount(in.Amount, in.Currency)},
+		{account: j.accountName(out.AccountID), amount: sent},
+	})
+}
+
+// writeLeg renders one leg of a transfer whose other leg is gone
+func (j *journalWriter) writeLeg(leg models.Transaction) {
+	j.writeTransaction(leg, transferMeta(leg), []journalPosting{
+		{account: j.accountName(leg.AccountID), amount: journalAmount(leg.Amount, leg.Currency)},
+		{account: JournalTransfers, amount: journalAmount(-leg.Amount, leg.Currency)},
+	})
+}
+
+// transferMeta keeps a transfer's category when it is not the default one
+func transferMeta(tx models.Transaction) [][2]string {
+	if tx.Category == "" || tx.Category == "Transfer" {
+		return nil
+	}
+	return [][2]string{{"category", tx.Category}}
+}
+
+// categoryPosting books an amount on the Expenses: or Income: account of a
+// category; the exact name goes into metadata when the account name loses it
+func (j *journalWriter) categoryPosting(txType, category string, amount money.Amount, currency, note string) journalPosting {
+	p := journalPosting{account: CategoryAccount(txType, category, j.dialect), amount: journalAmount(amount, currency)}
+	if AccountCategory(p.account) != category {
+		p.meta = append(p.meta, [2]string{"category", category})
+	}
+	if note != "" {
+		p.meta = append(p.meta, [2]string{"note", note})
+	}
+	return p
+}
+
+// writeTransaction writes the header, metadata and postings of one entry.
+// Beancount takes the payee as the first string of the header and tags as
+// #tag after it; ledger reads the payee from Payee metadata and hledger from
+// the description before " | ". Ledger writes tags as a :tag: comment and
+// hledger as tag: comments.
+func (j *journalWriter) writeTransaction(tx models.Transaction, meta [][2]string, postings []journalPosting) {
+	date := tx.Date.Format("2006-01-02")
+	note := strings.Join(strings.Fields(tx.Note), " ")
+	payee := strings.Join(strings.Fields(tx.Payee), " ")
+	var tags []string
+	exact := true
+	for _, tag := range tx.Tags {
+		name := journalTag(tag.Name, j.dialect)
+		if name != "" {
+			tags = append(tags, name)
+		}
+		exact = exact && name == tag.Name
+	}
+
+	switch j.dialect {
+	case ExportBeancount:
+		header := beancountString(note)
+		if payee != "" {
+			header = beancountString(payee) + " " + header
+		}
+		for _, tag := range tags {
+			header += " #" + tag
+		}
+		fmt.Fprintf(j.w, "%s * %s\n", date, header)
+		// Tag names a #tag cannot hold exactly come back from metadata
+		if !exact {
+			meta = append(meta, [2]string{"tags", strings.Join(tagNames(tx.Tags), ", ")})
+		}
+	case ExportHledger:
+		if note == "" {
+			note = tx.Category
+		}
+		if payee != "" {
+			note = payee + " | " + note
+		}
+		fmt.Fprintf(j.w, "%s * %s\n", date, note)
+	default:
+		if note == "" {
+			note = tx.Category
+		}
+		fmt.Fprintf(j.w, "%s * %s\n", date, note)
+		if payee != "" {
+			meta = append(meta, [2]string{"Payee", payee})
+		}
+	}
+
+	if tx.ExternalID != "" {
+		meta = append([][2]string{{"external_id", tx.ExternalID}}, meta...)
+	}
+	if tx.ValueDate != nil {
+		meta = append(meta, [2]string{"value_date", tx.ValueDate.Format("2006-01-02")})
+	}
+	j.writeMeta("    ", meta)
+	if len(tags) > 0 {
+		switch j.dialect {
+		case ExportLedger:
+			fmt.Fprintf(j.w, "    ; :%s:\n", strings.Join(tags, ":"))
+		case ExportHledger:
+			fmt.Fprintf(j.w, "    ; %s:\n", strings.Join(tags, ":, "))
+		}
+	}
+
+	for _, p := range postings {
+		fmt.Fprintf(j.w, "    %-40s  %s\n", p.account, p.amount)
+		j.writeMeta("      ", p.meta)
+		j.open(p.account, tx.Date)
+	}
+	j.w.WriteString("\n")
+}
+
+// writeMeta writes key: value lines, as beancount metadata or ledger comments
+func (j *journalWriter) writeMeta(indent string, meta [][2]string) {
+	for _, kv := range meta {
+		value := strings.Join(strings.Fields(kv[1]), " ")
+		if j.dialect == ExportBeancount {
+			if kv[0] != "value_date" {
+				value = beancountString(value)
+			}
+			fmt.Fprintf(j.w, "%s%s: %s\n", indent, kv[0], value)
+		} else {
+			fmt.Fprintf(j.w, "%s; %s: %s\n", indent, kv[0], value)
+		}
+	}
+}
+
+// writeBudgets renders budgets as periodic entries (ledger, hledger) or fava
+// budget directives (beancount). Custom periods have no equivalent in these
+// tools and are left as a comment.
+func (j *journalWriter) writeBudgets(budgets []models.Budget) {
+	for _, b := range budgets {
+		account := CategoryAccount("expense", b.Category, j.dialect)
+		amount := journalAmount(b.Amount, b.Currency)
+
+		switch {
+		case b.Period == BudgetCustom:
+			fmt.Fprintf(j.w, "; budget %s %s from %s to %s\n\n", account, amount, journalDay(b.StartDate), journalDay(b.EndDate))
+		case j.dialect == ExportBeancount:
+			start := b.CreatedAt
+			if b.StartDate != nil {
+				start = *b.StartDate
+			}
+			fmt.Fprintf(j.w, "%s custom \"budget\" %s %s %s\n", start.Format("2006-01-02"), account, beancountString(b.Period), amount)
+			if AccountCategory(account) != b.Category {
+				j.writeMeta("    ", [][2]string{{"category", b.Category}})
+			}
+			j.w.WriteString("\n")
+			j.open(account, start)
+		default:
+			period := b.Period
+			if j.dialect == ExportLedger {
+				period = strings.ToUpper(period[:1]) + period[1:]
+			}
+			fmt.Fprintf(j.w, "~ %s\n    %-40s  %s\n    %s\n\n", period, account, amount, JournalBudgetPool)
+		}
+	}
+}
+
+// open records the first date an account is used on
+func (j *journalWriter) open(account string, date time.Time) {
+	if j.dialect != ExportBeancount {
+		return
+	}
+	day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+	if first, ok := j.opened[account]; !ok || day.Before(first) {
+		j.opened[account] = day
+	}
+}
+
+// accountName returns the journal account of a transaction's account
+func (j *journalWriter) accountName(id *uint) string {
+	if id == nil {
+		return JournalUnassigned
+	}
+	if name, ok := j.accounts[*id]; ok {
+		return name
+	}
+	return JournalUnassigned
+}
+
+// JournalAccountNames names the user's accounts for a journal: credit cards
+// and loans under Liabilities:, everything else under Assets:. Names that
+// clash once cleaned up get the account ID appended.
+func JournalAccountNames(accounts []models.Account, dialect string) map[uint]string {
+	names := map[uint]string{}
+	count := map[string]int{}
+	for _, a := range accounts {
+		root := "Assets"
+		if a.Type == "credit" || a.Type == "loan" {
+			root = "Liabilities"
+		}
+		names[a.ID] = root + ":" + journalComponent(a.Name, dialect)
+		count[names[a.ID]]++
+	}
+	for id, name := range names {
+		if count[name] > 1 {
+			names[id] = name + "-" + strconv.FormatUint(uint64(id), 10)
+		}
+	}
+	return names
+}
+
+// CategoryAccount maps a category onto the Expenses: or Income: tree; the
+// " / " of nested categories and any ":" become levels of the tree
+func CategoryAccount(txType, category, dialect string) string {
+	root := "Expenses"
+	if txType == "income" {
+		root = "Income"
+	}
+	parts := strings.FieldsFunc(strings.ReplaceAll(category, " / ", ":"), func(r rune) bool { return r == ':' })
+	name := root
+	for _, p := range parts {
+		if c := journalComponent(p, dialect); c != "" {
+			name += ":" + c
+		}
+	}
+	if name == root {
+		name += ":" + DefaultImportCategory
+	}
+	return name
+}
+
+// AccountCategory is the inverse of CategoryAccount for names it did not have to clean up
+func AccountCategory(account string) string {
+	parts := strings.Split(account, ":")
+	if len(parts) < 2 {
+		return account
+	}
+	return strings.Join(parts[1:], " / ")
+}
+
+// journalComponent cleans up one level of an account name. Beancount only
+// allows letters, digits and dashes, starting with a capital or a digit;
+// ledger and hledger only mind runs of spaces, which end the account name,
+// and characters that mark virtual postings or comments.
+func journalComponent(s, dialect string) string {
+	if dialect != ExportBeancount {
+		s = strings.Map(func(r rune) rune {
+			switch r {
+			case ';', '(', ')', '[', ']':
+				return '-'
+			}
+			return r
+		}, s)
+		return strings.Join(strings.Fields(s), " ")
+	}
+
+	var b strings.Builder
+	dash := false
+	for _, r := range s {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	out := []rune(b.String())
+	if len(out) == 0 {
+		return ""
+	}
+	out[0] = unicode.ToUpper(out[0])
+	if !unicode.IsUpper(out[0]) && !unicode.IsDigit(out[0]) {
+		return "X-" + string(out)
+	}
+	return string(out)
+}
+
+// journalTag cleans up a tag name for a journal. Beancount tags only hold
+// ASCII letters, digits and -_/.; ledger and hledger tags end at spaces, colons
+// and commas.
+func journalTag(name, dialect string) string {
+	return strings.Join(strings.FieldsFunc(name, func(r rune) bool {
+		if dialect == ExportBeancount {
+			return r > unicode.MaxASCII || !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune("-_/.", r)
+		}
+		return unicode.IsSpace(r) || r == ':' || r == ','
+	}), "-")
+}
+
+// journalAmount renders an amount followed by its commodity
+func journalAmount(a money.Amount, currency string) string {
+	return a.Format(currency) + " " + currency
+}
+
+// journalDay formats an optional date
+func journalDay(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format("2006-01-02")
+}
+
+// beancountString quotes a string the way beancount reads it back
+func beancountString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,350 @@
+package service
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"tracker/models"
+	"tracker/money"
+)
+
+var (
+	// mt940Tag starts a field, e.g. :61: or :28C:
+	mt940Tag = regexp.MustCompile(`^:(\d{2}[A-Z]?):`)
+
+	// mt940Line is a :61: statement line: value date, optional booking date
+	// (MMDD), debit/credit mark, optional funds code, amount, transaction type,
+	// customer reference, optional //bank reference and supplementary details
+	mt940Line = regexp.MustCompile(`^(\d{6})(\d{4})?(RC|RD|C|D)([A-Z])?(\d+,\d*)([NFS][A-Z0-9]{3})([^/\n]*)(?://([^\n]*))?(?:\n([\s\S]*))?$`)
+
+	// mt940Balance is a :60F:/:62F: balance: mark, date, currency, amount
+	mt940Balance = regexp.MustCompile(`^([CD])(\d{6})([A-Z]{3})(\d+,\d*)`)
+
+	// mt940Subfield splits structured :86: details such as 166?00TEXT?20...
+	mt940Subfield = regexp.MustCompile(`\?(\d{2})`)
+)
+
+// mt940Field is one :tag: with its value, continuation lines included
+type mt940Field struct {
+	tag, value string
+}
+
+// ParseMT940 reads a SWIFT MT940 customer statement, possibly several of
+// them in one file. Each :61: line with its :86: details becomes a row with
+// booking and value date, counterparty and remittance information in the
+// note and the bank reference (or customer reference) as external ID.
+func ParseMT940(r io.Reader) ([]models.ImportRow, []models.StatementBalance, error) {
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	// MT940 files are ASCII or Latin-1 in practice; only the latter needs decoding
+	text := string(raw)
+	if !utf8.Valid(raw) {
+		decoded, err := DecodeReader(strings.NewReader(text), "windows-1252")
+		if err != nil {
+			return nil, nil, err
+		}
+		b, _ := io.ReadAll(decoded)
+		text = string(b)
+	}
+
+	var rows []models.ImportRow
+	var statements []models.StatementBalance
+	for _, fields := range splitMT940(text) {
+		stmtRows, summary, err := parseMT940Statement(fields, len(rows))
+		if err != nil {
+			return nil, nil, err
+		}
+		rows = append(rows, stmtRows...)
+		statements = append(statements, summary)
+	}
+
+	if len(rows) == 0 {
+		return nil, statements, ErrEmptyImportFile
+	}
+	return rows, statements, nil
+}
+
+// splitMT940 cuts a file into statements, each a list of fields. SWIFT
+// envelope blocks ({1:...}{2:...}{4:) are skipped; a line of "-" ends a statement.
+func splitMT940(text string) [][]mt940Field {
+	var statements [][]mt940Field
+	var current []mt940Field
+	flush := func() {
+		if len(current) > 0 {
+			statements = append(statements, current)
+			current = nil
+		}
+	}
+
+	sc := bufio.NewScanner(strings.NewReader(text))
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r ")
+		switch {
+		case line == "":
+			continue
+		case line == "-" || line == "-}" || strings.HasPrefix(line, "-}"):
+			flush()
+			continue
+		case strings.HasPrefix(line, "{"):
+			// a {4: block may carry the first field on the same line
+			if i := strings.Index(line, "{4:"); i >= 0 && len(line) > i+3 {
+				line = line[i+3:]
+			} else {
+				continue
+			}
+		}
+
+		if m := mt940Tag.FindStringSubmatch(line); m != nil {
+			if m[1] == "20" {
+				flush()
+			}
+			current = append(current, mt940Field{tag: m[1], value: line[len(m[0]):]})
+			continue
+		}
+		if n := len(current); n > 0 {
+			current[n-1].value += "\n" + line
+		}
+	}
+	flush()
+	return statements
+}
+
+// parseMT940Statement turns the fields of one statement into rows and its
+// balance summary; offset numbers the rows across statements
+func parseMT940Statement(fields []mt940Field, offset int) ([]models.ImportRow, models.StatementBalance, error) {
+	var summary models.StatementBalance
+	var rows []models.ImportRow
+	var reference, sequence string
+	opened, closed := false, false
+	seen := map[string]int{}
+
+	for i, f := range fields {
+		switch f.tag {
+		case "20":
+			reference = strings.TrimSpace(f.value)
+		case "25":
+			summary.Account = strings.TrimSpace(f.value)
+		case "28C", "28":
+			sequence = strings.TrimSpace(f.value)
+		case "60F", "60M":
+			amount, date, currency, err := parseMT940Balance(f.value)
+			if err != nil {
+				return nil, summary, err
+			}
+			summary.OpeningBalance, summary.OpeningDate, summary.Currency = amount, &date, currency
+			opened = true
+		case "62F", "62M":
+			amount, date, currency, err := parseMT940Balance(f.value)
+			if err != nil {
+				return nil, summary, err
+			}
+			summary.ClosingBalance, summary.ClosingDate = amount, &date
+			closed = true
+			if summary.Currency == "" {
+				summary.Currency = currency
+			}
+		case "61":
+			details := ""
+			if i+1 < len(fields) && fields[i+1].tag == "86" {
+				details = fields[i+1].value
+			}
+			row := mt940Row(f.value, details, summary.Currency, offset+len(rows)+1)
+			row.Transaction.Currency = summary.Currency
+
+			// Without a bank reference, identify the line by its content
+			if row.Transaction.ExternalID == "" {
+				sum := sha1.Sum([]byte(summary.Account + "\x00" + f.value + "\x00" + details))
+				key := hex.EncodeToString(sum[:8])
+				seen[key]++
+				row.Transaction.ExternalID = fmt.Sprintf("mt940:%s:%d", key, seen[key])
+			}
+			if len(row.Errors) == 0 {
+				summary.Entries++
+				summary.Movement += signedAmount(row.Transaction)
+			}
+			rows = append(rows, row)
+		}
+	}
+
+	summary.StatementID = reference
+	if sequence != "" {
+		summary.StatementID += "/" + sequence
+	}
+	// A missing balance reads as zero, which must not pass for a match
+	summary.Reconciled = opened && closed && summary.OpeningBalance+summary.Movement == summary.ClosingBalance
+	return rows, summary, nil
+}
+
+// parseMT940Balance reads C240131EUR1234,56
+func parseMT940Balance(v string) (money.Amount, time.Time, string, error) {
+	m := mt940Balance.FindStringSubmatch(strings.TrimSpace(v))
+	if m == nil {
+		return 0, time.Time{}, "", fmt.Errorf("%w: balance %q", ErrMalformedImport, v)
+	}
+	date, err := time.Parse("060102", m[2])
+	if err != nil {
+		return 0, time.Time{}, "", fmt.Errorf("%w: balance date %q", ErrMalformedImport, m[2])
+	}
+	amount, err := parseMT940Amount(m[4], m[3])
+	if err != nil {
+		return 0, time.Time{}, "", fmt.Errorf("%w: balance amount %q", ErrMalformedImport, m[4])
+	}
+	if m[1] == "D" {
+		amount = -amount
+	}
+	return amount, date, m[3], nil
+}
+
+// mt940Row maps a :61: line and its :86: details onto a transaction in the
+// statement's currency
+func mt940Row(line, details, currency string, n int) models.ImportRow {
+	row := models.ImportRow{Line: n}
+	tx := &row.Transaction
+
+	m := mt940Line.FindStringSubmatch(strings.TrimSpace(line))
+	if m == nil {
+		row.Errors = append(row.Errors, fmt.Sprintf("statement line %q cannot be read", line))
+		return row
+	}
+
+	valueDate, err := time.Parse("060102", m[1])
+	if err != nil {
+		row.Errors = append(row.Errors, fmt.Sprintf("value date %q is not a date", m[1]))
+	}
+	tx.Date = valueDate
+	if m[2] != "" {
+		booking, err := mt940BookingDate(m[2], valueDate)
+		if err != nil {
+			row.Errors = append(row.Errors, fmt.Sprintf("booking date %q is not a date", m[2]))
+		} else if !booking.Equal(valueDate) {
+			tx.Date = booking
+			tx.ValueDate = &valueDate
+		}
+	}
+
+	amount, err := parseMT940Amount(m[5], currency)
+	if err != nil {
+		row.Errors = append(row.Errors, fmt.Sprintf("amount %q is not a number", m[5]))
+	}
+	// RC reverses a credit and RD a debit, so they move money the other way
+	tx.Type = "income"
+	if m[3] == "D" || m[3] == "RC" {
+		tx.Type = "expense"
+	}
+	tx.Amount = amount
+
+	counterparty, remittance := parseMT940Details(details)
+	if remittance == "" {
+		remittance = strings.TrimSpace(m[9])
+	}
+	tx.Note = joinNote(counterparty, remittance)
+
+	if bankRef := strings.TrimSpace(m[8]); bankRef != "" && bankRef != "NONREF" {
+		tx.ExternalID = bankRef
+	} else if ref := strings.TrimSpace(m[7]); ref != "" && ref != "NONREF" {
+		tx.ExternalID = ref
+	}
+	return row
+}
+
+// mt940BookingDate places an MMDD booking date in the year of the value
+// date, or the neighbouring one when the two straddle new year
+func mt940BookingDate(mmdd string, value time.Time) (time.Time, error) {
+	t, err := time.Parse("0102", mmdd)
+	if err != nil {
+		return time.Time{}, err
+	}
+	year := value.Year()
+	switch {
+	case t.Month() == time.December && value.Month() == time.January:
+		year--
+	case t.Month() == time.January && value.Month() == time.December:
+		year++
+	}
+	return time.Date(year, t.Month(), t.Day(), 0, 0, 0, 0, time.UTC), nil
+}
+
+// parseMT940Amount reads 1234,56 or 1234, in currency
+func parseMT940Amount(s, currency string) (money.Amount, error) {
+	return ParseDecimal(strings.TrimSuffix(s, ","), ",", currency)
+}
+
+// parseMT940Details reads the counterparty and remittance information from
+// :86:. It understands the German structured layout (166?00...?20...?32...),
+// the SEPA keyword layout (/NAME/.../REMI/...) and falls back to free text.
+func parseMT940Details(details string) (counterparty, remittance string) {
+	details = strings.ReplaceAll(details, "\n", "")
+	if details == "" {
+		return "", ""
+	}
+
+	if len(details) > 3 && details[3] == '?' {
+		var name, remi []string
+		idx := mt940Subfield.FindAllStringSubmatchIndex(details, -1)
+		for i, loc := range idx {
+			end := len(details)
+			if i+1 < len(idx) {
+				end = idx[i+1][0]
+			}
+			code, value := details[loc[2]:loc[3]], strings.TrimSpace(details[loc[1]:end])
+			switch {
+			case code == "32" || code == "33":
+				name = append(name, value)
+			case code >= "20" && code <= "29", code >= "60" && code <= "63":
+				remi = append(remi, value)
+			}
+		}
+		return strings.Join(name, ""), strings.Join(remi, " ")
+	}
+
+	if strings.Contains(details, "/NAME/") || strings.Contains(details, "/REMI/") {
+		keywords := mt940Keywords(details)
+		return keywords["NAME"], firstNonEmpty(keywords["REMI"], keywords["EREF"])
+	}
+	return "", strings.TrimSpace(details)
+}
+
+// mt940Keywords splits /KEY/value/KEY/value details. Values may contain
+// slashes, so only known keywords start a new pair.
+func mt940Keywords(details string) map[string]string {
+	known := map[string]bool{
+		"TRTP": true, "IBAN": true, "BIC": true, "NAME": true, "REMI": true, "EREF": true,
+		"MARF": true, "CSID": true, "PREF": true, "RTRN": true, "ORDP": true, "BENM": true,
+		"ID": true, "ADDR": true, "CDTRREF": true, "CDTRREFTP": true, "CD": true, "SCOR": true,
+	}
+	out := map[string]string{}
+	parts := strings.Split(details, "/")
+	key := ""
+	var value []string
+	for _, p := range parts {
+		if known[p] {
+			if key != "" {
+				out[key] = strings.TrimSpace(strings.Join(value, "/"))
+			}
+			key, value = p, nil
+			continue
+		}
+		if key != "" {
+			value = append(value, p)
+		}
+	}
+	if key != "" {
+		out[key] = strings.TrimSpace(strings.Join(value, "/"))
+	}
+
+	// REMI is often structured itself: /REMI/USTD//text/
+	if remi := out["REMI"]; strings.HasPrefix(remi, "USTD//") {
+		out["REMI"] = strings.Trim(strings.TrimPrefix(remi, "USTD//"), "/ ")
+	}
+	return out
+}
@@ -0,0 +1,179 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"tracker/money"
+)
+
+// mt940Statement builds a statement with the given balance fields around one
+// debit of 25,00 and one credit of 100,00
+func mt940Statement(opening, closing string) string {
+	var b strings.Builder
+	b.WriteString(":20:STMT1\n:25:DE89370400440532013000\n:28C:1/1\n")
+	if opening != "" {
+		b.WriteString(":60F:" + opening + "\n")
+	}
+	b.WriteString(":61:2603020302D25,00NTRFNONREF//B1\n:86:166?00SEPA?20Groceries?32ACME MARKT\n")
+	b.WriteString(":61:2603030303C100,00NTRFNONREF//B2\n:86:166?00SEPA?20Salary?32EMPLOYER\n")
+	if closing != "" {
+		b.WriteString(":62F:" + closing + "\n")
+	}
+	b.WriteString("-\n")
+	return b.String()
+}
+
+func TestMT940Reconciliation(t *testing.T) {
+	tests := []struct {
+		name             string
+		opening, closing string
+		want             bool
+	}{
+		{"balances match", "C260301EUR500,00", "C260303EUR575,00", true},
+		{"balances differ", "C260301EUR500,00", "C260303EUR570,00", false},
+		{"no opening balance", "", "C260303EUR75,00", false},
+		{"no closing balance", "D260301EUR75,00", "", false},
+		{"no balances", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, statements, err := ParseMT940(strings.NewReader(mt940Statement(tt.opening, tt.closing)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(statements) != 1 {
+				t.Fatalf("got %d statements, want 1", len(statements))
+			}
+			if got := statements[0].Reconciled; got != tt.want {
+				t.Errorf("reconciled = %v, want %v (%+v)", got, tt.want, statements[0])
+			}
+		})
+	}
+}
+
+func TestParseMT940(t *testing.T) {
+	// Two statements in SWIFT envelopes, the second in Latin-1 with SEPA
+	// keyword details, a reversal and an entry that straddles new year
+	file := "{1:F01BANKDEFFAXXX0000000000}{2:I940BANKDEFFXXXXN}{4:\n" +
+		":20:STMT1\n:25:DE89370400440532013000\n:28C:1/1\n:60F:C260301EUR500,00\n" +
+		":61:2603020302D25,00NTRFNONREF//B1\n:86:166?00SEPA?20Groceries?21week 9?32ACME MARKT\n" +
+		":61:2603040303C100,NTRFNONREF\n:86:166?00SEPA?20Salary?32EMPLOYER\n" +
+		":62F:C260304EUR575,00\n-}\n" +
+		":20:STMT2\n:25:DE89370400440532013000\n:28C:2/1\n:60F:C251231EUR0,00\n" +
+		":61:2601011231D9,90NDDTREF-7\n:86:/NAME/B\xe4ckerei/REMI/USTD//Br\xf6tchen/\n" +
+		":61:260102RC5,00NTRFNONREF\n:86:Reversed card payment\n" +
+		":61:260103garbled\n" +
+		":62F:D260103EUR14,90\n-\n"
+
+	rows, statements, err := ParseMT940(strings.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statements) != 2 || statements[0].StatementID != "STMT1/1/1" || statements[1].StatementID != "STMT2/2/1" {
+		t.Fatalf("statements = %+v, want STMT1/1/1 and STMT2/2/1", statements)
+	}
+	if !statements[0].Reconciled || !statements[1].Reconciled {
+		t.Errorf("statements not reconciled: %+v", statements)
+	}
+
+	want := []struct {
+		date, valueDate string
+		typ, amount     string
+		note            string
+		externalID      string
+		errs            int
+	}{
+		{"2026-03-02", "", "expense", "25.00", "ACME MARKT - Groceries week 9", "B1", 0},
+		{"2026-03-03", "2026-03-04", "income", "100.00", "EMPLOYER - Salary", "mt940:", 0},
+		{"2025-12-31", "2026-01-01", "expense", "9.90", "Bäckerei - Brötchen", "REF-7", 0},
+		{"2026-01-02", "", "expense", "5.00", "Reversed card payment", "mt940:", 0},
+		{"0001-01-01", "", "", "0.00", "", "mt940:", 1},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("got %d rows, want %d", len(rows), len(want))
+	}
+	for i, w := range want {
+		row, tx := rows[i], rows[i].Transaction
+		if row.Line != i+1 || len(row.Errors) != w.errs {
+			t.Errorf("row %d = line %d errors %v, want line %d and %d errors", i, row.Line, row.Errors, i+1, w.errs)
+		}
+		valueDate := ""
+		if tx.ValueDate != nil {
+			valueDate = tx.ValueDate.Format("2006-01-02")
+		}
+		if got := tx.Date.Format("2006-01-02"); got != w.date || valueDate != w.valueDate {
+			t.Errorf("row %d: dates %s / %q, want %s / %q", i, got, valueDate, w.date, w.valueDate)
+		}
+		if tx.Type != w.typ || tx.Amount != money.MustParse(w.amount) || tx.Note != w.note {
+			t.Errorf("row %d = %s %s %q, want %s %s %q", i, tx.Type, tx.Amount, tx.Note, w.typ, w.amount, w.note)
+		}
+		if !strings.HasPrefix(tx.ExternalID, w.externalID) {
+			t.Errorf("row %d: external ID %q, want %q", i, tx.ExternalID, w.externalID)
+		}
+	}
+}
+
+func TestParseMT940Errors(t *testing.T) {
+	tests := []struct {
+		name, file string
+		wantErr    error
+	}{
+		{"bad opening balance", ":20:S\n:60F:X260301EUR1,00\n:61:2603020302D25,00NTRFNONREF\n-\n", ErrMalformedImport},
+		{"bad closing balance", ":20:S\n:61:2603020302D25,00NTRFNONREF\n:62F:C261301EUR1,00\n-\n", ErrMalformedImport},
+		{"no entries", ":20:S\n:60F:C260301EUR1,00\n:62F:C260301EUR1,00\n-\n", ErrEmptyImportFile},
+		{"not mt940", "Date,Amount\n2026-01-01,1.00\n", ErrEmptyImportFile},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := ParseMT940(strings.NewReader(tt.file)); !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseMT940Details(t *testing.T) {
+	tests := []struct {
+		name, details            string
+		counterparty, remittance string
+	}{
+		{"structured", "166?00SEPA-UEBERWEISUNG?20EREF+123?21Rent March?32LANDLORD?33GMBH", "LANDLORDGMBH", "EREF+123 Rent March"},
+		{"structured over lines", "166?00SEPA?20Rent\n March?32LANDLORD", "LANDLORD", "Rent March"},
+		{"keywords", "/TRTP/SEPA OVERBOEKING/IBAN/NL20INGB0001234567/NAME/ACME B.V./REMI/Invoice 2026/03/EREF/X1", "ACME B.V.", "Invoice 2026/03"},
+		{"keywords with end to end reference only", "/NAME/ACME/EREF/X1", "ACME", "X1"},
+		{"free text", "CARD PAYMENT KIOSK", "", "CARD PAYMENT KIOSK"},
+		{"empty", "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counterparty, remittance := parseMT940Details(tt.details)
+			if counterparty != tt.counterparty || remittance != tt.remittance {
+				t.Errorf("got %q, %q, want %q, %q", counterparty, remittance, tt.counterparty, tt.remittance)
+			}
+		})
+	}
+}
+
+func TestMT940BookingDate(t *testing.T) {
+	tests := []struct {
+		mmdd, value, want string
+	}{
+		{"0302", "2026-03-02", "2026-03-02"},
+		{"1231", "2026-01-02", "2025-12-31"},
+		{"0102", "2025-12-30", "2026-01-02"},
+	}
+	for _, tt := range tests {
+		value, _ := time.Parse("2006-01-02", tt.value)
+		got, err := mt940BookingDate(tt.mmdd, value)
+		if err != nil {
+			t.Errorf("mt940BookingDate(%s, %s): %v", tt.mmdd, tt.value, err)
+			continue
+		}
+		if got.Format("2006-01-02") != tt.want {
+			t.Errorf("mt940BookingDate(%s, %s) = %s, want %s", tt.mmdd, tt.value, got.Format("2006-01-02"), tt.want)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package service
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"tracker/models"
+	"tracker/money"
+)
+
+// ofxCharset finds the character set in an OFX 1.x header or an XML declaration
+var ofxCharset = regexp.MustCompile(`(?i)(?:CHARSET:\s*([\w-]+)|encoding=["']([\w-]+)["'])`)
+
+// ParseOFX reads an OFX or QFX statement, either OFX 1.x (SGML, where leaf
+// elements have no end tag) or OFX 2.x (XML). Every STMTTRN of every bank or
+// credit card statement in the file becomes a row; FITID is kept as the
+// external ID so the same entry is never imported twice.
+func ParseOFX(r io.Reader) ([]models.ImportRow, error) {
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	start := strings.Index(strings.ToUpper(string(raw)), "<OFX>")
+	if start < 0 {
+		return nil, fmt.Errorf("%w: no <OFX> element", ErrMalformedImport)
+	}
+	doc, err := decodeOFX(raw, string(raw[:start]))
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		rows      []models.ImportRow
+		entry     map[string]string // leaf values of the STMTTRN being read
+		currency  string            // CURDEF of the current statement
+		open      string            // last start tag, which an SGML value belongs to
+		inOrigCur bool              // inside ORIGCURRENCY, whose CURSYM is informational
+	)
+
+	for pos := 0; pos < len(doc); {
+		lt := strings.IndexByte(doc[pos:], '<')
+		if lt < 0 {
+			break
+		}
+		if text := strings.TrimSpace(doc[pos : pos+lt]); text != "" && open != "" {
+			value := html.UnescapeString(text)
+			switch {
+			case entry != nil && !(inOrigCur && open == "CURSYM"):
+				if _, ok := entry[open]; !ok {
+					entry[open] = value
+				}
+			case entry == nil && open == "CURDEF":
+				currency = strings.ToUpper(value)
+			}
+		}
+
+		gt := strings.IndexByte(doc[pos+lt:], '>')
+		if gt < 0 {
+			return nil, fmt.Errorf("%w: unterminated tag", ErrMalformedImport)
+		}
+		tag := strings.TrimSpace(doc[pos+lt+1 : pos+lt+gt])
+		pos += lt + gt + 1
+
+		switch {
+		case tag == "" || tag[0] == '?' || tag[0] == '!':
+			open = ""
+		case tag[0] == '/':
+			switch strings.ToUpper(tag[1:]) {
+			case "STMTTRN":
+				if entry != nil {
+					rows = append(rows, ofxRow(entry, currency, len(rows)+1))
+					entry = nil
+				}
+			case "ORIGCURRENCY":
+				inOrigCur = false
+			}
+			open = ""
+		default:
+			name := strings.ToUpper(strings.TrimSuffix(strings.Fields(tag)[0], "/"))
+			switch name {
+			case "STMTTRN":
+				entry = map[string]string{}
+			case "ORIGCURRENCY":
+				inOrigCur = true
+			case "STMTRS", "CCSTMTRS":
+				currency = ""
+			}
+			open = name
+		}
+	}
+
+	if len(rows) == 0 {
+		return nil, ErrEmptyImportFile
+	}
+	return rows, nil
+}
+
+// decodeOFX converts the document to UTF-8 using the charset its header names.
+// OFX 1.x files use CHARSET:1252 and friends for Windows code pages.
+func decodeOFX(raw []byte, header string) (string, error) {
+	m := ofxCharset.FindStringSubmatch(header)
+	if m == nil {
+		return string(raw), nil
+	}
+	charset := strings.ToLower(m[1] + m[2])
+	switch {
+	case charset == "none" || charset == "usascii":
+		return string(raw), nil
+	case charset != "" && strings.Trim(charset, "0123456789") == "":
+		charset = "windows-" + charset
+	}
+
+	r, err := DecodeReader(strings.NewReader(string(raw)), charset)
+	if err != nil {
+		return "", err
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrMalformedImport, err)
+	}
+	return string(b), nil
+}
+
+// ofxRow maps the leaf values of one STMTTRN onto a transaction
+func ofxRow(entry map[string]string, currency string, n int) models.ImportRow {
+	row := models.ImportRow{Line: n}
+	tx := &row.Transaction
+
+	date, err := parseOFXDate(entry["DTPOSTED"])
+	if err != nil {
+		row.Errors = append(row.Errors, fmt.Sprintf("DTPOSTED %q is not an OFX date", entry["DTPOSTED"]))
+	}
+	tx.Date = date
+
+	tx.Currency = currency
+	if sym := entry["CURSYM"]; sym != "" {
+		tx.Currency = strings.ToUpper(sym)
+	}
+
+	amount, err := parseLooseDecimal(entry["TRNAMT"], tx.Currency)
+	if err != nil {
+		row.Errors = append(row.Errors, fmt.Sprintf("TRNAMT %q is not a number", entry["TRNAMT"]))
+	}
+	tx.Type = "income"
+	if amount < 0 {
+		tx.Type = "expense"
+	}
+	tx.Amount = amount.Abs()
+
+	tx.Note = joinNote(entry["NAME"], entry["MEMO"])
+	tx.ExternalID = entry["FITID"]
+	if tx.ExternalID == "" {
+		row.Errors = append(row.Errors, "FITID is missing")
+	}
+	return row
+}
+
+// parseOFXDate reads YYYYMMDD[HHMMSS[.XXX]][[offset:TZ]]; only the day is kept
+func parseOFXDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if len(s) < 8 {
+		return time.Time{}, fmt.Errorf("short date")
+	}
+	return time.Parse("20060102", s[:8])
+}
+
+// parseLooseDecimal reads an amount whose decimal separator is not known up
+// front: a comma followed by one or two digits at the end is taken as the
+// decimal point, anything else as a thousands separator
+func parseLooseDecimal(s, currency string) (money.Amount, error) {
+	s = strings.TrimSpace(s)
+	sep := "."
+	if i := strings.LastIndexByte(s, ','); i >= 0 && !strings.Contains(s[i:], ".") {
+		if digits := len(s) - i - 1; digits == 1 || digits == 2 {
+			sep = ","
+		}
+	}
+	return ParseDecimal(s, sep, currency)
+}
+
+// joinNote combines a payee name and a memo without repeating either
+func joinNote(name, memo string) string {
+	name, memo = strings.TrimSpace(name), strings.TrimSpace(memo)
+	switch {
+	case memo == "" || strings.Contains(name, memo):
+		return name
+	case name == "" || strings.Contains(memo, name):
+		return memo
+	}
+	return name + " - " + memo
+}
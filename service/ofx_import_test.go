@@ -0,0 +1,174 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"tracker/money"
+)
+
+// ofxSGML is an OFX 1.x statement, whose leaf elements have no end tags
+const ofxSGML = `OFXHEADER:100
+DATA:OFXSGML
+VERSION:102
+ENCODING:USASCII
+CHARSET:1252
+
+<OFX>
+<BANKMSGSRSV1><STMTTRNRS><STMTRS>
+<CURDEF>EUR
+<BANKTRANLIST>
+<STMTTRN>
+<TRNTYPE>DEBIT
+<DTPOSTED>20260203120000.000[+1:CET]
+<TRNAMT>-23.90
+<FITID>A-1
+<NAME>B` + "\xe4" + `ckerei M&amp;M
+<MEMO>Card 4411
+</STMTTRN>
+<STMTTRN>
+<TRNTYPE>CREDIT
+<DTPOSTED>20260204
+<TRNAMT>1.250,00
+<FITID>A-2
+<NAME>Salary
+<MEMO>Salary
+<CURRENCY><CURRATE>1.1<CURSYM>usd</CURRENCY>
+</STMTTRN>
+</BANKTRANLIST>
+</STMTRS></STMTTRNRS></BANKMSGSRSV1>
+</OFX>
+`
+
+// ofxXML is an OFX 2.x statement with a credit card statement in USD
+const ofxXML = `<?xml version="1.0" encoding="UTF-8"?>
+<?OFX OFXHEADER="200" VERSION="211"?>
+<OFX>
+<CREDITCARDMSGSRSV1><CCSTMTTRNRS><CCSTMTRS>
+<CURDEF>USD</CURDEF>
+<BANKTRANLIST>
+<STMTTRN>
+<TRNTYPE>DEBIT</TRNTYPE>
+<DTPOSTED>20260210</DTPOSTED>
+<TRNAMT>-9.99</TRNAMT>
+<FITID>cc-1</FITID>
+<NAME>Streaming</NAME>
+<ORIGCURRENCY><CURRATE>0.9</CURRATE><CURSYM>EUR</CURSYM></ORIGCURRENCY>
+</STMTTRN>
+<STMTTRN>
+<DTPOSTED>yesterday</DTPOSTED>
+<TRNAMT>ten</TRNAMT>
+</STMTTRN>
+</BANKTRANLIST>
+</CCSTMTRS></CCSTMTTRNRS></CREDITCARDMSGSRSV1>
+</OFX>
+`
+
+func TestParseOFX(t *testing.T) {
+	type want struct {
+		date       time.Time
+		typ        string
+		amount     string
+		currency   string
+		note       string
+		externalID string
+		errs       int
+	}
+	tests := []struct {
+		name string
+		file string
+		want []want
+	}{
+		{"sgml", ofxSGML, []want{
+			{time.Date(2026, time.February, 3, 0, 0, 0, 0, time.UTC), "expense", "23.90", "EUR", "Bäckerei M&M - Card 4411", "A-1", 0},
+			{time.Date(2026, time.February, 4, 0, 0, 0, 0, time.UTC), "income", "1250.00", "USD", "Salary", "A-2", 0},
+		}},
+		{"xml", ofxXML, []want{
+			{time.Date(2026, time.February, 10, 0, 0, 0, 0, time.UTC), "expense", "9.99", "USD", "Streaming", "cc-1", 0},
+			{time.Time{}, "", "", "USD", "", "", 3},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := ParseOFX(strings.NewReader(tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rows) != len(tt.want) {
+				t.Fatalf("got %d rows, want %d", len(rows), len(tt.want))
+			}
+			for i, w := range tt.want {
+				row, tx := rows[i], rows[i].Transaction
+				if row.Line != i+1 || len(row.Errors) != w.errs {
+					t.Errorf("row %d = line %d errors %v, want line %d and %d errors", i, row.Line, row.Errors, i+1, w.errs)
+				}
+				if tx.Currency != w.currency || tx.Note != w.note || tx.ExternalID != w.externalID {
+					t.Errorf("row %d = %s %q %q, want %s %q %q", i, tx.Currency, tx.Note, tx.ExternalID, w.currency, w.note, w.externalID)
+				}
+				if w.typ == "" {
+					continue
+				}
+				if !tx.Date.Equal(w.date) || tx.Type != w.typ || tx.Amount != money.MustParse(w.amount) {
+					t.Errorf("row %d = %s %s %s, want %s %s %s", i, tx.Date.Format("2006-01-02"), tx.Type, tx.Amount, w.date.Format("2006-01-02"), w.typ, w.amount)
+				}
+			}
+		})
+	}
+}
+
+func TestParseOFXErrors(t *testing.T) {
+	tests := []struct {
+		name, file string
+		wantErr    error
+	}{
+		{"no ofx element", "OFXHEADER:100\n", ErrMalformedImport},
+		{"unterminated tag", "<OFX><STMTTRN", ErrMalformedImport},
+		{"no entries", "<OFX><BANKMSGSRSV1></BANKMSGSRSV1></OFX>", ErrEmptyImportFile},
+		{"unknown charset", "CHARSET:klingon\n<OFX></OFX>", ErrInvalidEncoding},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseOFX(strings.NewReader(tt.file)); !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseLooseDecimal(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"-23.90", "-23.90"},
+		{"23,90", "23.90"},
+		{"1,250.00", "1250.00"},
+		{"1.250,00", "1250.00"},
+		{"1,250", "1250.00"},
+		{"0,5", "0.50"},
+	}
+	for _, tt := range tests {
+		got, err := parseLooseDecimal(tt.in, "")
+		if err != nil {
+			t.Errorf("parseLooseDecimal(%q): %v", tt.in, err)
+			continue
+		}
+		if want := money.MustParse(tt.want); got != want {
+			t.Errorf("parseLooseDecimal(%q) = %s, want %s", tt.in, got, want)
+		}
+	}
+}
+
+func TestJoinNote(t *testing.T) {
+	tests := []struct{ name, memo, want string }{
+		{"Acme", "", "Acme"},
+		{"", "Card 4411", "Card 4411"},
+		{"Acme", "Card 4411", "Acme - Card 4411"},
+		{"Acme Markt", "Acme", "Acme Markt"},
+		{"Acme", "Acme Markt Berlin", "Acme Markt Berlin"},
+	}
+	for _, tt := range tests {
+		if got := joinNote(tt.name, tt.memo); got != tt.want {
+			t.Errorf("joinNote(%q, %q) = %q, want %q", tt.name, tt.memo, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,371 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"tracker/models"
+	"tracker/repository"
+)
+
+var (
+	ErrPayeeNotFound     = errors.New("payee not found")
+	ErrInvalidPayeeName  = errors.New("name is required")
+	ErrDuplicatePayee    = errors.New("a payee of this name already exists")
+	ErrInvalidPayeeAlias = errors.New("every alias needs a pattern, and regex patterns must compile")
+)
+
+type PayeeService struct {
+	Repo         repository.PayeeRepository
+	Transactions repository.TransactionRepository
+	Categories   *CategoryService   // optional, checks and books default categories
+	Suggestions  *SuggestionService // optional, relearns categories after payees are matched to history
+}
+
+// CreatePayee creates a new payee
+func (s *PayeeService) CreatePayee(payee *models.Payee) error {
+	if err := s.validatePayee(payee); err != nil {
+		return err
+	}
+	return s.Repo.CreatePayee(payee)
+}
+
+// GetPayeesByUserID fetches the payees of a user
+func (s *PayeeService) GetPayeesByUserID(userID uint) ([]models.Payee, error) {
+	return s.Repo.GetPayeesByUserID(userID)
+}
+
+// GetPayeeByID fetches a payee owned by the user
+func (s *PayeeService) GetPayeeByID(id uint, userID uint) (*models.Payee, error) {
+	if !s.Repo.CheckPayeeExistsForUser(id, userID) {
+		return nil, ErrPayeeNotFound
+	}
+	return s.Repo.GetPayeeByID(id)
+}
+
+// UpdatePayee updates a payee owned by the user; a new name is carried over
+// to its transactions
+func (s *PayeeService) UpdatePayee(payee *models.Payee) error {
+	existing, err := s.GetPayeeByID(payee.ID, payee.UserID)
+	if err != nil {
+		return err
+	}
+	if err := s.validatePayee(payee); err != nil {
+		return err
+	}
+	payee.CreatedAt = existing.CreatedAt
+	return s.Repo.UpdatePayee(payee, existing.Name)
+}
+
+// DeletePayee deletes a payee owned by the user; its transactions are kept
+func (s *PayeeService) DeletePayee(id uint, userID uint) error {
+	if !s.Repo.CheckPayeeExistsForUser(id, userID) {
+		return ErrPayeeNotFound
+	}
+
+	log.Printf("Payee with ID %d found for user %d, proceeding to delete", id, userID)
+	return s.Repo.DeletePayee(id)
+}
+
+// ApplyPayees matches the user's past transactions in the range that have
+// no payee yet against the payees, and saves the ones that now have one,
+// with the payee's default category where they lacked one
+func (s *PayeeService) ApplyPayees(userID uint, rng models.DateRange) (*models.PayeeApplyResult, error) {
+	result := &models.PayeeApplyResult{}
+	var candidates []models.Transaction
+	filter := models.TransactionFilter{UserID: userID, From: rng.From, To: rng.To}
+	err := s.Transactions.StreamTransactions(filter, func(tx models.Transaction) error {
+		result.Scanned++
+		if tx.PayeeID == nil && tx.Type != TypeTransfer {
+			candidates = append(candidates, tx)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	pending := make([]*models.Transaction, len(candidates))
+	categories := map[uint]string{}
+	for i := range candidates {
+		pending[i] = &candidates[i]
+		categories[candidates[i].ID] = candidates[i].Category
+	}
+	if err := s.assignTransactions(userID, pending, false); err != nil {
+		return nil, err
+	}
+	if err := s.assignCategories(userID, pending); err != nil {
+		return nil, err
+	}
+
+	var changed []models.Transaction
+	recategorized := false
+	for _, tx := range candidates {
+		if tx.PayeeID == nil {
+			continue
+		}
+		changed = append(changed, tx)
+		if tx.Category != categories[tx.ID] {
+			recategorized = true
+		}
+	}
+	if err := s.Repo.UpdateTransactionPayees(changed); err != nil {
+		return nil, err
+	}
+	if recategorized && s.Suggestions != nil {
+		s.Suggestions.Reset(userID)
+	}
+	result.Updated = len(changed)
+	return result, nil
+}
+
+// validatePayee checks a payee and tidies up its fields
+func (s *PayeeService) validatePayee(payee *models.Payee) error {
+	payee.Name = strings.TrimSpace(payee.Name)
+	if payee.Name == "" {
+		return ErrInvalidPayeeName
+	}
+	for i := range payee.Aliases {
+		alias := &payee.Aliases[i]
+		alias.Pattern = strings.TrimSpace(alias.Pattern)
+		if alias.MatchType == "" {
+			alias.MatchType = MatchContains
+		}
+		if alias.MatchType != MatchContains && alias.MatchType != MatchRegex {
+			return ErrInvalidMatchType
+		}
+		if alias.Pattern == "" {
+			return ErrInvalidPayeeAlias
+		}
+		if alias.MatchType == MatchRegex {
+			if _, err := regexp.Compile(alias.Pattern); err != nil {
+				return ErrInvalidPayeeAlias
+			}
+		}
+	}
+
+	payees, err := s.Repo.GetPayeesByUserID(payee.UserID)
+	if err != nil {
+		return err
+	}
+	for _, other := range payees {
+		if other.ID != payee.ID && strings.EqualFold(other.Name, payee.Name) {
+			return ErrDuplicatePayee
+		}
+	}
+
+	if payee.CategoryID != nil && s.Categories != nil {
+		category, err := s.Categories.GetCategoryByID(*payee.CategoryID, payee.UserID)
+		if err != nil {
+			return err
+		}
+		if category.Archived {
+			return ErrCategoryArchived
+		}
+	}
+	return nil
+}
+
+// assignTransactions links each transaction to one of the user's payees: by
+// ID when one is given, by name ignoring case when one is given, and by
+// matching the note against the payees otherwise. Names the user has no
+// payee for yet are created with create set, and left unlinked without.
+// Transfers are left without a payee. Default categories are booked
+// separately by assignCategories, so that rules can match the payee first.
+func (s *PayeeService) assignTransactions(userID uint, txs []*models.Transaction, create bool) error {
+	var entries []*models.Transaction
+	for _, tx := range txs {
+		if tx.Type == TypeTransfer {
+			tx.PayeeID, tx.Payee = nil, ""
+			continue
+		}
+		tx.Payee = strings.TrimSpace(tx.Payee)
+		entries = append(entries, tx)
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	set, err := s.payeeSet(userID)
+	if err != nil {
+		return err
+	}
+	if create {
+		var missing []models.Payee
+		seen := map[string]bool{}
+		for _, tx := range entries {
+			key := strings.ToLower(tx.Payee)
+			if tx.PayeeID != nil || key == "" || set.byName[key] != nil || seen[key] {
+				continue
+			}
+			seen[key] = true
+			missing = append(missing, models.Payee{UserID: userID, Name: tx.Payee})
+		}
+		if len(missing) > 0 {
+			if err := s.Repo.CreateMissingPayees(missing); err != nil {
+				return err
+			}
+			if set, err = s.payeeSet(userID); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, tx := range entries {
+		var payee *models.Payee
+		switch {
+		case tx.PayeeID != nil:
+			if payee = set.byID[*tx.PayeeID]; payee == nil {
+				return ErrPayeeNotFound
+			}
+		case tx.Payee != "":
+			payee = set.byName[strings.ToLower(tx.Payee)]
+		default:
+			payee = set.match(tx.Note)
+		}
+		if payee == nil {
+			continue
+		}
+		id := payee.ID
+		tx.PayeeID, tx.Payee = &id, payee.Name
+	}
+	return nil
+}
+
+// assignCategories gives transactions of one user that are linked to a payee
+// but still lack a category the payee's default one, if it is of the
+// transaction's kind and not archived
+func (s *PayeeService) assignCategories(userID uint, txs []*models.Transaction) error {
+	if s.Categories == nil {
+		return nil
+	}
+	var set *payeeSet
+	var categories *categoryIndex
+	for _, tx := range txs {
+		if tx.PayeeID == nil || tx.Type == TypeTransfer || len(tx.Splits) > 0 || hasCategory(tx) {
+			continue
+		}
+		if set == nil {
+			var err error
+			if set, err = s.payeeSet(userID); err != nil {
+				return err
+			}
+			if categories, err = s.Categories.index(userID); err != nil {
+				return err
+			}
+		}
+		payee := set.byID[*tx.PayeeID]
+		if payee == nil || payee.CategoryID == nil {
+			continue
+		}
+		if c := categories.byID[*payee.CategoryID]; c != nil && c.Kind == tx.Type && !c.Archived {
+			categoryID := c.ID
+			tx.CategoryID, tx.Category = &categoryID, c.Name
+		}
+	}
+	return nil
+}
+
+// payeeSet is a user's payees ready for lookup and matching
+type payeeSet struct {
+	payees []compiledPayee
+	byID   map[uint]*models.Payee
+	byName map[string]*models.Payee
+}
+
+// compiledPayee is a payee with its aliases prepared for matching. Its name
+// only matches as whole words, so "Shell" does not claim "Shellfish Bar";
+// contains aliases match anywhere.
+type compiledPayee struct {
+	payee    *models.Payee
+	name     string   // lower-cased
+	contains []string // lower-cased
+	res      []*regexp.Regexp
+}
+
+func (s *PayeeService) payeeSet(userID uint) (*payeeSet, error) {
+	payees, err := s.Repo.GetPayeesByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	set := &payeeSet{byID: map[uint]*models.Payee{}, byName: map[string]*models.Payee{}}
+	for i := range payees {
+		payee := &payees[i]
+		set.byID[payee.ID] = payee
+		set.byName[strings.ToLower(payee.Name)] = payee
+
+		c := compiledPayee{payee: payee, name: strings.ToLower(strings.TrimSpace(payee.Name))}
+		for _, alias := range payee.Aliases {
+			if alias.MatchType != MatchRegex {
+				c.contains = append(c.contains, strings.ToLower(alias.Pattern))
+				continue
+			}
+			re, err := regexp.Compile(alias.Pattern)
+			if err != nil {
+				// Patterns are checked when saved, so this one predates a change in syntax
+				log.Printf("payee %d: %v", payee.ID, err)
+				continue
+			}
+			c.res = append(c.res, re)
+		}
+		set.payees = append(set.payees, c)
+	}
+	return set, nil
+}
+
+// match finds the first payee, in creation order, whose name or one of
+// whose aliases the note matches
+func (ps *payeeSet) match(note string) *models.Payee {
+	if strings.TrimSpace(note) == "" {
+		return nil
+	}
+	lower := strings.ToLower(note)
+	for _, c := range ps.payees {
+		if containsWords(lower, c.name) {
+			return c.payee
+		}
+		for _, sub := range c.contains {
+			if sub != "" && strings.Contains(lower, sub) {
+				return c.payee
+			}
+		}
+		for _, re := range c.res {
+			if re.MatchString(note) {
+				return c.payee
+			}
+		}
+	}
+	return nil
+}
+
+// containsWords reports whether words occurs in s with no letter or digit
+// right before or after it
+func containsWords(s, words string) bool {
+	if words == "" {
+		return false
+	}
+	for start := 0; ; {
+		i := strings.Index(s[start:], words)
+		if i < 0 {
+			return false
+		}
+		i += start
+		end := i + len(words)
+		before, _ := utf8.DecodeLastRuneInString(s[:i])
+		after, _ := utf8.DecodeRuneInString(s[end:])
+		if (i == 0 || !isWordRune(before)) && (end == len(s) || !isWordRune(after)) {
+			return true
+		}
+		_, size := utf8.DecodeRuneInString(s[i:])
+		start = i + size
+	}
+}
+
+// isWordRune reports whether r is part of a word
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
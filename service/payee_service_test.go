@@ -0,0 +1,146 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"tracker/models"
+	"tracker/repository"
+
+	"gorm.io/gorm"
+)
+
+// memPayeeRepo serves a fixed set of payees
+type memPayeeRepo struct {
+	repository.PayeeRepository
+	payees []models.Payee
+}
+
+func (m *memPayeeRepo) GetPayeesByUserID(userID uint) ([]models.Payee, error) {
+	return m.payees, nil
+}
+
+// CreateMissingPayees adds the payees with the next free IDs
+func (m *memPayeeRepo) CreateMissingPayees(payees []models.Payee) error {
+	for _, p := range payees {
+		p.ID = uint(len(m.payees) + 1)
+		m.payees = append(m.payees, p)
+	}
+	return nil
+}
+
+func TestPayeeMatch(t *testing.T) {
+	payees := []models.Payee{
+		{Model: gorm.Model{ID: 1}, Name: "Shell"},
+		{Model: gorm.Model{ID: 2}, Name: "Acme", Aliases: []models.PayeeAlias{{Pattern: "acme markt"}}},
+		{Model: gorm.Model{ID: 3}, Name: "Netflix", Aliases: []models.PayeeAlias{{MatchType: MatchRegex, Pattern: `NFLX\*\d+`}}},
+		{Model: gorm.Model{ID: 4}, Name: "H&M"},
+		{Model: gorm.Model{ID: 5}, Name: "Café Müller"},
+	}
+	s := &PayeeService{Repo: &memPayeeRepo{payees: payees}}
+	set, err := s.payeeSet(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		note string
+		want uint // 0 for no payee
+	}{
+		{"SHELL 1234 HAMBURG", 1},
+		{"Card payment shell", 1},
+		{"Shell-Station A7", 1},
+		{"SHELLFISH BAR", 0},
+		{"SEASHELL SHOP", 0},
+		{"ACME MARKT BERLIN", 2},
+		{"XACME MARKTPLATZ", 2}, // contains aliases match anywhere
+		{"ACME", 2},
+		{"ACMEDIA GMBH", 0},
+		{"NFLX*123456", 3},
+		{"netflix.com", 3},
+		{"H&M STORE 12", 4},
+		{"CAFÉ MÜLLER KÖLN", 5},
+		{"CAFÉ MÜLLERS", 0},
+		{"", 0},
+	}
+	for _, tt := range tests {
+		var got uint
+		if p := set.match(tt.note); p != nil {
+			got = p.ID
+		}
+		if got != tt.want {
+			t.Errorf("match(%q) = payee %d, want %d", tt.note, got, tt.want)
+		}
+	}
+}
+
+func TestAssignPayees(t *testing.T) {
+	acmeID, unknownID := uint(1), uint(9)
+	tests := []struct {
+		name      string
+		tx        models.Transaction
+		create    bool
+		wantPayee string // "" for none
+		wantErr   error
+	}{
+		{"by ID", models.Transaction{Type: "expense", PayeeID: &acmeID, Note: "Shell"}, false, "Acme", nil},
+		{"by name ignoring case", models.Transaction{Type: "expense", Payee: " ACME ", Note: "Shell"}, false, "Acme", nil},
+		{"by note", models.Transaction{Type: "expense", Note: "Card payment SHELL"}, false, "Shell", nil},
+		{"unknown name left alone", models.Transaction{Type: "expense", Payee: "Kiosk"}, false, "", nil},
+		{"unknown name created", models.Transaction{Type: "expense", Payee: "Kiosk"}, true, "Kiosk", nil},
+		{"transfers have no payee", models.Transaction{Type: TypeTransfer, PayeeID: &acmeID, Payee: "Acme"}, false, "", nil},
+		{"unknown ID", models.Transaction{Type: "expense", PayeeID: &unknownID}, false, "", ErrPayeeNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &memPayeeRepo{payees: []models.Payee{
+				{Model: gorm.Model{ID: 1}, UserID: 1, Name: "Acme"},
+				{Model: gorm.Model{ID: 2}, UserID: 1, Name: "Shell"},
+			}}
+			s := &PayeeService{Repo: repo}
+			tx := tt.tx
+			err := s.assignTransactions(1, []*models.Transaction{&tx}, tt.create)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if tt.wantPayee == "" {
+				if tx.PayeeID != nil {
+					t.Errorf("payee = %d, want none", *tx.PayeeID)
+				}
+				return
+			}
+			if tx.PayeeID == nil || tx.Payee != tt.wantPayee || repo.payees[*tx.PayeeID-1].Name != tt.wantPayee {
+				t.Errorf("payee = %v %q, want %s", tx.PayeeID, tx.Payee, tt.wantPayee)
+			}
+		})
+	}
+}
+
+func TestValidatePayee(t *testing.T) {
+	tests := []struct {
+		name    string
+		payee   models.Payee
+		wantErr error
+	}{
+		{"plain", models.Payee{Name: " Kiosk "}, nil},
+		{"renamed to itself", models.Payee{Model: gorm.Model{ID: 1}, Name: "ACME"}, nil},
+		{"aliases", models.Payee{Name: "Kiosk", Aliases: []models.PayeeAlias{{Pattern: "kiosk 12"}, {MatchType: MatchRegex, Pattern: `^KSK\d+`}}}, nil},
+		{"no name", models.Payee{Name: " "}, ErrInvalidPayeeName},
+		{"taken name", models.Payee{Name: "acme"}, ErrDuplicatePayee},
+		{"empty alias", models.Payee{Name: "Kiosk", Aliases: []models.PayeeAlias{{Pattern: " "}}}, ErrInvalidPayeeAlias},
+		{"bad regex", models.Payee{Name: "Kiosk", Aliases: []models.PayeeAlias{{MatchType: MatchRegex, Pattern: "(k"}}}, ErrInvalidPayeeAlias},
+		{"unknown match type", models.Payee{Name: "Kiosk", Aliases: []models.PayeeAlias{{MatchType: "glob", Pattern: "k*"}}}, ErrInvalidMatchType},
+	}
+	s := &PayeeService{Repo: &memPayeeRepo{payees: []models.Payee{{Model: gorm.Model{ID: 1}, Name: "Acme"}}}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payee := tt.payee
+			if err := s.validatePayee(&payee); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
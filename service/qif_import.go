@@ -0,0 +1,249 @@
+package service
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"tracker/models"
+)
+
+// Orders of day, month and year in QIF dates, which the format leaves to the exporting program
+const (
+	DateOrderMDY = "mdy"
+	DateOrderDMY = "dmy"
+	DateOrderYMD = "ymd"
+)
+
+var ErrInvalidDateOrder = errors.New("date_order must be mdy, dmy or ymd")
+
+// qifSplit is one S/E/$ group of a QIF entry
+type qifSplit struct {
+	category, memo, amount string
+}
+
+// qifEntry collects the fields of one QIF entry up to its ^ terminator
+type qifEntry struct {
+	line                                int
+	date, amount, payee, memo, category string
+	splits                              []qifSplit
+}
+
+// ParseQIF reads the cash, bank and credit card sections of a QIF file.
+// Investment, account list and category list sections are skipped. QIF has no
+// entry IDs, so each entry gets one derived from its content and its
+// position among identical entries, which makes re-importing the same file a no-op.
+func ParseQIF(r io.Reader, dateOrder string) ([]models.ImportRow, error) {
+	switch dateOrder {
+	case "":
+		dateOrder = DateOrderMDY
+	case DateOrderMDY, DateOrderDMY, DateOrderYMD:
+	default:
+		return nil, ErrInvalidDateOrder
+	}
+
+	decoded, err := DecodeReader(r, "utf-8")
+	if err != nil {
+		return nil, err
+	}
+	sc := bufio.NewScanner(decoded)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var (
+		rows    []models.ImportRow
+		entry   = qifEntry{}
+		section = ""
+		lineNo  = 0
+		seen    = map[string]int{}
+	)
+	for sc.Scan() {
+		lineNo++
+		line := strings.TrimRight(sc.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		if line[0] == '!' {
+			header := strings.ToLower(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(header, "!type:"):
+				section = strings.TrimSpace(strings.TrimPrefix(header, "!type:"))
+			case strings.HasPrefix(header, "!option") || strings.HasPrefix(header, "!clear"):
+			default:
+				section = header // !Account and friends describe lists, not entries
+			}
+			entry = qifEntry{}
+			continue
+		}
+		if !qifTransactionSection(section) {
+			continue
+		}
+
+		if entry.line == 0 {
+			entry.line = lineNo
+		}
+		code, value := line[0], strings.TrimSpace(line[1:])
+		switch code {
+		case 'D':
+			entry.date = value
+		case 'T', 'U':
+			if entry.amount == "" {
+				entry.amount = value
+			}
+		case 'P':
+			entry.payee = value
+		case 'M':
+			entry.memo = value
+		case 'L':
+			entry.category = value
+		case 'S':
+			entry.splits = append(entry.splits, qifSplit{category: value})
+		case 'E':
+			if n := len(entry.splits); n > 0 {
+				entry.splits[n-1].memo = value
+			}
+		case '$':
+			if n := len(entry.splits); n > 0 {
+				entry.splits[n-1].amount = value
+			}
+		case '^':
+			row := qifRow(entry, dateOrder)
+			key := row.Transaction.ExternalID
+			seen[key]++
+			row.Transaction.ExternalID = fmt.Sprintf("qif:%s:%d", key, seen[key])
+			rows = append(rows, row)
+			entry = qifEntry{}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedImport, err)
+	}
+
+	if len(rows) == 0 {
+		return nil, ErrEmptyImportFile
+	}
+	return rows, nil
+}
+
+// qifTransactionSection reports whether a !Type section holds plain transactions
+func qifTransactionSection(section string) bool {
+	switch section {
+	case "bank", "cash", "ccard", "oth a", "oth l":
+		return true
+	}
+	return false
+}
+
+// qifRow maps one QIF entry onto a transaction. The external ID is left as a
+// content hash; the caller makes it unique within the file.
+func qifRow(e qifEntry, dateOrder string) models.ImportRow {
+	row := models.ImportRow{Line: e.line}
+	tx := &row.Transaction
+
+	date, err := parseQIFDate(e.date, dateOrder)
+	if err != nil {
+		row.Errors = append(row.Errors, fmt.Sprintf("date %q is not a %s date", e.date, dateOrder))
+	}
+	tx.Date = date
+
+	amount, err := parseLooseDecimal(e.amount, "")
+	if err != nil {
+		row.Errors = append(row.Errors, fmt.Sprintf("amount %q is not a number", e.amount))
+	}
+	tx.Type = "income"
+	if amount < 0 {
+		tx.Type = "expense"
+	}
+	tx.Amount = amount.Abs()
+	tx.Note = joinNote(e.payee, e.memo)
+	tx.Category = qifCategory(e.category)
+
+	for _, s := range e.splits {
+		a, err := parseLooseDecimal(s.amount, "")
+		if err != nil {
+			row.Errors = append(row.Errors, fmt.Sprintf("split amount %q is not a number", s.amount))
+			continue
+		}
+		if a != 0 && (a < 0) != (amount < 0) {
+			row.Errors = append(row.Errors, "split lines with opposite signs are not supported")
+			break
+		}
+		tx.Splits = append(tx.Splits, models.TransactionSplit{
+			Category: qifCategory(s.category),
+			Amount:   a.Abs(),
+			Note:     s.memo,
+		})
+	}
+	if len(tx.Splits) > 0 && tx.Category == "" {
+		tx.Category = "Split"
+	}
+
+	sum := sha1.Sum([]byte(strings.Join([]string{e.date, e.amount, e.payee, e.memo, e.category}, "\x00")))
+	tx.ExternalID = hex.EncodeToString(sum[:8])
+	return row
+}
+
+// qifCategory drops the class (after /) from a QIF category, turns the
+// Parent:Child separator into " / " and books transfers, which QIF writes as
+// [Account], under Transfer
+func qifCategory(s string) string {
+	s, _, _ = strings.Cut(s, "/")
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]") {
+		return "Transfer"
+	}
+	return strings.ReplaceAll(s, ":", " / ")
+}
+
+// parseQIFDate reads dates such as 1/5/24, 01/05/2024, 1/5'24 or 05.01.2024
+// in the given order. Two digit years are 19xx from 70 on, except after an
+// apostrophe, which Quicken writes for years from 2000.
+func parseQIFDate(s string, order string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	apostrophe := strings.Contains(s, "'")
+	parts := strings.FieldsFunc(s, func(r rune) bool {
+		return r == '/' || r == '.' || r == '-' || r == '\'' || r == ' '
+	})
+	if len(parts) != 3 {
+		return time.Time{}, fmt.Errorf("date needs three parts")
+	}
+
+	n := make([]int, 3)
+	for i, p := range parts {
+		v, err := strconv.Atoi(p)
+		if err != nil {
+			return time.Time{}, err
+		}
+		n[i] = v
+	}
+
+	var year, month, day int
+	switch order {
+	case DateOrderDMY:
+		day, month, year = n[0], n[1], n[2]
+	case DateOrderYMD:
+		year, month, day = n[0], n[1], n[2]
+	default:
+		month, day, year = n[0], n[1], n[2]
+	}
+	if year < 100 {
+		switch {
+		case apostrophe || year < 70:
+			year += 2000
+		default:
+			year += 1900
+		}
+	}
+
+	t := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if t.Day() != day || int(t.Month()) != month {
+		return time.Time{}, fmt.Errorf("no such day")
+	}
+	return t, nil
+}
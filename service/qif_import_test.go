@@ -0,0 +1,171 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"tracker/money"
+)
+
+const qifFile = `!Account
+NChecking
+TBank
+^
+!Type:Bank
+D02/03'26
+T-23.90
+PAcme Markt
+MCard 4411
+LFood:Groceries/Household
+^
+D02/04'26
+T1,250.00
+PEmployer
+LSalary
+^
+D02/05'26
+T-100.00
+PTransfer
+L[Savings]
+^
+D02/06'26
+T-60.00
+PDrugstore
+SHousehold
+$-40.00
+SHealth:Pharmacy
+EAspirin
+$-20.00
+^
+D02/03'26
+T-23.90
+PAcme Markt
+MCard 4411
+LFood:Groceries/Household
+^
+!Type:Invst
+D02/07'26
+NBuy
+T-500.00
+^
+`
+
+func TestParseQIF(t *testing.T) {
+	rows, err := ParseQIF(strings.NewReader(qifFile), DateOrderMDY)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		line     int
+		day      int
+		typ      string
+		amount   string
+		note     string
+		category string
+		splits   int
+	}{
+		{6, 3, "expense", "23.90", "Acme Markt - Card 4411", "Food / Groceries", 0},
+		{12, 4, "income", "1250.00", "Employer", "Salary", 0},
+		{17, 5, "expense", "100.00", "Transfer", "Transfer", 0},
+		{22, 6, "expense", "60.00", "Drugstore", "Split", 2},
+		{31, 3, "expense", "23.90", "Acme Markt - Card 4411", "Food / Groceries", 0},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("got %d rows, want %d", len(rows), len(want))
+	}
+	for i, w := range want {
+		row, tx := rows[i], rows[i].Transaction
+		if len(row.Errors) > 0 {
+			t.Errorf("row %d: unexpected errors %v", i, row.Errors)
+		}
+		if row.Line != w.line || !tx.Date.Equal(time.Date(2026, time.February, w.day, 0, 0, 0, 0, time.UTC)) {
+			t.Errorf("row %d = line %d date %s, want line %d day %d", i, row.Line, tx.Date, w.line, w.day)
+		}
+		if tx.Type != w.typ || tx.Amount != money.MustParse(w.amount) || tx.Note != w.note || tx.Category != w.category || len(tx.Splits) != w.splits {
+			t.Errorf("row %d = %s %s %q %q %d splits, want %s %s %q %q %d splits",
+				i, tx.Type, tx.Amount, tx.Note, tx.Category, len(tx.Splits), w.typ, w.amount, w.note, w.category, w.splits)
+		}
+	}
+
+	splits := rows[3].Transaction.Splits
+	if splits[1].Category != "Health / Pharmacy" || splits[1].Amount != money.MustParse("20.00") || splits[1].Note != "Aspirin" {
+		t.Errorf("split = %+v, want Health / Pharmacy 20.00 Aspirin", splits[1])
+	}
+
+	// Identical entries get distinct IDs, and the same ones on every import
+	if rows[0].Transaction.ExternalID == rows[4].Transaction.ExternalID {
+		t.Errorf("identical entries share the external ID %s", rows[0].Transaction.ExternalID)
+	}
+	again, err := ParseQIF(strings.NewReader(qifFile), DateOrderMDY)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range rows {
+		if again[i].Transaction.ExternalID != rows[i].Transaction.ExternalID {
+			t.Errorf("row %d: external ID %s on the second parse, want %s", i, again[i].Transaction.ExternalID, rows[i].Transaction.ExternalID)
+		}
+	}
+}
+
+func TestParseQIFEntryErrors(t *testing.T) {
+	tests := []struct {
+		name, entry string
+	}{
+		{"bad date", "D31/31/26\nT-1.00\n^\n"},
+		{"bad amount", "D01/31/26\nTten\n^\n"},
+		{"bad split amount", "D01/31/26\nT-1.00\nSFood\n$one\n^\n"},
+		{"opposite split signs", "D01/31/26\nT-1.00\nSFood\n$-2.00\nSRefund\n$1.00\n^\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := ParseQIF(strings.NewReader("!Type:Bank\n"+tt.entry), DateOrderMDY)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rows) != 1 || len(rows[0].Errors) != 1 {
+				t.Fatalf("rows = %+v, want one row with one error", rows)
+			}
+		})
+	}
+
+	if _, err := ParseQIF(strings.NewReader("!Type:Bank\nD01/31/26\n^\n"), "dym"); !errors.Is(err, ErrInvalidDateOrder) {
+		t.Errorf("unknown date order: err = %v, want ErrInvalidDateOrder", err)
+	}
+	if _, err := ParseQIF(strings.NewReader("!Type:Cat\nNFood\n^\n"), ""); !errors.Is(err, ErrEmptyImportFile) {
+		t.Errorf("category list only: err = %v, want ErrEmptyImportFile", err)
+	}
+}
+
+func TestParseQIFDate(t *testing.T) {
+	tests := []struct {
+		in, order string
+		want      time.Time
+	}{
+		{"1/5/26", DateOrderMDY, time.Date(2026, time.January, 5, 0, 0, 0, 0, time.UTC)},
+		{"01/05/2026", DateOrderMDY, time.Date(2026, time.January, 5, 0, 0, 0, 0, time.UTC)},
+		{"1/5'26", DateOrderMDY, time.Date(2026, time.January, 5, 0, 0, 0, 0, time.UTC)},
+		{"1/5/99", DateOrderMDY, time.Date(1999, time.January, 5, 0, 0, 0, 0, time.UTC)},
+		{"1/5'99", DateOrderMDY, time.Date(2099, time.January, 5, 0, 0, 0, 0, time.UTC)},
+		{"05.01.2026", DateOrderDMY, time.Date(2026, time.January, 5, 0, 0, 0, 0, time.UTC)},
+		{"2026-01-05", DateOrderYMD, time.Date(2026, time.January, 5, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, err := parseQIFDate(tt.in, tt.order)
+		if err != nil {
+			t.Errorf("parseQIFDate(%q, %s): %v", tt.in, tt.order, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("parseQIFDate(%q, %s) = %s, want %s", tt.in, tt.order, got, tt.want)
+		}
+	}
+
+	for _, in := range []string{"", "1/5", "2/30/26", "13/1/26", "a/b/c"} {
+		if _, err := parseQIFDate(in, DateOrderMDY); err == nil {
+			t.Errorf("parseQIFDate(%q) succeeded", in)
+		}
+	}
+}
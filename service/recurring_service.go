@@ -0,0 +1,361 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"tracker/models"
+	"tracker/repository"
+)
+
+var (
+	ErrRecurringNotFound    = errors.New("recurring transaction not found")
+	ErrInvalidFrequency     = errors.New("frequency must be daily, weekly, monthly or yearly")
+	ErrInvalidInterval      = errors.New("interval must be at least 1")
+	ErrInvalidDayOfMonth    = errors.New("day_of_month must be between 1 and 31 and is only valid for monthly schedules")
+	ErrInvalidRecurringEnd  = errors.New("end_date must not be before start_date and count must not be negative")
+	ErrLastBusinessDayUsage = errors.New("last_business_day is only valid for monthly schedules")
+)
+
+// A template whose occurrences fail the checks is retried after
+// recurringRetryDelay, doubling with every failure in a row, and stopped after
+// maxRecurringFailures until the user updates it
+const (
+	recurringRetryDelay  = time.Hour
+	maxRecurringFailures = 8
+)
+
+const (
+	FrequencyDaily   = "daily"
+	FrequencyWeekly  = "weekly"
+	FrequencyMonthly = "monthly"
+	FrequencyYearly  = "yearly"
+)
+
+type RecurringService struct {
+	Repo         repository.RecurringRepository
+	Alerts       *AlertService       // optional, evaluates budget thresholds for booked occurrences
+	Accounts     *AccountService     // optional, checks the account occurrences are booked on
+	Categories   *CategoryService    // optional, links templates to their categories
+	Transactions *TransactionService // optional, checks and completes occurrences like manual entries
+}
+
+// CreateRecurring validates a schedule and stores it
+func (s *RecurringService) CreateRecurring(rt *models.RecurringTransaction) error {
+	if err := validateRecurring(rt); err != nil {
+		return err
+	}
+	if err := s.checkAccount(rt); err != nil {
+		return err
+	}
+	if err := s.assignCategory(rt, false); err != nil {
+		return err
+	}
+	resetSchedule(rt)
+	return s.Repo.CreateRecurring(rt)
+}
+
+// GetRecurringByUserID fetches all recurring transactions for a user
+func (s *RecurringService) GetRecurringByUserID(userID uint) ([]models.RecurringTransaction, error) {
+	return s.Repo.GetRecurringByUserID(userID)
+}
+
+// GetRecurringByID fetches a recurring transaction owned by the user
+func (s *RecurringService) GetRecurringByID(id uint, userID uint) (*models.RecurringTransaction, error) {
+	if !s.Repo.CheckRecurringExistsForUser(id, userID) {
+		return nil, ErrRecurringNotFound
+	}
+	return s.Repo.GetRecurringByID(id)
+}
+
+// UpdateRecurring replaces the template and schedule of a recurring transaction.
+// Occurrences that were already booked stay put; the new schedule only books
+// dates after the last one.
+func (s *RecurringService) UpdateRecurring(rt *models.RecurringTransaction) error {
+	if err := validateRecurring(rt); err != nil {
+		return err
+	}
+
+	existing, err := s.GetRecurringByID(rt.ID, rt.UserID)
+	if err != nil {
+		return err
+	}
+	if err := s.checkAccount(rt); err != nil {
+		return err
+	}
+	if err := s.assignCategory(rt, true); err != nil {
+		return err
+	}
+
+	rt.CreatedAt = existing.CreatedAt
+	rt.Generated = existing.Generated
+	rt.LastRun = existing.LastRun
+	resetSchedule(rt)
+	return s.Repo.UpdateRecurring(rt)
+}
+
+// DeleteRecurring stops a recurring transaction; booked occurrences are kept
+func (s *RecurringService) DeleteRecurring(id uint, userID uint) error {
+	if !s.Repo.CheckRecurringExistsForUser(id, userID) {
+		return ErrRecurringNotFound
+	}
+
+	log.Printf("Recurring transaction with ID %d found for user %d, proceeding to delete", id, userID)
+	return s.Repo.DeleteRecurring(id)
+}
+
+// MaterializeDue books every occurrence that is due at now, including the ones
+// missed while the scheduler was not running. Occurrences go through the same
+// checks and hooks as manual entries; a template whose occurrences fail them
+// (an archived account, say) stays where it was and is retried with a growing
+// delay. After maxRecurringFailures runs in a row it is stopped, with the
+// error in LastError, until the user updates it.
+func (s *RecurringService) MaterializeDue(now time.Time) (int, error) {
+	created, err := s.Repo.ProcessDue(now, func(rt *models.RecurringTransaction) []models.Transaction {
+		before := *rt
+		due := advanceSchedule(rt, now)
+		if err := s.prepareOccurrences(due); err != nil {
+			*rt = before
+			recordFailure(rt, now, err)
+			return nil
+		}
+		rt.Failures = 0
+		rt.LastError = ""
+		return due
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	s.afterCreate(created)
+	return len(created), nil
+}
+
+// prepareOccurrences completes due occurrences the way CreateTransaction
+// completes a manual entry
+func (s *RecurringService) prepareOccurrences(due []models.Transaction) error {
+	if s.Transactions == nil {
+		return nil
+	}
+	for i := range due {
+		if err := s.Transactions.prepareTransaction(&due[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// afterCreate runs the hooks of new entries over the booked occurrences
+func (s *RecurringService) afterCreate(created []models.Transaction) {
+	if s.Transactions != nil {
+		booked := make([]*models.Transaction, len(created))
+		for i := range created {
+			booked[i] = &created[i]
+		}
+		s.Transactions.afterCreate(booked...)
+		return
+	}
+	if s.Alerts != nil {
+		for _, tx := range created {
+			s.Alerts.CheckTransaction(tx)
+		}
+	}
+}
+
+// Run materializes due occurrences right away and then on every tick until ctx is done
+func (s *RecurringService) Run(ctx context.Context, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for {
+		n, err := s.MaterializeDue(time.Now())
+		if err != nil {
+			log.Printf("recurring: %v", err)
+		} else if n > 0 {
+			log.Printf("recurring: booked %d transaction(s)", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// assignCategory links the template to its category; archived categories
+// are only accepted with archived set
+func (s *RecurringService) assignCategory(rt *models.RecurringTransaction, archived bool) error {
+	if s.Categories == nil {
+		return nil
+	}
+	return s.Categories.assignRecurring(rt, archived)
+}
+
+// checkAccount makes sure the optional account belongs to the user and is open,
+// and defaults the currency to the account's or the user's base currency
+func (s *RecurringService) checkAccount(rt *models.RecurringTransaction) error {
+	if rt.AccountID != nil && s.Accounts != nil {
+		if err := s.Accounts.CheckAccountUsable(*rt.AccountID, rt.UserID); err != nil {
+			return err
+		}
+	}
+	return s.Accounts.resolveCurrency(&rt.Currency, rt.AccountID, rt.UserID, &rt.Amount)
+}
+
+// advanceSchedule walks the schedule from its saved position up to now and
+// returns the occurrences to book. It leaves rt pointing at the next one.
+func advanceSchedule(rt *models.RecurringTransaction, now time.Time) []models.Transaction {
+	var due []models.Transaction
+	start := truncateDay(rt.StartDate)
+
+	for {
+		occ := occurrenceAt(rt, rt.NextIndex)
+
+		// Skip dates before the start or already covered by an earlier schedule
+		if occ.Before(start) || (rt.LastRun != nil && !occ.After(*rt.LastRun)) {
+			rt.NextIndex++
+			continue
+		}
+
+		if (rt.Count > 0 && rt.Generated >= rt.Count) || (rt.EndDate != nil && occ.After(truncateDay(*rt.EndDate))) {
+			rt.NextRun = nil
+			return due
+		}
+
+		if occ.After(now) {
+			rt.NextRun = &occ
+			return due
+		}
+
+		id := rt.ID
+		due = append(due, models.Transaction{
+			UserID:      rt.UserID,
+			Type:        rt.Type,
+			Category:    rt.Category,
+			CategoryID:  rt.CategoryID,
+			Amount:      rt.Amount,
+			Currency:    rt.Currency,
+			Note:        rt.Note,
+			AccountID:   rt.AccountID,
+			Date:        occ,
+			RecurringID: &id,
+		})
+		rt.Generated++
+		rt.NextIndex++
+		rt.LastRun = &occ
+	}
+}
+
+// occurrenceAt returns the n-th date of the schedule counted from the start
+// date's period. Some of the first dates may fall before the start date.
+func occurrenceAt(rt *models.RecurringTransaction, n int) time.Time {
+	start := truncateDay(rt.StartDate)
+	step := n * rt.Interval
+
+	switch rt.Frequency {
+	case FrequencyDaily:
+		return start.AddDate(0, 0, step)
+	case FrequencyWeekly:
+		return start.AddDate(0, 0, 7*step)
+	case FrequencyYearly:
+		return clampedDate(start.Year()+step, start.Month(), start.Day(), start.Location())
+	}
+
+	// monthly
+	first := time.Date(start.Year(), start.Month()+time.Month(step), 1, 0, 0, 0, 0, start.Location())
+	if rt.LastBusinessDay {
+		return lastBusinessDay(first.Year(), first.Month(), first.Location())
+	}
+	day := rt.DayOfMonth
+	if day == 0 {
+		day = start.Day()
+	}
+	return clampedDate(first.Year(), first.Month(), day, first.Location())
+}
+
+// clampedDate builds a date, moving days past the end of the month back to its
+// last day (the 31st becomes the 30th in April, Feb 29 becomes Feb 28)
+func clampedDate(year int, month time.Month, day int, loc *time.Location) time.Time {
+	last := time.Date(year, month+1, 0, 0, 0, 0, 0, loc).Day()
+	if day > last {
+		day = last
+	}
+	return time.Date(year, month, day, 0, 0, 0, 0, loc)
+}
+
+// lastBusinessDay returns the last Monday-Friday of the month
+func lastBusinessDay(year int, month time.Month, loc *time.Location) time.Time {
+	d := time.Date(year, month+1, 0, 0, 0, 0, 0, loc)
+	for d.Weekday() == time.Saturday || d.Weekday() == time.Sunday {
+		d = d.AddDate(0, 0, -1)
+	}
+	return d
+}
+
+// truncateDay drops the time of day
+func truncateDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// recordFailure keeps a failing template at its place in the schedule and
+// pushes its next try back, or stops it once it has failed too often
+func recordFailure(rt *models.RecurringTransaction, now time.Time, err error) {
+	rt.Failures++
+	rt.LastError = err.Error()
+	if rt.Failures >= maxRecurringFailures {
+		log.Printf("recurring: transaction %d of user %d stopped after %d failures: %v", rt.ID, rt.UserID, rt.Failures, err)
+		rt.NextRun = nil
+		return
+	}
+	retry := now.Add(recurringRetryDelay << (rt.Failures - 1))
+	log.Printf("recurring: transaction %d of user %d: %v; retrying at %s", rt.ID, rt.UserID, err, retry.Format(time.RFC3339))
+	rt.NextRun = &retry
+}
+
+// resetSchedule restarts the schedule walk; LastRun keeps booked dates from
+// repeating. It also clears failures, so updating a stopped template resumes it.
+func resetSchedule(rt *models.RecurringTransaction) {
+	rt.NextIndex = 0
+	next := truncateDay(rt.StartDate)
+	rt.NextRun = &next
+	rt.Failures = 0
+	rt.LastError = ""
+}
+
+// validateRecurring fills in defaults and checks the template and schedule
+func validateRecurring(rt *models.RecurringTransaction) error {
+	if err := validateTransactionType(rt.Type); err != nil {
+		return err
+	}
+
+	switch rt.Frequency {
+	case FrequencyDaily, FrequencyWeekly, FrequencyMonthly, FrequencyYearly:
+	default:
+		return ErrInvalidFrequency
+	}
+
+	if rt.Interval == 0 {
+		rt.Interval = 1
+	}
+	if rt.Interval < 0 {
+		return ErrInvalidInterval
+	}
+
+	if rt.DayOfMonth != 0 && (rt.Frequency != FrequencyMonthly || rt.DayOfMonth < 1 || rt.DayOfMonth > 31) {
+		return ErrInvalidDayOfMonth
+	}
+	if rt.LastBusinessDay && rt.Frequency != FrequencyMonthly {
+		return ErrLastBusinessDayUsage
+	}
+
+	if rt.StartDate.IsZero() {
+		rt.StartDate = truncateDay(time.Now())
+	}
+	if rt.Count < 0 || (rt.EndDate != nil && rt.EndDate.Before(truncateDay(rt.StartDate))) {
+		return ErrInvalidRecurringEnd
+	}
+	return nil
+}
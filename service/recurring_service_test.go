@@ -0,0 +1,327 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"tracker/models"
+	"tracker/money"
+	"tracker/repository"
+)
+
+func TestAdvanceScheduleCopiesTemplate(t *testing.T) {
+	accountID := uint(3)
+	categoryID := uint(7)
+	rt := &models.RecurringTransaction{
+		UserID:     1,
+		Type:       "expense",
+		Category:   "Rent",
+		CategoryID: &categoryID,
+		Amount:     money.MustParse("120000"),
+		Currency:   "CHF",
+		Note:       "flat",
+		AccountID:  &accountID,
+		Frequency:  FrequencyMonthly,
+		Interval:   1,
+		StartDate:  date(2026, time.January, 1),
+	}
+	rt.ID = 9
+
+	due := advanceSchedule(rt, date(2026, time.February, 15))
+	if len(due) != 2 {
+		t.Fatalf("got %d occurrences, want 2", len(due))
+	}
+	for _, tx := range due {
+		if tx.Currency != "CHF" {
+			t.Errorf("currency = %q, want CHF", tx.Currency)
+		}
+		if tx.Amount != rt.Amount || tx.Note != rt.Note || tx.Category != rt.Category || tx.UserID != rt.UserID || tx.Type != rt.Type {
+			t.Errorf("occurrence %+v does not match the template", tx)
+		}
+		if tx.AccountID == nil || *tx.AccountID != accountID || tx.CategoryID == nil || *tx.CategoryID != categoryID {
+			t.Errorf("occurrence %+v lost its account or category", tx)
+		}
+		if tx.RecurringID == nil || *tx.RecurringID != rt.ID {
+			t.Errorf("occurrence %+v is not linked to its template", tx)
+		}
+	}
+}
+
+func TestAdvanceSchedule(t *testing.T) {
+	tests := []struct {
+		name     string
+		rt       models.RecurringTransaction
+		now      time.Time
+		want     []time.Time
+		wantNext *time.Time
+	}{
+		{
+			name: "monthly on the 31st clamps to the end of shorter months",
+			rt:   models.RecurringTransaction{Frequency: FrequencyMonthly, Interval: 1, StartDate: date(2026, time.January, 31)},
+			now:  date(2026, time.April, 30),
+			want: []time.Time{date(2026, time.January, 31), date(2026, time.February, 28), date(2026, time.March, 31), date(2026, time.April, 30)},
+		},
+		{
+			name: "every two weeks",
+			rt:   models.RecurringTransaction{Frequency: FrequencyWeekly, Interval: 2, StartDate: date(2026, time.March, 2)},
+			now:  date(2026, time.March, 31),
+			want: []time.Time{date(2026, time.March, 2), date(2026, time.March, 16), date(2026, time.March, 30)},
+		},
+		{
+			name: "last business day skips the weekend",
+			rt:   models.RecurringTransaction{Frequency: FrequencyMonthly, Interval: 1, LastBusinessDay: true, StartDate: date(2026, time.January, 1)},
+			now:  date(2026, time.June, 1),
+			// May 31st 2026 is a Sunday
+			want: []time.Time{date(2026, time.January, 30), date(2026, time.February, 27), date(2026, time.March, 31), date(2026, time.April, 30), date(2026, time.May, 29)},
+		},
+		{
+			name: "day of month after a later start date",
+			rt:   models.RecurringTransaction{Frequency: FrequencyMonthly, Interval: 1, DayOfMonth: 5, StartDate: date(2026, time.January, 20)},
+			now:  date(2026, time.March, 10),
+			want: []time.Time{date(2026, time.February, 5), date(2026, time.March, 5)},
+		},
+		{
+			name: "yearly on Feb 29",
+			rt:   models.RecurringTransaction{Frequency: FrequencyYearly, Interval: 1, StartDate: date(2024, time.February, 29)},
+			now:  date(2026, time.March, 1),
+			want: []time.Time{date(2024, time.February, 29), date(2025, time.February, 28), date(2026, time.February, 28)},
+		},
+		{
+			name:     "count ends the schedule",
+			rt:       models.RecurringTransaction{Frequency: FrequencyDaily, Interval: 1, Count: 2, StartDate: date(2026, time.May, 1)},
+			now:      date(2026, time.May, 10),
+			want:     []time.Time{date(2026, time.May, 1), date(2026, time.May, 2)},
+			wantNext: nil,
+		},
+		{
+			name: "end date is inclusive",
+			rt: models.RecurringTransaction{Frequency: FrequencyDaily, Interval: 3, StartDate: date(2026, time.May, 1),
+				EndDate: func() *time.Time { d := date(2026, time.May, 7); return &d }()},
+			now:  date(2026, time.May, 10),
+			want: []time.Time{date(2026, time.May, 1), date(2026, time.May, 4), date(2026, time.May, 7)},
+		},
+		{
+			name: "already booked dates are not repeated",
+			rt: models.RecurringTransaction{Frequency: FrequencyDaily, Interval: 1, StartDate: date(2026, time.May, 1),
+				LastRun: func() *time.Time { d := date(2026, time.May, 2); return &d }()},
+			now:      date(2026, time.May, 3),
+			want:     []time.Time{date(2026, time.May, 3)},
+			wantNext: func() *time.Time { d := date(2026, time.May, 4); return &d }(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rt := tt.rt
+			due := advanceSchedule(&rt, tt.now)
+			if len(due) != len(tt.want) {
+				t.Fatalf("got %d occurrences, want %d", len(due), len(tt.want))
+			}
+			for i, tx := range due {
+				if !tx.Date.Equal(tt.want[i]) {
+					t.Errorf("occurrence %d on %s, want %s", i, tx.Date.Format("2006-01-02"), tt.want[i].Format("2006-01-02"))
+				}
+			}
+			if tt.wantNext != nil && (rt.NextRun == nil || !rt.NextRun.Equal(*tt.wantNext)) {
+				t.Errorf("next run = %v, want %s", rt.NextRun, tt.wantNext.Format("2006-01-02"))
+			}
+			if rt.Count > 0 && rt.NextRun != nil {
+				t.Errorf("next run = %v after the last occurrence, want none", rt.NextRun)
+			}
+		})
+	}
+}
+
+func TestOccurrenceAt(t *testing.T) {
+	tests := []struct {
+		name string
+		rt   models.RecurringTransaction
+		n    int
+		want time.Time
+	}{
+		{"daily", models.RecurringTransaction{Frequency: FrequencyDaily, Interval: 1, StartDate: date(2026, time.December, 30)}, 3, date(2027, time.January, 2)},
+		{"weekly drops the time of day", models.RecurringTransaction{Frequency: FrequencyWeekly, Interval: 1, StartDate: time.Date(2026, time.March, 2, 18, 0, 0, 0, time.UTC)}, 1, date(2026, time.March, 9)},
+		{"quarterly across new year", models.RecurringTransaction{Frequency: FrequencyMonthly, Interval: 3, StartDate: date(2026, time.November, 30)}, 1, date(2027, time.February, 28)},
+		{"monthly keeps the start day after a short month", models.RecurringTransaction{Frequency: FrequencyMonthly, Interval: 1, StartDate: date(2026, time.January, 30)}, 2, date(2026, time.March, 30)},
+		{"day of month clamps", models.RecurringTransaction{Frequency: FrequencyMonthly, Interval: 1, DayOfMonth: 31, StartDate: date(2026, time.April, 1)}, 0, date(2026, time.April, 30)},
+		{"day of month before the start date", models.RecurringTransaction{Frequency: FrequencyMonthly, Interval: 1, DayOfMonth: 1, StartDate: date(2026, time.April, 15)}, 0, date(2026, time.April, 1)},
+		{"last business day on a Saturday", models.RecurringTransaction{Frequency: FrequencyMonthly, Interval: 1, LastBusinessDay: true, StartDate: date(2026, time.February, 1)}, 0, date(2026, time.February, 27)},
+		{"leap day in a leap year", models.RecurringTransaction{Frequency: FrequencyYearly, Interval: 4, StartDate: date(2024, time.February, 29)}, 1, date(2028, time.February, 29)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := occurrenceAt(&tt.rt, tt.n); !got.Equal(tt.want) {
+				t.Errorf("occurrence %d = %s, want %s", tt.n, got.Format("2006-01-02"), tt.want.Format("2006-01-02"))
+			}
+		})
+	}
+}
+
+func TestValidateRecurring(t *testing.T) {
+	start := date(2026, time.March, 1)
+	before := date(2026, time.February, 28)
+	tests := []struct {
+		name    string
+		rt      models.RecurringTransaction
+		wantErr error
+	}{
+		{"monthly", models.RecurringTransaction{Type: "expense", Frequency: FrequencyMonthly, DayOfMonth: 31, StartDate: start}, nil},
+		{"end on the start date", models.RecurringTransaction{Type: "income", Frequency: FrequencyDaily, StartDate: start, EndDate: &start}, nil},
+		{"no type", models.RecurringTransaction{Frequency: FrequencyDaily, StartDate: start}, ErrInvalidTransactionType},
+		{"unknown frequency", models.RecurringTransaction{Type: "expense", Frequency: "hourly", StartDate: start}, ErrInvalidFrequency},
+		{"negative interval", models.RecurringTransaction{Type: "expense", Frequency: FrequencyDaily, Interval: -1, StartDate: start}, ErrInvalidInterval},
+		{"day of month on a weekly schedule", models.RecurringTransaction{Type: "expense", Frequency: FrequencyWeekly, DayOfMonth: 3, StartDate: start}, ErrInvalidDayOfMonth},
+		{"day of month 32", models.RecurringTransaction{Type: "expense", Frequency: FrequencyMonthly, DayOfMonth: 32, StartDate: start}, ErrInvalidDayOfMonth},
+		{"last business day on a yearly schedule", models.RecurringTransaction{Type: "expense", Frequency: FrequencyYearly, LastBusinessDay: true, StartDate: start}, ErrLastBusinessDayUsage},
+		{"end before start", models.RecurringTransaction{Type: "expense", Frequency: FrequencyDaily, StartDate: start, EndDate: &before}, ErrInvalidRecurringEnd},
+		{"negative count", models.RecurringTransaction{Type: "expense", Frequency: FrequencyDaily, Count: -1, StartDate: start}, ErrInvalidRecurringEnd},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rt := tt.rt
+			err := validateRecurring(&rt)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && rt.Interval != 1 {
+				t.Errorf("interval = %d, want the default 1", rt.Interval)
+			}
+		})
+	}
+}
+
+// memRecurringRepo books due occurrences in memory the way ProcessDue does
+type memRecurringRepo struct {
+	repository.RecurringRepository
+	templates []*models.RecurringTransaction
+	booked    []models.Transaction
+}
+
+func (m *memRecurringRepo) ProcessDue(now time.Time, advance func(rt *models.RecurringTransaction) []models.Transaction) ([]models.Transaction, error) {
+	var created []models.Transaction
+	for _, rt := range m.templates {
+		if rt.NextRun == nil || rt.NextRun.After(now) {
+			continue
+		}
+		created = append(created, advance(rt)...)
+	}
+	m.booked = append(m.booked, created...)
+	return created, nil
+}
+
+func TestMaterializeDueCatchesUp(t *testing.T) {
+	rent := &models.RecurringTransaction{UserID: 1, Type: "expense", Category: "Rent", Amount: money.MustParse("900"),
+		Frequency: FrequencyMonthly, Interval: 1, StartDate: date(2026, time.January, 1)}
+	later := &models.RecurringTransaction{UserID: 1, Type: "income", Category: "Salary", Amount: money.MustParse("3000"),
+		Frequency: FrequencyMonthly, Interval: 1, StartDate: date(2026, time.June, 1)}
+	resetSchedule(rent)
+	resetSchedule(later)
+
+	repo := &memRecurringRepo{templates: []*models.RecurringTransaction{rent, later}}
+	s := &RecurringService{Repo: repo}
+
+	// Every month missed while the scheduler was down is booked on the first run
+	n, err := s.MaterializeDue(date(2026, time.March, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 || rent.Generated != 3 || later.Generated != 0 {
+		t.Fatalf("booked %d occurrences, want the 3 rent payments so far", n)
+	}
+	if rent.NextRun == nil || !rent.NextRun.Equal(date(2026, time.April, 1)) {
+		t.Errorf("next run = %v, want April 1st", rent.NextRun)
+	}
+
+	// Running again before the next date books nothing
+	if n, err := s.MaterializeDue(date(2026, time.March, 31)); err != nil || n != 0 {
+		t.Errorf("second run booked %d, %v, want nothing", n, err)
+	}
+}
+
+func TestMaterializeDuePreparesOccurrences(t *testing.T) {
+	good := &models.RecurringTransaction{UserID: 1, Type: "expense", Category: "Rent", Amount: money.MustParse("900"),
+		Currency: " eur ", Frequency: FrequencyMonthly, Interval: 1, StartDate: date(2026, time.January, 1)}
+	bad := &models.RecurringTransaction{UserID: 1, Type: "expense", Category: "Gym", Amount: money.MustParse("30"),
+		Currency: "EURO", Frequency: FrequencyMonthly, Interval: 1, StartDate: date(2026, time.January, 1)}
+	resetSchedule(good)
+	resetSchedule(bad)
+
+	repo := &memRecurringRepo{templates: []*models.RecurringTransaction{good, bad}}
+	s := &RecurringService{Repo: repo, Transactions: &TransactionService{}}
+
+	n, err := s.MaterializeDue(date(2026, time.February, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 || len(repo.booked) != 2 {
+		t.Fatalf("booked %d occurrences, want the 2 of the valid template", n)
+	}
+	for _, tx := range repo.booked {
+		if tx.Currency != "EUR" {
+			t.Errorf("currency = %q, want it normalized to EUR like a manual entry", tx.Currency)
+		}
+	}
+
+	// The template that failed the checks stays where it was and is retried later
+	if bad.Generated != 0 || bad.NextIndex != 0 || bad.LastRun != nil {
+		t.Errorf("failed template moved on: generated %d, next index %d, last run %v",
+			bad.Generated, bad.NextIndex, bad.LastRun)
+	}
+	if bad.Failures != 1 || bad.LastError == "" {
+		t.Errorf("failures = %d, last error %q, want the failure recorded", bad.Failures, bad.LastError)
+	}
+	if good.Failures != 0 || good.LastError != "" {
+		t.Errorf("valid template has failures = %d, last error %q", good.Failures, good.LastError)
+	}
+}
+
+func TestMaterializeDueBacksOffFailingTemplates(t *testing.T) {
+	rt := &models.RecurringTransaction{UserID: 1, Type: "expense", Category: "Gym", Amount: money.MustParse("30"),
+		Currency: "EURO", Frequency: FrequencyMonthly, Interval: 1, StartDate: date(2026, time.January, 1)}
+	resetSchedule(rt)
+	repo := &memRecurringRepo{templates: []*models.RecurringTransaction{rt}}
+	s := &RecurringService{Repo: repo, Transactions: &TransactionService{}}
+
+	now := date(2026, time.February, 10)
+	for i := 1; i < maxRecurringFailures; i++ {
+		if _, err := s.MaterializeDue(now); err != nil {
+			t.Fatal(err)
+		}
+		want := now.Add(recurringRetryDelay << (i - 1))
+		if rt.Failures != i || rt.NextRun == nil || !rt.NextRun.Equal(want) {
+			t.Fatalf("after %d failures: failures = %d, next run %v, want %v", i, rt.Failures, rt.NextRun, want)
+		}
+
+		// Runs before the retry is due leave the template alone
+		if _, err := s.MaterializeDue(rt.NextRun.Add(-time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+		if rt.Failures != i {
+			t.Fatalf("template retried before its next run: failures = %d, want %d", rt.Failures, i)
+		}
+		now = *rt.NextRun
+	}
+
+	if _, err := s.MaterializeDue(now); err != nil {
+		t.Fatal(err)
+	}
+	if rt.NextRun != nil || rt.Failures != maxRecurringFailures || rt.LastError == "" {
+		t.Fatalf("after %d failures: next run %v, failures %d, last error %q, want the template stopped",
+			maxRecurringFailures, rt.NextRun, rt.Failures, rt.LastError)
+	}
+
+	// Fixing the template resets the schedule, which books the missed occurrences
+	rt.Currency = "EUR"
+	resetSchedule(rt)
+	n, err := s.MaterializeDue(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n == 0 || rt.Failures != 0 || rt.LastError != "" {
+		t.Errorf("fixed template booked %d, failures %d, last error %q", n, rt.Failures, rt.LastError)
+	}
+	if len(repo.booked) == 0 || !repo.booked[0].Date.Equal(date(2026, time.January, 1)) {
+		t.Errorf("booked %v, want the missed occurrences from January on", repo.booked)
+	}
+}
@@ -0,0 +1,458 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"regexp"
+	"strings"
+
+	"tracker/models"
+	"tracker/money"
+	"tracker/repository"
+)
+
+// Match types of a category rule
+const (
+	MatchContains = "contains"
+	MatchRegex    = "regex"
+)
+
+const (
+	DefaultRuleTestLimit = 50
+	MaxRuleTestLimit     = 200
+)
+
+var (
+	ErrRuleNotFound        = errors.New("rule not found")
+	ErrInvalidRuleName     = errors.New("name is required")
+	ErrInvalidMatchType    = errors.New("match_type must be contains or regex")
+	ErrInvalidRulePattern  = errors.New("pattern is not a valid regular expression")
+	ErrInvalidRuleType     = errors.New("type must be income or expense")
+	ErrInvalidRuleAmounts  = errors.New("min_amount must not be greater than max_amount")
+	ErrRuleWithoutCriteria = errors.New("a rule needs a pattern, amount range, account, payee or type")
+	ErrRuleWithoutAction   = errors.New("a rule must set a category or tags")
+)
+
+type RuleService struct {
+	Repo         repository.RuleRepository
+	Transactions repository.TransactionRepository
+	Accounts     *AccountService    // optional, checks the account a rule is limited to
+	Payees       *PayeeService      // optional, checks the payee a rule is limited to
+	Suggestions  *SuggestionService // optional, relearns categories after rules are re-applied
+	Categories   *CategoryService   // optional, links the categories rules assign
+	Tags         *TagService        // optional, resolves the tags rules set
+	FX           *ExchangeService   // optional, supplies the base currency and converts amounts for amount conditions
+}
+
+// CreateRule saves a new rule
+func (s *RuleService) CreateRule(rule *models.CategoryRule) error {
+	if err := s.validateRule(rule); err != nil {
+		return err
+	}
+	return s.Repo.CreateRule(rule)
+}
+
+// GetRulesByUserID fetches the rules of a user in the order they run
+func (s *RuleService) GetRulesByUserID(userID uint) ([]models.CategoryRule, error) {
+	return s.Repo.GetRulesByUserID(userID)
+}
+
+// GetRuleByID fetches a rule owned by the user
+func (s *RuleService) GetRuleByID(id uint, userID uint) (*models.CategoryRule, error) {
+	if !s.Repo.CheckRuleExistsForUser(id, userID) {
+		return nil, ErrRuleNotFound
+	}
+	return s.Repo.GetRuleByID(id)
+}
+
+// UpdateRule updates a rule owned by the user
+func (s *RuleService) UpdateRule(rule *models.CategoryRule) error {
+	existing, err := s.GetRuleByID(rule.ID, rule.UserID)
+	if err != nil {
+		return err
+	}
+	if err := s.validateRule(rule); err != nil {
+		return err
+	}
+	rule.CreatedAt = existing.CreatedAt
+	return s.Repo.UpdateRule(rule)
+}
+
+// DeleteRule deletes a rule owned by the user; what it categorized stays as is
+func (s *RuleService) DeleteRule(id uint, userID uint) error {
+	if !s.Repo.CheckRuleExistsForUser(id, userID) {
+		return ErrRuleNotFound
+	}
+
+	log.Printf("Rule with ID %d found for user %d, proceeding to delete", id, userID)
+	return s.Repo.DeleteRule(id)
+}
+
+// TestRule runs a rule, saved or not, over the user's past transactions
+// without changing any. It counts every match and lists the most recent
+// ones, up to limit, with the category and tags the rule would give them.
+func (s *RuleService) TestRule(rule *models.CategoryRule, limit int) (*models.RuleTestResult, error) {
+	if err := s.validateRule(rule); err != nil {
+		return nil, err
+	}
+	compiled, err := compileRule(*rule)
+	if err != nil {
+		return nil, err
+	}
+	compiled.fx = s.FX
+	if limit <= 0 {
+		limit = DefaultRuleTestLimit
+	}
+	if limit > MaxRuleTestLimit {
+		limit = MaxRuleTestLimit
+	}
+
+	result := &models.RuleTestResult{Matches: []models.RuleMatch{}}
+	filter := models.TransactionFilter{UserID: rule.UserID, SortDesc: true}
+	err = s.Transactions.StreamTransactions(filter, func(tx models.Transaction) error {
+		result.Scanned++
+		if !compiled.matches(&tx) {
+			return nil
+		}
+		result.Matched++
+		if len(result.Matches) >= limit {
+			return nil
+		}
+
+		updated := tx
+		ruleSet{*compiled}.apply(&updated, true)
+		result.Matches = append(result.Matches, models.RuleMatch{
+			TransactionID: tx.ID,
+			Date:          tx.Date.Format("2006-01-02"),
+			Type:          tx.Type,
+			Amount:        tx.Amount,
+			Currency:      tx.Currency,
+			Note:          tx.Note,
+			Category:      tx.Category,
+			NewCategory:   updated.Category,
+			Tags:          tagNames(tx.Tags),
+			NewTags:       tagNames(updated.Tags),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ApplyRules runs the user's rules over the past transactions in the range,
+// optionally on one account, and saves what they change. Categories are only
+// filled in where missing unless overwrite is set; tags are always added.
+func (s *RuleService) ApplyRules(userID uint, rng models.DateRange, accountID *uint, overwrite bool) (*models.RuleApplyResult, error) {
+	rules, err := s.ruleSet(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.RuleApplyResult{}
+	var changed []models.Transaction
+	filter := models.TransactionFilter{UserID: userID, From: rng.From, To: rng.To, AccountID: accountID}
+	err = s.Transactions.StreamTransactions(filter, func(tx models.Transaction) error {
+		result.Scanned++
+		if rules.apply(&tx, overwrite) {
+			changed = append(changed, tx)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	linked := make([]*models.Transaction, len(changed))
+	for i := range changed {
+		linked[i] = &changed[i]
+	}
+	if s.Categories != nil {
+		if err := s.Categories.assignTransactions(userID, linked, true, true); err != nil {
+			return nil, err
+		}
+	}
+	if s.Tags != nil {
+		if err := s.Tags.assignTransactions(userID, linked, true); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.Repo.UpdateCategoriesAndTags(changed); err != nil {
+		return nil, err
+	}
+	if len(changed) > 0 && s.Suggestions != nil {
+		s.Suggestions.Reset(userID)
+	}
+	result.Updated = len(changed)
+	return result, nil
+}
+
+// Categorize runs the user's rules over new transactions of that user,
+// filling in missing categories and adding tags
+func (s *RuleService) Categorize(userID uint, txs ...*models.Transaction) error {
+	rules, err := s.ruleSet(userID)
+	if err != nil {
+		return err
+	}
+	for _, tx := range txs {
+		rules.apply(tx, false)
+	}
+	return nil
+}
+
+// ruleSet loads the user's enabled rules, ready to run
+func (s *RuleService) ruleSet(userID uint) (ruleSet, error) {
+	rules, err := s.Repo.GetRulesByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	var set ruleSet
+	base := ""
+	for _, rule := range rules {
+		if rule.Disabled {
+			continue
+		}
+		compiled, err := compileRule(rule)
+		if err != nil {
+			// Patterns are checked when saved, so this rule predates a change in syntax
+			log.Printf("rule %d: %v", rule.ID, err)
+			continue
+		}
+		compiled.fx = s.FX
+		if compiled.hasAmounts() && compiled.Currency == "" {
+			// Saved before amount conditions had a currency
+			if base == "" {
+				if base, err = s.FX.BaseCurrency(userID); err != nil {
+					return nil, err
+				}
+			}
+			compiled.Currency = base
+		}
+		set = append(set, *compiled)
+	}
+	return set, nil
+}
+
+// validateRule checks a rule and tidies up its fields
+func (s *RuleService) validateRule(rule *models.CategoryRule) error {
+	rule.Name = strings.TrimSpace(rule.Name)
+	rule.Category = strings.TrimSpace(rule.Category)
+	rule.Tags = mergeTags(nil, rule.Tags)
+	if rule.MatchType == "" {
+		rule.MatchType = MatchContains
+	}
+
+	if rule.Name == "" {
+		return ErrInvalidRuleName
+	}
+	if rule.MatchType != MatchContains && rule.MatchType != MatchRegex {
+		return ErrInvalidMatchType
+	}
+	if rule.MatchType == MatchRegex {
+		if _, err := regexp.Compile(rule.Pattern); err != nil {
+			return ErrInvalidRulePattern
+		}
+	}
+	if rule.Type != "" {
+		if err := validateTransactionType(rule.Type); err != nil {
+			return ErrInvalidRuleType
+		}
+	}
+	if rule.MinAmount != nil && rule.MaxAmount != nil && *rule.MinAmount > *rule.MaxAmount {
+		return ErrInvalidRuleAmounts
+	}
+	if err := s.resolveCurrency(rule); err != nil {
+		return err
+	}
+	if rule.Pattern == "" && rule.MinAmount == nil && rule.MaxAmount == nil && rule.AccountID == nil && rule.PayeeID == nil && rule.Type == "" {
+		return ErrRuleWithoutCriteria
+	}
+	if rule.Category == "" && len(rule.Tags) == 0 {
+		return ErrRuleWithoutAction
+	}
+	if rule.AccountID != nil && s.Accounts != nil {
+		if _, err := s.Accounts.GetAccountByID(*rule.AccountID, rule.UserID); err != nil {
+			return err
+		}
+	}
+	if rule.PayeeID != nil && s.Payees != nil {
+		if _, err := s.Payees.GetPayeeByID(*rule.PayeeID, rule.UserID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveCurrency settles the currency of the rule's amount conditions, the
+// user's base currency unless one was given; rules without amounts have none
+func (s *RuleService) resolveCurrency(rule *models.CategoryRule) error {
+	var amounts []*money.Amount
+	for _, a := range []*money.Amount{rule.MinAmount, rule.MaxAmount} {
+		if a != nil {
+			amounts = append(amounts, a)
+		}
+	}
+	if len(amounts) == 0 {
+		rule.Currency = ""
+		return nil
+	}
+	return s.FX.ResolveCurrency(&rule.Currency, rule.UserID, amounts...)
+}
+
+// compiledRule is a rule with its pattern prepared for matching
+type compiledRule struct {
+	models.CategoryRule
+	re       *regexp.Regexp
+	contains string           // lower-cased pattern of a contains rule
+	fx       *ExchangeService // converts amounts into the rule's currency
+}
+
+// hasAmounts reports whether the rule has an amount condition
+func (c *compiledRule) hasAmounts() bool {
+	return c.MinAmount != nil || c.MaxAmount != nil
+}
+
+func compileRule(rule models.CategoryRule) (*compiledRule, error) {
+	c := &compiledRule{CategoryRule: rule}
+	if rule.Pattern == "" {
+		return c, nil
+	}
+	if rule.MatchType == MatchRegex {
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		c.re = re
+		return c, nil
+	}
+	c.contains = strings.ToLower(rule.Pattern)
+	return c, nil
+}
+
+// matches reports whether the transaction meets every condition of the
+// rule; transfers never do
+func (c *compiledRule) matches(tx *models.Transaction) bool {
+	if tx.Type == TypeTransfer {
+		return false
+	}
+	if c.Type != "" && tx.Type != c.Type {
+		return false
+	}
+	if c.AccountID != nil && (tx.AccountID == nil || *tx.AccountID != *c.AccountID) {
+		return false
+	}
+	if c.PayeeID != nil && (tx.PayeeID == nil || *tx.PayeeID != *c.PayeeID) {
+		return false
+	}
+	if c.hasAmounts() {
+		amount, err := c.fx.Convert(tx.Amount, tx.Currency, c.Currency, tx.Date)
+		if err != nil {
+			return false
+		}
+		if c.MinAmount != nil && amount < *c.MinAmount {
+			return false
+		}
+		if c.MaxAmount != nil && amount > *c.MaxAmount {
+			return false
+		}
+	}
+	switch {
+	case c.re != nil:
+		return c.re.MatchString(tx.Note)
+	case c.contains != "":
+		return strings.Contains(strings.ToLower(tx.Note), c.contains)
+	}
+	return true
+}
+
+// ruleSet is a user's rules in the order they run
+type ruleSet []compiledRule
+
+// apply gives the transaction the category of the first matching rule that
+// sets one, and the tags of every matching rule. A category already present
+// is only replaced with overwrite set; split transactions keep theirs. It
+// reports whether anything changed.
+func (rs ruleSet) apply(tx *models.Transaction, overwrite bool) bool {
+	categorySet := len(tx.Splits) > 0 || (hasCategory(tx) && !overwrite)
+	var tags []string
+	changed := false
+	for i := range rs {
+		rule := &rs[i]
+		if !rule.matches(tx) {
+			continue
+		}
+		if !categorySet && rule.Category != "" {
+			categorySet = true
+			if tx.Category != rule.Category {
+				tx.Category = rule.Category
+				tx.CategoryID = nil // linked again by name
+				changed = true
+			}
+		}
+		tags = append(tags, rule.Tags...)
+	}
+
+	if added := addTags(tx.Tags, tags); len(added) != len(tx.Tags) {
+		tx.Tags = added
+		changed = true
+	}
+	return changed
+}
+
+// hasCategory reports whether a transaction was given a category; one picked
+// by ID alone has no name yet but is set all the same
+func hasCategory(tx *models.Transaction) bool {
+	return !isUncategorized(tx.Category) || (strings.TrimSpace(tx.Category) == "" && tx.CategoryID != nil)
+}
+
+// isUncategorized reports whether a category is missing or the import default
+func isUncategorized(category string) bool {
+	category = strings.TrimSpace(category)
+	return category == "" || category == DefaultImportCategory
+}
+
+// addTags returns the tags with the names not yet among them, ignoring case,
+// added as new tags; the given slice is left as is
+func addTags(tags []models.Tag, names []string) []models.Tag {
+	added := append([]models.Tag{}, tags...)
+	for _, name := range mergeTags(nil, names) {
+		present := false
+		for _, tag := range added {
+			if strings.EqualFold(tag.Name, name) {
+				present = true
+				break
+			}
+		}
+		if !present {
+			added = append(added, models.Tag{Name: name})
+		}
+	}
+	return added
+}
+
+// tagNames lists the names of tags
+func tagNames(tags []models.Tag) []string {
+	var names []string
+	for _, tag := range tags {
+		names = append(names, tag.Name)
+	}
+	return names
+}
+
+// mergeTags adds the tags not yet present, ignoring case, to the existing
+// ones; blank tags are dropped
+func mergeTags(existing []string, add []string) []string {
+	seen := map[string]bool{}
+	var merged []string
+	for _, tag := range append(append([]string{}, existing...), add...) {
+		tag = strings.TrimSpace(tag)
+		key := strings.ToLower(tag)
+		if tag == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		merged = append(merged, tag)
+	}
+	return merged
+}
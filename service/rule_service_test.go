@@ -0,0 +1,241 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"tracker/models"
+	"tracker/money"
+	"tracker/repository"
+
+	"gorm.io/gorm"
+)
+
+// memRuleRepo serves a fixed set of rules
+type memRuleRepo struct {
+	repository.RuleRepository
+	rules []models.CategoryRule
+}
+
+func (m *memRuleRepo) GetRulesByUserID(userID uint) ([]models.CategoryRule, error) {
+	return m.rules, nil
+}
+
+func TestRuleMatches(t *testing.T) {
+	ten, fifty := money.MustParse("10.00"), money.MustParse("50.00")
+	checking, savings := uint(1), uint(2)
+	acme, other := uint(7), uint(8)
+	tx := models.Transaction{Type: "expense", Amount: money.MustParse("23.90"), Note: "CARD 4411 ACME Markt Berlin", AccountID: &checking, PayeeID: &acme}
+
+	tests := []struct {
+		name string
+		rule models.CategoryRule
+		want bool
+	}{
+		{"contains ignores case", models.CategoryRule{MatchType: MatchContains, Pattern: "acme markt"}, true},
+		{"contains misses", models.CategoryRule{MatchType: MatchContains, Pattern: "rewe"}, false},
+		{"regex", models.CategoryRule{MatchType: MatchRegex, Pattern: `^CARD \d+ ACME`}, true},
+		{"regex is case sensitive", models.CategoryRule{MatchType: MatchRegex, Pattern: `^card`}, false},
+		{"amount in range", models.CategoryRule{MinAmount: &ten, MaxAmount: &fifty}, true},
+		{"amount below range", models.CategoryRule{MinAmount: &fifty}, false},
+		{"account", models.CategoryRule{AccountID: &checking}, true},
+		{"other account", models.CategoryRule{AccountID: &savings}, false},
+		{"payee", models.CategoryRule{PayeeID: &acme}, true},
+		{"other payee", models.CategoryRule{PayeeID: &other}, false},
+		{"type", models.CategoryRule{Type: "income"}, false},
+		{"all conditions", models.CategoryRule{Pattern: "acme", PayeeID: &acme, AccountID: &checking, MaxAmount: &fifty, Type: "expense"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := compileRule(tt.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := c.matches(&tx); got != tt.want {
+				t.Errorf("matches = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	transfer := tx
+	transfer.Type = TypeTransfer
+	c, _ := compileRule(models.CategoryRule{Pattern: "acme"})
+	if c.matches(&transfer) {
+		t.Error("rule matched a transfer")
+	}
+}
+
+func TestRuleSetApply(t *testing.T) {
+	rules := []models.CategoryRule{
+		{Pattern: "acme", Category: "Groceries", Tags: []string{"food"}},
+		{Pattern: "markt", Category: "Shopping", Tags: []string{"Food", "weekly"}},
+		{Pattern: "rewe", Category: "Groceries"},
+	}
+	var set ruleSet
+	for _, r := range rules {
+		c, err := compileRule(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		set = append(set, *c)
+	}
+
+	tests := []struct {
+		name         string
+		tx           models.Transaction
+		overwrite    bool
+		wantCategory string
+		wantTags     string
+		wantChanged  bool
+	}{
+		{"first category wins, tags of all rules", models.Transaction{Type: "expense", Note: "ACME Markt"}, false, "Groceries", "food,weekly", true},
+		{"import default is replaced", models.Transaction{Type: "expense", Note: "ACME", Category: DefaultImportCategory}, false, "Groceries", "food", true},
+		{"category kept without overwrite", models.Transaction{Type: "expense", Note: "ACME", Category: "Gifts"}, false, "Gifts", "food", true},
+		{"category replaced with overwrite", models.Transaction{Type: "expense", Note: "ACME", Category: "Gifts"}, true, "Groceries", "food", true},
+		{"splits keep their categories", models.Transaction{Type: "expense", Note: "REWE", Splits: []models.TransactionSplit{{Category: "Food"}}}, true, "", "", false},
+		{"tags already present", models.Transaction{Type: "expense", Note: "ACME", Category: "Groceries", Tags: []models.Tag{{Name: "FOOD"}}}, false, "Groceries", "FOOD", false},
+		{"no rule matches", models.Transaction{Type: "expense", Note: "Kiosk"}, false, "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := tt.tx
+			changed := set.apply(&tx, tt.overwrite)
+			if changed != tt.wantChanged || tx.Category != tt.wantCategory {
+				t.Errorf("apply = %v, category %q, want %v, %q", changed, tx.Category, tt.wantChanged, tt.wantCategory)
+			}
+			if got := strings.Join(tagNames(tx.Tags), ","); got != tt.wantTags {
+				t.Errorf("tags = %q, want %q", got, tt.wantTags)
+			}
+		})
+	}
+}
+
+func TestValidateRule(t *testing.T) {
+	one, two := money.MustParse("1.00"), money.MustParse("2.00")
+	tests := []struct {
+		name    string
+		rule    models.CategoryRule
+		wantErr error
+	}{
+		{"contains", models.CategoryRule{Name: "acme", Pattern: "acme", Category: "Food"}, nil},
+		{"tags only", models.CategoryRule{Name: "acme", Type: "expense", Tags: []string{"food"}}, nil},
+		{"no name", models.CategoryRule{Name: " ", Pattern: "acme", Category: "Food"}, ErrInvalidRuleName},
+		{"unknown match type", models.CategoryRule{Name: "acme", MatchType: "glob", Pattern: "acme*", Category: "Food"}, ErrInvalidMatchType},
+		{"bad regex", models.CategoryRule{Name: "acme", MatchType: MatchRegex, Pattern: "acme(", Category: "Food"}, ErrInvalidRulePattern},
+		{"unknown type", models.CategoryRule{Name: "acme", Type: "transfer", Category: "Food"}, ErrInvalidRuleType},
+		{"amounts swapped", models.CategoryRule{Name: "acme", MinAmount: &two, MaxAmount: &one, Category: "Food"}, ErrInvalidRuleAmounts},
+		{"no conditions", models.CategoryRule{Name: "acme", Category: "Food"}, ErrRuleWithoutCriteria},
+		{"no actions", models.CategoryRule{Name: "acme", Pattern: "acme", Tags: []string{" "}}, ErrRuleWithoutAction},
+	}
+	s := &RuleService{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := tt.rule
+			if err := s.validateRule(&rule); !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCategorizeSkipsDisabledRules(t *testing.T) {
+	s := &RuleService{Repo: &memRuleRepo{rules: []models.CategoryRule{
+		{Name: "old", Pattern: "acme", Category: "Shopping", Disabled: true},
+		{Name: "acme", Pattern: "acme", Category: "Groceries"},
+	}}}
+
+	tx := models.Transaction{UserID: 1, Type: "expense", Note: "CARD 4411 ACME MARKT", Category: DefaultImportCategory}
+	if err := s.Categorize(1, &tx); err != nil {
+		t.Fatal(err)
+	}
+	if tx.Category != "Groceries" {
+		t.Errorf("category = %q, want Groceries", tx.Category)
+	}
+}
+
+func TestRuleAmountsInCurrency(t *testing.T) {
+	fx := &ExchangeService{Repo: &memRateRepo{rates: map[string]float64{"USD": 1.25, "JPY": 160}}}
+	ten, fifty := money.MustParse("10.00"), money.MustParse("50.00")
+	rule := models.CategoryRule{MinAmount: &ten, MaxAmount: &fifty, Currency: "EUR"}
+	day := date(2026, time.March, 2)
+
+	tests := []struct {
+		name string
+		tx   models.Transaction
+		want bool
+	}{
+		{"same currency", models.Transaction{Amount: money.MustParse("23.90"), Currency: "EUR", Date: day}, true},
+		{"converted into range", models.Transaction{Amount: money.MustParse("60.00"), Currency: "USD", Date: day}, true},       // 48 EUR
+		{"converted out of range", models.Transaction{Amount: money.MustParse("70.00"), Currency: "USD", Date: day}, false},    // 56 EUR
+		{"no decimals abroad", models.Transaction{Amount: money.MustParseIn("1600", "JPY"), Currency: "JPY", Date: day}, true}, // 10 EUR
+		{"raw minor units would match", models.Transaction{Amount: 1200, Currency: "JPY", Date: day}, false},                   // 7.50 EUR
+		{"no rate", models.Transaction{Amount: money.MustParse("20.00"), Currency: "GBP", Date: day}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := compileRule(rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.fx = fx
+			if got := c.matches(&tt.tx); got != tt.want {
+				t.Errorf("matches = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRuleCurrencyDefaultsToBase(t *testing.T) {
+	users := &memUserRepo{users: map[uint]*models.User{1: {BaseCurrency: "JPY"}}}
+	s := &RuleService{FX: &ExchangeService{Users: users}}
+
+	min := money.MustParse("1000")
+	rule := models.CategoryRule{UserID: 1, Name: "big", MinAmount: &min, Category: "Large"}
+	if err := s.validateRule(&rule); err != nil {
+		t.Fatal(err)
+	}
+	if rule.Currency != "JPY" || *rule.MinAmount != 1000 {
+		t.Errorf("currency %q, min amount %d, want 1000 JPY", rule.Currency, *rule.MinAmount)
+	}
+
+	tagged := models.CategoryRule{UserID: 1, Name: "acme", Pattern: "acme", Currency: "EUR", Category: "Food"}
+	if err := s.validateRule(&tagged); err != nil {
+		t.Fatal(err)
+	}
+	if tagged.Currency != "" {
+		t.Errorf("currency = %q, want none without amount conditions", tagged.Currency)
+	}
+
+	// Rules saved before amounts had a currency compare in the base currency
+	s.Repo = &memRuleRepo{rules: []models.CategoryRule{{UserID: 1, Name: "old", MinAmount: &min, Category: "Large"}}}
+	set, err := s.ruleSet(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(set) != 1 || set[0].Currency != "JPY" {
+		t.Fatalf("rule set = %+v, want the old rule in JPY", set)
+	}
+}
+
+func TestRulesMatchPayeesOfNewEntries(t *testing.T) {
+	acme := models.Payee{Model: gorm.Model{ID: 7}, UserID: 1, Name: "Acme",
+		Aliases: []models.PayeeAlias{{MatchType: MatchContains, Pattern: "acme markt"}}}
+	acmeID := acme.ID
+	svc := &TransactionService{
+		Rules:  &RuleService{Repo: &memRuleRepo{rules: []models.CategoryRule{{Name: "acme", PayeeID: &acmeID, Category: "Groceries"}}}},
+		Payees: &PayeeService{Repo: &memPayeeRepo{payees: []models.Payee{acme}}},
+	}
+
+	tx := models.Transaction{UserID: 1, Type: "expense", Amount: money.MustParse("23.90"), Currency: "EUR", Note: "CARD 4411 ACME MARKT BERLIN"}
+	if err := svc.prepareTransaction(&tx); err != nil {
+		t.Fatal(err)
+	}
+	if tx.PayeeID == nil || *tx.PayeeID != acmeID {
+		t.Fatalf("payee = %v, want %d", tx.PayeeID, acmeID)
+	}
+	if tx.Category != "Groceries" {
+		t.Errorf("category = %q, want the payee rule's Groceries", tx.Category)
+	}
+}
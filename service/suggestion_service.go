@@ -0,0 +1,142 @@
+package service
+
+import (
+	"errors"
+	"sync"
+
+	"tracker/models"
+	"tracker/repository"
+)
+
+const (
+	DefaultSuggestionLimit = 3
+	MaxSuggestionLimit     = 10
+
+	// trainingAttempts is how often training starts over because the
+	// user's transactions changed while their history was read
+	trainingAttempts = 3
+)
+
+var ErrSuggestionType = errors.New("type must be income or expense")
+
+// SuggestionService learns from each user's history which category a
+// transaction belongs to. A user's model is trained from every past
+// transaction on first use and then kept up to date as transactions are
+// written; models live in memory and are trained again after a restart.
+type SuggestionService struct {
+	Transactions repository.TransactionRepository
+
+	mu     sync.Mutex
+	models map[uint]*categoryModel
+	writes map[uint]int // changes seen per user, to tell when training raced one
+}
+
+// Suggest ranks the categories of the user's past transactions that the
+// transaction most likely belongs to, best first, at most limit of them
+func (s *SuggestionService) Suggest(tx models.Transaction, limit int) ([]models.CategorySuggestion, error) {
+	if err := validateTransactionType(tx.Type); err != nil {
+		return nil, ErrSuggestionType
+	}
+	if limit <= 0 {
+		limit = DefaultSuggestionLimit
+	}
+	if limit > MaxSuggestionLimit {
+		limit = MaxSuggestionLimit
+	}
+
+	m, err := s.train(tx.UserID)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return m.suggest(tx, limit), nil
+}
+
+// Learn adds written transactions of one user to their model
+func (s *SuggestionService) Learn(txs ...models.Transaction) {
+	s.update(1, txs)
+}
+
+// Forget takes transactions of one user that were changed or deleted back
+// out of their model
+func (s *SuggestionService) Forget(txs ...models.Transaction) {
+	s.update(-1, txs)
+}
+
+// Reset drops a user's model after many transactions changed at once; it is
+// trained again on next use
+func (s *SuggestionService) Reset(userID uint) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.models, userID)
+	s.changed(userID)
+}
+
+func (s *SuggestionService) update(delta int, txs []models.Transaction) {
+	if len(txs) == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.changed(txs[0].UserID)
+
+	// A model not trained yet will read these from the database
+	m := s.models[txs[0].UserID]
+	if m == nil {
+		return
+	}
+	for _, tx := range txs {
+		m.learn(tx, delta)
+	}
+}
+
+// changed counts a change to the user's transactions; the caller holds the lock
+func (s *SuggestionService) changed(userID uint) {
+	if s.writes == nil {
+		s.writes = map[uint]int{}
+	}
+	s.writes[userID]++
+}
+
+// train returns the user's model, building it from their history unless it
+// exists. The history is read without holding the lock; when a write or
+// Reset lands meanwhile, the model may have missed it or seen it twice, so
+// training starts over. After trainingAttempts the last model still answers
+// the request but is not kept, and the next one trains again.
+func (s *SuggestionService) train(userID uint) (*categoryModel, error) {
+	var m *categoryModel
+	for attempt := 0; attempt < trainingAttempts; attempt++ {
+		s.mu.Lock()
+		if stored := s.models[userID]; stored != nil {
+			s.mu.Unlock()
+			return stored, nil
+		}
+		writes := s.writes[userID]
+		s.mu.Unlock()
+
+		m = newCategoryModel()
+		err := s.Transactions.StreamTransactions(models.TransactionFilter{UserID: userID}, func(tx models.Transaction) error {
+			m.learn(tx, 1)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		s.mu.Lock()
+		if s.writes[userID] == writes {
+			if s.models == nil {
+				s.models = map[uint]*categoryModel{}
+			}
+			if s.models[userID] == nil {
+				s.models[userID] = m
+			}
+			m = s.models[userID]
+			s.mu.Unlock()
+			return m, nil
+		}
+		s.mu.Unlock()
+	}
+	return m, nil
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"testing"
+
+	"tracker/models"
+	"tracker/repository"
+)
+
+// streamRepo serves a fixed history and calls during once per stream, in the
+// middle of it, the way a write lands while a model trains
+type streamRepo struct {
+	repository.TransactionRepository
+	history []models.Transaction
+	during  func(stream int)
+	streams int
+}
+
+func (r *streamRepo) StreamTransactions(filter models.TransactionFilter, fn func(models.Transaction) error) error {
+	r.streams++
+	for i, tx := range r.history {
+		if i == len(r.history)/2 && r.during != nil {
+			r.during(r.streams)
+		}
+		if err := fn(tx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestSuggestTrainsOnce(t *testing.T) {
+	repo := &streamRepo{history: []models.Transaction{expense("REWE Markt", "Groceries", "23.90")}}
+	s := &SuggestionService{Transactions: repo}
+
+	for i := 0; i < 2; i++ {
+		got, err := s.Suggest(expense("REWE", "", "20.00"), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 1 || got[0].Category != "Groceries" {
+			t.Fatalf("suggest = %v, want Groceries", got)
+		}
+	}
+	if repo.streams != 1 {
+		t.Errorf("history read %d times, want once", repo.streams)
+	}
+
+	s.Learn(expense("Shell station", "Fuel", "60.00"))
+	if got, _ := s.Suggest(expense("Shell", "", "60.00"), 1); len(got) != 1 || got[0].Category != "Fuel" {
+		t.Errorf("suggest after Learn = %v, want Fuel", got)
+	}
+	s.Reset(1)
+	if _, err := s.Suggest(expense("REWE", "", "20.00"), 1); err != nil {
+		t.Fatal(err)
+	}
+	if repo.streams != 2 {
+		t.Errorf("history read %d times after Reset, want twice", repo.streams)
+	}
+}
+
+func TestSuggestKeepsWritesDuringTraining(t *testing.T) {
+	history := []models.Transaction{
+		expense("REWE Markt", "Groceries", "23.90"),
+		expense("Aldi", "Groceries", "12.10"),
+		expense("Shell station", "Fuel", "60.00"),
+		expense("Aral station", "Fuel", "55.00"),
+	}
+	cinema := expense("Cinema", "Fun", "12.00")
+
+	tests := []struct {
+		name       string
+		history    []models.Transaction
+		during     func(s *SuggestionService, repo *streamRepo, stream int)
+		wantFun    bool
+		wantStored bool
+	}{
+		{
+			name:    "learned while training",
+			history: history,
+			during: func(s *SuggestionService, repo *streamRepo, stream int) {
+				if stream == 1 {
+					repo.history = append(repo.history, cinema)
+					s.Learn(cinema)
+				}
+			},
+			wantFun: true, wantStored: true,
+		},
+		{
+			name:    "forgotten while training",
+			history: append(history[:len(history):len(history)], cinema),
+			during: func(s *SuggestionService, repo *streamRepo, stream int) {
+				if stream == 1 {
+					repo.history = repo.history[:len(repo.history)-1]
+					s.Forget(cinema)
+				}
+			},
+			wantStored: true,
+		},
+		{
+			name:    "writes that never stop",
+			history: history,
+			during: func(s *SuggestionService, repo *streamRepo, stream int) {
+				s.Reset(1)
+			},
+			wantStored: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &streamRepo{history: append([]models.Transaction{}, tt.history...)}
+			s := &SuggestionService{Transactions: repo}
+			repo.during = func(stream int) { tt.during(s, repo, stream) }
+
+			got, err := s.Suggest(expense("Cinema", "", "12.00"), 5)
+			if err != nil {
+				t.Fatal(err)
+			}
+			hasFun := false
+			for _, sg := range got {
+				hasFun = hasFun || sg.Category == "Fun"
+			}
+			if hasFun != tt.wantFun {
+				t.Errorf("suggest = %v, want Fun among them: %v", got, tt.wantFun)
+			}
+			if stored := s.models[1] != nil; stored != tt.wantStored {
+				t.Errorf("model stored = %v, want %v", stored, tt.wantStored)
+			}
+			if repo.streams > trainingAttempts {
+				t.Errorf("history read %d times, want at most %d", repo.streams, trainingAttempts)
+			}
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"strings"
+
+	"tracker/models"
+	"tracker/repository"
+)
+
+var (
+	ErrTagNotFound     = errors.New("tag not found")
+	ErrInvalidTagName  = errors.New("name is required")
+	ErrInvalidTagColor = errors.New("color must be #rrggbb")
+	ErrDuplicateTag    = errors.New("a tag of this name already exists; merge the two instead")
+	ErrTagMergeSelf    = errors.New("a tag cannot be merged into itself")
+	ErrTagInUse        = errors.New("tag is set by a rule; change the rule first")
+)
+
+type TagService struct {
+	Repo repository.TagRepository
+}
+
+// CreateTag creates a new tag
+func (s *TagService) CreateTag(tag *models.Tag) error {
+	if err := s.validateTag(tag); err != nil {
+		return err
+	}
+	return s.Repo.CreateTag(tag)
+}
+
+// GetTagsByUserID fetches the tags of a user
+func (s *TagService) GetTagsByUserID(userID uint) ([]models.Tag, error) {
+	return s.Repo.GetTagsByUserID(userID)
+}
+
+// GetTagByID fetches a tag owned by the user
+func (s *TagService) GetTagByID(id uint, userID uint) (*models.Tag, error) {
+	if !s.Repo.CheckTagExistsForUser(id, userID) {
+		return nil, ErrTagNotFound
+	}
+	return s.Repo.GetTagByID(id)
+}
+
+// UpdateTag renames or recolors a tag owned by the user; rules setting the
+// old name set the new one from then on
+func (s *TagService) UpdateTag(tag *models.Tag) error {
+	existing, err := s.GetTagByID(tag.ID, tag.UserID)
+	if err != nil {
+		return err
+	}
+	if err := s.validateTag(tag); err != nil {
+		return err
+	}
+	tag.CreatedAt = existing.CreatedAt
+	return s.Repo.UpdateTag(tag, existing.Name)
+}
+
+// MergeTags moves everything tagged with one tag of the user over to
+// another and deletes the first. It returns the tag that is kept.
+func (s *TagService) MergeTags(id uint, intoID uint, userID uint) (*models.Tag, error) {
+	if id == intoID {
+		return nil, ErrTagMergeSelf
+	}
+	from, err := s.GetTagByID(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	into, err := s.GetTagByID(intoID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Merging tag %d into tag %d for user %d", id, intoID, userID)
+	if err := s.Repo.MergeTags(from, into); err != nil {
+		return nil, err
+	}
+	return into, nil
+}
+
+// DeleteTag deletes a tag and takes it off every transaction. Tags that a
+// rule sets are kept, as the rule would only bring them back.
+func (s *TagService) DeleteTag(id uint, userID uint) error {
+	tag, err := s.GetTagByID(id, userID)
+	if err != nil {
+		return err
+	}
+
+	count, err := s.Repo.CountRulesWithTag(userID, tag.Name)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrTagInUse
+	}
+
+	log.Printf("Tag with ID %d found for user %d, proceeding to delete", id, userID)
+	return s.Repo.DeleteTag(id)
+}
+
+// validateTag checks a tag and tidies up its fields
+func (s *TagService) validateTag(tag *models.Tag) error {
+	tag.Name = strings.TrimSpace(tag.Name)
+	if tag.Name == "" {
+		return ErrInvalidTagName
+	}
+	if tag.Color != "" && !categoryColor.MatchString(tag.Color) {
+		return ErrInvalidTagColor
+	}
+
+	tags, err := s.Repo.GetTagsByUserID(tag.UserID)
+	if err != nil {
+		return err
+	}
+	for _, other := range tags {
+		if other.ID != tag.ID && strings.EqualFold(other.Name, tag.Name) {
+			return ErrDuplicateTag
+		}
+	}
+	return nil
+}
+
+// assignTransactions resolves the tags of each transaction to the user's
+// tags: by ID when one is given, otherwise by name ignoring case. Each tag
+// then carries its saved name and color, and is listed once. Names the user
+// has no tag for yet are created with create set, and left unresolved
+// without. Transfers are left without tags.
+func (s *TagService) assignTransactions(userID uint, txs []*models.Transaction, create bool) error {
+	var named []*models.Transaction
+	for _, tx := range txs {
+		if tx.Type == TypeTransfer {
+			tx.Tags = nil
+			continue
+		}
+		if len(tx.Tags) > 0 {
+			named = append(named, tx)
+		}
+	}
+	if len(named) == 0 {
+		return nil
+	}
+
+	byID, byName, err := s.index(userID)
+	if err != nil {
+		return err
+	}
+	if create {
+		var missing []models.Tag
+		seen := map[string]bool{}
+		for _, tx := range named {
+			for _, tag := range tx.Tags {
+				name := strings.TrimSpace(tag.Name)
+				key := strings.ToLower(name)
+				if tag.ID != 0 || name == "" || byName[key] != nil || seen[key] {
+					continue
+				}
+				seen[key] = true
+				missing = append(missing, models.Tag{UserID: userID, Name: name})
+			}
+		}
+		if len(missing) > 0 {
+			if err := s.Repo.CreateMissingTags(missing); err != nil {
+				return err
+			}
+			if byID, byName, err = s.index(userID); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, tx := range named {
+		var tags []models.Tag
+		seen := map[string]bool{}
+		for _, tag := range tx.Tags {
+			name := strings.TrimSpace(tag.Name)
+			var found *models.Tag
+			if tag.ID != 0 {
+				if found = byID[tag.ID]; found == nil {
+					return ErrTagNotFound
+				}
+			} else if name == "" {
+				continue
+			} else if found = byName[strings.ToLower(name)]; found == nil {
+				found = &models.Tag{UserID: userID, Name: name}
+			}
+
+			key := strings.ToLower(found.Name)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			tags = append(tags, *found)
+		}
+		tx.Tags = tags
+	}
+	return nil
+}
+
+// index looks up a user's tags by ID and by lower-cased name
+func (s *TagService) index(userID uint) (map[uint]*models.Tag, map[string]*models.Tag, error) {
+	tags, err := s.Repo.GetTagsByUserID(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	byID := map[uint]*models.Tag{}
+	byName := map[string]*models.Tag{}
+	for i := range tags {
+		tag := &tags[i]
+		byID[tag.ID] = tag
+		byName[strings.ToLower(tag.Name)] = tag
+	}
+	return byID, byName, nil
+}
+
+// hasTag reports whether tags holds the tag with the ID
+func hasTag(tags []models.Tag, id uint) bool {
+	for _, tag := range tags {
+		if tag.ID == id {
+			return true
+		}
+	}
+	return false
+}
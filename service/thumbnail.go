@@ -0,0 +1,88 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+
+	// decoders for the image types thumbnails are made of
+	_ "image/gif"
+	_ "image/png"
+)
+
+const (
+	// thumbnailSize bounds the longer side of a thumbnail, in pixels
+	thumbnailSize = 256
+	// maxThumbnailPixels keeps a small file claiming huge dimensions from
+	// being decoded into a huge buffer; 16 MP decode to at most 64 MB
+	maxThumbnailPixels = 16_000_000
+)
+
+var errImageTooLarge = errors.New("image too large for a thumbnail")
+
+// makeThumbnail scales a JPEG, PNG or GIF down to fit thumbnailSize and
+// encodes it as JPEG on a white background. Other formats, such as WebP,
+// give an error.
+func makeThumbnail(data []byte) ([]byte, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > maxThumbnailPixels {
+		return nil, errImageTooLarge
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w > thumbnailSize || h > thumbnailSize {
+		if w >= h {
+			w, h = thumbnailSize, max(1, h*thumbnailSize/b.Dx())
+		} else {
+			w, h = max(1, w*thumbnailSize/b.Dy()), thumbnailSize
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, downscale(src, w, h), &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// downscale resizes an image to w×h by averaging the source pixels that
+// fall into each target pixel. Transparent parts are laid over white, as
+// they would turn black in a JPEG. Only the small target is allocated.
+func downscale(src image.Image, w, h int) *image.RGBA {
+	b := src.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0, y1 := y*sh/h, max((y+1)*sh/h, y*sh/h+1)
+		for x := 0; x < w; x++ {
+			x0, x1 := x*sw/w, max((x+1)*sw/w, x*sw/w+1)
+			var r, g, bl, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					// Colors are alpha-premultiplied, so white shows
+					// through in proportion to the transparency
+					pr, pg, pb, pa := src.At(b.Min.X+sx, b.Min.Y+sy).RGBA()
+					r += uint64(pr + 0xffff - pa)
+					g += uint64(pg + 0xffff - pa)
+					bl += uint64(pb + 0xffff - pa)
+					n++
+				}
+			}
+			i := dst.PixOffset(x, y)
+			dst.Pix[i] = uint8(r / n >> 8)
+			dst.Pix[i+1] = uint8(g / n >> 8)
+			dst.Pix[i+2] = uint8(bl / n >> 8)
+			dst.Pix[i+3] = 0xff
+		}
+	}
+	return dst
+}
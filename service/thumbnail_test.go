@@ -0,0 +1,118 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// pngClaiming returns a PNG whose header claims the given size without
+// holding the pixels
+func pngClaiming(t *testing.T, w, h uint32) []byte {
+	data := encodePNG(t, image.NewGray(image.Rect(0, 0, 1, 1)))
+	// The IHDR chunk follows the 8 byte signature: length, type, width, height, ..., CRC
+	ihdr := data[8+8 : 8+8+13]
+	binary.BigEndian.PutUint32(ihdr[0:], w)
+	binary.BigEndian.PutUint32(ihdr[4:], h)
+	binary.BigEndian.PutUint32(data[8+8+13:], crc32.ChecksumIEEE(data[8+4:8+8+13]))
+	return data
+}
+
+func TestMakeThumbnail(t *testing.T) {
+	opaque := func(w, h int) image.Image {
+		img := image.NewRGBA(image.Rect(0, 0, w, h))
+		for i := range img.Pix {
+			img.Pix[i] = 0x80
+		}
+		return img
+	}
+	var gifBuf bytes.Buffer
+	if err := gif.Encode(&gifBuf, opaque(300, 600), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		data          []byte
+		width, height int
+		err           error
+	}{
+		{name: "wide image fits the width", data: encodePNG(t, opaque(1000, 500)), width: 256, height: 128},
+		{name: "tall gif fits the height", data: gifBuf.Bytes(), width: 128, height: 256},
+		{name: "small image keeps its size", data: encodePNG(t, opaque(40, 30)), width: 40, height: 30},
+		{name: "thin strip keeps a pixel", data: encodePNG(t, opaque(5000, 1)), width: 256, height: 1},
+		{name: "too many pixels", data: pngClaiming(t, 5000, 5000), err: errImageTooLarge},
+		{name: "just over the limit", data: pngClaiming(t, maxThumbnailPixels/1000+1, 1000), err: errImageTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			thumb, err := makeThumbnail(tt.data)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("err = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg, format, err := image.DecodeConfig(bytes.NewReader(thumb))
+			if err != nil || format != "jpeg" {
+				t.Fatalf("thumbnail is not a JPEG: %s, %v", format, err)
+			}
+			if cfg.Width != tt.width || cfg.Height != tt.height {
+				t.Errorf("thumbnail is %dx%d, want %dx%d", cfg.Width, cfg.Height, tt.width, tt.height)
+			}
+		})
+	}
+}
+
+func TestMakeThumbnailFlattensTransparency(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			if x < 32 {
+				img.Set(x, y, color.NRGBA{0, 0, 0, 0xff})
+			}
+			// the right half stays fully transparent
+		}
+	}
+
+	thumb, err := makeThumbnail(encodePNG(t, img))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := jpeg.Decode(bytes.NewReader(thumb))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, g, b, _ := out.At(48, 32).RGBA(); r>>8 < 0xf0 || g>>8 < 0xf0 || b>>8 < 0xf0 {
+		t.Errorf("transparent area is %d,%d,%d, want white", r>>8, g>>8, b>>8)
+	}
+	if r, _, _, _ := out.At(16, 32).RGBA(); r>>8 > 0x10 {
+		t.Errorf("opaque black area is %d, want black", r>>8)
+	}
+}
+
+func TestMakeThumbnailRejectsOtherFormats(t *testing.T) {
+	if _, err := makeThumbnail([]byte("%PDF-1.4\n")); err == nil {
+		t.Error("a PDF was turned into a thumbnail")
+	}
+}
@@ -1,17 +1,134 @@
 package service
 
 import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"strings"
+	"time"
+
 	"tracker/models"
+	"tracker/money"
 	"tracker/repository"
 )
 
+var (
+	ErrTransactionNotFound    = errors.New("transaction not found")
+	ErrInvalidTransactionType = errors.New("type must be income or expense")
+	ErrInvalidCursor          = repository.ErrInvalidCursor
+	ErrInvalidPeriod          = errors.New("period must be this_month, last_month, ytd or custom")
+	ErrCustomPeriodRange      = errors.New("custom period needs both from and to")
+	ErrInvalidSplit           = errors.New("every split needs a category and a positive amount")
+	ErrSplitsMismatch         = errors.New("splits must add up to the transaction amount")
+	ErrTransferSplits         = errors.New("transfers cannot be split")
+	ErrExternalIDTaken        = errors.New("external_id is already used on this account")
+)
+
+const (
+	PeriodThisMonth = "this_month"
+	PeriodLastMonth = "last_month"
+	PeriodYTD       = "ytd"
+	PeriodCustom    = "custom"
+)
+
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 200
+)
+
+const (
+	DefaultTopPayees = 10
+	MaxTopPayees     = 100
+)
+
 type TransactionService struct {
-	Repo repository.TransactionRepository
+	Repo        repository.TransactionRepository
+	Alerts      *AlertService      // optional, evaluates budget thresholds after every write
+	Accounts    *AccountService    // optional, checks the account a transaction is booked on
+	FX          *ExchangeService   // optional, supplies the base currency and converts transfers
+	Budgets     *BudgetService     // optional, adds budgets to journal exports
+	Duplicates  *DuplicateService  // optional, flags likely duplicates of new transactions
+	Rules       *RuleService       // optional, categorizes and tags new transactions
+	Suggestions *SuggestionService // optional, learns categories from every write
+	Categories  *CategoryService   // optional, links transactions to their categories
+	Tags        *TagService        // optional, links transactions to their tags
+	Payees      *PayeeService      // optional, recognizes the payee of transactions
+	Attachments *AttachmentService // optional, removes the attachments of deleted transactions
 }
 
-// CreateTransaction creates a new transaction
+// CreateTransaction creates a new transaction; transfers are booked as two linked legs
 func (t *TransactionService) CreateTransaction(transaction *models.Transaction) error {
-	return t.Repo.CreateTransaction(transaction)
+	if transaction.Type == TypeTransfer {
+		return t.createTransfer(transaction)
+	}
+
+	// Occurrences are only linked by the recurring scheduler
+	transaction.RecurringID = nil
+	if err := t.prepareTransaction(transaction); err != nil {
+		return err
+	}
+	if err := t.checkExternalID(transaction); err != nil {
+		return err
+	}
+	if err := t.Repo.CreateTransaction(transaction); err != nil {
+		return err
+	}
+
+	t.afterCreate(transaction)
+	return nil
+}
+
+// prepareTransaction validates a new income or expense and completes it the
+// way every new entry is: the user's rules, payees, categories and tags are
+// applied and a missing date becomes today. Manual entries and recurring
+// occurrences both go through it before they are saved.
+func (t *TransactionService) prepareTransaction(transaction *models.Transaction) error {
+	if err := validateTransactionType(transaction.Type); err != nil {
+		return err
+	}
+	if err := validateSplits(transaction); err != nil {
+		return err
+	}
+	if err := t.checkAccount(transaction.AccountID, transaction.UserID); err != nil {
+		return err
+	}
+	if err := t.Accounts.resolveCurrency(&transaction.Currency, transaction.AccountID, transaction.UserID, transactionAmounts(transaction)...); err != nil {
+		return err
+	}
+
+	// Payees are linked first, so rules can match on them
+	if err := t.assignPayees(true, transaction); err != nil {
+		return err
+	}
+	t.categorize(transaction)
+	if err := t.assignCategories(true, false, transaction); err != nil {
+		return err
+	}
+	if err := t.assignTags(true, transaction); err != nil {
+		return err
+	}
+
+	// Entries without a date are booked for today
+	if transaction.Date.IsZero() {
+		transaction.Date = time.Now()
+	}
+	return nil
+}
+
+// afterCreate runs what follows every new entry once it is saved: duplicate
+// flagging, learning its category and the budget alerts
+func (t *TransactionService) afterCreate(transactions ...*models.Transaction) {
+	if len(transactions) == 0 {
+		return
+	}
+	t.flagDuplicates(transactions...)
+	for _, transaction := range transactions {
+		t.learn(*transaction)
+		t.checkAlerts(transaction)
+	}
 }
 
 // GetTransactionsByUserID fetches all transactions for a user
@@ -19,17 +136,502 @@ func (t *TransactionService) GetTransactionsByUserID(userID uint) ([]models.Tran
 	return t.Repo.GetTransactionsByUserID(userID)
 }
 
-// GetTotalIncome returns total income for a user
-func (t *TransactionService) GetTotalIncome(userID uint) (float64, error) {
-	return t.Repo.GetTotalIncome(userID)
+// ListTransactions returns one page of a user's transactions matching the filter.
+// cursor is the opaque next_cursor of the previous page, or empty for the first page.
+func (t *TransactionService) ListTransactions(filter models.TransactionFilter, cursor string) (*models.TransactionPage, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultPageSize
+	}
+	if filter.Limit > MaxPageSize {
+		filter.Limit = MaxPageSize
+	}
+
+	if err := t.resolveAmountFilter(&filter); err != nil {
+		return nil, err
+	}
+	if cursor != "" {
+		after, err := decodeCursor(cursor)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		filter.After = after
+	}
+
+	// Ask for one extra row so we know whether another page exists
+	pageSize := filter.Limit
+	filter.Limit++
+	transactions, err := t.Repo.ListTransactions(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &models.TransactionPage{Transactions: transactions}
+	if len(transactions) > pageSize {
+		page.Transactions = transactions[:pageSize]
+		last := page.Transactions[pageSize-1]
+		page.NextCursor = encodeCursor(repository.CursorFor(last, filter.SortBy))
+	}
+	if page.Transactions == nil {
+		page.Transactions = []models.Transaction{}
+	}
+	return page, nil
+}
+
+// resolveAmountFilter settles the currency the filter's amount bounds are in,
+// the user's base currency unless one was given
+func (t *TransactionService) resolveAmountFilter(filter *models.TransactionFilter) error {
+	var amounts []*money.Amount
+	for _, a := range []*money.Amount{filter.MinAmount, filter.MaxAmount} {
+		if a != nil {
+			amounts = append(amounts, a)
+		}
+	}
+	if len(amounts) == 0 {
+		return nil
+	}
+	return t.FX.ResolveCurrency(&filter.Currency, filter.UserID, amounts...)
 }
 
-// GetTotalExpense returns total expense for a user
-func (t *TransactionService) GetTotalExpense(userID uint) (float64, error) {
-	return t.Repo.GetTotalExpense(userID)
+// GetTransactionByID fetches a transaction owned by the user
+func (t *TransactionService) GetTransactionByID(id uint, userID uint) (*models.Transaction, error) {
+	// Ensure transaction exists and belongs to user
+	if !t.Repo.CheckTransactionExistsForUser(id, userID) {
+		return nil, ErrTransactionNotFound
+	}
+	return t.Repo.GetTransactionByID(id)
+}
+
+// UpdateTransaction updates a transaction owned by the user; both legs of a
+// transfer are updated together
+func (t *TransactionService) UpdateTransaction(transaction *models.Transaction) error {
+	existing, err := t.GetTransactionByID(transaction.ID, transaction.UserID)
+	if err != nil {
+		return err
+	}
+
+	if (existing.Type == TypeTransfer) != (transaction.Type == TypeTransfer) {
+		return ErrTransferTypeChange
+	}
+	if existing.Type == TypeTransfer {
+		return t.updateTransfer(transaction, existing)
+	}
+	if err := validateTransactionType(transaction.Type); err != nil {
+		return err
+	}
+	if err := validateSplits(transaction); err != nil {
+		return err
+	}
+
+	// Only a move to another account needs the account checked again
+	if !sameAccount(existing.AccountID, transaction.AccountID) {
+		if err := t.checkAccount(transaction.AccountID, transaction.UserID); err != nil {
+			return err
+		}
+	}
+	if err := t.Accounts.resolveCurrency(&transaction.Currency, transaction.AccountID, transaction.UserID, transactionAmounts(transaction)...); err != nil {
+		return err
+	}
+
+	// Keep the original date unless a new one was sent
+	if transaction.Date.IsZero() {
+		transaction.Date = existing.Date
+	}
+	transaction.CreatedAt = existing.CreatedAt
+	transaction.RecurringID = existing.RecurringID
+	transaction.ExternalID = existing.ExternalID
+	transaction.LinkedID = nil
+	if err := t.assignPayees(true, transaction); err != nil {
+		return err
+	}
+	if err := t.payeeCategories(transaction); err != nil {
+		return err
+	}
+	if err := t.assignCategories(true, true, transaction); err != nil {
+		return err
+	}
+	if err := t.assignTags(true, transaction); err != nil {
+		return err
+	}
+	if err := t.Repo.UpdateTransaction(transaction); err != nil {
+		return err
+	}
+
+	if t.Suggestions != nil {
+		t.Suggestions.Forget(*existing)
+	}
+	t.learn(*transaction)
+	t.checkAlerts(transaction)
+	return nil
+}
+
+// DeleteTransaction deletes a transaction for a user; deleting either leg of
+// a transfer deletes both
+func (t *TransactionService) DeleteTransaction(id uint, userID uint) error {
+	// Ensure transaction exists and belongs to user
+	existing, err := t.GetTransactionByID(id, userID)
+	if err != nil {
+		return err
+	}
+	if existing.Type == TypeTransfer {
+		return t.deleteTransfer(existing)
+	}
+
+	log.Printf("Transaction with ID %d found for user %d, proceeding to delete", id, userID)
+	if err := t.Repo.DeleteTransaction(id); err != nil {
+		return err
+	}
+	if t.Suggestions != nil {
+		t.Suggestions.Forget(*existing)
+	}
+	t.deleteAttachments(id)
+	return nil
+}
+
+// deleteAttachments removes the attachments of deleted transactions. The
+// transactions are gone already, so a failure is only logged.
+func (t *TransactionService) deleteAttachments(ids ...uint) {
+	if t.Attachments == nil {
+		return
+	}
+	if err := t.Attachments.DeleteForTransactions(context.Background(), ids...); err != nil {
+		log.Printf("delete attachments of transactions %v: %v", ids, err)
+	}
+}
+
+// SuggestCategories ranks the categories the user's history suggests for a
+// transaction that is about to be entered, with how confident each one is
+func (t *TransactionService) SuggestCategories(transaction models.Transaction, limit int) ([]models.CategorySuggestion, error) {
+	if t.Suggestions == nil {
+		return []models.CategorySuggestion{}, nil
+	}
+	return t.Suggestions.Suggest(transaction, limit)
+}
+
+// GetTotalIncome returns total income for a user within the range, in the
+// user's base currency
+func (t *TransactionService) GetTotalIncome(userID uint, rng models.DateRange) (money.Amount, string, error) {
+	base, err := t.FX.BaseCurrency(userID)
+	if err != nil {
+		return 0, "", err
+	}
+	total, err := t.Repo.GetTotalIncome(userID, base, rng)
+	return total, base, err
+}
+
+// GetTotalExpense returns total expense for a user within the range, in the
+// user's base currency
+func (t *TransactionService) GetTotalExpense(userID uint, rng models.DateRange) (money.Amount, string, error) {
+	base, err := t.FX.BaseCurrency(userID)
+	if err != nil {
+		return 0, "", err
+	}
+	total, err := t.Repo.GetTotalExpense(userID, base, rng)
+	return total, base, err
+}
+
+// GetTotalBalance returns the total balance for a user within the range, in
+// the user's base currency
+func (t *TransactionService) GetTotalBalance(userID uint, rng models.DateRange) (money.Amount, string, error) {
+	base, err := t.FX.BaseCurrency(userID)
+	if err != nil {
+		return 0, "", err
+	}
+	total, err := t.Repo.GetTotalBalance(userID, base, rng)
+	return total, base, err
+}
+
+// GetCategoryTotals returns income and expense per category within the range
+// in the user's base currency; split transactions count towards the
+// categories of their lines
+func (t *TransactionService) GetCategoryTotals(userID uint, rng models.DateRange) ([]models.CategoryTotal, error) {
+	base, err := t.FX.BaseCurrency(userID)
+	if err != nil {
+		return nil, err
+	}
+	totals, err := t.Repo.GetCategoryTotals(userID, base, rng)
+	if err != nil {
+		return nil, err
+	}
+	if totals == nil {
+		totals = []models.CategoryTotal{}
+	}
+	return totals, nil
+}
+
+// GetTagTotals returns income and expense per tag within the range in the
+// user's base currency
+func (t *TransactionService) GetTagTotals(userID uint, rng models.DateRange) ([]models.TagTotal, error) {
+	base, err := t.FX.BaseCurrency(userID)
+	if err != nil {
+		return nil, err
+	}
+	totals, err := t.Repo.GetTagTotals(userID, base, rng)
+	if err != nil {
+		return nil, err
+	}
+	if totals == nil {
+		totals = []models.TagTotal{}
+	}
+	return totals, nil
+}
+
+// GetTopPayees ranks the payees the user spent most at in a named period
+// (this_month, last_month, ytd) or a custom from/to window, in the user's
+// base currency; limit caps the number of payees
+func (t *TransactionService) GetTopPayees(userID uint, period string, custom models.DateRange, limit int) (*models.PayeeReport, error) {
+	if period == "" {
+		period = PeriodThisMonth
+	}
+	from, to, err := ResolvePeriod(period, custom, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = DefaultTopPayees
+	}
+	if limit > MaxTopPayees {
+		limit = MaxTopPayees
+	}
+
+	base, err := t.FX.BaseCurrency(userID)
+	if err != nil {
+		return nil, err
+	}
+	totals, err := t.Repo.GetPayeeTotals(userID, base, models.DateRange{From: &from, To: &to})
+	if err != nil {
+		return nil, err
+	}
+	if len(totals) > limit {
+		totals = totals[:limit]
+	}
+	if totals == nil {
+		totals = []models.PayeeTotal{}
+	}
+	return &models.PayeeReport{Period: period, From: from, To: to, Currency: base, Payees: totals}, nil
+}
+
+// GetSummary returns income, expense, net and savings rate for a named period
+// (this_month, last_month, ytd) or a custom from/to window, in the user's base currency
+func (t *TransactionService) GetSummary(userID uint, period string, custom models.DateRange) (*models.Summary, error) {
+	if period == "" {
+		period = PeriodThisMonth
+	}
+	from, to, err := ResolvePeriod(period, custom, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	base, err := t.FX.BaseCurrency(userID)
+	if err != nil {
+		return nil, err
+	}
+	income, expense, err := t.Repo.GetTotals(userID, base, models.DateRange{From: &from, To: &to})
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &models.Summary{
+		Period:   period,
+		From:     from,
+		To:       to,
+		Income:   income,
+		Expense:  expense,
+		Net:      income - expense,
+		Currency: base,
+	}
+	if income > 0 {
+		summary.SavingsRate = math.Round(float64(summary.Net)/float64(income)*10000) / 100
+	}
+	return summary, nil
+}
+
+// ResolvePeriod turns a named period into a [from, to) window relative to now
+func ResolvePeriod(period string, custom models.DateRange, now time.Time) (time.Time, time.Time, error) {
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+
+	switch period {
+	case PeriodThisMonth:
+		return monthStart, monthStart.AddDate(0, 1, 0), nil
+	case PeriodLastMonth:
+		return monthStart.AddDate(0, -1, 0), monthStart, nil
+	case PeriodYTD:
+		yearStart := time.Date(now.Year(), time.January, 1, 0, 0, 0, 0, now.Location())
+		return yearStart, now, nil
+	case PeriodCustom:
+		if custom.From == nil || custom.To == nil {
+			return time.Time{}, time.Time{}, ErrCustomPeriodRange
+		}
+		return *custom.From, *custom.To, nil
+	}
+	return time.Time{}, time.Time{}, ErrInvalidPeriod
+}
+
+// checkAccount makes sure an optional account belongs to the user and is open
+func (t *TransactionService) checkAccount(accountID *uint, userID uint) error {
+	if accountID == nil || t.Accounts == nil {
+		return nil
+	}
+	return t.Accounts.CheckAccountUsable(*accountID, userID)
+}
+
+// checkExternalID makes sure an external ID sent with a manual entry is not
+// taken on its account, by a live or a deleted transaction
+func (t *TransactionService) checkExternalID(transaction *models.Transaction) error {
+	if transaction.ExternalID == "" {
+		return nil
+	}
+	taken, err := t.Repo.GetImportedIDs(transaction.UserID, transaction.AccountID, []string{transaction.ExternalID})
+	if err != nil {
+		return err
+	}
+	if taken[transaction.ExternalID] {
+		return ErrExternalIDTaken
+	}
+	return nil
+}
+
+// sameAccount compares two optional account IDs
+func sameAccount(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// checkAlerts runs the budget threshold checks for a written transaction
+func (t *TransactionService) checkAlerts(transaction *models.Transaction) {
+	if t.Alerts != nil {
+		t.Alerts.CheckTransaction(*transaction)
+	}
+}
+
+// flagDuplicates records which earlier transactions new ones look like.
+// Failures are logged rather than returned so they never block the write.
+func (t *TransactionService) flagDuplicates(transactions ...*models.Transaction) {
+	if t.Duplicates == nil {
+		return
+	}
+	if err := t.Duplicates.Flag(transactions, true); err != nil {
+		log.Printf("duplicates: flag transactions of user %d: %v", transactions[0].UserID, err)
+	}
+}
+
+// categorize runs the user's rules over new transactions of that user, then
+// gives the ones still without a category their payee's default one.
+// Failures are logged rather than returned so they never block the write.
+func (t *TransactionService) categorize(transactions ...*models.Transaction) {
+	if len(transactions) == 0 {
+		return
+	}
+	if t.Rules != nil {
+		if err := t.Rules.Categorize(transactions[0].UserID, transactions...); err != nil {
+			log.Printf("rules: categorize transactions of user %d: %v", transactions[0].UserID, err)
+		}
+	}
+	if err := t.payeeCategories(transactions...); err != nil {
+		log.Printf("payees: categorize transactions of user %d: %v", transactions[0].UserID, err)
+	}
+}
+
+// assignCategories links transactions of one user to their categories,
+// creating the missing ones with create set; archived categories are only
+// accepted with archived set
+func (t *TransactionService) assignCategories(create, archived bool, transactions ...*models.Transaction) error {
+	if t.Categories == nil || len(transactions) == 0 {
+		return nil
+	}
+	return t.Categories.assignTransactions(transactions[0].UserID, transactions, create, archived)
+}
+
+// assignPayees links transactions of one user to their payees, creating the
+// missing ones with create set
+func (t *TransactionService) assignPayees(create bool, transactions ...*models.Transaction) error {
+	if t.Payees == nil || len(transactions) == 0 {
+		return nil
+	}
+	return t.Payees.assignTransactions(transactions[0].UserID, transactions, create)
+}
+
+// payeeCategories gives transactions of one user that lack a category the
+// default category of their payee
+func (t *TransactionService) payeeCategories(transactions ...*models.Transaction) error {
+	if t.Payees == nil || len(transactions) == 0 {
+		return nil
+	}
+	return t.Payees.assignCategories(transactions[0].UserID, transactions)
+}
+
+// assignTags resolves the tags of transactions of one user, creating the
+// missing ones with create set
+func (t *TransactionService) assignTags(create bool, transactions ...*models.Transaction) error {
+	if t.Tags == nil || len(transactions) == 0 {
+		return nil
+	}
+	return t.Tags.assignTransactions(transactions[0].UserID, transactions, create)
+}
+
+// learn feeds written transactions of one user to the category suggestions
+func (t *TransactionService) learn(transactions ...models.Transaction) {
+	if t.Suggestions != nil {
+		t.Suggestions.Learn(transactions...)
+	}
+}
+
+// encodeCursor turns a cursor into an opaque URL-safe token
+func encodeCursor(c models.TransactionCursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeCursor reverses encodeCursor
+func decodeCursor(s string) (*models.TransactionCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	var c models.TransactionCursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// transactionAmounts lists the amount of a transaction and of its split lines
+func transactionAmounts(transaction *models.Transaction) []*money.Amount {
+	amounts := []*money.Amount{&transaction.Amount}
+	for i := range transaction.Splits {
+		amounts = append(amounts, &transaction.Splits[i].Amount)
+	}
+	return amounts
+}
+
+// validateSplits checks that split lines are complete and add up to the amount
+func validateSplits(transaction *models.Transaction) error {
+	if len(transaction.Splits) == 0 {
+		return nil
+	}
+
+	var sum money.Amount
+	for i := range transaction.Splits {
+		split := &transaction.Splits[i]
+		split.ID, split.TransactionID = 0, 0 // always written as new lines of this transaction
+		split.Category = strings.TrimSpace(split.Category)
+		if (split.Category == "" && split.CategoryID == nil) || split.Amount <= 0 {
+			return ErrInvalidSplit
+		}
+		sum += split.Amount
+	}
+
+	if sum != transaction.Amount {
+		return ErrSplitsMismatch
+	}
+	return nil
 }
 
-// GetTotalBalance returns the total balance for a user
-func (t *TransactionService) GetTotalBalance(userID uint) (float64, error) {
-	return t.Repo.GetTotalBalance(userID)
+// validateTransactionType makes sure only known transaction types reach the DB
+func validateTransactionType(typ string) error {
+	if typ != "income" && typ != "expense" {
+		return ErrInvalidTransactionType
+	}
+	return nil
 }
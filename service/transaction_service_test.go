@@ -0,0 +1,467 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"tracker/models"
+	"tracker/money"
+	"tracker/repository"
+
+	"gorm.io/gorm"
+)
+
+// memTransactionRepo keeps transactions in memory
+type memTransactionRepo struct {
+	repository.TransactionRepository
+	txs    map[uint]*models.Transaction
+	nextID uint
+	listed models.TransactionFilter
+
+	income, expense money.Amount     // served by GetTotals
+	totals          models.DateRange // the range GetTotals was asked for
+}
+
+func (m *memTransactionRepo) save(tx *models.Transaction) {
+	if m.txs == nil {
+		m.txs = map[uint]*models.Transaction{}
+	}
+	if tx.ID == 0 {
+		m.nextID++
+		tx.ID = m.nextID
+	}
+	stored := *tx
+	m.txs[tx.ID] = &stored
+}
+
+func (m *memTransactionRepo) CreateTransaction(tx *models.Transaction) error {
+	m.save(tx)
+	return nil
+}
+
+func (m *memTransactionRepo) CreateTransfer(out, in *models.Transaction) error {
+	m.save(out)
+	in.LinkedID = &out.ID
+	m.save(in)
+	out.LinkedID = &in.ID
+	m.save(out)
+	return nil
+}
+
+func (m *memTransactionRepo) UpdateTransaction(tx *models.Transaction) error {
+	m.save(tx)
+	return nil
+}
+
+func (m *memTransactionRepo) UpdateTransfer(legs ...*models.Transaction) error {
+	for _, leg := range legs {
+		m.save(leg)
+	}
+	return nil
+}
+
+func (m *memTransactionRepo) GetTransactionByID(id uint) (*models.Transaction, error) {
+	tx, ok := m.txs[id]
+	if !ok {
+		return nil, errors.New("record not found")
+	}
+	found := *tx
+	return &found, nil
+}
+
+func (m *memTransactionRepo) CheckTransactionExistsForUser(id uint, userID uint) bool {
+	tx, ok := m.txs[id]
+	return ok && tx.UserID == userID
+}
+
+func (m *memTransactionRepo) DeleteTransaction(id uint) error {
+	return m.DeleteTransfer(id)
+}
+
+func (m *memTransactionRepo) DeleteTransfer(ids ...uint) error {
+	for _, id := range ids {
+		delete(m.txs, id)
+	}
+	return nil
+}
+
+func (m *memTransactionRepo) GetTotals(userID uint, base string, rng models.DateRange) (money.Amount, money.Amount, error) {
+	m.totals = rng
+	return m.income, m.expense, nil
+}
+
+// ListTransactions pages through the transactions in the order they were
+// created, whatever the filter's sort
+func (m *memTransactionRepo) ListTransactions(f models.TransactionFilter) ([]models.Transaction, error) {
+	m.listed = f
+	var txs []models.Transaction
+	for id := uint(1); id <= m.nextID && len(txs) < f.Limit; id++ {
+		tx, ok := m.txs[id]
+		if !ok || (f.After != nil && id <= f.After.ID) {
+			continue
+		}
+		txs = append(txs, *tx)
+	}
+	return txs, nil
+}
+
+// memUserRepo serves users from memory
+type memUserRepo struct {
+	UserRepo
+	users map[uint]*models.User
+}
+
+func (m *memUserRepo) GetUserByID(id uint) (*models.User, error) {
+	if u, ok := m.users[id]; ok {
+		return u, nil
+	}
+	return nil, errors.New("user not found")
+}
+
+// date returns midnight UTC of a day
+func date(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestTransactionOwnership(t *testing.T) {
+	repo := &memTransactionRepo{}
+	s := &TransactionService{Repo: repo}
+	tx := models.Transaction{UserID: 1, Type: "expense", Category: "Rent", Amount: money.MustParse("900")}
+	if err := s.CreateTransaction(&tx); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		id     uint
+		userID uint
+		err    error
+	}{
+		{"owner", tx.ID, 1, nil},
+		{"another user", tx.ID, 2, ErrTransactionNotFound},
+		{"missing", tx.ID + 1, 1, ErrTransactionNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := s.GetTransactionByID(tt.id, tt.userID); !errors.Is(err, tt.err) {
+				t.Errorf("get: err = %v, want %v", err, tt.err)
+			}
+
+			before := repo.txs[tx.ID].Amount
+			update := models.Transaction{Model: gorm.Model{ID: tt.id}, UserID: tt.userID, Type: "expense", Category: "Rent",
+				Amount: before + money.MustParse("100")}
+			err := s.UpdateTransaction(&update)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("update: err = %v, want %v", err, tt.err)
+			}
+			if stored := repo.txs[tx.ID]; err != nil && stored.Amount != before {
+				t.Errorf("rejected update changed the amount to %v", stored.Amount)
+			}
+			if err == nil && (repo.txs[tx.ID].Amount != update.Amount || repo.txs[tx.ID].Date.IsZero()) {
+				t.Errorf("update stored %+v, want the new amount and the old date", repo.txs[tx.ID])
+			}
+		})
+	}
+
+	for _, userID := range []uint{2, 1} {
+		err := s.DeleteTransaction(tx.ID, userID)
+		if userID == 2 && (!errors.Is(err, ErrTransactionNotFound) || repo.txs[tx.ID] == nil) {
+			t.Errorf("another user's delete: err = %v, want %v and the transaction kept", err, ErrTransactionNotFound)
+		}
+		if userID == 1 && (err != nil || repo.txs[tx.ID] != nil) {
+			t.Errorf("owner's delete: err = %v, transaction left %v", err, repo.txs[tx.ID] != nil)
+		}
+	}
+}
+
+func TestListTransactionsPages(t *testing.T) {
+	repo := &memTransactionRepo{}
+	s := &TransactionService{Repo: repo}
+	for i := 0; i < 5; i++ {
+		if err := s.CreateTransaction(&models.Transaction{UserID: 1, Type: "expense", Category: "Food", Amount: money.MustParse("10")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var pages [][]uint
+	cursor := ""
+	for {
+		page, err := s.ListTransactions(models.TransactionFilter{UserID: 1, Limit: 2}, cursor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []uint
+		for _, tx := range page.Transactions {
+			ids = append(ids, tx.ID)
+		}
+		pages = append(pages, ids)
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+	if got := fmt.Sprint(pages); got != "[[1 2] [3 4] [5]]" {
+		t.Errorf("pages = %s, want [[1 2] [3 4] [5]]", got)
+	}
+
+	tests := []struct {
+		name   string
+		limit  int
+		cursor string
+		asked  int // rows asked of the repository
+		err    error
+	}{
+		{"default size", 0, "", DefaultPageSize + 1, nil},
+		{"capped size", 10 * MaxPageSize, "", MaxPageSize + 1, nil},
+		{"bad cursor", 2, "not a cursor", 0, ErrInvalidCursor},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo.listed = models.TransactionFilter{}
+			page, err := s.ListTransactions(models.TransactionFilter{UserID: 1, Limit: tt.limit}, tt.cursor)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if err == nil && (repo.listed.Limit != tt.asked || page.NextCursor != "") {
+				t.Errorf("asked for %d rows with next cursor %q, want %d and none", repo.listed.Limit, page.NextCursor, tt.asked)
+			}
+		})
+	}
+
+	empty, err := (&TransactionService{Repo: &memTransactionRepo{}}).ListTransactions(models.TransactionFilter{UserID: 1}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if empty.Transactions == nil {
+		t.Error("an empty page lists nil instead of an empty array")
+	}
+}
+
+func TestListTransactionsAmountCurrency(t *testing.T) {
+	ten := money.MustParse("10")
+	users := &memUserRepo{users: map[uint]*models.User{1: {BaseCurrency: "JPY"}}}
+
+	tests := []struct {
+		name     string
+		filter   models.TransactionFilter
+		currency string
+		min      money.Amount // in minor units of currency
+		err      error
+	}{
+		{"base currency by default", models.TransactionFilter{MinAmount: &ten}, "JPY", 10, nil},
+		{"given currency", models.TransactionFilter{MinAmount: &ten, Currency: "eur"}, "EUR", 1000, nil},
+		{"invalid currency", models.TransactionFilter{MinAmount: &ten, Currency: "EURO"}, "", 0, ErrInvalidCurrency},
+		{"no amounts", models.TransactionFilter{}, "", 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &memTransactionRepo{}
+			s := &TransactionService{Repo: repo, FX: &ExchangeService{Users: users}}
+			filter := tt.filter
+			filter.UserID = 1
+			if filter.MinAmount != nil {
+				min := *filter.MinAmount
+				filter.MinAmount = &min
+			}
+
+			_, err := s.ListTransactions(filter, "")
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if repo.listed.Currency != tt.currency {
+				t.Errorf("currency = %q, want %q", repo.listed.Currency, tt.currency)
+			}
+			if tt.filter.MinAmount != nil && *repo.listed.MinAmount != tt.min {
+				t.Errorf("min amount = %d, want %d", *repo.listed.MinAmount, tt.min)
+			}
+		})
+	}
+}
+
+func TestResolvePeriod(t *testing.T) {
+	now := time.Date(2026, time.March, 18, 14, 30, 0, 0, time.UTC)
+	from, to := date(2025, time.December, 1), date(2026, time.February, 1)
+	tests := []struct {
+		name     string
+		period   string
+		custom   models.DateRange
+		now      time.Time
+		from, to time.Time
+		err      error
+	}{
+		{"this month", PeriodThisMonth, models.DateRange{}, now, date(2026, time.March, 1), date(2026, time.April, 1), nil},
+		{"this month in December", PeriodThisMonth, models.DateRange{}, date(2025, time.December, 31), date(2025, time.December, 1), date(2026, time.January, 1), nil},
+		{"last month", PeriodLastMonth, models.DateRange{}, now, date(2026, time.February, 1), date(2026, time.March, 1), nil},
+		{"last month in January", PeriodLastMonth, models.DateRange{}, date(2026, time.January, 10), date(2025, time.December, 1), date(2026, time.January, 1), nil},
+		{"year to date", PeriodYTD, models.DateRange{}, now, date(2026, time.January, 1), now, nil},
+		{"custom", PeriodCustom, models.DateRange{From: &from, To: &to}, now, from, to, nil},
+		{"custom without end", PeriodCustom, models.DateRange{From: &from}, now, time.Time{}, time.Time{}, ErrCustomPeriodRange},
+		{"custom without start", PeriodCustom, models.DateRange{To: &to}, now, time.Time{}, time.Time{}, ErrCustomPeriodRange},
+		{"unknown", "last_week", models.DateRange{}, now, time.Time{}, time.Time{}, ErrInvalidPeriod},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, to, err := ResolvePeriod(tt.period, tt.custom, tt.now)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if !from.Equal(tt.from) || !to.Equal(tt.to) {
+				t.Errorf("window = [%s, %s), want [%s, %s)", from, to, tt.from, tt.to)
+			}
+		})
+	}
+}
+
+func TestSummarySavingsRate(t *testing.T) {
+	tests := []struct {
+		name            string
+		income, expense money.Amount
+		net             money.Amount
+		rate            float64
+	}{
+		{"saving", money.MustParse("3000"), money.MustParse("900"), money.MustParse("2100"), 70},
+		{"rounded to two decimals", money.MustParse("3"), money.MustParse("2"), money.MustParse("1"), 33.33},
+		{"overspent", money.MustParse("1000"), money.MustParse("1500"), -money.MustParse("500"), -50},
+		{"no income", 0, money.MustParse("40"), -money.MustParse("40"), 0},
+		{"nothing booked", 0, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &memTransactionRepo{income: tt.income, expense: tt.expense}
+			s := &TransactionService{Repo: repo}
+			summary, err := s.GetSummary(1, "", models.DateRange{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if summary.Period != PeriodThisMonth || summary.Currency != DefaultBaseCurrency {
+				t.Errorf("period %q in %s, want this month in the default currency", summary.Period, summary.Currency)
+			}
+			if repo.totals.From == nil || !repo.totals.From.Equal(summary.From) || !repo.totals.To.Equal(summary.To) {
+				t.Errorf("totals asked for %v, want the summary's window", repo.totals)
+			}
+			if summary.Net != tt.net || summary.SavingsRate != tt.rate {
+				t.Errorf("net %s, savings rate %v, want %s and %v", summary.Net, summary.SavingsRate, tt.net, tt.rate)
+			}
+		})
+	}
+
+	s := &TransactionService{Repo: &memTransactionRepo{}}
+	if _, err := s.GetSummary(1, "fortnight", models.DateRange{}); !errors.Is(err, ErrInvalidPeriod) {
+		t.Errorf("err = %v, want %v", err, ErrInvalidPeriod)
+	}
+}
+
+func TestValidateSplits(t *testing.T) {
+	tests := []struct {
+		name   string
+		amount money.Amount
+		splits []models.TransactionSplit
+		err    error
+	}{
+		{"no splits", money.MustParse("10"), nil, nil},
+		{"adds up", money.MustParse("10"), []models.TransactionSplit{{Category: "Groceries", Amount: money.MustParse("6")}, {Category: " Household ", Amount: money.MustParse("4")}}, nil},
+		{"short", money.MustParse("10"), []models.TransactionSplit{{Category: "Groceries", Amount: money.MustParse("6")}, {Category: "Household", Amount: money.MustParse("3.99")}}, ErrSplitsMismatch},
+		{"over", money.MustParse("10"), []models.TransactionSplit{{Category: "Groceries", Amount: money.MustParse("10.01")}}, ErrSplitsMismatch},
+		{"no category", money.MustParse("10"), []models.TransactionSplit{{Category: " ", Amount: money.MustParse("10")}}, ErrInvalidSplit},
+		{"zero line", money.MustParse("10"), []models.TransactionSplit{{Category: "Groceries", Amount: money.MustParse("10")}, {Category: "Household"}}, ErrInvalidSplit},
+		{"negative line", money.MustParse("10"), []models.TransactionSplit{{Category: "Groceries", Amount: money.MustParse("15")}, {Category: "Household", Amount: -money.MustParse("5")}}, ErrInvalidSplit},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := models.Transaction{Amount: tt.amount, Splits: tt.splits}
+			for i := range tx.Splits {
+				tx.Splits[i].ID, tx.Splits[i].TransactionID = uint(i+1), 99
+			}
+			if err := validateSplits(&tx); !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			for _, split := range tx.Splits {
+				if tt.err == nil && (split.ID != 0 || split.TransactionID != 0 || split.Category != strings.TrimSpace(split.Category)) {
+					t.Errorf("split = %+v, want it written as a new, trimmed line", split)
+				}
+			}
+		})
+	}
+}
+
+func TestCreateSplitTransaction(t *testing.T) {
+	one, two := uint(1), uint(2)
+	splits := []models.TransactionSplit{{Category: "Groceries", Amount: money.MustParse("6")}, {Category: "Household", Amount: money.MustParse("4")}}
+	tests := []struct {
+		name string
+		tx   models.Transaction
+		err  error
+	}{
+		{"expense", models.Transaction{Type: "expense", Amount: money.MustParse("10")}, nil},
+		{"income", models.Transaction{Type: "income", Amount: money.MustParse("10")}, nil},
+		{"not adding up", models.Transaction{Type: "expense", Amount: money.MustParse("12")}, ErrSplitsMismatch},
+		{"transfer", models.Transaction{Type: TypeTransfer, Amount: money.MustParse("10"), AccountID: &one, ToAccountID: &two}, ErrTransferSplits},
+		{"unknown type", models.Transaction{Type: "refund", Amount: money.MustParse("10")}, ErrInvalidTransactionType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &memTransactionRepo{}
+			s := &TransactionService{Repo: repo}
+			tx := tt.tx
+			tx.UserID = 1
+			tx.Splits = append([]models.TransactionSplit(nil), splits...)
+			if err := s.CreateTransaction(&tx); !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if tt.err != nil {
+				if len(repo.txs) != 0 {
+					t.Errorf("stored a rejected transaction")
+				}
+				return
+			}
+			if stored := repo.txs[tx.ID]; len(stored.Splits) != len(splits) {
+				t.Errorf("stored %d splits, want %d", len(stored.Splits), len(splits))
+			}
+		})
+	}
+}
+
+func TestSplitCategoryKind(t *testing.T) {
+	groceries, salary := uint(3), uint(5)
+	categories := &CategoryService{Repo: &memCategoryRepo{categories: []models.Category{
+		{Model: gorm.Model{ID: groceries}, UserID: 1, Kind: "expense", Name: "Groceries"},
+		{Model: gorm.Model{ID: salary}, UserID: 1, Kind: "income", Name: "Salary"},
+	}}}
+	tests := []struct {
+		name   string
+		typ    string
+		splits []models.TransactionSplit
+		err    error
+	}{
+		{"expense lines", "expense", []models.TransactionSplit{
+			{Category: "groceries", Amount: money.MustParse("6")}, {CategoryID: &groceries, Amount: money.MustParse("4")}}, nil},
+		{"income line on an expense", "expense", []models.TransactionSplit{
+			{Category: "Groceries", Amount: money.MustParse("6")}, {CategoryID: &salary, Amount: money.MustParse("4")}}, ErrCategoryKindMismatch},
+		{"expense line on income", "income", []models.TransactionSplit{
+			{CategoryID: &salary, Amount: money.MustParse("6")}, {CategoryID: &groceries, Amount: money.MustParse("4")}}, ErrCategoryKindMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &memTransactionRepo{}
+			s := &TransactionService{Repo: repo, Categories: categories}
+			tx := models.Transaction{UserID: 1, Type: tt.typ, Amount: money.MustParse("10"), Currency: "EUR", Splits: tt.splits}
+			if err := s.CreateTransaction(&tx); !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if tt.err != nil {
+				return
+			}
+			for _, split := range repo.txs[tx.ID].Splits {
+				if split.CategoryID == nil || *split.CategoryID != groceries || split.Category != "Groceries" {
+					t.Errorf("split = %+v, want it linked to Groceries", split)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"tracker/models"
+	"tracker/money"
+)
+
+const TypeTransfer = "transfer"
+
+var (
+	ErrTransferAccounts   = errors.New("a transfer needs two different accounts in account_id and to_account_id")
+	ErrTransferAmount     = errors.New("transfer amount must be positive")
+	ErrTransferTypeChange = errors.New("cannot change a transaction to or from a transfer")
+)
+
+// createTransfer books a transfer as two linked legs in one DB transaction.
+// On success transaction holds the source leg.
+func (t *TransactionService) createTransfer(transaction *models.Transaction) error {
+	if transaction.Amount <= 0 {
+		return ErrTransferAmount
+	}
+	if len(transaction.Splits) > 0 {
+		return ErrTransferSplits
+	}
+	if err := t.checkTransferAccounts(transaction.AccountID, transaction.ToAccountID, transaction.UserID); err != nil {
+		return err
+	}
+
+	if transaction.Date.IsZero() {
+		transaction.Date = time.Now()
+	}
+	if transaction.Category == "" {
+		transaction.Category = "Transfer"
+	}
+	transaction.CategoryID = nil
+	transaction.Tags = nil
+	transaction.RecurringID = nil
+
+	out := *transaction
+	out.ToAccountID = nil
+
+	in := *transaction
+	in.AccountID = transaction.ToAccountID
+	in.ToAccountID = nil
+
+	if err := t.priceTransfer(&out, &in, transaction.Amount, transaction.Currency); err != nil {
+		return err
+	}
+	if err := t.Repo.CreateTransfer(&out, &in); err != nil {
+		return err
+	}
+
+	*transaction = out
+	transaction.ToAccountID = in.AccountID
+	return nil
+}
+
+// updateTransfer applies an update to one leg of a transfer and mirrors it on
+// the other. Amount is the size of the transfer; the signs of the legs stay.
+// account_id moves this leg, to_account_id moves the other one.
+func (t *TransactionService) updateTransfer(transaction *models.Transaction, existing *models.Transaction) error {
+	if transaction.Amount <= 0 {
+		return ErrTransferAmount
+	}
+	if len(transaction.Splits) > 0 {
+		return ErrTransferSplits
+	}
+	if existing.LinkedID == nil {
+		return ErrTransactionNotFound
+	}
+	peer, err := t.GetTransactionByID(*existing.LinkedID, existing.UserID)
+	if err != nil {
+		return err
+	}
+
+	accountID := transaction.AccountID
+	if accountID == nil {
+		accountID = existing.AccountID
+	}
+	peerAccountID := transaction.ToAccountID
+	if peerAccountID == nil {
+		peerAccountID = peer.AccountID
+	}
+	if !sameAccount(accountID, existing.AccountID) || !sameAccount(peerAccountID, peer.AccountID) {
+		if err := t.checkTransferAccounts(accountID, peerAccountID, existing.UserID); err != nil {
+			return err
+		}
+	}
+
+	date := transaction.Date
+	if date.IsZero() {
+		date = existing.Date
+	}
+	category := transaction.Category
+	if category == "" {
+		category = existing.Category
+	}
+
+	for _, leg := range []*models.Transaction{existing, peer} {
+		leg.Category = category
+		leg.Note = transaction.Note
+		leg.Date = date
+	}
+	existing.AccountID = accountID
+	peer.AccountID = peerAccountID
+
+	// Keep each leg on its side of the transfer
+	out, in := existing, peer
+	if existing.Amount > 0 {
+		out, in = peer, existing
+	}
+	if err := t.priceTransfer(out, in, transaction.Amount, transaction.Currency); err != nil {
+		return err
+	}
+
+	if err := t.Repo.UpdateTransfer(existing, peer); err != nil {
+		return err
+	}
+
+	*transaction = *existing
+	transaction.ToAccountID = peer.AccountID
+	return nil
+}
+
+// priceTransfer books amount on both legs. The amount is taken in the source
+// account's currency, whatever currency it was read in. Each leg takes the
+// currency of its account; the incoming leg is converted at the rates of the
+// transfer date when the two differ.
+func (t *TransactionService) priceTransfer(out, in *models.Transaction, amount money.Amount, currency string) error {
+	out.Currency, in.Currency = "", ""
+	if err := t.Accounts.resolveCurrency(&out.Currency, out.AccountID, out.UserID); err != nil {
+		return err
+	}
+	if err := t.Accounts.resolveCurrency(&in.Currency, in.AccountID, in.UserID); err != nil {
+		return err
+	}
+
+	amount, err := amount.Rescale(currency, out.Currency)
+	if err != nil {
+		return err
+	}
+	converted, err := t.FX.Convert(amount, out.Currency, in.Currency, out.Date)
+	if err != nil {
+		return err
+	}
+	out.Amount = -amount
+	in.Amount = converted
+	return nil
+}
+
+// deleteTransfer removes both legs of a transfer
+func (t *TransactionService) deleteTransfer(leg *models.Transaction) error {
+	ids := []uint{leg.ID}
+	if leg.LinkedID != nil {
+		ids = append(ids, *leg.LinkedID)
+	}
+
+	log.Printf("Transfer legs %v found for user %d, proceeding to delete", ids, leg.UserID)
+	if err := t.Repo.DeleteTransfer(ids...); err != nil {
+		return err
+	}
+	t.deleteAttachments(ids...)
+	return nil
+}
+
+// checkTransferAccounts makes sure both sides of a transfer are distinct usable accounts
+func (t *TransactionService) checkTransferAccounts(from, to *uint, userID uint) error {
+	if from == nil || to == nil || *from == *to {
+		return ErrTransferAccounts
+	}
+	if err := t.checkAccount(from, userID); err != nil {
+		return err
+	}
+	return t.checkAccount(to, userID)
+}
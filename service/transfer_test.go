@@ -0,0 +1,171 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"tracker/models"
+	"tracker/money"
+
+	"gorm.io/gorm"
+)
+
+// transferService books transfers between a euro checking account (1), a
+// euro savings account (2), a dollar account (3) and an archived account (4)
+// of user 1
+func transferService() (*TransactionService, *memTransactionRepo) {
+	accounts := &memAccountRepo{accounts: map[uint]*models.Account{
+		1: {Model: gorm.Model{ID: 1}, UserID: 1, Name: "Checking", Currency: "EUR"},
+		2: {Model: gorm.Model{ID: 2}, UserID: 1, Name: "Savings", Currency: "EUR"},
+		3: {Model: gorm.Model{ID: 3}, UserID: 1, Name: "Dollars", Currency: "USD"},
+		4: {Model: gorm.Model{ID: 4}, UserID: 1, Name: "Closed", Currency: "EUR", Archived: true},
+	}}
+	fx := &ExchangeService{Repo: &memRateRepo{rates: map[string]float64{"USD": 1.25}}}
+	repo := &memTransactionRepo{}
+	return &TransactionService{Repo: repo, Accounts: &AccountService{Repo: accounts, FX: fx}, FX: fx}, repo
+}
+
+func TestCreateTransfer(t *testing.T) {
+	day := date(2026, time.March, 2)
+	tests := []struct {
+		name     string
+		from, to uint
+		amount   money.Amount
+		out, in  money.Amount // booked on the legs
+		inCur    string
+	}{
+		{"same currency", 1, 2, money.MustParse("100"), -money.MustParse("100"), money.MustParse("100"), "EUR"},
+		{"into dollars", 1, 3, money.MustParse("100"), -money.MustParse("100"), money.MustParse("125"), "USD"},
+		{"out of dollars", 3, 1, money.MustParse("125"), -money.MustParse("125"), money.MustParse("100"), "EUR"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, repo := transferService()
+			from, to := tt.from, tt.to
+			tx := models.Transaction{UserID: 1, Type: TypeTransfer, Amount: tt.amount, AccountID: &from, ToAccountID: &to, Date: day}
+			if err := s.CreateTransaction(&tx); err != nil {
+				t.Fatal(err)
+			}
+			if len(repo.txs) != 2 {
+				t.Fatalf("booked %d legs, want 2", len(repo.txs))
+			}
+
+			out, in := repo.txs[tx.ID], repo.txs[*tx.LinkedID]
+			if in.LinkedID == nil || *in.LinkedID != out.ID {
+				t.Errorf("legs are not linked to each other: %v, %v", out.LinkedID, in.LinkedID)
+			}
+			if *out.AccountID != from || *in.AccountID != to || out.ToAccountID != nil || in.ToAccountID != nil {
+				t.Errorf("legs on accounts %d and %d, want %d and %d", *out.AccountID, *in.AccountID, from, to)
+			}
+			if out.Amount != tt.out || in.Amount != tt.in || in.Currency != tt.inCur {
+				t.Errorf("legs = %d %s and %d %s, want %d and %d %s", out.Amount, out.Currency, in.Amount, in.Currency, tt.out, tt.in, tt.inCur)
+			}
+			for _, leg := range []*models.Transaction{out, in} {
+				if leg.Type != TypeTransfer || leg.Category != "Transfer" || !leg.Date.Equal(day) {
+					t.Errorf("leg %d = %+v, want a transfer on %s", leg.ID, leg, day)
+				}
+			}
+			if tx.ToAccountID == nil || *tx.ToAccountID != to {
+				t.Errorf("returned transfer goes to %v, want %d", tx.ToAccountID, to)
+			}
+		})
+	}
+}
+
+func TestCreateTransferRejected(t *testing.T) {
+	one, two, archived, foreign := uint(1), uint(2), uint(4), uint(9)
+	ten := money.MustParse("10")
+	tests := []struct {
+		name string
+		tx   models.Transaction
+		err  error
+	}{
+		{"no target", models.Transaction{Amount: ten, AccountID: &one}, ErrTransferAccounts},
+		{"same account", models.Transaction{Amount: ten, AccountID: &one, ToAccountID: &one}, ErrTransferAccounts},
+		{"negative amount", models.Transaction{Amount: -ten, AccountID: &one, ToAccountID: &two}, ErrTransferAmount},
+		{"split", models.Transaction{Amount: ten, AccountID: &one, ToAccountID: &two, Splits: []models.TransactionSplit{{Category: "Savings", Amount: ten}}}, ErrTransferSplits},
+		{"archived account", models.Transaction{Amount: ten, AccountID: &one, ToAccountID: &archived}, ErrAccountArchived},
+		{"someone else's account", models.Transaction{Amount: ten, AccountID: &foreign, ToAccountID: &one}, ErrAccountNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, repo := transferService()
+			tx := tt.tx
+			tx.UserID, tx.Type = 1, TypeTransfer
+			if err := s.CreateTransaction(&tx); !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if len(repo.txs) != 0 {
+				t.Errorf("booked %d legs of a rejected transfer", len(repo.txs))
+			}
+		})
+	}
+
+	// Without a rate neither leg is booked
+	s, repo := transferService()
+	s.FX.Repo.(*memRateRepo).rates = nil
+	from, to := uint(1), uint(3)
+	tx := models.Transaction{UserID: 1, Type: TypeTransfer, Amount: ten, AccountID: &from, ToAccountID: &to, Date: date(2026, time.March, 2)}
+	if err := s.CreateTransaction(&tx); !errors.Is(err, ErrMissingExchangeRate) {
+		t.Fatalf("err = %v, want %v", err, ErrMissingExchangeRate)
+	}
+	if len(repo.txs) != 0 {
+		t.Errorf("booked %d legs without a rate", len(repo.txs))
+	}
+}
+
+func TestUpdateTransferMirrorsLegs(t *testing.T) {
+	s, repo := transferService()
+	from, to := uint(1), uint(3)
+	tx := models.Transaction{UserID: 1, Type: TypeTransfer, Amount: money.MustParse("100"), AccountID: &from, ToAccountID: &to, Date: date(2026, time.March, 2)}
+	if err := s.CreateTransaction(&tx); err != nil {
+		t.Fatal(err)
+	}
+	inID := *tx.LinkedID
+
+	// Updating the incoming leg still prices the transfer from the source account
+	update := models.Transaction{Model: gorm.Model{ID: inID}, UserID: 1, Type: TypeTransfer, Amount: money.MustParse("40"), Note: "rent share"}
+	if err := s.UpdateTransaction(&update); err != nil {
+		t.Fatal(err)
+	}
+	out, in := repo.txs[tx.ID], repo.txs[inID]
+	if out.Amount != -money.MustParse("40") || in.Amount != money.MustParse("50") {
+		t.Errorf("legs = %d and %d, want -40.00 EUR and 50.00 USD", out.Amount, in.Amount)
+	}
+	if out.Note != "rent share" || in.Note != "rent share" {
+		t.Errorf("notes = %q and %q, want both updated", out.Note, in.Note)
+	}
+
+	income := models.Transaction{Model: gorm.Model{ID: inID}, UserID: 1, Type: "income", Amount: money.MustParse("40")}
+	if err := s.UpdateTransaction(&income); !errors.Is(err, ErrTransferTypeChange) {
+		t.Errorf("err = %v, want %v", err, ErrTransferTypeChange)
+	}
+}
+
+func TestDeleteTransferDeletesBothLegs(t *testing.T) {
+	for _, leg := range []string{"outgoing", "incoming"} {
+		t.Run(leg, func(t *testing.T) {
+			s, repo := transferService()
+			from, to := uint(1), uint(2)
+			tx := models.Transaction{UserID: 1, Type: TypeTransfer, Amount: money.MustParse("100"), AccountID: &from, ToAccountID: &to}
+			if err := s.CreateTransaction(&tx); err != nil {
+				t.Fatal(err)
+			}
+			id := tx.ID
+			if leg == "incoming" {
+				id = *tx.LinkedID
+			}
+
+			if err := s.DeleteTransaction(id, 2); !errors.Is(err, ErrTransactionNotFound) {
+				t.Fatalf("another user's delete: err = %v, want %v", err, ErrTransactionNotFound)
+			}
+			if err := s.DeleteTransaction(id, 1); err != nil {
+				t.Fatal(err)
+			}
+			if len(repo.txs) != 0 {
+				t.Errorf("%d legs left after deleting the %s one", len(repo.txs), leg)
+			}
+		})
+	}
+}
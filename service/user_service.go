@@ -2,6 +2,7 @@ package service
 
 import (
 	"errors"
+	"strings"
 
 	"tracker/middleware"
 	"tracker/models"
@@ -13,7 +14,9 @@ import (
 // Define the interface here so we don't depend on repository package types.
 type UserRepo interface {
 	GetUserByEmail(email string) (*models.User, error)
+	GetUserByID(id uint) (*models.User, error)
 	CreateUser(user *models.User) error
+	UpdateBaseCurrency(id uint, currency string) error
 }
 
 var (
@@ -44,6 +47,14 @@ func (s *UserService) RegisterUser(user *models.User) error {
 		return err
 	}
 
+	if user.BaseCurrency == "" {
+		user.BaseCurrency = DefaultBaseCurrency
+	}
+	user.BaseCurrency = strings.ToUpper(user.BaseCurrency)
+	if !isCurrencyCode(user.BaseCurrency) {
+		return ErrInvalidCurrency
+	}
+
 	// Hash password
 	hash, err := utils.HashPassword(user.Password)
 	if err != nil {
@@ -79,3 +90,15 @@ func (s *UserService) LoginUser(req models.LoginRequest) (string, error) {
 	}
 	return token, nil
 }
+
+// SetBaseCurrency changes the currency a user's totals and reports are shown in
+func (s *UserService) SetBaseCurrency(userID uint, currency string) (string, error) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if !isCurrencyCode(currency) {
+		return "", ErrInvalidCurrency
+	}
+	if err := s.Repo.UpdateBaseCurrency(userID, currency); err != nil {
+		return "", err
+	}
+	return currency, nil
+}
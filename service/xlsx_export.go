@@ -0,0 +1,177 @@
+package service
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+
+	"tracker/models"
+)
+
+// The fixed parts of a one-sheet workbook. Style 1 shows a date serial as
+// yyyy-mm-dd, style 2 a number with two decimals.
+const (
+	xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>
+</Types>`
+
+	xlsxRootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`
+
+	xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="Transactions" sheetId="1" r:id="rId1"/></sheets>
+</workbook>`
+
+	xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>
+</Relationships>`
+
+	xlsxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy-mm-dd"/></numFmts>
+<fonts count="1"><font><sz val="11"/><name val="Calibri"/></font></fonts>
+<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>
+<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>
+<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>
+<cellXfs count="3">
+<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>
+<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+<xf numFmtId="4" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+</cellXfs>
+</styleSheet>`
+
+	xlsxSheetStart = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>
+<sheetData>`
+
+	xlsxSheetEnd = `</sheetData>
+</worksheet>`
+)
+
+// xlsxCell is one cell of a row; an empty value leaves the cell out
+type xlsxCell struct {
+	value  string
+	number bool
+	style  int
+}
+
+// xlsxWriter streams a single-sheet workbook. The fixed parts are written
+// up front and the sheet is the last zip entry, so rows go straight to the
+// output and nothing but the current row is held in memory. Strings are
+// stored inline rather than in a shared string table for the same reason.
+type xlsxWriter struct {
+	zip   *zip.Writer
+	sheet *bufio.Writer
+	row   int
+}
+
+func newXLSXWriter(w io.Writer) (*xlsxWriter, error) {
+	z := zip.NewWriter(w)
+	parts := []struct{ name, body string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", xlsxWorkbook},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+		{"xl/styles.xml", xlsxStyles},
+	}
+	for _, p := range parts {
+		f, err := z.Create(p.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(f, p.body); err != nil {
+			return nil, err
+		}
+	}
+
+	sheet, err := z.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	x := &xlsxWriter{zip: z, sheet: bufio.NewWriter(sheet)}
+	x.sheet.WriteString(xlsxSheetStart)
+
+	header := make([]xlsxCell, len(exportColumns))
+	for i, c := range exportColumns {
+		header[i] = xlsxCell{value: c}
+	}
+	return x, x.writeRow(header)
+}
+
+func (x *xlsxWriter) Write(tx models.Transaction) error {
+	rec := exportRecord(tx)
+	cells := make([]xlsxCell, len(rec))
+	for i, v := range rec {
+		cells[i] = xlsxCell{value: v}
+	}
+
+	// Dates, amounts and IDs are numbers so they sort and add up in a spreadsheet
+	cells[0].number = true
+	cells[1] = xlsxCell{value: excelDate(tx.Date), number: true, style: 1}
+	if tx.ValueDate != nil {
+		cells[2] = xlsxCell{value: excelDate(*tx.ValueDate), number: true, style: 1}
+	}
+	cells[5] = xlsxCell{value: tx.Amount.Format(tx.Currency), number: true, style: 2}
+	cells[7].number = true
+	return x.writeRow(cells)
+}
+
+func (x *xlsxWriter) Close() error {
+	x.sheet.WriteString(xlsxSheetEnd)
+	if err := x.sheet.Flush(); err != nil {
+		return err
+	}
+	return x.zip.Close()
+}
+
+// writeRow appends one <row> to the sheet
+func (x *xlsxWriter) writeRow(cells []xlsxCell) error {
+	x.row++
+	n := strconv.Itoa(x.row)
+	x.sheet.WriteString(`<row r="` + n + `">`)
+	for i, c := range cells {
+		if c.value == "" {
+			continue
+		}
+		x.sheet.WriteString(`<c r="` + xlsxColumn(i) + n + `"`)
+		if c.style != 0 {
+			x.sheet.WriteString(` s="` + strconv.Itoa(c.style) + `"`)
+		}
+		if c.number {
+			x.sheet.WriteString(`><v>` + c.value + `</v></c>`)
+			continue
+		}
+		x.sheet.WriteString(` t="inlineStr"><is><t xml:space="preserve">`)
+		xml.EscapeText(x.sheet, []byte(c.value))
+		x.sheet.WriteString(`</t></is></c>`)
+	}
+	_, err := x.sheet.WriteString(`</row>`)
+	return err
+}
+
+// xlsxColumn converts a 0-based column index to its letters: A, B, ..., Z, AA
+func xlsxColumn(i int) string {
+	var b strings.Builder
+	for i++; i > 0; i = (i - 1) / 26 {
+		b.WriteByte(byte('A' + (i-1)%26))
+	}
+	s := []byte(b.String())
+	for l, r := 0, len(s)-1; l < r; l, r = l+1, r-1 {
+		s[l], s[r] = s[r], s[l]
+	}
+	return string(s)
+}
@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// minioStore connects to the MinIO server named by MINIO_ENDPOINT, e.g.
+//
+//	docker run -p 9000:9000 minio/minio server /data
+//	MINIO_ENDPOINT=http://localhost:9000 MINIO_ACCESS_KEY=minioadmin \
+//	MINIO_SECRET_KEY=minioadmin MINIO_BUCKET=attachments go test ./storage
+//
+// The bucket must exist. The test is skipped when the variables are unset.
+func minioStore(t *testing.T) *S3Store {
+	t.Helper()
+	s := &S3Store{
+		Endpoint:  os.Getenv("MINIO_ENDPOINT"),
+		Region:    getenv("MINIO_REGION", "us-east-1"),
+		Bucket:    os.Getenv("MINIO_BUCKET"),
+		AccessKey: os.Getenv("MINIO_ACCESS_KEY"),
+		SecretKey: os.Getenv("MINIO_SECRET_KEY"),
+		PathStyle: true,
+	}
+	if s.Endpoint == "" || s.Bucket == "" || s.AccessKey == "" || s.SecretKey == "" {
+		t.Skip("set MINIO_ENDPOINT, MINIO_BUCKET, MINIO_ACCESS_KEY and MINIO_SECRET_KEY to run against MinIO")
+	}
+	return s
+}
+
+func TestS3StoreMinIO(t *testing.T) {
+	s := minioStore(t)
+	ctx := context.Background()
+	key := "test/" + strconv.FormatInt(time.Now().UnixNano(), 10) + "/receipt.pdf"
+	body := "%PDF-1.4\n% receipt\n"
+
+	if err := s.Put(ctx, key, strings.NewReader(body), int64(len(body)), "application/pdf"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	t.Cleanup(func() { s.Delete(context.Background(), key) })
+
+	rc, err := s.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	got, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != body {
+		t.Errorf("Get = %q, want %q", got, body)
+	}
+
+	if err := s.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := s.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete: err = %v, want ErrNotFound", err)
+	}
+	if err := s.Delete(ctx, key); err != nil {
+		t.Errorf("Delete of a missing key: %v", err)
+	}
+}
+
+func TestS3StoreMinIOWrongSecret(t *testing.T) {
+	s := minioStore(t)
+	s.SecretKey += "x"
+	body := "x"
+	err := s.Put(context.Background(), "test/rejected", strings.NewReader(body), int64(len(body)), "")
+	if err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("Put with a wrong secret: err = %v, want 403", err)
+	}
+}
@@ -0,0 +1,82 @@
+// Package storage keeps file contents, such as receipts attached to
+// transactions, outside the database
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+// ErrNotFound is returned when no blob is stored under a key
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore keeps blobs under keys chosen by the caller. Keys are slash
+// separated paths of letters, digits, '.', '-' and '_'.
+type BlobStore interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// FromEnv builds the blob store configured through environment variables.
+// BLOB_STORE=s3 stores in an S3-compatible bucket set up by the S3_*
+// variables; otherwise blobs go to the directory ATTACHMENTS_DIR.
+func FromEnv() (BlobStore, error) {
+	switch driver := getenv("BLOB_STORE", "local"); driver {
+	case "local":
+		dir := getenv("ATTACHMENTS_DIR", "data/attachments")
+		log.Printf("storage: attachments in %s", dir)
+		return &FSStore{Root: dir}, nil
+	case "s3":
+		s := &S3Store{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Region:    getenv("S3_REGION", "us-east-1"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+			PathStyle: getenv("S3_PATH_STYLE", "true") == "true",
+		}
+		if s.Endpoint == "" || s.Bucket == "" || s.AccessKey == "" || s.SecretKey == "" {
+			return nil, errors.New("storage: s3 needs S3_ENDPOINT, S3_BUCKET, S3_ACCESS_KEY and S3_SECRET_KEY")
+		}
+		log.Printf("storage: attachments in bucket %s at %s", s.Bucket, s.Endpoint)
+		return s, nil
+	default:
+		return nil, fmt.Errorf("storage: unknown BLOB_STORE %q, want local or s3", driver)
+	}
+}
+
+// validKey reports whether a key only holds the characters keys may use and
+// cannot climb out of its root
+func validKey(key string) bool {
+	if key == "" || key[0] == '/' || key[len(key)-1] == '/' {
+		return false
+	}
+	segment := 0
+	for i := 0; i <= len(key); i++ {
+		if i == len(key) || key[i] == '/' {
+			if s := key[segment:i]; s == "" || s == "." || s == ".." {
+				return false
+			}
+			segment = i + 1
+			continue
+		}
+		c := key[i]
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '.' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// small helper for defaults
+func getenv(k, def string) string {
+	if v := os.Getenv(k); v != "" {
+		return v
+	}
+	return def
+}
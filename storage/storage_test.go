@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{"1/7/3f2a-receipt.pdf", true},
+		{"a", true},
+		{"a/b_c/D-1.jpg", true},
+		{"a/.hidden", true},
+		{"", false},
+		{"/etc/passwd", false},
+		{"a/", false},
+		{"a//b", false},
+		{".", false},
+		{"..", false},
+		{"../a", false},
+		{"a/../../b", false},
+		{"a/./b", false},
+		{"a\\..\\b", false},
+		{"a b", false},
+		{"a%2e%2e/b", false},
+		{"a/\x00b", false},
+		{"ä", false},
+	}
+	for _, tt := range tests {
+		if got := validKey(tt.key); got != tt.want {
+			t.Errorf("validKey(%q) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestFSStore(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "blobs")
+	s := &FSStore{Root: root}
+	ctx := context.Background()
+
+	if err := s.Put(ctx, "1/7/receipt.pdf", strings.NewReader("%PDF"), 4, "application/pdf"); err != nil {
+		t.Fatal(err)
+	}
+	rc, err := s.Get(ctx, "1/7/receipt.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(got) != "%PDF" {
+		t.Errorf("Get = %q, want %%PDF", got)
+	}
+
+	// No temporary upload files are left behind
+	entries, err := os.ReadDir(filepath.Join(root, "1", "7"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("directory holds %d files, want 1", len(entries))
+	}
+
+	if err := s.Delete(ctx, "1/7/receipt.pdf"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(ctx, "1/7/receipt.pdf"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete: err = %v, want ErrNotFound", err)
+	}
+	if err := s.Delete(ctx, "1/7/receipt.pdf"); err != nil {
+		t.Errorf("Delete of a missing key: %v", err)
+	}
+}
+
+func TestFSStoreStaysBelowRoot(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "blobs")
+	outside := filepath.Join(dir, "secret")
+	if err := os.WriteFile(outside, []byte("secret"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	s := &FSStore{Root: root}
+	ctx := context.Background()
+
+	for _, key := range []string{"../secret", "a/../../secret", "/" + outside, "..", ""} {
+		if err := s.Put(ctx, key, strings.NewReader("x"), 1, ""); err == nil {
+			t.Errorf("Put(%q) succeeded", key)
+		}
+		if rc, err := s.Get(ctx, key); err == nil {
+			rc.Close()
+			t.Errorf("Get(%q) succeeded", key)
+		}
+		if err := s.Delete(ctx, key); err == nil {
+			t.Errorf("Delete(%q) succeeded", key)
+		}
+	}
+	if b, err := os.ReadFile(outside); err != nil || string(b) != "secret" {
+		t.Errorf("file outside the root = %q, %v, want it untouched", b, err)
+	}
+}
+
+func TestS3StoreRejectsInvalidKeys(t *testing.T) {
+	s := &S3Store{Endpoint: "http://127.0.0.1:1", Bucket: "b", PathStyle: true}
+	if _, err := s.request(context.Background(), "GET", "../other-bucket/key", nil); err == nil {
+		t.Error("request for a key outside the bucket succeeded")
+	}
+	req, err := s.request(context.Background(), "GET", "1/7/receipt.pdf", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.URL.Path != "/b/1/7/receipt.pdf" {
+		t.Errorf("path = %s, want /b/1/7/receipt.pdf", req.URL.Path)
+	}
+
+	s.PathStyle = false
+	s.Endpoint = "https://s3.eu-central-1.amazonaws.com"
+	if req, err = s.request(context.Background(), "GET", "1/7/receipt.pdf", nil); err != nil {
+		t.Fatal(err)
+	}
+	if req.URL.Host != "b.s3.eu-central-1.amazonaws.com" || req.URL.Path != "/1/7/receipt.pdf" {
+		t.Errorf("url = %s, want https://b.s3.eu-central-1.amazonaws.com/1/7/receipt.pdf", req.URL)
+	}
+}